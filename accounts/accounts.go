@@ -0,0 +1,541 @@
+// Package accounts serves several WhatsApp numbers from one process. Each
+// account has its own paired device in the shared session store, its own
+// message database and media directory, and its own outbox, scheduler,
+// broadcast, webhook and event stream workers.
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/broadcast"
+	"whatsapp-go-mcp/config"
+	"whatsapp-go-mcp/drafts"
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/scheduler"
+	"whatsapp-go-mcp/stream"
+	"whatsapp-go-mcp/webhooks"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// DefaultAccount is the account used when a request does not name one. It
+// keeps the file locations of a single-account server.
+const DefaultAccount = "default"
+
+// Errors returned by the manager
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrAccountExists   = errors.New("account already exists")
+	ErrInvalidAccount  = errors.New("invalid account name, use up to 32 lowercase letters, digits, - or _")
+	ErrDefaultAccount  = errors.New("the default account cannot be removed")
+)
+
+// namePattern is the format of account names, which are used in file names
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Options configures the manager
+type Options struct {
+	DBPath       string         // session store shared by all accounts; the default account's messages are next to it
+	MediaDir     string         // media directory of the default account; other accounts get a sibling directory
+	QRCodeDir    string         // pairing QR codes of other accounts go into subdirectories
+	Config       *config.Config // voice services and LlamaStack bot of every client; nil uses the defaults
+	EventLogSize int
+	ApprovalMode string // drafts.ModeOff, ModeAPI or ModeAll
+	AdminChat    string // chat in which approvers review drafts, if any
+	// Configure applies settings such as encryption and business hours to
+	// the client of every account
+	Configure func(*whatsapp.Client) error
+}
+
+// Account is a WhatsApp number served by the process, with its workers
+type Account struct {
+	Name       string
+	Client     *whatsapp.Client
+	Scheduler  *scheduler.Scheduler
+	Broadcasts *broadcast.Manager
+	Drafts     *drafts.Manager
+	Webhooks   *webhooks.Dispatcher
+	Events     *stream.Hub
+	MediaDir   string
+	record     *models.Account
+	stop       context.CancelFunc
+}
+
+// Info describes an account
+type Info struct {
+	*models.Account
+	Default    bool                     `json:"default"`
+	Paired     bool                     `json:"paired"`
+	PairingURL string                   `json:"pairing_url,omitempty"`
+	Connection whatsapp.ConnectionState `json:"connection"`
+}
+
+// Manager loads, starts and stops the accounts
+type Manager struct {
+	opts      Options
+	container *sqlstore.Container
+	store     *models.AccountStore
+	auditDB   *models.Database // kept apart from the message databases, out of backups
+	audit     *audit.Log
+
+	mu        sync.RWMutex
+	accounts  map[string]*Account
+	ctx       context.Context // set by Start; accounts added later start right away
+	restoring bool            // a backup is being restored; accounts cannot be added or removed
+}
+
+// NewManager opens the session store and loads every registered account. A
+// device paired before accounts existed is given to the default account.
+// Accounts are not connected until Start is called.
+func NewManager(opts Options) (*Manager, error) {
+	container, db, err := whatsapp.OpenDeviceStore(opts.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	accountStore, err := models.NewAccountStore(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account registry: %w", err)
+	}
+	m := &Manager{opts: opts, container: container, store: accountStore, accounts: make(map[string]*Account)}
+
+	records, err := accountStore.GetAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load accounts: %w", err)
+	}
+	if !hasDefault(records) {
+		record := &models.Account{Name: DefaultAccount}
+		if err := accountStore.CreateAccount(record); err != nil {
+			return nil, fmt.Errorf("failed to register the default account: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	devices, err := container.GetAllDevices(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	assigned := assignDevices(records, devices)
+	for _, device := range devices {
+		if !isAssigned(assigned, device) {
+			log.Printf("⚠️ Paired device %s does not belong to any account and is not used", device.ID)
+		}
+	}
+
+	for _, record := range records {
+		device := assigned[record.Name]
+		if device == nil {
+			device = container.NewDevice()
+		}
+		account, err := m.open(record, device)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("failed to open account %s: %w", record.Name, err)
+		}
+		m.accounts[record.Name] = account
+	}
+
+	// Every account records into one audit log
+	auditDB, err := models.NewAuditDatabase(AuditDBPath(opts.DBPath))
+	if err != nil {
+		m.Close()
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	m.auditDB = auditDB
+	if moved, err := auditDB.MoveAuditLog(m.accounts[DefaultAccount].Client.Database()); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("failed to move the audit log out of the message database: %w", err)
+	} else if moved > 0 {
+		log.Printf("📜 Moved %d audit log entries to %s", moved, AuditDBPath(opts.DBPath))
+	}
+	m.audit = audit.New(auditDB)
+	for name, account := range m.accounts {
+		account.Client.SetAuditLog(m.audit.ForAccount(name))
+	}
+	return m, nil
+}
+
+// AuditDBPath returns the path of the audit log next to the session store.
+// It is not part of backups.
+func AuditDBPath(dbPath string) string {
+	return dbPath + "_audit.db"
+}
+
+// assignDevices matches the stored devices to the accounts by JID. The
+// default account takes the first unmatched device if it has none.
+func assignDevices(records []*models.Account, devices []*store.Device) map[string]*store.Device {
+	byJID := make(map[string]*store.Device)
+	for _, device := range devices {
+		byJID[device.ID.ToNonAD().String()] = device
+	}
+
+	assigned := make(map[string]*store.Device)
+	for _, record := range records {
+		if device, ok := byJID[record.JID]; ok && record.JID != "" {
+			assigned[record.Name] = device
+			delete(byJID, record.JID)
+		}
+	}
+	if assigned[DefaultAccount] == nil {
+		for _, device := range devices {
+			if _, ok := byJID[device.ID.ToNonAD().String()]; ok {
+				assigned[DefaultAccount] = device
+				break
+			}
+		}
+	}
+	return assigned
+}
+
+func hasDefault(records []*models.Account) bool {
+	for _, record := range records {
+		if record.Name == DefaultAccount {
+			return true
+		}
+	}
+	return false
+}
+
+func isAssigned(assigned map[string]*store.Device, device *store.Device) bool {
+	for _, d := range assigned {
+		if d == device {
+			return true
+		}
+	}
+	return false
+}
+
+// paths returns the message database, media directory and QR code directory
+// of an account
+func (m *Manager) paths(name string) (messagesDB, mediaDir, qrDir string) {
+	if name == DefaultAccount {
+		return m.opts.DBPath + "_messages.db", m.opts.MediaDir, m.opts.QRCodeDir
+	}
+	messagesDB, mediaDir = accountFiles(m.opts.DBPath, m.opts.MediaDir, name)
+	if m.opts.QRCodeDir != "" {
+		qrDir = filepath.Join(m.opts.QRCodeDir, name)
+	}
+	return messagesDB, mediaDir, qrDir
+}
+
+// open creates the client and workers of an account without starting them
+func (m *Manager) open(record *models.Account, device *store.Device) (*Account, error) {
+	messagesDB, mediaDir, qrDir := m.paths(record.Name)
+	client, err := whatsapp.NewAccountClient(device, m.opts.DBPath, messagesDB, mediaDir, m.opts.Config)
+	if err != nil {
+		return nil, err
+	}
+	if m.opts.Configure != nil {
+		if err := m.opts.Configure(client); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if err := client.SetQRCodeDir(qrDir); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+
+	// Deliver events to webhook subscribers, subscribing before the
+	// connection so connection events are included
+	dispatcher, err := webhooks.NewDispatcher(client.Database())
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create webhook dispatcher: %w", err)
+	}
+	client.Subscribe(dispatcher.Handle)
+
+	// Record events for live streaming to /api/events and /api/ws clients
+	hub := stream.NewHub(client.Database(), m.opts.EventLogSize)
+	client.Subscribe(hub.Publish)
+
+	client.Subscribe(m.trackPairing(record.Name, client))
+	if m.audit != nil {
+		client.SetAuditLog(m.audit.ForAccount(record.Name))
+	}
+
+	// Park messages for approval
+	approvals := drafts.New(client.Database(), client, m.opts.ApprovalMode, filepath.Join(mediaDir, "drafts"))
+	if approvals.HoldsBotReplies() {
+		client.SetReplyDrafter(func(chatJID, text string) error {
+			return approvals.Create(&models.Draft{Recipient: chatJID, Text: text, Source: models.DraftFromBot})
+		})
+	}
+	if m.opts.AdminChat != "" && approvals.Mode() != drafts.ModeOff {
+		adminChat, err := types.ParseJID(m.opts.AdminChat)
+		if err != nil || adminChat.User == "" {
+			client.Close()
+			return nil, fmt.Errorf("invalid approval admin chat %q, use a JID", m.opts.AdminChat)
+		}
+		client.SetAdminChat(adminChat, approvals.HandleCommand)
+	}
+
+	return &Account{
+		Name:       record.Name,
+		Client:     client,
+		Scheduler:  scheduler.New(client.Database(), client, filepath.Join(mediaDir, "scheduled")),
+		Broadcasts: broadcast.New(client.Database(), client, filepath.Join(mediaDir, "broadcasts")),
+		Drafts:     approvals,
+		Webhooks:   dispatcher,
+		Events:     hub,
+		MediaDir:   mediaDir,
+		record:     record,
+	}, nil
+}
+
+// trackPairing records the JID of an account when it is paired, so the device
+// is found again after a restart
+func (m *Manager) trackPairing(name string, client *whatsapp.Client) func(whatsapp.Event) {
+	return func(evt whatsapp.Event) {
+		if evt.Type != whatsapp.EventConnection {
+			return
+		}
+		var jid string
+		switch evt.Data.(*whatsapp.ConnectionEvent).State {
+		case whatsapp.StateConnected:
+			jid = client.JID()
+		case whatsapp.StateLoggedOut:
+			// forget the JID, the device has been removed
+		default:
+			return
+		}
+		if err := m.store.SetAccountJID(name, jid); err != nil {
+			log.Printf("❌ Failed to record the JID of account %s: %v", name, err)
+		}
+	}
+}
+
+// Start runs the workers of every account and connects them, or starts
+// pairing for those without a session. Accounts stop when ctx is cancelled.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	accounts := make([]*Account, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	m.mu.Unlock()
+
+	for _, account := range accounts {
+		account.start(ctx)
+	}
+}
+
+// start runs the workers of the account and connects it
+func (a *Account) start(ctx context.Context) {
+	ctx, a.stop = context.WithCancel(ctx)
+	go a.Webhooks.Run(ctx)
+	go a.Client.RunOutbox(ctx)
+	go a.Scheduler.Run(ctx)
+	go a.Broadcasts.Run(ctx)
+	go a.Client.Supervise(ctx)
+
+	// With a stored session, a failed first attempt is retried by the supervisor
+	if err := a.Client.Connect(context.Background()); err != nil {
+		if a.Client.HasSession() {
+			log.Printf("⚠️ Failed to connect account %s, retrying in the background: %v", a.Name, err)
+		} else {
+			log.Printf("⚠️ Failed to start pairing account %s, request a QR code to retry: %v", a.Name, err)
+		}
+	}
+}
+
+// AuditLog returns the audit log shared by all accounts
+func (m *Manager) AuditLog() *audit.Log {
+	return m.audit
+}
+
+// Get returns an account by name; an empty name means the default account
+func (m *Manager) Get(name string) (*Account, error) {
+	if name == "" {
+		name = DefaultAccount
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	account, ok := m.accounts[name]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// Default returns the default account
+func (m *Manager) Default() *Account {
+	account, _ := m.Get(DefaultAccount)
+	return account
+}
+
+// All returns every account, the default account first
+func (m *Manager) All() []*Account {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	all := make([]*Account, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		all = append(all, account)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if (all[i].Name == DefaultAccount) != (all[j].Name == DefaultAccount) {
+			return all[i].Name == DefaultAccount
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// List describes every account, the default account first
+func (m *Manager) List() []*Info {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	infos := make([]*Info, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		infos = append(infos, account.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Default != infos[j].Default {
+			return infos[i].Default
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Info describes the account
+func (a *Account) Info() *Info {
+	record := *a.record
+	record.JID = a.Client.JID()
+	info := &Info{
+		Account:    &record,
+		Default:    a.Name == DefaultAccount,
+		Paired:     a.Client.HasSession(),
+		Connection: a.Client.ConnectionState(),
+	}
+	if !info.Paired {
+		info.PairingURL = "/api/pairing/qr?account=" + a.Name
+	}
+	return info
+}
+
+// Add registers a new account and starts pairing it. The QR code and pairing
+// code are requested from the pairing endpoints with the account parameter.
+func (m *Manager) Add(name, createdBy string) (*Account, error) {
+	if !namePattern.MatchString(name) {
+		return nil, ErrInvalidAccount
+	}
+
+	m.mu.Lock()
+	if m.restoring {
+		m.mu.Unlock()
+		return nil, whatsapp.ErrRestoreInProgress
+	}
+	if _, ok := m.accounts[name]; ok {
+		m.mu.Unlock()
+		return nil, ErrAccountExists
+	}
+	record := &models.Account{Name: name, CreatedBy: createdBy}
+	if err := m.store.CreateAccount(record); err != nil {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("failed to register account: %w", err)
+	}
+	account, err := m.open(record, m.container.NewDevice())
+	if err != nil {
+		m.store.DeleteAccount(name)
+		m.mu.Unlock()
+		return nil, err
+	}
+	m.accounts[name] = account
+	ctx := m.ctx
+	m.mu.Unlock()
+
+	// Connecting to start pairing takes a moment, so it happens outside the lock
+	if ctx != nil {
+		account.start(ctx)
+	}
+	log.Printf("📱 Added account %s", name)
+	return account, nil
+}
+
+// Remove unlinks an account from WhatsApp, stops its workers and removes it
+// from the registry. Its message database and media directory are left on
+// disk.
+func (m *Manager) Remove(ctx context.Context, name string) error {
+	if name == DefaultAccount {
+		return ErrDefaultAccount
+	}
+
+	m.mu.Lock()
+	if m.restoring {
+		m.mu.Unlock()
+		return whatsapp.ErrRestoreInProgress
+	}
+	account, ok := m.accounts[name]
+	delete(m.accounts, name)
+	m.mu.Unlock()
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	if err := account.Client.Unlink(ctx); err != nil {
+		log.Printf("⚠️ Failed to unlink account %s, remove it from Linked Devices on the phone: %v", name, err)
+	}
+	account.close()
+	if err := m.store.DeleteAccount(name); err != nil {
+		return fmt.Errorf("failed to remove account: %w", err)
+	}
+	log.Printf("🗑️ Removed account %s", name)
+	return nil
+}
+
+// Close stops and disconnects every account and closes the session store and
+// the audit log
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, account := range m.accounts {
+		account.close()
+	}
+	m.container.Close()
+	if m.auditDB != nil {
+		m.auditDB.Close()
+	}
+}
+
+// close stops the workers of an account and disconnects it
+func (a *Account) close() {
+	if a.stop != nil {
+		a.stop()
+	}
+	a.Client.Disconnect()
+	a.Client.Close()
+}
+
+type contextKey struct{}
+
+// Middleware routes each request to the account named by its account query
+// parameter, or to the default account
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("account")
+		account, err := m.Get(name)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unknown account %q", name), http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, account)))
+	})
+}
+
+// FromRequest returns the account a request was routed to by the middleware
+func FromRequest(r *http.Request) *Account {
+	account, _ := r.Context().Value(contextKey{}).(*Account)
+	return account
+}
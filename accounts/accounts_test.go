@@ -0,0 +1,164 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"whatsapp-go-mcp/models"
+)
+
+func newTestManager(t *testing.T, dir string) *Manager {
+	t.Helper()
+	m, err := NewManager(Options{
+		DBPath:   filepath.Join(dir, "whatsapp.db"),
+		MediaDir: filepath.Join(dir, "media"),
+	})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+func names(m *Manager) []string {
+	var names []string
+	for _, info := range m.List() {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func TestManagerAddAndRemoveAccounts(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir)
+
+	if got := names(m); len(got) != 1 || got[0] != DefaultAccount {
+		t.Fatalf("new manager has accounts %v, want only the default", got)
+	}
+	if _, err := m.Add("support", "test"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := m.Add("sales", "test"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := m.Add("sales", "test"); err != ErrAccountExists {
+		t.Errorf("adding sales twice = %v, want ErrAccountExists", err)
+	}
+	for _, name := range []string{"", "Sales", "../sales", "sales team"} {
+		if _, err := m.Add(name, "test"); err != ErrInvalidAccount {
+			t.Errorf("Add(%q) = %v, want ErrInvalidAccount", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "media_sales")); err != nil {
+		t.Errorf("sales media directory not created: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "whatsapp.db_sales_messages.db")); err != nil {
+		t.Errorf("sales message database not created: %v", err)
+	}
+
+	sales, _ := m.Get("sales")
+	if info := sales.Info(); info.Paired || info.PairingURL != "/api/pairing/qr?account=sales" || info.CreatedBy != "test" {
+		t.Errorf("unexpected info for an unpaired account: %+v", info)
+	}
+
+	// Accounts survive a restart
+	m.Close()
+	m = newTestManager(t, dir)
+	defer m.Close()
+	if got := names(m); len(got) != 3 || got[0] != DefaultAccount || got[1] != "sales" || got[2] != "support" {
+		t.Fatalf("accounts after restart = %v", got)
+	}
+
+	if err := m.Remove(context.Background(), DefaultAccount); err != ErrDefaultAccount {
+		t.Errorf("removing the default account = %v, want ErrDefaultAccount", err)
+	}
+	if err := m.Remove(context.Background(), "sales"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := m.Remove(context.Background(), "sales"); err != ErrAccountNotFound {
+		t.Errorf("removing sales twice = %v, want ErrAccountNotFound", err)
+	}
+	if _, err := m.Get("sales"); err != ErrAccountNotFound {
+		t.Errorf("Get of a removed account = %v", err)
+	}
+}
+
+func TestMiddlewareRoutesByAccount(t *testing.T) {
+	m := newTestManager(t, t.TempDir())
+	defer m.Close()
+	if _, err := m.Add("sales", "test"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(FromRequest(r).Name))
+	}))
+
+	for url, want := range map[string]string{
+		"/api/outbox/1":               DefaultAccount,
+		"/api/outbox/1?account=sales": "sales",
+		"/api/outbox/1?account=":      DefaultAccount,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("%s routed to %d %q, want %q", url, rec.Code, rec.Body.String(), want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/outbox/1?account=billing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown account answered %d, want 404", rec.Code)
+	}
+}
+
+func TestBackupAndRestoreCoverEveryAccount(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir)
+	defer m.Close()
+	sales, err := m.Add("sales", "test")
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	msg := &models.Message{Time: time.Now(), Sender: "353851234567@s.whatsapp.net", Content: "quote", ChatJID: "353851234567@s.whatsapp.net", MessageID: "s1"}
+	if err := sales.Client.Database().StoreMessage(msg); err != nil {
+		t.Fatalf("StoreMessage: %v", err)
+	}
+
+	// The offline commands find the named accounts in the registry
+	src, err := BackupSources(filepath.Join(dir, "whatsapp.db"), filepath.Join(dir, "media"))
+	if err != nil || len(src.Accounts) != 1 || src.Accounts[0] != "sales" {
+		t.Fatalf("BackupSources = %+v, %v; want the sales account", src.Accounts, err)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := m.Backup(&archive)
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if len(manifest.Accounts) != 1 || manifest.Accounts[0] != "sales" {
+		t.Fatalf("backed up accounts %v, want sales", manifest.Accounts)
+	}
+
+	if err := sales.Client.Database().StoreMessage(&models.Message{Time: time.Now(), Sender: msg.Sender, Content: "later", ChatJID: msg.ChatJID, MessageID: "s2"}); err != nil {
+		t.Fatalf("StoreMessage: %v", err)
+	}
+	m.AuditLog().Record(&models.AuditEntry{ActorType: models.ActorSystem, Action: "message.sent", Status: models.AuditOK})
+	if _, restart, err := m.Restore(&archive); err != nil || restart {
+		t.Fatalf("Restore = restart %v, %v; want a restore without restart", restart, err)
+	}
+	if entries, err := m.auditDB.GetAuditEntries(models.AuditFilter{}); err != nil || len(entries) != 1 {
+		t.Errorf("audit log has %d entries after the restore, %v; want the one recorded after the backup", len(entries), err)
+	}
+	if messages, _ := sales.Client.Database().GetMessagesByContact(msg.Sender); len(messages) != 1 {
+		t.Errorf("sales has %d messages after the restore, want the backed up one", len(messages))
+	}
+	if _, err := m.Add("support", "test"); err != nil {
+		t.Errorf("Add after the restore: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"whatsapp-go-mcp/backup"
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// accountFiles returns the message database and media directory of an
+// account other than the default one
+func accountFiles(dbPath, mediaDir, name string) (messagesDB, accountMediaDir string) {
+	return dbPath + "_" + name + "_messages.db", mediaDir + "_" + name
+}
+
+// backupSources returns the state files of the default account and of the
+// named accounts
+func backupSources(dbPath, mediaDir string, names []string) backup.Sources {
+	src := backup.Sources{
+		SessionDBPath:  dbPath,
+		MessagesDBPath: dbPath + "_messages.db",
+		MediaDir:       mediaDir,
+		AccountFiles: func(name string) (string, string, error) {
+			if !namePattern.MatchString(name) || name == DefaultAccount {
+				return "", "", fmt.Errorf("%w: %q", ErrInvalidAccount, name)
+			}
+			messagesDB, accountMediaDir := accountFiles(dbPath, mediaDir, name)
+			return messagesDB, accountMediaDir, nil
+		},
+	}
+	for _, name := range names {
+		if name != DefaultAccount {
+			src.Accounts = append(src.Accounts, name)
+		}
+	}
+	return src
+}
+
+// BackupSources returns the state files of every account registered in the
+// session store at dbPath, for the offline backup and restore commands. A
+// running server uses Manager.Backup and Manager.Restore.
+func BackupSources(dbPath, mediaDir string) (backup.Sources, error) {
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return backupSources(dbPath, mediaDir, nil), nil
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath)
+	if err != nil {
+		return backup.Sources{}, fmt.Errorf("failed to open session store: %w", err)
+	}
+	defer db.Close()
+	store, err := models.NewAccountStore(db)
+	if err != nil {
+		return backup.Sources{}, fmt.Errorf("failed to open account registry: %w", err)
+	}
+	records, err := store.GetAccounts()
+	if err != nil {
+		return backup.Sources{}, fmt.Errorf("failed to load accounts: %w", err)
+	}
+	var names []string
+	for _, record := range records {
+		names = append(names, record.Name)
+	}
+	return backupSources(dbPath, mediaDir, names), nil
+}
+
+// Backup writes a consistent snapshot of the session store and of the
+// message database and media directory of every account to w
+func (m *Manager) Backup(w io.Writer) (*backup.Manifest, error) {
+	m.mu.RLock()
+	names := make([]string, 0, len(m.accounts))
+	for name := range m.accounts {
+		names = append(names, name)
+	}
+	m.mu.RUnlock()
+	return backup.Create(w, backupSources(m.opts.DBPath, m.opts.MediaDir, names))
+}
+
+// Restore replaces the state of every account with a snapshot produced by
+// Backup. The session store is shared by the accounts, so it refuses unless
+// every account is disconnected, holds off their reconnections while
+// restoring, and then reloads the device of every account from the restored
+// store. It reports whether the server has to be restarted because the
+// archive registers other accounts than those being served.
+func (m *Manager) Restore(r io.Reader) (manifest *backup.Manifest, restart bool, err error) {
+	m.mu.Lock()
+	if m.restoring {
+		m.mu.Unlock()
+		return nil, false, whatsapp.ErrRestoreInProgress
+	}
+	var held []*Account
+	for _, account := range m.accounts {
+		if err := account.Client.BeginRestore(); err != nil {
+			for _, a := range held {
+				a.Client.EndRestore()
+			}
+			m.mu.Unlock()
+			return nil, false, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+		held = append(held, account)
+	}
+	m.restoring = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.restoring = false
+		m.mu.Unlock()
+		for _, account := range held {
+			account.Client.EndRestore()
+		}
+	}()
+
+	names := make([]string, 0, len(held))
+	for _, account := range held {
+		names = append(names, account.Name)
+	}
+	if manifest, err = backup.Restore(r, backupSources(m.opts.DBPath, m.opts.MediaDir, names)); err != nil {
+		return nil, false, err
+	}
+	if restart, err = m.reloadDevices(held); err != nil {
+		return manifest, true, fmt.Errorf("backup restored, but the accounts could not be reloaded; restart the server: %w", err)
+	}
+	return manifest, restart, nil
+}
+
+// reloadDevices gives every account its device from the restored session
+// store. It reports whether the restored registry lists other accounts than
+// those given.
+func (m *Manager) reloadDevices(held []*Account) (restart bool, err error) {
+	records, err := m.store.GetAccounts()
+	if err != nil {
+		return false, fmt.Errorf("failed to load accounts: %w", err)
+	}
+	devices, err := m.container.GetAllDevices(context.Background())
+	if err != nil {
+		return false, fmt.Errorf("failed to load devices: %w", err)
+	}
+	assigned := assignDevices(records, devices)
+
+	registered := make(map[string]bool)
+	for _, record := range records {
+		registered[record.Name] = true
+	}
+	restart = len(records) != len(held)
+	for _, account := range held {
+		if !registered[account.Name] {
+			// Its old device is gone from the store too; it must not reconnect with it
+			log.Printf("⚠️ Account %s is not in the restored backup; restart the server", account.Name)
+			restart = true
+		}
+		device := assigned[account.Name]
+		if device == nil {
+			device = m.container.NewDevice()
+		}
+		account.Client.LoadRestoredDevice(device)
+	}
+	return restart, nil
+}
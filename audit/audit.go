@@ -0,0 +1,175 @@
+// Package audit keeps an append-only record of who did what: every API
+// request with the API key that made it, every message queued, blocked or
+// sent with its send policy decision, every bot reply with the LLM model and
+// tool calls behind it, and every draft review. Entries never contain
+// message text. The log lives in a database of its own next to the session
+// store, where triggers refuse updates and deletes, and is left out of backups
+// so that a restore cannot roll it back.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"whatsapp-go-mcp/models"
+)
+
+// Recorder appends an entry to the audit log. Failures are logged rather than
+// returned, so auditing never stops the action being audited.
+type Recorder func(entry *models.AuditEntry)
+
+// Log is the audit log
+type Log struct {
+	db *models.Database
+}
+
+// New creates an audit log backed by a message database
+func New(db *models.Database) *Log {
+	return &Log{db: db}
+}
+
+// Record appends an entry to the log
+func (l *Log) Record(entry *models.AuditEntry) {
+	if entry.Status == "" {
+		entry.Status = models.AuditOK
+	}
+	if err := l.db.RecordAudit(entry); err != nil {
+		log.Printf("❌ Failed to record audit entry %s: %v", entry.Action, err)
+	}
+}
+
+// ForAccount returns a recorder that attributes entries to an account
+func (l *Log) ForAccount(account string) Recorder {
+	return func(entry *models.AuditEntry) {
+		if entry.Account == "" {
+			entry.Account = account
+		}
+		l.Record(entry)
+	}
+}
+
+// Query returns entries matching filter, newest first
+func (l *Log) Query(filter models.AuditFilter) ([]*models.AuditEntry, error) {
+	return l.db.GetAuditEntries(filter)
+}
+
+// Export writes entries matching filter as JSON Lines, oldest first
+func (l *Log) Export(w io.Writer, filter models.AuditFilter) error {
+	encoder := json.NewEncoder(w)
+	return l.db.EachAuditEntry(filter, func(entry *models.AuditEntry) error {
+		return encoder.Encode(entry)
+	})
+}
+
+// contextKey is the request context key of the entry being recorded
+type contextKey struct{}
+
+// maxErrorLength caps the response body kept as the error of a failed request
+const maxErrorLength = 200
+
+// Middleware records an entry for every API request, except those skip
+// reports true for. It must be the outermost middleware, so that requests
+// refused by authentication are recorded too; handlers and inner middleware
+// add to the entry with FromRequest.
+func (l *Log) Middleware(skip func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip != nil && skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			entry := &models.AuditEntry{
+				ActorType:  models.ActorAnonymous,
+				RemoteAddr: remoteAddr(r),
+				Action:     "api.request",
+				Tool:       r.Method + " " + r.URL.Path,
+			}
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), contextKey{}, entry)))
+
+			entry.HTTPStatus = recorder.status
+			switch {
+			case recorder.status == http.StatusUnauthorized || recorder.status == http.StatusForbidden:
+				entry.Status = models.AuditDenied
+			case recorder.status >= 400:
+				entry.Status = models.AuditError
+			}
+			if entry.Status != "" && entry.Error == "" {
+				entry.Error = strings.TrimSpace(recorder.body.String())
+			}
+			l.Record(entry)
+		})
+	}
+}
+
+// FromRequest returns the entry being recorded for a request, so that
+// handlers can add the recipient and message they acted on. Requests that are
+// not audited get a throwaway entry.
+func FromRequest(r *http.Request) *models.AuditEntry {
+	if entry, ok := r.Context().Value(contextKey{}).(*models.AuditEntry); ok {
+		return entry
+	}
+	return &models.AuditEntry{}
+}
+
+// remoteAddr returns the client address of a request
+func remoteAddr(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return r.RemoteAddr
+}
+
+// statusRecorder captures the status code of a response and the start of
+// its body if it is an error
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        strings.Builder
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = status, true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	if s.status >= 400 && s.body.Len() < maxErrorLength {
+		rest := maxErrorLength - s.body.Len()
+		if len(b) < rest {
+			rest = len(b)
+		}
+		s.body.Write(b[:rest])
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush lets server-sent event streams through
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	s.wroteHeader = true
+	s.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(s.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+)
+
+func TestMiddlewareRecordsRequests(t *testing.T) {
+	db, err := models.NewAuditDatabase(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatalf("NewAuditDatabase: %v", err)
+	}
+	defer db.Close()
+	l := New(db)
+
+	handler := l.Middleware(func(r *http.Request) bool {
+		return r.URL.Path == "/health"
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") == "" {
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+		entry := FromRequest(r)
+		entry.ActorType, entry.Actor = models.ActorAPIKey, "crm"
+		entry.Recipient = "353851111111@s.whatsapp.net"
+	}))
+
+	request := func(path, key string) {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	request("/health", "")
+	request("/api/send-message", "")
+	request("/api/send-message", "secret")
+
+	entries, err := l.Query(models.AuditFilter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2 (public routes are not audited)", len(entries))
+	}
+	sent, refused := entries[0], entries[1]
+	if sent.Actor != "crm" || sent.Status != models.AuditOK || sent.Recipient == "" || sent.Tool != "POST /api/send-message" {
+		t.Errorf("authenticated request recorded as %+v", sent)
+	}
+	if refused.ActorType != models.ActorAnonymous || refused.Status != models.AuditDenied ||
+		refused.HTTPStatus != http.StatusUnauthorized || refused.Error != "API key required" {
+		t.Errorf("refused request recorded as %+v", refused)
+	}
+
+	var export bytes.Buffer
+	if err := l.Export(&export, models.AuditFilter{Status: models.AuditDenied}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(export.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"status":"denied"`) {
+		t.Errorf("export = %q, want the refused request only", export.String())
+	}
+}
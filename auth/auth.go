@@ -0,0 +1,295 @@
+// Package auth authenticates API requests with API keys. Keys carry scopes
+// deciding which routes they may call, and optionally the recipients they may
+// send to. Only a SHA-256 hash of each key is stored; keys are random enough
+// that a slow hash would add nothing.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/models"
+)
+
+// Scopes granted to API keys
+const (
+	ScopeReadMessages = "read:messages" // read messages, contacts, chats and events
+	ScopeSendText     = "send:text"     // send, schedule and broadcast text messages
+	ScopeSendMedia    = "send:media"    // send voice notes and files
+	ScopeMCP          = "mcp"           // reserved for an MCP endpoint; the server does not serve one
+	ScopeAdmin        = "admin"         // everything, including pairing, accounts, rules, webhooks and keys
+)
+
+// Scopes lists every scope
+var Scopes = []string{ScopeReadMessages, ScopeSendText, ScopeSendMedia, ScopeMCP, ScopeAdmin}
+
+// Errors returned by the key store
+var (
+	ErrInvalidKeyRequest = errors.New("invalid API key request")
+	ErrUnauthorized      = errors.New("missing, unknown, expired or revoked API key")
+)
+
+const (
+	// keyPrefix starts every key so that leaked keys are easy to recognise
+	keyPrefix = "wak_"
+	// keyBytes is the amount of randomness in a key
+	keyBytes = 32
+	// displayPrefixLength is the number of characters of a key kept for display
+	displayPrefixLength = 12
+)
+
+// CreateRequest describes a new API key
+type CreateRequest struct {
+	Name              string   `json:"name" example:"crm"`
+	Scopes            []string `json:"scopes" example:"read:messages,send:text"`
+	AllowedRecipients []string `json:"allowed_recipients,omitempty" example:"+353851234567"` // JIDs or phone numbers; empty allows any
+	ExpiresInDays     int      `json:"expires_in_days,omitempty" example:"90"`               // 0 never expires
+	CreatedBy         string   `json:"-"`
+}
+
+// Store creates and checks API keys
+type Store struct {
+	db *models.Database
+}
+
+// NewStore creates a key store on the given database
+func NewStore(db *models.Database) *Store {
+	return &Store{db: db}
+}
+
+// Create generates a key and stores its hash. The key itself is returned
+// only here and cannot be recovered later.
+func (s *Store) Create(req *CreateRequest) (*models.APIKey, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidKeyRequest)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required (%s)", ErrInvalidKeyRequest, strings.Join(Scopes, ", "))
+	}
+	for _, scope := range req.Scopes {
+		if !isScope(scope) {
+			return nil, "", fmt.Errorf("%w: unknown scope %q (use %s)", ErrInvalidKeyRequest, scope, strings.Join(Scopes, ", "))
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		return nil, "", fmt.Errorf("%w: expires_in_days must not be negative", ErrInvalidKeyRequest)
+	}
+
+	var recipients []string
+	for _, recipient := range req.AllowedRecipients {
+		jid, err := NormalizeRecipient(recipient)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidKeyRequest, err)
+		}
+		recipients = append(recipients, jid)
+	}
+
+	random := make([]byte, keyBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	k := &models.APIKey{
+		Name:              name,
+		Prefix:            key[:displayPrefixLength],
+		Hash:              hashKey(key),
+		Scopes:            req.Scopes,
+		AllowedRecipients: recipients,
+		CreatedBy:         req.CreatedBy,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		k.ExpiresAt = &expiresAt
+	}
+	if err := s.db.CreateAPIKey(k); err != nil {
+		return nil, "", err
+	}
+	log.Printf("🔑 Created API key %d (%s, %s) with scopes %s", k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ", "))
+	return k, key, nil
+}
+
+// Authenticate returns the stored key matching key if it is neither revoked
+// nor expired
+func (s *Store) Authenticate(key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, ErrUnauthorized
+	}
+	k, err := s.db.GetAPIKeyByHash(hashKey(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.RevokedAt != nil || (k.ExpiresAt != nil && !time.Now().Before(*k.ExpiresAt)) {
+		return nil, ErrUnauthorized
+	}
+	return k, nil
+}
+
+// List returns every key, newest first
+func (s *Store) List() ([]*models.APIKey, error) {
+	return s.db.GetAPIKeys()
+}
+
+// Get returns a key by ID
+func (s *Store) Get(id int64) (*models.APIKey, error) {
+	return s.db.GetAPIKey(id)
+}
+
+// Revoke revokes a key, which stops working right away
+func (s *Store) Revoke(id int64) (*models.APIKey, error) {
+	if err := s.db.RevokeAPIKey(id); err != nil {
+		return nil, err
+	}
+	log.Printf("🔑 Revoked API key %d", id)
+	return s.db.GetAPIKey(id)
+}
+
+// HasActiveKeys reports whether any key can currently be used
+func (s *Store) HasActiveKeys() (bool, error) {
+	n, err := s.db.CountActiveAPIKeys()
+	return n > 0, err
+}
+
+// HasScope reports whether a key grants scope. The admin scope grants every scope.
+func HasScope(k *models.APIKey, scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRecipient reports whether a key may send to recipient. A nil key,
+// used when authentication is disabled, and a key without a recipient list
+// may send to anyone.
+func AllowsRecipient(k *models.APIKey, recipient string) bool {
+	if k == nil || len(k.AllowedRecipients) == 0 {
+		return true
+	}
+	jid, err := NormalizeRecipient(recipient)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range k.AllowedRecipients {
+		if allowed == jid {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeRecipient turns a JID or phone number into the JID it addresses,
+// so that different spellings of a recipient compare equal
+func NormalizeRecipient(recipient string) (string, error) {
+	recipient = strings.TrimSpace(recipient)
+	if strings.Contains(recipient, "@") {
+		jid, err := types.ParseJID(recipient)
+		if err != nil || jid.User == "" {
+			return "", fmt.Errorf("invalid recipient %q", recipient)
+		}
+		return jid.ToNonAD().String(), nil
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, recipient)
+	if len(digits) < 7 {
+		return "", fmt.Errorf("invalid recipient %q", recipient)
+	}
+	return types.NewJID(digits, types.DefaultUserServer).String(), nil
+}
+
+type contextKey struct{}
+
+// Middleware authenticates every request whose route needs a scope, as
+// decided by scope; an empty scope marks a public route. The key is read from
+// an "Authorization: Bearer" or X-API-Key header, or for GET requests from
+// the api_key query parameter, since browsers cannot set headers on images
+// and event streams.
+func (s *Store) Middleware(scope func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			required := scope(r)
+			if required == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			k, err := s.Authenticate(keyFromRequest(r))
+			if err != nil {
+				if !errors.Is(err, ErrUnauthorized) {
+					log.Printf("❌ Failed to check API key: %v", err)
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer realm="whatsapp"`)
+				http.Error(w, "Unauthorized: a valid API key is required", http.StatusUnauthorized)
+				return
+			}
+			entry := audit.FromRequest(r)
+			entry.ActorType, entry.Actor = models.ActorAPIKey, k.Name
+			if !HasScope(k, required) {
+				http.Error(w, fmt.Sprintf("Forbidden: API key %s lacks the %s scope", k.Prefix, required), http.StatusForbidden)
+				return
+			}
+			if err := s.db.TouchAPIKey(k.ID); err != nil {
+				log.Printf("⚠️ Failed to record use of API key %d: %v", k.ID, err)
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, k)))
+		})
+	}
+}
+
+// FromRequest returns the API key a request was authenticated with, or nil
+// for public routes and when authentication is disabled
+func FromRequest(r *http.Request) *models.APIKey {
+	k, _ := r.Context().Value(contextKey{}).(*models.APIKey)
+	return k
+}
+
+// keyFromRequest reads the API key from a request
+func keyFromRequest(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if r.Method == http.MethodGet {
+		return r.URL.Query().Get("api_key")
+	}
+	return ""
+}
+
+// hashKey returns the stored hash of a key
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func isScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewStore(db)
+}
+
+func TestMiddlewareEnforcesScopes(t *testing.T) {
+	s := newTestStore(t)
+	_, reader, err := s.Create(&CreateRequest{Name: "reader", Scopes: []string{ScopeReadMessages}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	k, admin, err := s.Create(&CreateRequest{Name: "admin", Scopes: []string{ScopeAdmin}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	handler := s.Middleware(func(r *http.Request) string {
+		if r.URL.Path == "/health" {
+			return ""
+		}
+		return ScopeSendText
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" && FromRequest(r) == nil {
+			t.Error("authenticated request has no key in its context")
+		}
+	}))
+
+	request := func(path, header, key string) int {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		if header != "" {
+			r.Header.Set(header, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := request("/health", "", ""); code != http.StatusOK {
+		t.Errorf("public route = %d, want 200", code)
+	}
+	if code := request("/send", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("no key = %d, want 401", code)
+	}
+	if code := request("/send", "X-API-Key", "wak_nonsense"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key = %d, want 401", code)
+	}
+	if code := request("/send", "X-API-Key", reader); code != http.StatusForbidden {
+		t.Errorf("key without scope = %d, want 403", code)
+	}
+	if code := request("/send", "Authorization", "Bearer "+admin); code != http.StatusOK {
+		t.Errorf("admin key = %d, want 200", code)
+	}
+
+	if _, err := s.Revoke(k.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if code := request("/send", "Authorization", "Bearer "+admin); code != http.StatusUnauthorized {
+		t.Errorf("revoked key = %d, want 401", code)
+	}
+}
+
+func TestAllowsRecipient(t *testing.T) {
+	s := newTestStore(t)
+	k, _, err := s.Create(&CreateRequest{
+		Name:              "support",
+		Scopes:            []string{ScopeSendText},
+		AllowedRecipients: []string{"+353 85 123 4567", "120363012345678901@g.us"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	for recipient, want := range map[string]bool{
+		"353851234567":                true,
+		"353851234567@s.whatsapp.net": true,
+		"120363012345678901@g.us":     true,
+		"447700900123":                false,
+		"not a number":                false,
+	} {
+		if got := AllowsRecipient(k, recipient); got != want {
+			t.Errorf("AllowsRecipient(%q) = %v, want %v", recipient, got, want)
+		}
+	}
+	if !AllowsRecipient(nil, "447700900123") {
+		t.Error("requests without a key should not be restricted")
+	}
+
+	if _, _, err := s.Create(&CreateRequest{Name: "bad", Scopes: []string{"write:everything"}}); err == nil {
+		t.Error("Create accepted an unknown scope")
+	}
+}
@@ -0,0 +1,432 @@
+// Package backup creates and restores consistent snapshots of the WhatsApp
+// session store, the message databases and the media directories of every
+// account.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// ManifestVersion is the archive format version written to the manifest
+	ManifestVersion = 1
+	// manifestName is the name of the manifest entry inside the archive
+	manifestName = "manifest.json"
+
+	sessionEntry  = "databases/session.db"
+	messagesEntry = "databases/messages.db"
+	mediaPrefix   = "media/"
+	// accountsPrefix holds the message database and media of the accounts
+	// other than the default one, under accounts/<name>/
+	accountsPrefix = "accounts/"
+)
+
+// Sources describes the files that make up the server state. The session
+// store is shared by every account; the message database and media directory
+// are those of the default account.
+type Sources struct {
+	SessionDBPath  string // whatsmeow sqlstore database
+	MessagesDBPath string // models.Database message store
+	MediaDir       string
+	Accounts       []string // other accounts to back up
+	// AccountFiles returns the message database and media directory of an
+	// account other than the default one. Restore uses it for every account
+	// in the archive, including those not in Accounts, and rejects the
+	// archive if it returns an error.
+	AccountFiles func(name string) (messagesDBPath, mediaDir string, err error)
+}
+
+// Manifest describes the contents of a backup archive
+type Manifest struct {
+	Version   int         `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Accounts  []string    `json:"accounts,omitempty"` // accounts other than the default one
+	Files     []FileEntry `json:"files"`
+}
+
+// FileEntry describes one file in a backup archive
+type FileEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Create writes a gzip-compressed tar archive of the sources to w. SQLite
+// databases are copied with the online backup API so the snapshot is
+// consistent even while the server keeps writing.
+func Create(w io.Writer, src Sources) (*Manifest, error) {
+	tmpDir, err := os.MkdirTemp("", "whatsapp-backup-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &Manifest{Version: ManifestVersion, CreatedAt: time.Now().UTC()}
+
+	databases := []struct{ entry, path string }{
+		{sessionEntry, src.SessionDBPath},
+		{messagesEntry, src.MessagesDBPath},
+	}
+	mediaDirs := []struct{ prefix, dir string }{
+		{mediaPrefix, src.MediaDir},
+	}
+	for _, name := range src.Accounts {
+		if src.AccountFiles == nil {
+			return nil, fmt.Errorf("no file locations for account %s", name)
+		}
+		messagesDBPath, mediaDir, err := src.AccountFiles(name)
+		if err != nil {
+			return nil, err
+		}
+		databases = append(databases, struct{ entry, path string }{accountsPrefix + name + "/messages.db", messagesDBPath})
+		mediaDirs = append(mediaDirs, struct{ prefix, dir string }{accountsPrefix + name + "/" + mediaPrefix, mediaDir})
+		manifest.Accounts = append(manifest.Accounts, name)
+	}
+
+	for i, db := range databases {
+		if db.path == "" || !fileExists(db.path) {
+			log.Printf("⚠️ Skipping missing database: %s", db.path)
+			continue
+		}
+
+		snapshot := filepath.Join(tmpDir, fmt.Sprintf("%d.db", i))
+		if err := CopyDatabase(db.path, snapshot); err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", db.path, err)
+		}
+		entry, err := addFile(tw, db.entry, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, *entry)
+	}
+
+	for _, media := range mediaDirs {
+		if media.dir == "" || !fileExists(media.dir) {
+			continue
+		}
+		err := filepath.Walk(media.dir, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(media.dir, filePath)
+			if err != nil {
+				return err
+			}
+			entry, err := addFile(tw, media.prefix+filepath.ToSlash(rel), filePath)
+			if err != nil {
+				return err
+			}
+			manifest.Files = append(manifest.Files, *entry)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to archive media directory %s: %w", media.dir, err)
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    manifestName,
+		Mode:    0644,
+		Size:    int64(len(manifestData)),
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(manifestData); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Restore validates an archive produced by Create and writes it back to the
+// destination paths. The archive is fully extracted and checked against its
+// manifest before anything is overwritten. Databases are restored through the
+// SQLite backup API; media files are written over existing files with the same
+// name and other files in the media directory are left alone. The files of
+// accounts other than the default one go where dst.AccountFiles puts them.
+func Restore(r io.Reader, dst Sources) (*Manifest, error) {
+	tmpDir, err := os.MkdirTemp("", "whatsapp-restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest, err := extract(r, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve every destination before overwriting anything
+	type target struct {
+		extracted, path string
+		database        bool
+	}
+	var targets []target
+	for _, entry := range manifest.Files {
+		extracted := filepath.Join(tmpDir, filepath.FromSlash(entry.Name))
+		messagesDBPath, mediaDir, rest := dst.MessagesDBPath, dst.MediaDir, entry.Name
+		if strings.HasPrefix(entry.Name, accountsPrefix) {
+			name, accountRest, ok := strings.Cut(strings.TrimPrefix(entry.Name, accountsPrefix), "/")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("invalid path in backup archive: %s", entry.Name)
+			}
+			if dst.AccountFiles == nil {
+				return nil, fmt.Errorf("backup archive holds account %s, but no location is known for it", name)
+			}
+			if messagesDBPath, mediaDir, err = dst.AccountFiles(name); err != nil {
+				return nil, fmt.Errorf("invalid account in backup archive: %w", err)
+			}
+			rest = accountRest
+			if rest == "messages.db" {
+				rest = messagesEntry
+			}
+		}
+		switch {
+		case entry.Name == sessionEntry:
+			targets = append(targets, target{extracted, dst.SessionDBPath, true})
+		case rest == messagesEntry:
+			targets = append(targets, target{extracted, messagesDBPath, true})
+		case strings.HasPrefix(rest, mediaPrefix):
+			path := filepath.Join(mediaDir, filepath.FromSlash(strings.TrimPrefix(rest, mediaPrefix)))
+			targets = append(targets, target{extracted, path, false})
+		}
+	}
+
+	for _, t := range targets {
+		if t.database {
+			if err := CopyDatabase(t.extracted, t.path); err != nil {
+				return nil, fmt.Errorf("failed to restore %s: %w", t.path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+			return nil, err
+		}
+		if err := copyFile(t.extracted, t.path); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", t.path, err)
+		}
+	}
+
+	return manifest, nil
+}
+
+// CopyDatabase copies a SQLite database using the online backup API
+func CopyDatabase(srcPath, dstPath string) error {
+	ctx := context.Background()
+
+	srcDB, err := sql.Open("sqlite3", "file:"+srcPath)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	dstDB, err := sql.Open("sqlite3", "file:"+dstPath)
+	if err != nil {
+		return err
+	}
+	defer dstDB.Close()
+
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	dstConn, err := dstDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dstRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			dstSQLite, ok := dstRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("destination is not a sqlite3 connection")
+			}
+			srcSQLite, ok := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("source is not a sqlite3 connection")
+			}
+
+			b, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				// Copy in small batches so writers are only blocked briefly
+				done, err := b.Step(256)
+				if err != nil {
+					b.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// extract unpacks an archive into dir and validates it against its manifest
+func extract(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	hashes := make(map[string]string)
+	sizes := make(map[string]int64)
+	var manifest *Manifest
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup archive: %w", err)
+		}
+
+		name := path.Clean(header.Name)
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return nil, fmt.Errorf("invalid path in backup archive: %s", header.Name)
+		}
+
+		if name == manifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("invalid backup manifest: %w", err)
+			}
+			continue
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(file, hash), tr)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		hashes[name] = hex.EncodeToString(hash.Sum(nil))
+		sizes[name] = size
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("backup archive has no manifest")
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	for _, entry := range manifest.Files {
+		hash, ok := hashes[entry.Name]
+		if !ok {
+			return nil, fmt.Errorf("backup archive is missing %s", entry.Name)
+		}
+		if hash != entry.SHA256 || sizes[entry.Name] != entry.Size {
+			return nil, fmt.Errorf("checksum mismatch for %s", entry.Name)
+		}
+	}
+	return manifest, nil
+}
+
+// addFile writes a file to the archive and returns its manifest entry
+func addFile(tw *tar.Writer, name, filePath string) (*FileEntry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(info.Mode().Perm()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return nil, err
+	}
+
+	// Copy exactly the size recorded in the header in case the file is still growing
+	hash := sha256.New()
+	size, err := io.CopyN(io.MultiWriter(tw, hash), file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive %s: %w", filePath, err)
+	}
+
+	return &FileEntry{Name: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// copyFile copies a regular file, replacing the destination
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// fileExists checks if a file exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return !os.IsNotExist(err)
+}
@@ -0,0 +1,252 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// archiveEntry is a file written by buildArchive
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+// buildArchive writes a gzip-compressed tar archive with the given entries
+// followed by the manifest, unless manifest is nil
+func buildArchive(t *testing.T, entries []archiveEntry, manifest *Manifest) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	write := func(name string, data []byte) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, entry := range entries {
+		write(entry.name, entry.data)
+	}
+	if manifest != nil {
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(manifestName, data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// manifestFor returns a manifest listing the entries with their checksums
+func manifestFor(entries []archiveEntry) *Manifest {
+	manifest := &Manifest{Version: ManifestVersion, CreatedAt: time.Now().UTC()}
+	for _, entry := range entries {
+		sum := sha256.Sum256(entry.data)
+		manifest.Files = append(manifest.Files, FileEntry{
+			Name:   entry.name,
+			Size:   int64(len(entry.data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	return manifest
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := Sources{
+		SessionDBPath:  filepath.Join(dir, "whatsapp.db"),
+		MessagesDBPath: filepath.Join(dir, "whatsapp.db_messages.db"),
+		MediaDir:       filepath.Join(dir, "media"),
+	}
+	db, err := sql.Open("sqlite3", "file:"+src.MessagesDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE messages (content TEXT); INSERT INTO messages VALUES ('before')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src.MediaDir, "outbox"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	voiceNote := filepath.Join(src.MediaDir, "outbox", "voice.ogg")
+	if err := os.WriteFile(voiceNote, []byte("OggS before"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	created, err := Create(&archive, src)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if len(created.Files) != 2 {
+		t.Fatalf("archived %d files, want the message database and the voice note", len(created.Files))
+	}
+
+	if _, err := db.Exec(`UPDATE messages SET content = 'after'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(voiceNote, []byte("OggS after"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := Restore(&archive, src)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if len(restored.Files) != len(created.Files) {
+		t.Errorf("restored %d files, want %d", len(restored.Files), len(created.Files))
+	}
+	var content string
+	if err := db.QueryRow(`SELECT content FROM messages`).Scan(&content); err != nil || content != "before" {
+		t.Errorf("message = %q, %v; want the backed up message", content, err)
+	}
+	if data, _ := os.ReadFile(voiceNote); string(data) != "OggS before" {
+		t.Errorf("voice note = %q, want the backed up file", data)
+	}
+}
+
+func TestExtractValidatesManifest(t *testing.T) {
+	entries := []archiveEntry{{name: "media/photo.jpg", data: []byte("JFIF photo")}}
+
+	tampered := manifestFor(entries)
+	tampered.Files[0].SHA256 = strings.Repeat("0", 64)
+	truncated := manifestFor(entries)
+	truncated.Files[0].Size--
+	future := manifestFor(entries)
+	future.Version = ManifestVersion + 1
+	missing := manifestFor(append(entries, archiveEntry{name: "media/video.mp4", data: []byte("ftyp")}))
+
+	tests := []struct {
+		name     string
+		manifest *Manifest
+		want     string
+	}{
+		{"checksum mismatch", tampered, "checksum mismatch for media/photo.jpg"},
+		{"size mismatch", truncated, "checksum mismatch for media/photo.jpg"},
+		{"unsupported version", future, "unsupported backup version"},
+		{"missing file", missing, "backup archive is missing media/video.mp4"},
+		{"no manifest", nil, "backup archive has no manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extract(buildArchive(t, entries, tt.manifest), t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("extract = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := extract(buildArchive(t, entries, manifestFor(entries)), t.TempDir()); err != nil {
+		t.Errorf("extract of a valid archive: %v", err)
+	}
+}
+
+func TestExtractRejectsPathTraversal(t *testing.T) {
+	for _, name := range []string{"../evil.sh", "media/../../evil.sh", "/tmp/evil.sh"} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "extract")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			entries := []archiveEntry{{name: name, data: []byte("#!/bin/sh")}}
+
+			_, err := extract(buildArchive(t, entries, manifestFor(entries)), dir)
+			if err == nil || !strings.Contains(err.Error(), "invalid path in backup archive") {
+				t.Errorf("extract = %v, want an invalid path error", err)
+			}
+			if _, err := os.Stat(filepath.Join(root, "evil.sh")); !os.IsNotExist(err) {
+				t.Errorf("file written outside the extraction directory: %v", err)
+			}
+		})
+	}
+}
+
+func TestRestoreCoversEveryAccount(t *testing.T) {
+	dir := t.TempDir()
+	accountFiles := func(name string) (string, string, error) {
+		if name != "sales" {
+			return "", "", fmt.Errorf("unknown account %q", name)
+		}
+		return filepath.Join(dir, "whatsapp.db_sales_messages.db"), filepath.Join(dir, "media_sales"), nil
+	}
+	src := Sources{
+		SessionDBPath:  filepath.Join(dir, "whatsapp.db"),
+		MessagesDBPath: filepath.Join(dir, "whatsapp.db_messages.db"),
+		MediaDir:       filepath.Join(dir, "media"),
+		Accounts:       []string{"sales"},
+		AccountFiles:   accountFiles,
+	}
+	salesDB, salesMedia, _ := accountFiles("sales")
+	db, err := sql.Open("sqlite3", "file:"+salesDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE messages (content TEXT); INSERT INTO messages VALUES ('quote sent')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(salesMedia, 0755); err != nil {
+		t.Fatal(err)
+	}
+	quote := filepath.Join(salesMedia, "quote.pdf")
+	if err := os.WriteFile(quote, []byte("%PDF quote"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Create(&archive, src)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if len(manifest.Accounts) != 1 || len(manifest.Files) != 2 {
+		t.Fatalf("manifest = %+v, want the sales database and media", manifest)
+	}
+	snapshot := archive.Bytes()
+
+	if _, err := db.Exec(`DELETE FROM messages`); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(quote)
+
+	// Restoring into a server without the account still finds its files
+	dst := src
+	dst.Accounts = nil
+	if _, err := Restore(bytes.NewReader(snapshot), dst); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM messages`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("sales messages = %d, %v; want the backed up message", n, err)
+	}
+	if data, _ := os.ReadFile(quote); string(data) != "%PDF quote" {
+		t.Errorf("sales media = %q, want the backed up file", data)
+	}
+
+	dst.AccountFiles = func(name string) (string, string, error) {
+		return "", "", fmt.Errorf("unknown account %q", name)
+	}
+	if _, err := Restore(bytes.NewReader(snapshot), dst); err == nil || !strings.Contains(err.Error(), "invalid account") {
+		t.Errorf("Restore of an unknown account = %v, want an invalid account error", err)
+	}
+}
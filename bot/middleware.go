@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+)
+
+// IgnoreFromMe skips messages sent from this account, so the bot does not
+// answer itself or the people using the phone
+func IgnoreFromMe(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) error {
+		if ctx.Message.IsFromMe {
+			return nil
+		}
+		return next(ctx)
+	}
+}
+
+// Recover turns a panicking handler into an error so one bad handler does not
+// take down the client
+func Recover(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		return next(ctx)
+	}
+}
+
+// Logging logs which handler each message was routed to
+func Logging(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) error {
+		log.Printf("🤖 Routing %s message %s from %s to %s",
+			ctx.Message.MediaType, ctx.Message.MessageID, ctx.Message.Sender, ctx.Route)
+		return next(ctx)
+	}
+}
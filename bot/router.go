@@ -0,0 +1,327 @@
+// Package bot routes incoming WhatsApp messages to registered handlers.
+// Handlers are commands such as "/ping", regular expressions, keywords and
+// fallbacks, each scoped to a set of chats and message types, and wrapped by
+// middleware shared by the whole router.
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-go-mcp/models"
+)
+
+// CommandPrefix starts a command message, as in "/ping"
+const CommandPrefix = "/"
+
+// HandlerFunc handles a message routed to it
+type HandlerFunc func(ctx *Context) error
+
+// Middleware wraps the handler chosen for a message. It may act before or
+// after calling next, or skip next to stop the message from being handled.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// ReplyFunc sends a text message to a chat
+type ReplyFunc func(chatJID, text string) error
+
+// Context carries a routed message to its handler
+type Context struct {
+	context.Context
+
+	// Message is the stored message; MediaType is its message type
+	Message *models.Message
+	// Event is the WhatsApp event the message was received in
+	Event *events.Message
+	// Route names the handler the message was routed to, e.g. "/ping"
+	Route string
+
+	// Command, Args and ArgText are set for commands. For "/remind 10m buy milk",
+	// Command is "remind", Args is ["10m", "buy", "milk"] and ArgText is "10m buy milk".
+	Command string
+	Args    []string
+	ArgText string
+
+	// Matches holds the match and submatches of a regex or keyword handler
+	Matches []string
+
+	router *Router
+}
+
+// Reply sends a text message to the chat the message came from
+func (ctx *Context) Reply(text string) error {
+	return ctx.router.reply(ctx.Message.ChatJID, text)
+}
+
+// IsGroup reports whether the message was sent in a group
+func (ctx *Context) IsGroup() bool {
+	return ctx.Event != nil && ctx.Event.Info.IsGroup
+}
+
+// Router returns the router that dispatched the message
+func (ctx *Context) Router() *Router {
+	return ctx.router
+}
+
+// Option limits the messages a handler applies to
+type Option func(*route)
+
+// InChats limits a handler to the given chat JIDs
+func InChats(chatJIDs ...string) Option {
+	return func(r *route) { r.chats = chatJIDs }
+}
+
+// OfTypes limits a handler to the given message types ("text", "image",
+// "video", "audio", "voice", "document", "unknown"). Handlers apply to text
+// messages when no types are given. Captions of media messages are matched
+// by commands, regexes and keywords that include the media type.
+func OfTypes(messageTypes ...string) Option {
+	return func(r *route) { r.types = messageTypes }
+}
+
+// DirectOnly limits a handler to one-to-one chats
+func DirectOnly() Option {
+	return func(r *route) { r.direct, r.groups = true, false }
+}
+
+// GroupsOnly limits a handler to group chats
+func GroupsOnly() Option {
+	return func(r *route) { r.direct, r.groups = false, true }
+}
+
+// route is a registered handler and its scope
+type route struct {
+	name        string
+	description string
+	pattern     *regexp.Regexp
+	handler     HandlerFunc
+	chats       []string
+	types       []string
+	direct      bool
+	groups      bool
+}
+
+// applies reports whether a message is in the route's scope
+func (r *route) applies(msg *models.Message, isGroup bool) bool {
+	if len(r.chats) > 0 && !contains(r.chats, msg.ChatJID) {
+		return false
+	}
+	if !contains(r.types, msg.MediaType) {
+		return false
+	}
+	if isGroup {
+		return r.groups
+	}
+	return r.direct
+}
+
+// Router dispatches each message to a single handler. Commands are looked up
+// first, then regex and keyword handlers in registration order, then
+// fallbacks in registration order.
+type Router struct {
+	reply      ReplyFunc
+	mu         sync.RWMutex
+	middleware []Middleware
+	commands   map[string]*route
+	matchers   []*route
+	fallbacks  []*route
+}
+
+// NewRouter creates a router that sends replies with reply
+func NewRouter(reply ReplyFunc) *Router {
+	return &Router{
+		reply:    reply,
+		commands: make(map[string]*route),
+	}
+}
+
+// Use adds middleware. The first middleware added is the outermost.
+func (r *Router) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Command registers a handler for "/name". Names are case-insensitive, and
+// registering a name again replaces the previous handler.
+func (r *Router) Command(name, description string, handler HandlerFunc, opts ...Option) {
+	name = strings.ToLower(strings.TrimPrefix(name, CommandPrefix))
+	rt := newRoute(CommandPrefix+name, handler, opts)
+	rt.description = description
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[name] = rt
+}
+
+// Regex registers a handler for messages matching pattern. The match and its
+// submatches are passed in Context.Matches.
+func (r *Router) Regex(pattern string, handler HandlerFunc, opts ...Option) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	rt := newRoute("regex "+pattern, handler, opts)
+	rt.pattern = re
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.matchers = append(r.matchers, rt)
+	return nil
+}
+
+// Keyword registers a handler for messages containing any of the keywords as
+// a whole word, ignoring case, so "hi" matches "Hi there" but not "this".
+func (r *Router) Keyword(keywords []string, handler HandlerFunc, opts ...Option) {
+	quoted := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		quoted[i] = regexp.QuoteMeta(strings.TrimSpace(keyword))
+	}
+	rt := newRoute("keyword "+strings.Join(keywords, ","), handler, opts)
+	rt.pattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.matchers = append(r.matchers, rt)
+}
+
+// Fallback registers a handler for messages no other handler matched
+func (r *Router) Fallback(handler HandlerFunc, opts ...Option) {
+	rt := newRoute("fallback", handler, opts)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallbacks = append(r.fallbacks, rt)
+}
+
+func newRoute(name string, handler HandlerFunc, opts []Option) *route {
+	rt := &route{name: name, handler: handler, types: []string{"text"}, direct: true, groups: true}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return rt
+}
+
+// Dispatch routes a message to its handler. It reports whether a handler was
+// found; handler errors are logged.
+func (r *Router) Dispatch(ctx context.Context, msg *models.Message, evt *events.Message) bool {
+	bctx := &Context{Context: ctx, Message: msg, Event: evt, router: r}
+
+	r.mu.RLock()
+	rt := r.match(bctx)
+	middleware := r.middleware
+	r.mu.RUnlock()
+
+	if rt == nil {
+		return false
+	}
+	bctx.Route = rt.name
+
+	handler := rt.handler
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	if err := handler(bctx); err != nil {
+		log.Printf("❌ Bot handler %s failed for message %s: %v", rt.name, msg.MessageID, err)
+	}
+	return true
+}
+
+// match finds the route for a message and fills in its command or matches
+func (r *Router) match(ctx *Context) *route {
+	msg, isGroup := ctx.Message, ctx.IsGroup()
+	text := strings.TrimSpace(msg.Content)
+
+	if strings.HasPrefix(text, CommandPrefix) {
+		fields := strings.Fields(text)
+		name := strings.ToLower(strings.TrimPrefix(fields[0], CommandPrefix))
+		if rt, ok := r.commands[name]; ok && rt.applies(msg, isGroup) {
+			ctx.Command = name
+			ctx.ArgText = strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+			ctx.Args = ParseArgs(ctx.ArgText)
+			return rt
+		}
+	}
+
+	for _, rt := range r.matchers {
+		if !rt.applies(msg, isGroup) {
+			continue
+		}
+		if matches := rt.pattern.FindStringSubmatch(text); matches != nil {
+			ctx.Matches = matches
+			return rt
+		}
+	}
+
+	for _, rt := range r.fallbacks {
+		if rt.applies(msg, isGroup) {
+			return rt
+		}
+	}
+	return nil
+}
+
+// Help lists the commands available for a message, one per line
+func (r *Router) Help(msg *models.Message, isGroup bool) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	for name, rt := range r.commands {
+		if rt.applies(msg, isGroup) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Available commands:")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n%s%s - %s", CommandPrefix, name, r.commands[name].description)
+	}
+	return b.String()
+}
+
+// ParseArgs splits command arguments on whitespace. Double quotes group
+// words into one argument: `add "John Smith" 42` gives ["add", "John Smith", "42"].
+func ParseArgs(text string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes, hasArg := false, false
+
+	for _, ch := range text {
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case !inQuotes && (ch == ' ' || ch == '\t' || ch == '\n'):
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteRune(ch)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-go-mcp/models"
+)
+
+const chatJID = "353851234567@s.whatsapp.net"
+
+// dispatch routes a message and returns the route it reached, or "" if none
+func dispatch(t *testing.T, r *Router, mediaType, content string, isGroup bool) (string, *Context) {
+	t.Helper()
+	msg := &models.Message{ChatJID: chatJID, MediaType: mediaType, Content: content, MessageID: "ID"}
+	evt := &events.Message{Info: types.MessageInfo{MessageSource: types.MessageSource{IsGroup: isGroup}}}
+
+	var reached *Context
+	r.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) error {
+			reached = ctx
+			return next(ctx)
+		}
+	})
+	defer func() { r.middleware = r.middleware[:len(r.middleware)-1] }()
+
+	if !r.Dispatch(context.Background(), msg, evt) {
+		return "", nil
+	}
+	return reached.Route, reached
+}
+
+func noop(ctx *Context) error { return nil }
+
+func TestRoutingOrderAndMatching(t *testing.T) {
+	r := NewRouter(func(string, string) error { return nil })
+	r.Command("remind", "Set a reminder", noop)
+	r.Keyword([]string{"hello", "hi"}, noop)
+	if err := r.Regex(`order #(\d+)`, noop); err != nil {
+		t.Fatal(err)
+	}
+	r.Fallback(noop)
+
+	route, ctx := dispatch(t, r, "text", `/Remind 10m "buy milk"`, false)
+	if route != "/remind" || ctx.Command != "remind" || !reflect.DeepEqual(ctx.Args, []string{"10m", "buy milk"}) ||
+		ctx.ArgText != `10m "buy milk"` {
+		t.Errorf("command routed to %q with %+v", route, ctx)
+	}
+
+	if route, _ := dispatch(t, r, "text", "Hi there", false); route != "keyword hello,hi" {
+		t.Errorf("greeting routed to %q", route)
+	}
+	for _, text := range []string{"this ship", "/unknown", "hiking"} {
+		if route, _ := dispatch(t, r, "text", text, false); route != "fallback" {
+			t.Errorf("%q routed to %q, want fallback", text, route)
+		}
+	}
+
+	route, ctx = dispatch(t, r, "text", "where is order #42", false)
+	if route != `regex order #(\d+)` || len(ctx.Matches) != 2 || ctx.Matches[1] != "42" {
+		t.Errorf("regex routed to %q with %v", route, ctx.Matches)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	r := NewRouter(func(string, string) error { return nil })
+	r.Command("admin", "Admin only", noop, InChats("120363000000000000@g.us"))
+	r.Command("join", "Groups only", noop, GroupsOnly())
+	r.Keyword([]string{"invoice"}, noop, OfTypes("text", "document"))
+	r.Fallback(noop, OfTypes("voice"))
+
+	if route, _ := dispatch(t, r, "text", "/admin", false); route != "" {
+		t.Errorf("command outside its chats routed to %q", route)
+	}
+	if route, _ := dispatch(t, r, "text", "/join", false); route != "" {
+		t.Errorf("group command routed to %q in a direct chat", route)
+	}
+	if route, _ := dispatch(t, r, "text", "/join", true); route != "/join" {
+		t.Errorf("group command routed to %q in a group", route)
+	}
+	if route, _ := dispatch(t, r, "document", "Invoice March", false); route != "keyword invoice" {
+		t.Errorf("document caption routed to %q", route)
+	}
+	if route, _ := dispatch(t, r, "image", "invoice", false); route != "" {
+		t.Errorf("image routed to %q", route)
+	}
+	if route, _ := dispatch(t, r, "voice", "[Voice Message]", false); route != "fallback" {
+		t.Errorf("voice routed to %q", route)
+	}
+
+	help := r.Help(&models.Message{ChatJID: chatJID, MediaType: "text"}, true)
+	if help != "Available commands:\n/join - Groups only" {
+		t.Errorf("unexpected help %q", help)
+	}
+}
+
+func TestMiddlewareCanStopMessages(t *testing.T) {
+	var replies []string
+	r := NewRouter(func(chat, text string) error {
+		replies = append(replies, text)
+		return nil
+	})
+	r.Use(IgnoreFromMe)
+	r.Command("ping", "", func(ctx *Context) error { return ctx.Reply("pong") })
+
+	for _, fromMe := range []bool{true, false} {
+		msg := &models.Message{ChatJID: chatJID, MediaType: "text", Content: "/ping", IsFromMe: fromMe}
+		r.Dispatch(context.Background(), msg, &events.Message{})
+	}
+	if !reflect.DeepEqual(replies, []string{"pong"}) {
+		t.Errorf("replies = %v", replies)
+	}
+}
@@ -0,0 +1,454 @@
+// Package broadcast sends one message template to many recipients. Each
+// recipient gets a personalised copy that is handed to the client's outbox
+// one at a time, with a configurable pause and random jitter between
+// messages so bulk sends do not look like spam. Broadcasts are stored in the
+// message database and carry on after a restart.
+package broadcast
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/models"
+)
+
+const (
+	// pollInterval is how often the running broadcast is checked for a due message
+	pollInterval = time.Second
+	// defaultDelay and defaultJitter pace broadcasts that do not set their own, in seconds
+	defaultDelay  = 5
+	defaultJitter = 3
+	// maxRecipients bounds the size of a single broadcast
+	maxRecipients = 5000
+)
+
+// Errors returned when managing broadcasts
+var (
+	ErrInvalidBroadcast = errors.New("invalid broadcast")
+	ErrInvalidState     = errors.New("broadcast cannot be changed in its current state")
+)
+
+// rateLimitError is returned by a Sender that refuses a message over a send
+// limit. It is implemented by *whatsapp.RateLimitError.
+type rateLimitError interface {
+	error
+	RetryDelay() time.Duration
+}
+
+// Sender queues messages for delivery and decides which files may be sent.
+// It is implemented by *whatsapp.Client.
+type Sender interface {
+	QueueText(recipient, text, idempotencyKey string) (*models.OutboxMessage, error)
+	QueueFile(recipient, filePath, caption, idempotencyKey string) (*models.OutboxMessage, error)
+	IsConnected() bool
+	CheckMediaPath(path string) (string, error)
+}
+
+// Request describes a new broadcast. Recipients are listed explicitly, found
+// with a contact search query, or both.
+type Request struct {
+	Name       string            `json:"name,omitempty" example:"Holiday opening hours"`
+	Template   string            `json:"template" example:"Hi {{name}}, we are open {{hours}} over the holidays."`
+	MediaPath  string            `json:"media_path,omitempty" example:"flyer.jpg"`
+	Recipients []Recipient       `json:"recipients,omitempty"`
+	Query      string            `json:"query,omitempty" example:"customer"`
+	Variables  map[string]string `json:"variables,omitempty"`                  // defaults for every recipient
+	Delay      *int              `json:"delay_seconds,omitempty" example:"5"`  // pause between messages
+	Jitter     *int              `json:"jitter_seconds,omitempty" example:"3"` // random extra pause
+	CreatedBy  string            `json:"-"`
+}
+
+// Recipient is a JID or phone number with its own template variables
+type Recipient struct {
+	To        string            `json:"to" example:"+353 85 123 4567"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// Manager stores broadcasts and paces their messages
+type Manager struct {
+	db       *models.Database
+	sender   Sender
+	mediaDir string // where files attached to broadcasts are kept
+	wake     chan struct{}
+}
+
+// New creates a broadcast manager backed by the message database. Files
+// attached to broadcasts are copied into mediaDir.
+func New(db *models.Database, sender Sender, mediaDir string) *Manager {
+	return &Manager{
+		db:       db,
+		sender:   sender,
+		mediaDir: mediaDir,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Run sends the messages of running broadcasts until ctx is cancelled.
+// Broadcasts run one at a time, oldest first.
+func (m *Manager) Run(ctx context.Context) {
+	log.Printf("📣 Broadcast sender started")
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.step(time.Now())
+		m.removeFinishedMedia()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+	}
+}
+
+// step sends the next message of the running broadcast if it is due. Nothing
+// is sent while disconnected, otherwise the outbox would deliver the backlog
+// all at once when the connection comes back.
+func (m *Manager) step(now time.Time) {
+	if !m.sender.IsConnected() {
+		return
+	}
+	b, err := m.db.GetNextRunningBroadcast()
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	} else if err != nil {
+		log.Printf("❌ Failed to load running broadcast: %v", err)
+		return
+	}
+	if b.NextSendAt.After(now) {
+		return
+	}
+
+	r, err := m.db.GetNextPendingBroadcastRecipient(b.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if ok, err := m.db.UpdateBroadcastStatus(b.ID, models.BroadcastCompleted, models.BroadcastRunning); err != nil {
+			log.Printf("❌ Failed to complete broadcast %d: %v", b.ID, err)
+		} else if ok {
+			log.Printf("📣 Broadcast %d completed", b.ID)
+		}
+		return
+	} else if err != nil {
+		log.Printf("❌ Failed to load next recipient of broadcast %d: %v", b.ID, err)
+		return
+	}
+
+	// The idempotency key ties the outbox entry to this recipient, so nobody
+	// gets the message twice even if recording the send fails
+	key := fmt.Sprintf("broadcast-%d-%d", b.ID, r.ID)
+	var queued *models.OutboxMessage
+	if b.MediaPath != "" {
+		queued, err = m.sender.QueueFile(r.Recipient, b.MediaPath, r.Text, key)
+	} else {
+		queued, err = m.sender.QueueText(r.Recipient, r.Text, key)
+	}
+
+	// A rate limited recipient stays pending and the broadcast waits until
+	// the limit allows another message
+	var limited rateLimitError
+	if errors.As(err, &limited) {
+		log.Printf("🚦 Broadcast %d message to %s is rate limited, retrying in %s", b.ID, r.Recipient, limited.RetryDelay())
+		if err := m.db.SetBroadcastNextSend(b.ID, time.Now().Add(limited.RetryDelay())); err != nil {
+			log.Printf("❌ Failed to pace broadcast %d: %v", b.ID, err)
+		}
+		return
+	}
+
+	var outboxID int64
+	sendError := ""
+	if err != nil {
+		sendError = err.Error()
+		log.Printf("❌ Broadcast %d message to %s could not be queued: %v", b.ID, r.Recipient, err)
+	} else {
+		outboxID = queued.ID
+		log.Printf("📣 Broadcast %d message to %s queued as outbox message %d (%s)", b.ID, r.Recipient, queued.ID, queued.Status)
+	}
+	if err := m.db.RecordBroadcastSend(r.ID, outboxID, sendError); err != nil {
+		log.Printf("❌ Failed to record broadcast %d message to %s: %v", b.ID, r.Recipient, err)
+	}
+	if err := m.db.SetBroadcastNextSend(b.ID, time.Now().Add(pause(b))); err != nil {
+		log.Printf("❌ Failed to pace broadcast %d: %v", b.ID, err)
+	}
+}
+
+// pause returns the wait before the next message of a broadcast: its delay
+// plus a random part of its jitter
+func pause(b *models.Broadcast) time.Duration {
+	d := time.Duration(b.Delay) * time.Second
+	if b.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(b.Jitter) * int64(time.Second)))
+	}
+	return d
+}
+
+// removeFinishedMedia deletes the attached files of broadcasts that have been
+// cancelled or completed
+func (m *Manager) removeFinishedMedia() {
+	finished, err := m.db.GetFinishedBroadcastsWithMedia()
+	if err != nil {
+		log.Printf("❌ Failed to load finished broadcasts: %v", err)
+		return
+	}
+	for _, b := range finished {
+		if err := os.Remove(b.MediaPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ Failed to remove broadcast media %s: %v", b.MediaPath, err)
+			continue
+		}
+		if err := m.db.ClearBroadcastMedia(b.ID); err != nil {
+			log.Printf("❌ Failed to clear media of broadcast %d: %v", b.ID, err)
+		}
+	}
+}
+
+// Create validates a broadcast, renders its message for every recipient and
+// starts sending. Rendering fails if any recipient lacks a template variable,
+// in which case nothing is sent.
+func (m *Manager) Create(req *Request) (*models.Broadcast, error) {
+	if strings.TrimSpace(req.Template) == "" && req.MediaPath == "" {
+		return nil, fmt.Errorf("%w: template or media_path is required", ErrInvalidBroadcast)
+	}
+	b := &models.Broadcast{
+		Name:      req.Name,
+		Template:  req.Template,
+		Delay:     defaultDelay,
+		Jitter:    defaultJitter,
+		CreatedBy: req.CreatedBy,
+	}
+	if req.Delay != nil {
+		if *req.Delay < 1 {
+			return nil, fmt.Errorf("%w: delay_seconds must be at least 1", ErrInvalidBroadcast)
+		}
+		b.Delay = *req.Delay
+	}
+	if req.Jitter != nil {
+		if *req.Jitter < 0 {
+			return nil, fmt.Errorf("%w: jitter_seconds cannot be negative", ErrInvalidBroadcast)
+		}
+		b.Jitter = *req.Jitter
+	}
+
+	recipients, err := m.resolveRecipients(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: no recipients", ErrInvalidBroadcast)
+	}
+	if len(recipients) > maxRecipients {
+		return nil, fmt.Errorf("%w: %d recipients, at most %d are allowed", ErrInvalidBroadcast, len(recipients), maxRecipients)
+	}
+
+	if req.MediaPath != "" {
+		if b.MediaPath, err = m.attachMedia(req.MediaPath); err != nil {
+			return nil, err
+		}
+		b.Filename = filepath.Base(req.MediaPath)
+	}
+	if err := m.db.CreateBroadcast(b, recipients); err != nil {
+		if b.MediaPath != "" {
+			os.Remove(b.MediaPath)
+		}
+		return nil, err
+	}
+	log.Printf("📣 Broadcast %d to %d recipients started", b.ID, len(recipients))
+	m.notify()
+	return m.db.GetBroadcast(b.ID)
+}
+
+// resolveRecipients normalizes the listed recipients, adds the contacts
+// matching the query and renders the message for each. A recipient listed
+// more than once gets one message. Variables come from the recipient, then
+// the stored contact (name and phone), then the broadcast defaults.
+func (m *Manager) resolveRecipients(req *Request) ([]*models.BroadcastRecipient, error) {
+	type target struct {
+		jid  types.JID
+		vars map[string]string
+	}
+	var targets []target
+	seen := map[string]bool{}
+	add := func(jid types.JID, vars map[string]string) {
+		if !seen[jid.String()] {
+			seen[jid.String()] = true
+			targets = append(targets, target{jid, vars})
+		}
+	}
+
+	for _, r := range req.Recipients {
+		jid, err := ParseRecipient(r.To)
+		if err != nil {
+			return nil, err
+		}
+		add(jid, r.Variables)
+	}
+	if req.Query != "" {
+		contacts, err := m.db.SearchContacts(req.Query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search contacts: %w", err)
+		}
+		for _, contact := range contacts {
+			jid, err := types.ParseJID(contact.JID)
+			if err != nil || contact.IsGroup || contact.IsBlocked || jid.Server != types.DefaultUserServer {
+				continue
+			}
+			add(jid, nil)
+		}
+	}
+
+	recipients := make([]*models.BroadcastRecipient, 0, len(targets))
+	for _, t := range targets {
+		vars := map[string]string{}
+		for k, v := range req.Variables {
+			vars[k] = v
+		}
+		vars["phone"] = t.jid.User
+		if contact, err := m.db.GetContact(t.jid.String()); err == nil {
+			if contact.Name != "" {
+				vars["name"] = contact.Name
+			} else if contact.PushName != "" {
+				vars["name"] = contact.PushName
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to look up contact %s: %w", t.jid, err)
+		}
+		for k, v := range t.vars {
+			vars[k] = v
+		}
+
+		text, err := Render(req.Template, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%w: recipient %s: %v", ErrInvalidBroadcast, t.jid, err)
+		}
+		recipients = append(recipients, &models.BroadcastRecipient{Recipient: t.jid.String(), Text: text})
+	}
+	return recipients, nil
+}
+
+// ParseRecipient accepts a JID or a phone number in international format,
+// with or without a leading + and separators
+func ParseRecipient(to string) (types.JID, error) {
+	to = strings.TrimSpace(to)
+	if strings.Contains(to, "@") {
+		jid, err := types.ParseJID(to)
+		if err != nil || jid.User == "" {
+			return types.JID{}, fmt.Errorf("%w: invalid recipient %q", ErrInvalidBroadcast, to)
+		}
+		return jid, nil
+	}
+
+	phone := strings.Map(func(r rune) rune {
+		switch r {
+		case '+', ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, to)
+	if len(phone) < 7 || len(phone) > 15 || strings.Trim(phone, "0123456789") != "" {
+		return types.JID{}, fmt.Errorf("%w: invalid recipient %q", ErrInvalidBroadcast, to)
+	}
+	return types.NewJID(phone, types.DefaultUserServer), nil
+}
+
+// Pause stops a running broadcast after the message being sent
+func (m *Manager) Pause(id int64) (*models.Broadcast, error) {
+	return m.transition(id, "paused", models.BroadcastPaused, models.BroadcastRunning)
+}
+
+// Resume carries on with a paused broadcast
+func (m *Manager) Resume(id int64) (*models.Broadcast, error) {
+	return m.transition(id, "resumed", models.BroadcastRunning, models.BroadcastPaused)
+}
+
+// Cancel stops a broadcast for good. Recipients not reached yet are skipped.
+func (m *Manager) Cancel(id int64) (*models.Broadcast, error) {
+	return m.transition(id, "cancelled", models.BroadcastCancelled, models.BroadcastRunning, models.BroadcastPaused)
+}
+
+// transition moves a broadcast between states, returning ErrInvalidState if
+// it is not in one of the from states
+func (m *Manager) transition(id int64, verb, status string, from ...string) (*models.Broadcast, error) {
+	ok, err := m.db.UpdateBroadcastStatus(id, status, from...)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if _, err := m.db.GetBroadcast(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidState
+	}
+	log.Printf("📣 Broadcast %d %s", id, verb)
+	m.notify()
+	return m.db.GetBroadcast(id)
+}
+
+// Get returns a broadcast with its progress
+func (m *Manager) Get(id int64) (*models.Broadcast, error) {
+	return m.db.GetBroadcast(id)
+}
+
+// List returns broadcasts with their progress, optionally filtered by status
+func (m *Manager) List(status string) ([]*models.Broadcast, error) {
+	return m.db.GetBroadcasts(status)
+}
+
+// Recipients returns the per-recipient status of a broadcast, optionally
+// filtered by status
+func (m *Manager) Recipients(id int64, status string) ([]*models.BroadcastRecipient, error) {
+	if _, err := m.db.GetBroadcast(id); err != nil {
+		return nil, err
+	}
+	return m.db.GetBroadcastRecipients(id, status)
+}
+
+// notify makes the run loop check the running broadcast now
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// attachMedia copies the file of a broadcast into the media directory and
+// returns the path of the copy
+func (m *Manager) attachMedia(path string) (string, error) {
+	path, err := m.sender.CheckMediaPath(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidBroadcast, err)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidBroadcast, err)
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(m.mediaDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create broadcast media directory: %w", err)
+	}
+	dst := filepath.Join(m.mediaDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(path)))
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
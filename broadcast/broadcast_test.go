@@ -0,0 +1,213 @@
+package broadcast
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// fakeSender records queued messages, or refuses them while limited is set
+type fakeSender struct {
+	sent    []string // recipient: text
+	limited *whatsapp.RateLimitError
+}
+
+func (f *fakeSender) QueueText(recipient, text, key string) (*models.OutboxMessage, error) {
+	if f.limited != nil {
+		return nil, f.limited
+	}
+	f.sent = append(f.sent, recipient+": "+text)
+	return &models.OutboxMessage{ID: int64(len(f.sent)), Recipient: recipient, Status: models.OutboxQueued}, nil
+}
+
+func (f *fakeSender) QueueFile(recipient, filePath, caption, key string) (*models.OutboxMessage, error) {
+	return f.QueueText(recipient, caption, key)
+}
+
+func (f *fakeSender) IsConnected() bool {
+	return true
+}
+
+func (f *fakeSender) CheckMediaPath(path string) (string, error) {
+	return path, nil
+}
+
+func newTestManager(t *testing.T) (*Manager, *fakeSender) {
+	t.Helper()
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sender := &fakeSender{}
+	return New(db, sender, t.TempDir()), sender
+}
+
+func TestParseRecipient(t *testing.T) {
+	for in, want := range map[string]string{
+		"+353 85 123-4567":            "353851234567@s.whatsapp.net",
+		"353851234567":                "353851234567@s.whatsapp.net",
+		"353851234567@s.whatsapp.net": "353851234567@s.whatsapp.net",
+		"120363025246125888@g.us":     "120363025246125888@g.us",
+	} {
+		jid, err := ParseRecipient(in)
+		if err != nil || jid.String() != want {
+			t.Errorf("ParseRecipient(%q) = %s, %v; want %s", in, jid, err, want)
+		}
+	}
+	for _, in := range []string{"", "12345", "call me", "@s.whatsapp.net"} {
+		if _, err := ParseRecipient(in); err == nil {
+			t.Errorf("expected %q to be rejected", in)
+		}
+	}
+}
+
+func TestBroadcastSendsPersonalisedMessagesInTurn(t *testing.T) {
+	m, sender := newTestManager(t)
+	if err := m.db.StoreContact(&models.Contact{JID: "353851111111@s.whatsapp.net", PushName: "Aoife"}); err != nil {
+		t.Fatalf("StoreContact: %v", err)
+	}
+
+	delay, jitter := 60, 0
+	b, err := m.Create(&Request{
+		Template: "Hi {{name}}, your code is {{code}}",
+		Recipients: []Recipient{
+			{To: "+353 85 111 1111", Variables: map[string]string{"code": "A1"}},
+			{To: "353852222222", Variables: map[string]string{"name": "Brian", "code": "B2"}},
+			{To: "353851111111@s.whatsapp.net"},
+		},
+		Variables: map[string]string{"code": "none"},
+		Delay:     &delay,
+		Jitter:    &jitter,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if b.Progress.Total != 2 || b.Progress.Pending != 2 {
+		t.Fatalf("duplicate recipient not merged: %+v", b.Progress)
+	}
+
+	// One message per step, paced by the delay
+	now := time.Now()
+	m.step(now)
+	m.step(now)
+	if len(sender.sent) != 1 {
+		t.Fatalf("sent %d messages before the delay passed, want 1", len(sender.sent))
+	}
+	m.step(now.Add(2 * time.Minute))
+	m.step(now.Add(4 * time.Minute))
+
+	want := []string{
+		"353851111111@s.whatsapp.net: Hi Aoife, your code is A1",
+		"353852222222@s.whatsapp.net: Hi Brian, your code is B2",
+	}
+	if len(sender.sent) != len(want) {
+		t.Fatalf("sent %v, want %v", sender.sent, want)
+	}
+	for i := range want {
+		if sender.sent[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, sender.sent[i], want[i])
+		}
+	}
+
+	got, err := m.Get(b.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Status != models.BroadcastCompleted || got.Progress.Pending != 0 {
+		t.Errorf("broadcast not completed: %s %+v", got.Status, got.Progress)
+	}
+}
+
+func TestRateLimitedRecipientIsRetried(t *testing.T) {
+	m, sender := newTestManager(t)
+	sender.limited = &whatsapp.RateLimitError{Scope: "global", RetryAfter: time.Minute}
+	delay, jitter := 1, 0
+	b, err := m.Create(&Request{
+		Template:   "Closed tomorrow",
+		Recipients: []Recipient{{To: "353851111111"}},
+		Delay:      &delay,
+		Jitter:     &jitter,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	now := time.Now()
+	m.step(now)
+	got, _ := m.Get(b.ID)
+	if got.Progress.Pending != 1 || got.Progress.Failed != 0 {
+		t.Fatalf("rate limited recipient should stay pending: %+v", got.Progress)
+	}
+
+	sender.limited = nil
+	m.step(now.Add(30 * time.Second))
+	if len(sender.sent) != 0 {
+		t.Fatalf("retried before the limit allowed: %v", sender.sent)
+	}
+	m.step(now.Add(2 * time.Minute))
+	if want := "353851111111@s.whatsapp.net: Closed tomorrow"; len(sender.sent) != 1 || sender.sent[0] != want {
+		t.Errorf("sent %v after the limit, want %q", sender.sent, want)
+	}
+}
+
+func TestBroadcastPauseResumeCancel(t *testing.T) {
+	m, sender := newTestManager(t)
+	b, err := m.Create(&Request{
+		Template:   "Closed tomorrow",
+		Recipients: []Recipient{{To: "353851111111"}, {To: "353852222222"}, {To: "353853333333"}},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	later := time.Now().Add(time.Hour)
+
+	m.step(later)
+	if _, err := m.Pause(b.ID); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if _, err := m.Pause(b.ID); err != ErrInvalidState {
+		t.Errorf("pausing twice = %v, want ErrInvalidState", err)
+	}
+	m.step(later.Add(time.Hour))
+	if len(sender.sent) != 1 {
+		t.Fatalf("paused broadcast sent %d messages, want 1", len(sender.sent))
+	}
+
+	if _, err := m.Resume(b.ID); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	m.step(later.Add(2 * time.Hour))
+	got, err := m.Cancel(b.ID)
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	m.step(later.Add(3 * time.Hour))
+
+	if len(sender.sent) != 2 || got.Progress.Queued != 2 || got.Progress.Skipped != 1 {
+		t.Errorf("after cancel sent %v, progress %+v", sender.sent, got.Progress)
+	}
+	skipped, err := m.Recipients(b.ID, models.RecipientSkipped)
+	if err != nil || len(skipped) != 1 || skipped[0].Recipient != "353853333333@s.whatsapp.net" {
+		t.Errorf("skipped recipients = %+v, %v", skipped, err)
+	}
+}
+
+func TestCreateRejectsMissingVariables(t *testing.T) {
+	m, sender := newTestManager(t)
+	_, err := m.Create(&Request{
+		Template:   "Hi {{name}}, see you on {{day}}",
+		Recipients: []Recipient{{To: "353851111111", Variables: map[string]string{"day": "Monday"}}},
+	})
+	if err == nil {
+		t.Fatal("expected missing name to be rejected")
+	}
+	if list, _ := m.List(""); len(list) != 0 || len(sender.sent) != 0 {
+		t.Errorf("rejected broadcast was stored or sent")
+	}
+}
@@ -0,0 +1,34 @@
+package broadcast
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholder matches a {{variable}} in a message template
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// Render fills the {{variable}} placeholders of a template. Every variable
+// must have a value; the missing ones are reported together.
+func Render(template string, vars map[string]string) (string, error) {
+	missing := map[string]bool{}
+	text := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		name := placeholder.FindStringSubmatch(match)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing[name] = true
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("missing variables: %s", strings.Join(names, ", "))
+	}
+	return text, nil
+}
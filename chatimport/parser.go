@@ -0,0 +1,263 @@
+// Package chatimport parses the transcripts written by the WhatsApp phone
+// app's "Export chat" feature, in both the Android and the iOS layout.
+package chatimport
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateOrder is the order of the day, month and year fields in export timestamps
+type DateOrder string
+
+// Date orders found in exports. The phone writes dates in the format of its
+// locale, which is not recorded anywhere in the export.
+const (
+	DateOrderAuto DateOrder = ""
+	DateOrderDMY  DateOrder = "dmy"
+	DateOrderMDY  DateOrder = "mdy"
+	DateOrderYMD  DateOrder = "ymd"
+)
+
+// IDPrefix marks the message IDs of imported messages
+const IDPrefix = "import-"
+
+// Message is a single entry of an exported chat
+type Message struct {
+	ID           string    // stable synthetic ID, set by AssignIDs
+	Time         time.Time // minute precision on Android, second precision on iOS
+	Sender       string    // display name or phone number as shown on the phone
+	Content      string    // text, or the caption of an attachment
+	Attachment   string    // file name of an attached media file
+	MediaOmitted bool      // media was not included in the export
+	System       bool      // notices such as "Alice added Bob" that have no sender
+}
+
+// Options control how an export is parsed
+type Options struct {
+	// DateOrder overrides detection of the date field order
+	DateOrder DateOrder
+	// Location is the time zone of the phone that made the export. Defaults to
+	// the local time zone.
+	Location *time.Location
+}
+
+var (
+	// headerPattern matches the timestamp starting each message, either
+	// "04/03/2026, 09:05 - " (Android) or "[04/03/2026, 09:05:00] " (iOS)
+	headerPattern = regexp.MustCompile(`^\[?(\d{1,4})[./-](\d{1,2})[./-](\d{1,4}),? (\d{1,2})[:.](\d{2})(?:[:.](\d{2}))? ?([aApP])?\.? ?(?:[mM]\.?)?(?:\] | - )(.*)$`)
+
+	// iOS lists attachments as "<attached: 00000012-PHOTO-2026-03-04-09-05-00.jpg>"
+	attachedPattern = regexp.MustCompile(`^<attached: (.+)>$`)
+
+	// Android lists attachments as "IMG-20260304-WA0001.jpg (file attached)",
+	// with the phrase translated to the phone's language
+	fileAttachedPattern = regexp.MustCompile(`^(\S.*\.[A-Za-z0-9]{1,5}) \((?:file attached|Datei angehängt|archivo adjunto|fichier joint|file allegato|arquivo anexado|bestand bijgevoegd)\)$`)
+
+	// omittedPattern matches the placeholders used when media is left out
+	omittedPattern = regexp.MustCompile(`^(?:<Media omitted>|<Medien ausgeschlossen>|<Multimedia omitido>|<Médias omis>|<Media omessi>|<Arquivo de mídia oculto>|(?:image|video|audio|sticker|document|GIF) omitted)$`)
+)
+
+// rawMessage is a message whose timestamp has not been interpreted yet
+type rawMessage struct {
+	fields [3]int // date fields in file order
+	hour   int
+	minute int
+	second int
+	ampm   string
+	body   string
+}
+
+// Parse reads an exported chat transcript. Lines without a timestamp are
+// continuations of the previous message.
+func Parse(r io.Reader, opts Options) ([]*Message, error) {
+	var raws []*rawMessage
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := normalizeSpaces(scanner.Text())
+		if len(raws) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		raw, ok := parseHeader(line)
+		if !ok {
+			if len(raws) > 0 {
+				raws[len(raws)-1].body += "\n" + line
+			}
+			continue
+		}
+		raws = append(raws, raw)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chat export: %w", err)
+	}
+	if len(raws) == 0 {
+		return nil, fmt.Errorf("no messages found; not a WhatsApp chat export")
+	}
+
+	order := opts.DateOrder
+	if order == DateOrderAuto {
+		order = detectDateOrder(raws)
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	messages := make([]*Message, 0, len(raws))
+	for _, raw := range raws {
+		t, err := raw.time(order, loc)
+		if err != nil {
+			return nil, err
+		}
+		msg := parseBody(raw.body)
+		msg.Time = t
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// normalizeSpaces replaces the non-breaking spaces some locales use around
+// AM/PM markers with plain spaces
+func normalizeSpaces(line string) string {
+	return strings.NewReplacer("\u202f", " ", "\u00a0", " ").Replace(line)
+}
+
+// parseHeader splits a line starting with a timestamp into its fields
+func parseHeader(line string) (*rawMessage, bool) {
+	m := headerPattern.FindStringSubmatch(strings.TrimPrefix(line, "\u200e"))
+	if m == nil {
+		return nil, false
+	}
+
+	raw := &rawMessage{ampm: strings.ToLower(m[7]), body: m[8]}
+	for i := 0; i < 3; i++ {
+		raw.fields[i], _ = strconv.Atoi(m[i+1])
+	}
+	raw.hour, _ = strconv.Atoi(m[4])
+	raw.minute, _ = strconv.Atoi(m[5])
+	if m[6] != "" {
+		raw.second, _ = strconv.Atoi(m[6])
+	}
+	return raw, true
+}
+
+// detectDateOrder infers the date field order from the values seen across the
+// whole export. A field above 12 cannot be a month; when nothing tells the
+// orders apart the day-first order used by most locales is assumed.
+func detectDateOrder(raws []*rawMessage) DateOrder {
+	for _, raw := range raws {
+		if raw.fields[0] > 31 {
+			return DateOrderYMD
+		}
+	}
+	for _, raw := range raws {
+		if raw.fields[0] > 12 {
+			return DateOrderDMY
+		}
+		if raw.fields[1] > 12 {
+			return DateOrderMDY
+		}
+	}
+	return DateOrderDMY
+}
+
+// time interprets the timestamp fields of a message
+func (raw *rawMessage) time(order DateOrder, loc *time.Location) (time.Time, error) {
+	var year, month, day int
+	switch order {
+	case DateOrderDMY:
+		day, month, year = raw.fields[0], raw.fields[1], raw.fields[2]
+	case DateOrderMDY:
+		month, day, year = raw.fields[0], raw.fields[1], raw.fields[2]
+	case DateOrderYMD:
+		year, month, day = raw.fields[0], raw.fields[1], raw.fields[2]
+	default:
+		return time.Time{}, fmt.Errorf("unknown date order %q", order)
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	hour := raw.hour
+	switch raw.ampm {
+	case "a":
+		if hour == 12 {
+			hour = 0
+		}
+	case "p":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || raw.minute > 59 || raw.second > 59 {
+		return time.Time{}, fmt.Errorf("invalid timestamp %v %02d:%02d in %s order", raw.fields, raw.hour, raw.minute, order)
+	}
+	return time.Date(year, time.Month(month), day, hour, raw.minute, raw.second, 0, loc), nil
+}
+
+// parseBody splits the text after the timestamp into sender, attachment and content
+func parseBody(body string) *Message {
+	// iOS marks system notices and attachments with a left-to-right mark
+	marked := strings.HasPrefix(body, "\u200e")
+	body = strings.TrimPrefix(body, "\u200e")
+
+	sender, content, found := strings.Cut(body, ": ")
+	if !found {
+		return &Message{System: true, Content: body}
+	}
+
+	msg := &Message{Sender: sender}
+	marked = marked || strings.HasPrefix(content, "\u200e")
+	content = strings.TrimPrefix(content, "\u200e")
+
+	first, rest, _ := strings.Cut(content, "\n")
+	if m := attachedPattern.FindStringSubmatch(first); m != nil {
+		msg.Attachment = m[1]
+		content = rest
+	} else if m := fileAttachedPattern.FindStringSubmatch(first); m != nil {
+		msg.Attachment = m[1]
+		content = rest
+	} else if omittedPattern.MatchString(first) {
+		msg.MediaOmitted = true
+		content = rest
+	} else if marked {
+		// e.g. "[...] Group: Messages and calls are end-to-end encrypted."
+		return &Message{System: true, Content: content}
+	}
+
+	msg.Content = content
+	return msg
+}
+
+// AssignIDs gives every message a synthetic ID derived from the chat and the
+// message itself, so importing the same export twice yields the same IDs.
+// Identical messages sent within the same minute are told apart by their
+// position among each other.
+func AssignIDs(chatJID string, messages []*Message) {
+	seen := make(map[string]int)
+	for _, msg := range messages {
+		key := strings.Join([]string{
+			chatJID,
+			msg.Time.Format("2006-01-02T15:04:05"),
+			msg.Sender,
+			msg.Content,
+			msg.Attachment,
+		}, "\x00")
+		occurrence := seen[key]
+		seen[key]++
+
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d", key, occurrence)))
+		msg.ID = IDPrefix + hex.EncodeToString(sum[:16])
+	}
+}
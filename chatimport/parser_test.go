@@ -0,0 +1,141 @@
+package chatimport
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAndroidExport(t *testing.T) {
+	export := "\ufeff13/03/2026, 09:05 - Messages and calls are end-to-end encrypted. No one outside of this chat can read them.\n" +
+		"13/03/2026, 09:06 - Alice: Morning!\n" +
+		"Are we still on for today?\n" +
+		"\n" +
+		"Let me know\n" +
+		"13/03/2026, 09:07 - Bob: IMG-20260313-WA0001.jpg (file attached)\n" +
+		"the venue\n" +
+		"13/03/2026, 09:08 - Alice: <Media omitted>\n" +
+		"13/03/2026, 21:15 - Alice: Note: bring the keys\n"
+
+	messages, err := Parse(strings.NewReader(export), Options{Location: time.UTC})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("got %d messages, want 5", len(messages))
+	}
+
+	if !messages[0].System || messages[0].Sender != "" {
+		t.Errorf("first line should be a system notice: %+v", messages[0])
+	}
+
+	multi := messages[1]
+	if multi.Sender != "Alice" || multi.Content != "Morning!\nAre we still on for today?\n\nLet me know" {
+		t.Errorf("multi-line message parsed as %+v", multi)
+	}
+	if want := time.Date(2026, 3, 13, 9, 6, 0, 0, time.UTC); !multi.Time.Equal(want) {
+		t.Errorf("time = %v, want %v", multi.Time, want)
+	}
+
+	if messages[2].Attachment != "IMG-20260313-WA0001.jpg" || messages[2].Content != "the venue" {
+		t.Errorf("attachment parsed as %+v", messages[2])
+	}
+	if !messages[3].MediaOmitted || messages[3].Content != "" {
+		t.Errorf("omitted media parsed as %+v", messages[3])
+	}
+	if messages[4].Sender != "Alice" || messages[4].Content != "Note: bring the keys" {
+		t.Errorf("message containing a colon parsed as %+v", messages[4])
+	}
+}
+
+func TestParseIOSExport(t *testing.T) {
+	export := "[3/14/26, 9:05:12\u202fPM] Team: \u200eMessages and calls are end-to-end encrypted.\n" +
+		"\u200e[3/14/26, 9:06:00\u202fPM] +353 85 123 4567: \u200e<attached: 00000012-PHOTO-2026-03-14-21-06-00.jpg>\n" +
+		"[3/14/26, 12:01:00\u202fAM] Carol: \u200eimage omitted\n"
+
+	messages, err := Parse(strings.NewReader(export), Options{Location: time.UTC})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+
+	if !messages[0].System {
+		t.Errorf("encryption notice should be a system line: %+v", messages[0])
+	}
+	if want := time.Date(2026, 3, 14, 21, 5, 12, 0, time.UTC); !messages[0].Time.Equal(want) {
+		t.Errorf("time = %v, want %v (month-first order should be detected)", messages[0].Time, want)
+	}
+	if messages[1].Sender != "+353 85 123 4567" || messages[1].Attachment != "00000012-PHOTO-2026-03-14-21-06-00.jpg" {
+		t.Errorf("attachment parsed as %+v", messages[1])
+	}
+	if !messages[2].MediaOmitted || messages[2].Time.Hour() != 0 {
+		t.Errorf("omitted media at 12 AM parsed as %+v", messages[2])
+	}
+}
+
+func TestParseDateOrder(t *testing.T) {
+	export := "04.03.26, 10:00 - Alice: hi\n"
+
+	// 04/03 is ambiguous: day-first is assumed unless told otherwise
+	messages, err := Parse(strings.NewReader(export), Options{Location: time.UTC})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if messages[0].Time.Month() != time.March || messages[0].Time.Day() != 4 {
+		t.Errorf("ambiguous date parsed as %v, want 4 March", messages[0].Time)
+	}
+
+	messages, err = Parse(strings.NewReader(export), Options{DateOrder: DateOrderMDY, Location: time.UTC})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if messages[0].Time.Month() != time.April || messages[0].Time.Day() != 3 {
+		t.Errorf("month-first date parsed as %v, want 3 April", messages[0].Time)
+	}
+
+	if _, err := Parse(strings.NewReader("just some text\n"), Options{}); err == nil {
+		t.Error("expected an error for a file without messages")
+	}
+}
+
+func TestAssignIDsIsStable(t *testing.T) {
+	export := "04/03/2026, 10:00 - Alice: ok\n" +
+		"04/03/2026, 10:00 - Alice: ok\n" +
+		"04/03/2026, 10:01 - Bob: ok\n"
+
+	parse := func() []*Message {
+		messages, err := Parse(strings.NewReader(export), Options{Location: time.UTC})
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		AssignIDs("353851234567@s.whatsapp.net", messages)
+		return messages
+	}
+
+	first, second := parse(), parse()
+	ids := make(map[string]bool)
+	for i := range first {
+		if first[i].ID != second[i].ID {
+			t.Errorf("message %d got ID %s, then %s", i, first[i].ID, second[i].ID)
+		}
+		if !strings.HasPrefix(first[i].ID, IDPrefix) || strings.Contains(first[i].ID, "_") {
+			t.Errorf("unexpected ID format %q", first[i].ID)
+		}
+		ids[first[i].ID] = true
+	}
+	if len(ids) != len(first) {
+		t.Errorf("identical messages must get distinct IDs: %v", ids)
+	}
+
+	// IDs do not depend on the time zone the export is interpreted in
+	other, err := Parse(strings.NewReader(export), Options{Location: time.FixedZone("X", 3600)})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	AssignIDs("353851234567@s.whatsapp.net", other)
+	if other[0].ID != first[0].ID {
+		t.Errorf("ID changed with the time zone: %s vs %s", other[0].ID, first[0].ID)
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-go-mcp/accounts"
+	"whatsapp-go-mcp/auth"
+	"whatsapp-go-mcp/backup"
+	"whatsapp-go-mcp/chatimport"
+	"whatsapp-go-mcp/config"
+	"whatsapp-go-mcp/health"
+	"whatsapp-go-mcp/hours"
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/policy"
+	"whatsapp-go-mcp/ratelimit"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// command is a CLI subcommand run instead of the server
+type command struct {
+	description string
+	run         func(cfg *config.Config, args []string) error
+}
+
+// commands lists the available CLI subcommands
+var commands = map[string]command{
+	"backup": {
+		description: "Write a snapshot of the session store and every account's message database and media directory",
+		run:         runBackup,
+	},
+	"restore": {
+		description: "Restore a snapshot written by the backup command (server must be stopped)",
+		run:         runRestore,
+	},
+	"export-contact": {
+		description: "Export everything held about a contact to a zip archive",
+		run:         runExportContact,
+	},
+	"import-chat": {
+		description: "Import a chat exported from the phone (.txt or .zip)",
+		run:         runImportChat,
+	},
+	"erase-contact": {
+		description: "Erase everything held about a contact",
+		run:         runEraseContact,
+	},
+	"create-api-key": {
+		description: "Create an API key, e.g. the first admin key",
+		run:         runCreateAPIKey,
+	},
+	"revoke-api-key": {
+		description: "Revoke an API key",
+		run:         runRevokeAPIKey,
+	},
+}
+
+// runCommand runs the CLI subcommand named in args. It reports false when
+// args do not name a subcommand and the server should start instead.
+func runCommand(cfg *config.Config, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return true
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(cfg, args[1:]); err != nil {
+		log.Fatalf("❌ %s failed: %v", name, err)
+	}
+	return true
+}
+
+// printUsage prints the list of CLI subcommands
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [settings] [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Without a command the WhatsApp server is started.\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].description)
+	}
+}
+
+// enableEncryption turns on encryption at rest if a key has been configured
+func enableEncryption(cfg *config.Config, client *whatsapp.Client) error {
+	if !cfg.EncryptionEnabled() {
+		return nil
+	}
+	enc, err := models.LoadEncryptor(cfg.EncryptionKeyFile, cfg.EncryptionKEK, cfg.EncryptionActiveKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	return client.EnableEncryption(enc)
+}
+
+// enableBusinessHours sets up away messages and the after-hours bot mode if
+// business hours have been configured
+func enableBusinessHours(cfg *config.Config, client *whatsapp.Client) error {
+	if cfg.BusinessHours == "" {
+		return nil
+	}
+	calendar, err := hours.Parse(cfg.BusinessHoursTimezone, cfg.BusinessHours, cfg.BusinessHolidays)
+	if err != nil {
+		return fmt.Errorf("invalid business hours: %w", err)
+	}
+	mode, err := hours.ParseBotMode(cfg.AfterHoursBot)
+	if err != nil {
+		return err
+	}
+	client.SetBusinessHours(&hours.Policy{
+		Calendar:      calendar,
+		AwayMessage:   cfg.AwayMessage,
+		AfterHoursBot: mode,
+	})
+	return nil
+}
+
+// configureHandoff applies the human handoff settings
+func configureHandoff(cfg *config.Config, client *whatsapp.Client) {
+	keywords := whatsapp.DefaultHandoffKeywords
+	if cfg.HandoffKeywords != "" {
+		keywords = nil
+		for _, keyword := range strings.Split(cfg.HandoffKeywords, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				keywords = append(keywords, keyword)
+			}
+		}
+	}
+	client.SetHandoff(whatsapp.HandoffSettings{
+		PauseDuration: time.Duration(cfg.HandoffPauseMinutes) * time.Minute,
+		StaffGroupJID: cfg.HandoffStaffGroup,
+		Keywords:      keywords,
+	})
+}
+
+// configureSendPolicy applies the allow and deny lists. The staff group that
+// handoff notices go to and the approval admin chat are always allowed,
+// without restricting the numbers that may be messaged.
+func configureSendPolicy(cfg *config.Config, client *whatsapp.Client) error {
+	rules, err := policy.Parse(cfg.SendAllow, cfg.SendDeny, cfg.SendApproveFirstContact)
+	if err != nil {
+		return err
+	}
+	if cfg.HandoffStaffGroup != "" {
+		staffGroup, err := policy.ParsePattern(cfg.HandoffStaffGroup)
+		if err != nil {
+			return fmt.Errorf("invalid staff group: %w", err)
+		}
+		rules.Always = append(rules.Always, staffGroup)
+	}
+	if cfg.ApprovalAdminChat != "" {
+		adminChat, err := policy.ParsePattern(cfg.ApprovalAdminChat)
+		if err != nil {
+			return fmt.Errorf("invalid approval admin chat: %w", err)
+		}
+		rules.Always = append(rules.Always, adminChat)
+	}
+	client.SetSendPolicy(rules)
+	return nil
+}
+
+// configureClient applies encryption at rest, business hours, the human
+// handoff settings, the send policy and send limits to the client of an account
+func configureClient(cfg *config.Config, client *whatsapp.Client) error {
+	if err := enableEncryption(cfg, client); err != nil {
+		return fmt.Errorf("failed to enable encryption at rest: %w", err)
+	}
+	if err := enableBusinessHours(cfg, client); err != nil {
+		return fmt.Errorf("failed to configure business hours: %w", err)
+	}
+	configureHandoff(cfg, client)
+	if err := configureSendPolicy(cfg, client); err != nil {
+		return fmt.Errorf("failed to configure send policy: %w", err)
+	}
+	client.SetSendLimits(whatsapp.SendLimits{
+		PerRecipient: ratelimit.PerMinute(cfg.RateLimitPerRecipient),
+		Global:       ratelimit.PerMinute(cfg.RateLimitGlobal),
+		BotLoop: ratelimit.Limit{
+			Events: cfg.BotLoopMaxMessages,
+			Per:    time.Duration(cfg.BotLoopWindowSeconds) * time.Second,
+		},
+	})
+	return nil
+}
+
+// newProbes builds the liveness and readiness checks. Liveness only covers
+// the process itself; readiness covers the WhatsApp connection, message
+// database and media disk of every account and every dependency, with the
+// optional voice and LLM services as non-critical checks.
+func newProbes(cfg *config.Config, manager *accounts.Manager) *health.Probes {
+	llamaStackHealth := ""
+	if cfg.LlamaStackBaseURL != "" {
+		llamaStackHealth = strings.TrimSuffix(cfg.LlamaStackBaseURL, "/") + "/v1/health"
+	}
+	return &health.Probes{
+		Live: []health.Check{
+			health.DatabaseResponsive(manager.Default().Client.Database()),
+		},
+		Ready: []health.Check{
+			health.Endpoint("tts", cfg.TTSUrl, false),
+			health.Endpoint("stt", cfg.STTUrl, false),
+			health.Endpoint("llamastack", llamaStackHealth, false),
+		},
+		ReadyEach: func() []health.Check {
+			var checks []health.Check
+			for _, account := range manager.All() {
+				checks = append(checks,
+					accountCheck(account.Name, health.WhatsApp(account.Client)),
+					accountCheck(account.Name, health.DatabaseWritable(account.Client.Database())),
+					accountCheck(account.Name, health.DiskSpace("media_disk", account.MediaDir, uint64(cfg.MinFreeDiskMB)<<20)),
+				)
+			}
+			return checks
+		},
+	}
+}
+
+// accountCheck names a check after the account it covers. Checks of the
+// default account keep their plain names.
+func accountCheck(account string, check health.Check) health.Check {
+	if account != accounts.DefaultAccount {
+		check.Name += ":" + account
+	}
+	return check
+}
+
+// openClient creates a WhatsApp client for offline commands without connecting it
+func openClient(cfg *config.Config) (*whatsapp.Client, error) {
+	client, err := whatsapp.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := enableEncryption(cfg, client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// currentUser identifies who ran a CLI command for audit records
+func currentUser() string {
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return "unknown"
+}
+
+// backupSources returns the state file locations of every registered account
+func backupSources(cfg *config.Config) (backup.Sources, error) {
+	return accounts.BackupSources(cfg.DBPath, cfg.MediaDir)
+}
+
+// lockFilePath returns the path of the lock file written by a running server
+func lockFilePath(cfg *config.Config) string {
+	return cfg.DBPath + ".lock"
+}
+
+// runBackup implements the backup command
+func runBackup(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("o", fmt.Sprintf("whatsapp-backup-%s.tar.gz", time.Now().Format("20060102-150405")), "output archive path")
+	fs.Parse(args)
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *output, err)
+	}
+	defer file.Close()
+
+	src, err := backupSources(cfg)
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	manifest, err := backup.Create(file, src)
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+
+	log.Printf("✅ Backup written to %s (%d files)", *output, len(manifest.Files))
+	return nil
+}
+
+// runRestore implements the restore command
+func runRestore(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	input := fs.String("i", "", "backup archive to restore")
+	fs.Parse(args)
+
+	if *input == "" {
+		return fmt.Errorf("missing -i <archive>")
+	}
+	if err := backup.CheckNotRunning(lockFilePath(cfg)); err != nil {
+		return err
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", *input, err)
+	}
+	defer file.Close()
+
+	src, err := backupSources(cfg)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Restore(file, src)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("✅ Restored %d files from backup created at %s", len(manifest.Files), manifest.CreatedAt.Format(time.RFC3339))
+
+	// The audit log is not part of the backup, so the restore is recorded in
+	// the log as it was
+	auditDB, err := models.NewAuditDatabase(accounts.AuditDBPath(cfg.DBPath))
+	if err != nil {
+		return fmt.Errorf("backup restored, but the audit log could not be opened: %w", err)
+	}
+	defer auditDB.Close()
+	return auditDB.RecordAudit(&models.AuditEntry{
+		ActorType: models.ActorSystem,
+		Actor:     "cli:" + currentUser(),
+		Action:    "backup.restored",
+		Status:    models.AuditOK,
+		Details: map[string]string{
+			"backup_created_at": manifest.CreatedAt.Format(time.RFC3339),
+			"files":             strconv.Itoa(len(manifest.Files)),
+		},
+	})
+}
+
+// runExportContact implements the export-contact command
+func runExportContact(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export-contact", flag.ExitOnError)
+	jid := fs.String("jid", "", "contact JID or phone number")
+	output := fs.String("o", "", "output zip path (default: contact-export-<phone>.zip)")
+	fs.Parse(args)
+
+	if *jid == "" {
+		return fmt.Errorf("missing -jid <contact>")
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("contact-export-%s.zip", strings.Split(*jid, "@")[0])
+	}
+
+	client, err := openClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *output, err)
+	}
+	defer file.Close()
+
+	if err := client.ExportContactData(*jid, file, "cli", currentUser()); err != nil {
+		os.Remove(*output)
+		return err
+	}
+
+	log.Printf("✅ Contact data exported to %s", *output)
+	return nil
+}
+
+// runEraseContact implements the erase-contact command
+func runEraseContact(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("erase-contact", flag.ExitOnError)
+	jid := fs.String("jid", "", "contact JID or phone number")
+	confirm := fs.Bool("yes", false, "confirm the erasure")
+	fs.Parse(args)
+
+	if *jid == "" {
+		return fmt.Errorf("missing -jid <contact>")
+	}
+	if !*confirm {
+		return fmt.Errorf("erasure cannot be undone, pass -yes to confirm")
+	}
+	if err := backup.CheckNotRunning(lockFilePath(cfg)); err != nil {
+		// The running server keeps LLM conversation history in memory, which
+		// only the DELETE /api/contacts/{jid} endpoint can clear
+		return fmt.Errorf("%w; use DELETE /api/contacts/{jid} instead", err)
+	}
+
+	client, err := openClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	result, err := client.EraseContactData(*jid, "cli", currentUser())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("✅ Erased %s: %d messages, %d chats, %d contacts, %d transcripts, %d media files",
+		result.JID, result.Database.Messages, result.Database.Chats, result.Database.Contacts,
+		result.Database.Transcripts, result.MediaFiles)
+	return nil
+}
+
+// runImportChat implements the import-chat command
+func runImportChat(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("import-chat", flag.ExitOnError)
+	jid := fs.String("jid", "", "chat JID or phone number to import into")
+	input := fs.String("i", "", "exported chat (.txt or .zip)")
+	self := fs.String("self", "", "name the export uses for your own messages (default: the device push name)")
+	dateOrder := fs.String("date-order", "", "date field order of the export: dmy, mdy or ymd (default: detected)")
+	tz := fs.String("tz", "", "IANA time zone of the phone that made the export (default: local)")
+	fs.Parse(args)
+
+	if *jid == "" || *input == "" {
+		return fmt.Errorf("missing -jid <chat> or -i <export>")
+	}
+
+	opts := whatsapp.ImportOptions{Self: *self, DateOrder: chatimport.DateOrder(*dateOrder)}
+	if *tz != "" {
+		loc, err := time.LoadLocation(*tz)
+		if err != nil {
+			return fmt.Errorf("invalid time zone %q: %w", *tz, err)
+		}
+		opts.Location = loc
+	}
+
+	client, err := openClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	result, err := client.ImportChat(*jid, *input, opts)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("✅ Imported %d of %d messages into %s (%d duplicates, %d merged with live messages, %d system lines skipped, %d media files)",
+		result.Imported, result.Parsed, result.ChatJID, result.Duplicates, result.Merged, result.System, result.MediaFiles)
+	return nil
+}
+
+// runCreateAPIKey implements the create-api-key command
+func runCreateAPIKey(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("create-api-key", flag.ExitOnError)
+	name := fs.String("name", "", "name identifying the key")
+	scopes := fs.String("scopes", auth.ScopeAdmin, "comma-separated scopes: "+strings.Join(auth.Scopes, ", "))
+	recipients := fs.String("recipients", "", "comma-separated JIDs or phone numbers the key may send to (default: any)")
+	expiresInDays := fs.Int("expires-in-days", 0, "days until the key expires (default: never)")
+	fs.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("missing -name <name>")
+	}
+
+	client, err := openClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	req := &auth.CreateRequest{
+		Name:          *name,
+		Scopes:        splitList(*scopes),
+		ExpiresInDays: *expiresInDays,
+		CreatedBy:     "cli:" + currentUser(),
+	}
+	if *recipients != "" {
+		req.AllowedRecipients = splitList(*recipients)
+	}
+	_, key, err := auth.NewStore(client.Database()).Create(req)
+	if err != nil {
+		return err
+	}
+
+	// The key is only shown once, so print it on stdout for scripts to capture
+	fmt.Println(key)
+	return nil
+}
+
+// runRevokeAPIKey implements the revoke-api-key command
+func runRevokeAPIKey(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("revoke-api-key", flag.ExitOnError)
+	id := fs.Int64("id", 0, "ID of the key, as listed by GET /api/keys")
+	fs.Parse(args)
+
+	if *id <= 0 {
+		return fmt.Errorf("missing -id <key id>")
+	}
+
+	client, err := openClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	_, err = auth.NewStore(client.Database()).Revoke(*id)
+	return err
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
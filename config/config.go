@@ -1,58 +1,124 @@
+// Package config holds the settings of the server. Settings are read from a
+// YAML or TOML file, then from environment variables, then from command-line
+// flags, each overriding the one before. In the file a setting is named like
+// its environment variable in lowercase (tts_url for TTS_URL), and as a flag
+// with dashes (-tts-url).
 package config
 
-import (
-	"os"
-	"strconv"
-)
-
-// Config holds the application configuration
+// Config holds the application configuration. The env tag names the
+// environment variable of each setting; secret settings are redacted when the
+// configuration is shown.
 type Config struct {
-	Port      string
-	DBPath    string
-	MediaDir  string
-	LogLevel  string
-	QRCodeDir string
-	TTSUrl    string
-	STTUrl    string
+	Port      string `env:"PORT"`
+	DBPath    string `env:"WHATSAPP_DB_PATH"`
+	MediaDir  string `env:"WHATSAPP_MEDIA_DIR"`
+	LogLevel  string `env:"LOG_LEVEL"`
+	QRCodeDir string `env:"QR_CODE_DIR"`
+	TTSUrl    string `env:"TTS_URL"`
+	STTUrl    string `env:"STT_URL"`
+
+	// OpenAI key for Whisper transcription when STT_URL is not set
+	OpenAIAPIKey string `env:"OPENAI_API_KEY" secret:"true"`
+
+	// LlamaStack server and the model, tools and instructions of the bot
+	LlamaStackBaseURL         string `env:"LLAMASTACK_BASE_URL"`
+	LlamaStackAPIKey          string `env:"LLAMASTACK_API_KEY" secret:"true"`
+	LlamaStackModel           string `env:"LLAMASTACK_MODEL"`
+	LlamaStackUseResponsesAPI bool   `env:"LLAMASTACK_USE_RESPONSES_API"`
+	LlamaStackMCPToolGroup    string `env:"LLAMASTACK_MCP_TOOL_GROUP"`
+	VectorStoreName           string `env:"VECTOR_STORE_NAME"`
+	MCPURL                    string `env:"MCP_URL"`
+	MCPServerLabel            string `env:"MCP_SERVER_LABEL"`
+	ModelInstructions         string `env:"MODEL_INSTRUCTIONS"` // empty uses the built-in instructions
+
+	// Readiness fails when the media directory has less free space than this
+	MinFreeDiskMB int `env:"MIN_FREE_DISK_MB"`
+
+	// Encryption at rest
+	EncryptionKeyFile     string `env:"ENCRYPTION_KEY_FILE"`
+	EncryptionKEK         string `env:"ENCRYPTION_KEK" secret:"true"`
+	EncryptionActiveKeyID string `env:"ENCRYPTION_ACTIVE_KEY_ID"`
+
+	// Number of recent events kept for /api/events and /api/ws replay
+	EventLogSize int `env:"EVENT_LOG_SIZE"`
+
+	// Business hours and away messages
+	BusinessHours         string `env:"BUSINESS_HOURS"`
+	BusinessHoursTimezone string `env:"BUSINESS_HOURS_TZ"`
+	BusinessHolidays      string `env:"BUSINESS_HOLIDAYS"`
+	AwayMessage           string `env:"AWAY_MESSAGE"`
+	AfterHoursBot         string `env:"AFTER_HOURS_BOT"`
+
+	// Human handoff
+	HandoffPauseMinutes int    `env:"HANDOFF_PAUSE_MINUTES"`
+	HandoffStaffGroup   string `env:"HANDOFF_STAFF_GROUP"`
+	HandoffKeywords     string `env:"HANDOFF_KEYWORDS"`
+
+	// Serve the API without API keys, for local development only
+	AuthDisabled bool `env:"AUTH_DISABLED"`
+
+	// Send policy: comma-separated allow and deny lists of numbers, prefixes
+	// such as +353* and group JIDs
+	SendAllow               string `env:"SEND_ALLOW"`
+	SendDeny                string `env:"SEND_DENY"`
+	SendApproveFirstContact bool   `env:"SEND_APPROVE_FIRST_CONTACT"`
+
+	// Approval mode: off, api (sends requested through the API are drafted)
+	// or all (bot replies are drafted too). Drafts can be approved in the
+	// admin chat by writing "approve 12".
+	ApprovalMode      string `env:"APPROVAL_MODE"`
+	ApprovalAdminChat string `env:"APPROVAL_ADMIN_CHAT"`
+
+	// Send limits in messages per minute; 0 disables a limit
+	RateLimitPerKey       int `env:"RATE_LIMIT_PER_KEY"`
+	RateLimitPerRecipient int `env:"RATE_LIMIT_PER_RECIPIENT"`
+	RateLimitGlobal       int `env:"RATE_LIMIT_GLOBAL"`
+
+	// The bot stops answering a direct chat that sends more than
+	// BotLoopMaxMessages within BotLoopWindowSeconds; 0 disables detection
+	BotLoopMaxMessages   int `env:"BOT_LOOP_MAX_MESSAGES"`
+	BotLoopWindowSeconds int `env:"BOT_LOOP_WINDOW_SECONDS"`
+
+	file    string            // configuration file, if any
+	sources map[string]string // where each setting that is not a default came from
 }
 
-// LoadConfig loads configuration from environment variables
-func LoadConfig() *Config {
+// Defaults returns the configuration used when nothing is set
+func Defaults() *Config {
 	return &Config{
-		Port:      getEnv("PORT", "8080"),
-		DBPath:    getEnv("WHATSAPP_DB_PATH", "./whatsapp.db"),
-		MediaDir:  getEnv("WHATSAPP_MEDIA_DIR", "./media"),
-		LogLevel:  getEnv("LOG_LEVEL", "info"),
-		QRCodeDir: getEnv("QR_CODE_DIR", "./qr_codes"),
-		TTSUrl:    getEnv("TTS_URL", "http://localhost:8001/text-to-speech"),
-		STTUrl:    getEnv("STT_URL", ""),
-	}
-}
+		Port:      "8080",
+		DBPath:    "./whatsapp.db",
+		MediaDir:  "./media",
+		LogLevel:  "info",
+		QRCodeDir: "./qr_codes",
+		TTSUrl:    "http://localhost:8001/text-to-speech",
 
-// getEnv gets an environment variable with a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
+		LlamaStackBaseURL: "http://ragathon-team-1-ragathon-team-1.apps.llama-rag-pool-b84hp.aws.rh-ods.com",
+		LlamaStackModel:   "vllm-inference/llama-4-scout-17b-16e-w4a16",
+		VectorStoreName:   "redbank-kb-vector-store",
+		MCPURL:            "http://redbank-mcp-server:8000/mcp",
+		MCPServerLabel:    "dmcp",
 
-// getEnvInt gets an environment variable as integer with a default value
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
+		MinFreeDiskMB: 100,
+		EventLogSize:  1000,
+
+		BusinessHoursTimezone: "UTC",
+		AfterHoursBot:         "on",
+
+		HandoffPauseMinutes: 30,
+
+		ApprovalMode: "off",
+
+		RateLimitPerKey:       60,
+		RateLimitPerRecipient: 20,
+		RateLimitGlobal:       120,
+
+		BotLoopMaxMessages:   15,
+		BotLoopWindowSeconds: 60,
 	}
-	return defaultValue
 }
 
-// getEnvBool gets an environment variable as boolean with a default value
-func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
-		}
-	}
-	return defaultValue
+// EncryptionEnabled reports whether encryption at rest has been configured
+func (c *Config) EncryptionEnabled() bool {
+	return c.EncryptionKeyFile != "" || c.EncryptionKEK != ""
 }
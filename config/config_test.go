@@ -0,0 +1,75 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadLayersFileEnvAndFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(`port: 9000
+tts_url: http://tts:8001/text-to-speech
+llamastack_api_key: file-key
+rate_limit_global: 50
+send_allow:
+  - "+353851234567"
+  - "+353857654321"
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("PORT", "9001")
+	t.Setenv("LLAMASTACK_MODEL", "llama-3-2-3b-instruct")
+
+	cfg, args, err := Load([]string{"-port", "9002", "-auth-disabled", "create-api-key", "-name", "admin"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != "9002" || !cfg.AuthDisabled {
+		t.Errorf("flags did not override: port %s, auth disabled %v", cfg.Port, cfg.AuthDisabled)
+	}
+	if cfg.TTSUrl != "http://tts:8001/text-to-speech" || cfg.RateLimitGlobal != 50 || cfg.SendAllow != "+353851234567,+353857654321" {
+		t.Errorf("file settings not applied: %+v", cfg)
+	}
+	if cfg.LlamaStackModel != "llama-3-2-3b-instruct" || cfg.MediaDir != "./media" {
+		t.Errorf("env or default lost: model %s, media dir %s", cfg.LlamaStackModel, cfg.MediaDir)
+	}
+	if strings.Join(args, " ") != "create-api-key -name admin" {
+		t.Errorf("remaining args = %v", args)
+	}
+
+	view := cfg.Redacted()
+	if got := view.Settings["llamastack_api_key"]; got.Value != redacted || got.Source != SourceFile {
+		t.Errorf("secret shown as %+v", got)
+	}
+	if got := view.Settings["port"]; got.Value != "9002" || got.Source != SourceFlag {
+		t.Errorf("port shown as %+v", got)
+	}
+	if got := view.Settings["openai_api_key"]; got.Value != "" || got.Source != SourceDefault {
+		t.Errorf("unset secret shown as %+v", got)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("PORT", "http")
+	t.Setenv("RATE_LIMIT_GLOBAL", "lots")
+	t.Setenv("APPROVAL_MODE", "sometimes")
+
+	_, _, err := Load(nil, io.Discard)
+	if err == nil {
+		t.Fatal("invalid settings were accepted")
+	}
+	for _, want := range []string{"RATE_LIMIT_GLOBAL", "APPROVAL_MODE"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+
+	t.Setenv("RATE_LIMIT_GLOBAL", "")
+	if _, _, err := Load(nil, io.Discard); err == nil || !strings.Contains(err.Error(), "PORT") || !strings.Contains(err.Error(), "APPROVAL_MODE") {
+		t.Errorf("validation error = %v, want PORT and APPROVAL_MODE", err)
+	}
+}
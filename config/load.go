@@ -0,0 +1,316 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"whatsapp-go-mcp/drafts"
+	"whatsapp-go-mcp/hours"
+	"whatsapp-go-mcp/policy"
+)
+
+// Where a setting came from
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// redacted replaces the value of secret settings when they are shown
+const redacted = "[redacted]"
+
+// setting is a field of Config with its names
+type setting struct {
+	env    string // PORT
+	key    string // port, in the configuration file
+	flag   string // port, as -port
+	secret bool
+	value  reflect.Value
+}
+
+// settings lists the settings of c in declaration order
+func (c *Config) settings() []setting {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	var settings []setting
+	for i := 0; i < t.NumField(); i++ {
+		env := t.Field(i).Tag.Get("env")
+		if env == "" {
+			continue
+		}
+		key := strings.ToLower(env)
+		settings = append(settings, setting{
+			env:    env,
+			key:    key,
+			flag:   strings.ReplaceAll(key, "_", "-"),
+			secret: t.Field(i).Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return settings
+}
+
+// set parses value into the setting
+func (s setting) set(value string) error {
+	switch s.value.Kind() {
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		s.value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		s.value.SetBool(b)
+	default:
+		s.value.SetString(value)
+	}
+	return nil
+}
+
+// settingFlag holds the value of a flag until the file and environment have
+// been applied, so that flags override both
+type settingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string     { return f.value }
+func (f *settingFlag) Set(v string) error { f.value = v; return nil }
+func (f *settingFlag) IsBoolFlag() bool   { return f.isBool }
+
+// Load reads the configuration from the file named by -config or CONFIG_FILE,
+// then from environment variables, then from the flags in args, and validates
+// it. It returns the arguments left after the flags, which name a CLI
+// subcommand if any. Every problem found is reported in the error.
+func Load(args []string, output io.Writer) (*Config, []string, error) {
+	c := Defaults()
+	c.sources = make(map[string]string)
+	settings := c.settings()
+
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	flags.SetOutput(output)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file (CONFIG_FILE)")
+	values := make(map[string]*settingFlag)
+	for _, s := range settings {
+		f := &settingFlag{isBool: s.value.Kind() == reflect.Bool}
+		flags.Var(f, s.flag, "overrides "+s.env)
+		values[s.flag] = f
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	var problems []error
+	if *configFile != "" {
+		c.file = *configFile
+		problems = append(problems, c.loadFile(*configFile, settings)...)
+	}
+	for _, s := range settings {
+		if value := os.Getenv(s.env); value != "" {
+			if err := s.set(value); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", s.env, err))
+				continue
+			}
+			c.sources[s.key] = SourceEnv
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag != f.Name {
+				continue
+			}
+			if err := s.set(values[s.flag].value); err != nil {
+				problems = append(problems, fmt.Errorf("-%s: %w", s.flag, err))
+				return
+			}
+			c.sources[s.key] = SourceFlag
+		}
+	})
+
+	problems = append(problems, c.Validate()...)
+	if len(problems) > 0 {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(problems...))
+	}
+	return c, flags.Args(), nil
+}
+
+// loadFile applies the settings in a YAML or TOML file. Unknown settings are
+// reported, since they are usually misspelled.
+func (c *Config) loadFile(path string, settings []setting) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("failed to read configuration file: %w", err)}
+	}
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return []error{fmt.Errorf("configuration file %s must end in .yaml, .yml or .toml", path)}
+	}
+	if err != nil {
+		return []error{fmt.Errorf("failed to parse %s: %w", path, err)}
+	}
+
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []error
+	for _, key := range keys {
+		s, ok := byKey[strings.ToLower(key)]
+		if !ok {
+			problems = append(problems, fmt.Errorf("%s in %s: unknown setting", key, path))
+			continue
+		}
+		if err := s.set(fileValue(values[key])); err != nil {
+			problems = append(problems, fmt.Errorf("%s in %s: %w", key, path, err))
+			continue
+		}
+		c.sources[s.key] = SourceFile
+	}
+	return problems
+}
+
+// fileValue turns a value read from a file into the text of an environment
+// variable. Lists, such as the numbers of the send allow list, are joined
+// with commas.
+func fileValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Validate checks the settings and returns every problem found
+func (c *Config) Validate() []error {
+	var problems []error
+	problem := func(env, format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("%s: %s", env, fmt.Sprintf(format, args...)))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		problem("PORT", "%q is not a port number", c.Port)
+	}
+	if c.DBPath == "" {
+		problem("WHATSAPP_DB_PATH", "is required")
+	}
+	if c.MediaDir == "" {
+		problem("WHATSAPP_MEDIA_DIR", "is required")
+	}
+
+	for _, u := range []struct{ env, value string }{
+		{"TTS_URL", c.TTSUrl},
+		{"STT_URL", c.STTUrl},
+		{"LLAMASTACK_BASE_URL", c.LlamaStackBaseURL},
+		{"MCP_URL", c.MCPURL},
+	} {
+		if u.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problem(u.env, "%q is not an http or https URL", u.value)
+		}
+	}
+
+	for _, n := range []struct {
+		env   string
+		value int
+	}{
+		{"MIN_FREE_DISK_MB", c.MinFreeDiskMB},
+		{"EVENT_LOG_SIZE", c.EventLogSize},
+		{"HANDOFF_PAUSE_MINUTES", c.HandoffPauseMinutes},
+		{"RATE_LIMIT_PER_KEY", c.RateLimitPerKey},
+		{"RATE_LIMIT_PER_RECIPIENT", c.RateLimitPerRecipient},
+		{"RATE_LIMIT_GLOBAL", c.RateLimitGlobal},
+		{"BOT_LOOP_MAX_MESSAGES", c.BotLoopMaxMessages},
+		{"BOT_LOOP_WINDOW_SECONDS", c.BotLoopWindowSeconds},
+	} {
+		if n.value < 0 {
+			problem(n.env, "must not be negative")
+		}
+	}
+
+	if c.EncryptionActiveKeyID != "" && !c.EncryptionEnabled() {
+		problem("ENCRYPTION_ACTIVE_KEY_ID", "is set but neither ENCRYPTION_KEY_FILE nor ENCRYPTION_KEK is")
+	}
+	if c.BusinessHours != "" {
+		if _, err := hours.Parse(c.BusinessHoursTimezone, c.BusinessHours, c.BusinessHolidays); err != nil {
+			problem("BUSINESS_HOURS", "%v", err)
+		}
+	}
+	if _, err := hours.ParseBotMode(c.AfterHoursBot); err != nil {
+		problem("AFTER_HOURS_BOT", "%v", err)
+	}
+	if _, err := policy.Parse(c.SendAllow, c.SendDeny, c.SendApproveFirstContact); err != nil {
+		problem("SEND_ALLOW/SEND_DENY", "%v", err)
+	}
+	if !drafts.ValidMode(c.ApprovalMode) {
+		problem("APPROVAL_MODE", "%q is not off, api or all", c.ApprovalMode)
+	}
+	return problems
+}
+
+// View is the configuration as shown by /api/admin/config
+type View struct {
+	File     string                 `json:"file,omitempty"`
+	Settings map[string]SettingView `json:"settings"`
+}
+
+// SettingView is a setting with where it came from. Secret settings that are
+// set show as [redacted].
+type SettingView struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source" example:"env"`
+	Env    string      `json:"env" example:"PORT"`
+}
+
+// Redacted returns the configuration with secrets hidden
+func (c *Config) Redacted() *View {
+	view := &View{File: c.file, Settings: make(map[string]SettingView)}
+	for _, s := range c.settings() {
+		source := c.sources[s.key]
+		if source == "" {
+			source = SourceDefault
+		}
+		value := s.value.Interface()
+		if s.secret && !s.value.IsZero() {
+			value = redacted
+		}
+		view.Settings[s.key] = SettingView{Value: value, Source: source, Env: s.env}
+	}
+	return view
+}
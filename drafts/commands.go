@@ -0,0 +1,117 @@
+package drafts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"whatsapp-go-mcp/models"
+)
+
+// commandHelp lists the commands understood in the admin chat
+const commandHelp = `Draft commands:
+drafts - list pending drafts
+show 12 - preview draft 12
+approve 12 - send draft 12
+reject 12 <reason> - discard draft 12`
+
+// HandleCommand runs a command written in the admin chat, such as
+// "approve 12", and returns the reply. It reports false if the text is not a
+// draft command, so ordinary chatter in the admin chat is left alone.
+func (m *Manager) HandleCommand(text, reviewer string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", false
+	}
+	command := strings.ToLower(fields[0])
+
+	switch command {
+	case "drafts":
+		if len(fields) != 1 {
+			return "", false
+		}
+		return m.pendingSummary(), true
+	case "help":
+		if len(fields) != 1 {
+			return "", false
+		}
+		return commandHelp, true
+	case "show", "approve", "reject":
+	default:
+		return "", false
+	}
+
+	if len(fields) < 2 {
+		return "", false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(fields[1], "#"), 10, 64)
+	if err != nil || id <= 0 {
+		return "", false
+	}
+
+	switch command {
+	case "show":
+		d, err := m.Get(id)
+		if err != nil {
+			return commandError(id, err), true
+		}
+		return Preview(d), true
+	case "approve":
+		if len(fields) != 2 {
+			return "", false
+		}
+		d, err := m.Approve(id, reviewer)
+		if err != nil {
+			return commandError(id, err), true
+		}
+		return fmt.Sprintf("✅ Draft %d to %s approved and queued", d.ID, d.Recipient), true
+	default:
+		reason := strings.TrimSpace(strings.Join(fields[2:], " "))
+		d, err := m.Reject(id, reviewer, reason)
+		if err != nil {
+			return commandError(id, err), true
+		}
+		return fmt.Sprintf("🗑️ Draft %d to %s rejected", d.ID, d.Recipient), true
+	}
+}
+
+// pendingSummary lists pending drafts with the first line of each
+func (m *Manager) pendingSummary() string {
+	pending, err := m.List(models.DraftPending)
+	if err != nil {
+		return fmt.Sprintf("❌ Could not list drafts: %v", err)
+	}
+	if len(pending) == 0 {
+		return "No drafts are waiting for approval"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d draft(s) waiting for approval:", len(pending))
+	for _, d := range pending {
+		summary := d.Text
+		if d.Filename != "" {
+			summary = strings.TrimSpace(fmt.Sprintf("[%s] %s", d.Filename, summary))
+		}
+		if i := strings.IndexByte(summary, '\n'); i >= 0 {
+			summary = summary[:i] + " …"
+		}
+		if len([]rune(summary)) > 80 {
+			summary = string([]rune(summary)[:80]) + "…"
+		}
+		fmt.Fprintf(&b, "\n#%d to %s: %s", d.ID, d.Recipient, summary)
+	}
+	return b.String()
+}
+
+// commandError describes why a command on a draft failed
+func commandError(id int64, err error) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Sprintf("❌ There is no draft %d", id)
+	case errors.Is(err, ErrNotPending):
+		return fmt.Sprintf("❌ Draft %d has already been reviewed", id)
+	default:
+		return fmt.Sprintf("❌ Draft %d: %v", id, err)
+	}
+}
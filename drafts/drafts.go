@@ -0,0 +1,299 @@
+// Package drafts holds outgoing messages for a person to review. In
+// approval mode, messages requested through the API or written by the bot
+// are parked as drafts instead of being sent; an approver can edit them and
+// then approve or reject each one. Approved drafts are handed to the client's
+// outbox, so they go through the send policy, rate limits and retries like
+// any other message.
+package drafts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/models"
+)
+
+// Approval modes, set with APPROVAL_MODE
+const (
+	ModeOff = "off" // everything is sent straight away
+	ModeAPI = "api" // sends requested through the API are drafted
+	ModeAll = "all" // bot replies are drafted as well
+)
+
+// Errors returned when managing drafts
+var (
+	ErrInvalidDraft = errors.New("invalid draft")
+	ErrNotPending   = errors.New("draft has already been reviewed")
+)
+
+// Sender queues messages for delivery and decides which files may be sent.
+// It is implemented by *whatsapp.Client.
+type Sender interface {
+	QueueText(recipient, text, idempotencyKey string) (*models.OutboxMessage, error)
+	QueueAudio(recipient, filePath, idempotencyKey string) (*models.OutboxMessage, error)
+	QueueFile(recipient, filePath, caption, idempotencyKey string) (*models.OutboxMessage, error)
+	CheckMediaPath(path string) (string, error)
+}
+
+// Manager stores drafts and sends them once approved
+type Manager struct {
+	db       *models.Database
+	sender   Sender
+	mode     string
+	mediaDir string // where voice notes and files of drafts are kept
+}
+
+// New creates a draft manager backed by the message database. Files
+// attached to drafts are copied into mediaDir.
+func New(db *models.Database, sender Sender, mode, mediaDir string) *Manager {
+	if mode == "" {
+		mode = ModeOff
+	}
+	return &Manager{db: db, sender: sender, mode: mode, mediaDir: mediaDir}
+}
+
+// ValidMode reports whether mode is a known approval mode
+func ValidMode(mode string) bool {
+	return mode == ModeOff || mode == ModeAPI || mode == ModeAll
+}
+
+// Mode returns the approval mode
+func (m *Manager) Mode() string {
+	return m.mode
+}
+
+// HoldsAPISends reports whether sends requested through the API are drafted
+func (m *Manager) HoldsAPISends() bool {
+	return m != nil && (m.mode == ModeAPI || m.mode == ModeAll)
+}
+
+// HoldsBotReplies reports whether bot replies are drafted
+func (m *Manager) HoldsBotReplies() bool {
+	return m != nil && m.mode == ModeAll
+}
+
+// Create validates and stores a new pending draft. A voice note or file is
+// copied from MediaPath, so the caller may remove it afterwards.
+func (m *Manager) Create(d *models.Draft) error {
+	if err := m.prepare(d); err != nil {
+		return err
+	}
+	if err := m.attachMedia(d); err != nil {
+		return err
+	}
+	if err := m.db.CreateDraft(d); err != nil {
+		m.removeMedia(d)
+		return err
+	}
+	log.Printf("📝 Drafted %s message %d to %s for approval (%s)", d.Kind, d.ID, d.Recipient, d.Source)
+	return nil
+}
+
+// CreateUpload stores a new pending voice note or file draft whose content
+// was uploaded rather than taken from the media directory. MediaPath names
+// the upload.
+func (m *Manager) CreateUpload(d *models.Draft, upload io.Reader) error {
+	if err := m.prepare(d); err != nil {
+		return err
+	}
+	if d.Kind == models.OutboxText {
+		return fmt.Errorf("%w: uploads need the audio or file kind", ErrInvalidDraft)
+	}
+	if err := m.storeMedia(d, upload); err != nil {
+		return err
+	}
+	if err := m.db.CreateDraft(d); err != nil {
+		m.removeMedia(d)
+		return err
+	}
+	log.Printf("📝 Drafted %s message %d to %s for approval (%s)", d.Kind, d.ID, d.Recipient, d.Source)
+	return nil
+}
+
+// Get returns a draft by ID
+func (m *Manager) Get(id int64) (*models.Draft, error) {
+	return m.db.GetDraft(id)
+}
+
+// List returns drafts with the given status, or all drafts, oldest first
+func (m *Manager) List(status string) ([]*models.Draft, error) {
+	return m.db.GetDrafts(status)
+}
+
+// Edit replaces the text, or caption, of a pending draft
+func (m *Manager) Edit(id int64, text, editedBy string) (*models.Draft, error) {
+	d, err := m.db.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if d.Kind == models.OutboxText && strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("%w: text is required", ErrInvalidDraft)
+	}
+	if d.Kind == models.OutboxAudio && text != "" {
+		return nil, fmt.Errorf("%w: voice notes have no text", ErrInvalidDraft)
+	}
+	ok, err := m.db.EditDraft(id, text, editedBy)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotPending
+	}
+	return m.db.GetDraft(id)
+}
+
+// Approve sends a pending draft through the outbox. If it cannot be queued,
+// for example because the send policy blocks the recipient, the draft goes
+// back to pending with the error recorded.
+func (m *Manager) Approve(id int64, reviewedBy string) (*models.Draft, error) {
+	ok, err := m.db.ReviewDraft(id, models.DraftApproved, reviewedBy, "")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if _, err := m.db.GetDraft(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotPending
+	}
+	d, err := m.db.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The idempotency key ties the outbox entry to the draft, so approving
+	// it again after a failure never sends it twice
+	key := fmt.Sprintf("draft-%d", d.ID)
+	var queued *models.OutboxMessage
+	switch d.Kind {
+	case models.OutboxAudio:
+		queued, err = m.sender.QueueAudio(d.Recipient, d.MediaPath, key)
+	case models.OutboxFile:
+		queued, err = m.sender.QueueFile(d.Recipient, d.MediaPath, d.Text, key)
+	default:
+		queued, err = m.sender.QueueText(d.Recipient, d.Text, key)
+	}
+	if err != nil {
+		log.Printf("❌ Approved draft %d to %s could not be queued: %v", d.ID, d.Recipient, err)
+		if reopenErr := m.db.ReopenDraft(d.ID, err.Error()); reopenErr != nil {
+			log.Printf("❌ Failed to reopen draft %d: %v", d.ID, reopenErr)
+		}
+		return nil, err
+	}
+
+	if err := m.db.RecordDraftQueued(d.ID, queued.ID); err != nil {
+		log.Printf("❌ Failed to record outbox message of draft %d: %v", d.ID, err)
+	}
+	d.OutboxID = queued.ID
+	log.Printf("✅ Draft %d to %s approved by %s and queued as outbox message %d (%s)",
+		d.ID, d.Recipient, reviewedBy, queued.ID, queued.Status)
+	return d, nil
+}
+
+// Reject discards a pending draft
+func (m *Manager) Reject(id int64, reviewedBy, reason string) (*models.Draft, error) {
+	ok, err := m.db.ReviewDraft(id, models.DraftRejected, reviewedBy, reason)
+	if err != nil {
+		return nil, err
+	}
+	d, err := m.db.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotPending
+	}
+	m.removeMedia(d)
+	log.Printf("🗑️ Draft %d to %s rejected by %s", d.ID, d.Recipient, reviewedBy)
+	return d, nil
+}
+
+// prepare validates a draft and normalizes its recipient
+func (m *Manager) prepare(d *models.Draft) error {
+	jid, err := types.ParseJID(d.Recipient)
+	if err != nil || jid.User == "" {
+		return fmt.Errorf("%w: invalid recipient %q", ErrInvalidDraft, d.Recipient)
+	}
+	d.Recipient = jid.String()
+
+	switch d.Kind {
+	case "":
+		d.Kind = models.OutboxText
+		fallthrough
+	case models.OutboxText:
+		if strings.TrimSpace(d.Text) == "" {
+			return fmt.Errorf("%w: text is required", ErrInvalidDraft)
+		}
+		d.MediaPath, d.Filename = "", ""
+	case models.OutboxAudio, models.OutboxFile:
+		if d.MediaPath == "" {
+			return fmt.Errorf("%w: a file is required for %s messages", ErrInvalidDraft, d.Kind)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidDraft, d.Kind)
+	}
+	return nil
+}
+
+// attachMedia copies the voice note or file of a draft into the media
+// directory and points MediaPath at the copy
+func (m *Manager) attachMedia(d *models.Draft) error {
+	if d.MediaPath == "" {
+		return nil
+	}
+	path, err := m.sender.CheckMediaPath(d.MediaPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDraft, err)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDraft, err)
+	}
+	defer src.Close()
+	return m.storeMedia(d, src)
+}
+
+// storeMedia writes the voice note or file of a draft into the media
+// directory and points MediaPath at it
+func (m *Manager) storeMedia(d *models.Draft, src io.Reader) error {
+	if err := os.MkdirAll(m.mediaDir, 0755); err != nil {
+		return fmt.Errorf("failed to create draft media directory: %w", err)
+	}
+	if d.Filename == "" {
+		d.Filename = filepath.Base(d.MediaPath)
+	}
+	dst := filepath.Join(m.mediaDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(d.MediaPath)))
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	d.MediaPath = dst
+	return nil
+}
+
+// removeMedia deletes the stored voice note or file of a draft
+func (m *Manager) removeMedia(d *models.Draft) {
+	if d.MediaPath == "" {
+		return
+	}
+	if err := os.Remove(d.MediaPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("⚠️ Failed to remove draft media %s: %v", d.MediaPath, err)
+	}
+}
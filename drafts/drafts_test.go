@@ -0,0 +1,134 @@
+package drafts
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+)
+
+// fakeSender records queued texts and can be made to fail
+type fakeSender struct {
+	texts []string
+	err   error
+}
+
+func (f *fakeSender) queue(recipient string) (*models.OutboxMessage, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.OutboxMessage{ID: int64(len(f.texts)), Recipient: recipient, Status: models.OutboxQueued}, nil
+}
+
+func (f *fakeSender) QueueText(recipient, text, key string) (*models.OutboxMessage, error) {
+	if f.err == nil {
+		f.texts = append(f.texts, text)
+	}
+	return f.queue(recipient)
+}
+
+func (f *fakeSender) QueueAudio(recipient, filePath, key string) (*models.OutboxMessage, error) {
+	return f.queue(recipient)
+}
+
+func (f *fakeSender) QueueFile(recipient, filePath, caption, key string) (*models.OutboxMessage, error) {
+	return f.queue(recipient)
+}
+
+func (f *fakeSender) CheckMediaPath(path string) (string, error) {
+	return path, nil
+}
+
+func newManager(t *testing.T, sender Sender) *Manager {
+	t.Helper()
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db, sender, ModeAPI, t.TempDir())
+}
+
+func TestOnlyApprovedDraftsAreSent(t *testing.T) {
+	sender := &fakeSender{}
+	m := newManager(t, sender)
+
+	d := &models.Draft{Recipient: "353851234567@s.whatsapp.net", Text: "Your order has shipped.\nThanks!", Source: models.DraftFromAPI}
+	if err := m.Create(d); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if len(sender.texts) != 0 {
+		t.Fatalf("draft was sent before approval: %v", sender.texts)
+	}
+
+	edited, err := m.Edit(d.ID, "Your order has shipped today.\nThanks!", "api-key:support")
+	if err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	preview := Preview(edited)
+	for _, want := range []string{"To: 353851234567@s.whatsapp.net", "-Your order has shipped.", "+Your order has shipped today.", " Thanks!"} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("preview is missing %q:\n%s", want, preview)
+		}
+	}
+
+	if reply, ok := m.HandleCommand("approve 1", "admin"); !ok || !strings.Contains(reply, "approved") {
+		t.Fatalf("approve command = %q, %v", reply, ok)
+	}
+	if len(sender.texts) != 1 || sender.texts[0] != "Your order has shipped today.\nThanks!" {
+		t.Fatalf("sent %v, want the edited text once", sender.texts)
+	}
+	if _, err := m.Approve(d.ID, "admin"); !errors.Is(err, ErrNotPending) {
+		t.Errorf("approving twice = %v, want ErrNotPending", err)
+	}
+	if _, err := m.Edit(d.ID, "too late", "admin"); !errors.Is(err, ErrNotPending) {
+		t.Errorf("editing an approved draft = %v, want ErrNotPending", err)
+	}
+
+	rejected := &models.Draft{Recipient: "353851234567@s.whatsapp.net", Text: "Unreviewed text", Source: models.DraftFromBot}
+	if err := m.Create(rejected); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, ok := m.HandleCommand("reject 2 wrong tone", "admin"); !ok {
+		t.Fatal("reject command was not recognised")
+	}
+	got, _ := m.Get(rejected.ID)
+	if got.Status != models.DraftRejected || got.RejectReason != "wrong tone" || len(sender.texts) != 1 {
+		t.Errorf("rejected draft: %+v, sent %v", got, sender.texts)
+	}
+
+	if _, ok := m.HandleCommand("approve the plan for Monday", "admin"); ok {
+		t.Error("ordinary chatter was taken for a command")
+	}
+}
+
+func TestFailedApprovalReopensDraft(t *testing.T) {
+	sender := &fakeSender{err: errors.New("send blocked by policy")}
+	m := newManager(t, sender)
+
+	d := &models.Draft{Recipient: "353851234567@s.whatsapp.net", Text: "Hello", Source: models.DraftFromAPI}
+	if err := m.Create(d); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := m.Approve(d.ID, "admin"); err == nil {
+		t.Fatal("Approve succeeded although the message could not be queued")
+	}
+	got, _ := m.Get(d.ID)
+	if got.Status != models.DraftPending || got.LastError == "" {
+		t.Errorf("draft after failed approval: %+v", got)
+	}
+
+	for _, invalid := range []*models.Draft{
+		{Recipient: "353851234567", Text: "not a JID"},
+		{Recipient: "353851234567@s.whatsapp.net", Text: "  "},
+		{Recipient: "353851234567@s.whatsapp.net", Kind: models.OutboxFile},
+	} {
+		if err := m.Create(invalid); !errors.Is(err, ErrInvalidDraft) {
+			t.Errorf("Create(%+v) = %v, want ErrInvalidDraft", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package drafts
+
+import (
+	"fmt"
+	"strings"
+
+	"whatsapp-go-mcp/models"
+)
+
+// Preview renders a draft as plain text for review. Edited drafts end with a
+// unified-style line diff of the text as drafted against the current text.
+func Preview(d *models.Draft) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Draft #%d (%s)\n", d.ID, d.Status)
+	fmt.Fprintf(&b, "To: %s\n", d.Recipient)
+	fmt.Fprintf(&b, "Kind: %s\n", d.Kind)
+	if d.Filename != "" {
+		fmt.Fprintf(&b, "Attachment: %s\n", d.Filename)
+	}
+	if d.Source != "" {
+		fmt.Fprintf(&b, "Source: %s\n", d.Source)
+	}
+	if d.RequestedBy != "" {
+		fmt.Fprintf(&b, "Requested by: %s\n", d.RequestedBy)
+	}
+	if d.LastError != "" {
+		fmt.Fprintf(&b, "Last error: %s\n", d.LastError)
+	}
+	b.WriteString("\n")
+	b.WriteString(d.Text)
+	if !strings.HasSuffix(d.Text, "\n") {
+		b.WriteString("\n")
+	}
+
+	if d.Text != d.OriginalText {
+		b.WriteString("\n--- drafted\n+++ edited\n")
+		for _, line := range diffLines(splitLines(d.OriginalText), splitLines(d.Text)) {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// splitLines splits text into lines, ignoring a trailing newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the lines of a and b prefixed with " " when kept, "-"
+// when removed and "+" when added, using a longest common subsequence
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+"+b[j])
+	}
+	return out
+}
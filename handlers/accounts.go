@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/accounts"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// CreateAccountRequest represents a request to add an account
+type CreateAccountRequest struct {
+	Name string `json:"name" example:"sales"`
+}
+
+// writeAccountError maps account errors to HTTP status codes
+func writeAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, accounts.ErrInvalidAccount):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, accounts.ErrAccountNotFound):
+		http.Error(w, "Account not found", http.StatusNotFound)
+	case errors.Is(err, accounts.ErrAccountExists), errors.Is(err, accounts.ErrDefaultAccount),
+		errors.Is(err, whatsapp.ErrRestoreInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("❌ Account operation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleCreateAccount adds an account and starts pairing it
+// @Summary Add an account
+// @Description Register another WhatsApp number with its own message database and media directory, and start pairing it. Link it with GET /api/pairing/qr?account={name} or POST /api/pairing/phone?account={name}.
+// @Tags Accounts
+// @Accept json
+// @Produce json
+// @Param request body CreateAccountRequest true "Account name: up to 32 lowercase letters, digits, - or _"
+// @Success 201 {object} accounts.Info "Account, waiting to be paired"
+// @Failure 400 {object} map[string]string "Invalid account name"
+// @Failure 409 {object} map[string]string "Account already exists"
+// @Router /api/accounts [post]
+func HandleCreateAccount(w http.ResponseWriter, r *http.Request, manager *accounts.Manager) {
+	var req CreateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	account, err := manager.Add(req.Name, requesterFromRequest(r))
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account.Info())
+}
+
+// HandleListAccounts lists the accounts
+// @Summary List accounts
+// @Description Every WhatsApp number served by this server with its JID and connection state. Other endpoints act on the default account unless given ?account={name}.
+// @Tags Accounts
+// @Produce json
+// @Success 200 {array} accounts.Info "Accounts, the default account first"
+// @Router /api/accounts [get]
+func HandleListAccounts(w http.ResponseWriter, r *http.Request, manager *accounts.Manager) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manager.List())
+}
+
+// HandleGetAccount describes an account
+// @Summary Get an account
+// @Tags Accounts
+// @Produce json
+// @Param name path string true "Account name"
+// @Success 200 {object} accounts.Info "Account"
+// @Failure 404 {object} map[string]string "Account not found"
+// @Router /api/accounts/{name} [get]
+func HandleGetAccount(w http.ResponseWriter, r *http.Request, manager *accounts.Manager) {
+	account, err := manager.Get(mux.Vars(r)["name"])
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account.Info())
+}
+
+// HandleDeleteAccount removes an account
+// @Summary Remove an account
+// @Description Unlink the number from this server and stop serving it. Its message database and media directory are kept on disk. The default account cannot be removed.
+// @Tags Accounts
+// @Param name path string true "Account name"
+// @Success 204 "Account removed"
+// @Failure 404 {object} map[string]string "Account not found"
+// @Failure 409 {object} map[string]string "The default account cannot be removed"
+// @Router /api/accounts/{name} [delete]
+func HandleDeleteAccount(w http.ResponseWriter, r *http.Request, manager *accounts.Manager) {
+	if err := manager.Remove(r.Context(), mux.Vars(r)["name"]); err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/auth"
+	"whatsapp-go-mcp/models"
+)
+
+// CreateAPIKeyResponse is a new API key. The key is only ever shown here.
+type CreateAPIKeyResponse struct {
+	Key string `json:"key" example:"wak_3q2x..."`
+	*models.APIKey
+}
+
+// AllowRecipient checks that the request's API key may send to recipient,
+// and writes a 403 response if not
+func AllowRecipient(w http.ResponseWriter, r *http.Request, recipient string) bool {
+	audit.FromRequest(r).Recipient = recipient
+	if auth.AllowsRecipient(auth.FromRequest(r), recipient) {
+		return true
+	}
+	http.Error(w, fmt.Sprintf("Forbidden: API key may not send to %s", recipient), http.StatusForbidden)
+	return false
+}
+
+// AllowWithoutApproval checks that the request's API key may schedule or
+// broadcast messages, which are never drafted. While held is set, API sends
+// need approval, so only admin keys may; a 403 response is written if not.
+func AllowWithoutApproval(w http.ResponseWriter, r *http.Request, held bool) bool {
+	if k := auth.FromRequest(r); !held || k == nil || auth.HasScope(k, auth.ScopeAdmin) {
+		return true
+	}
+	http.Error(w, "Forbidden: sends need approval, so scheduling and broadcasting need an admin key", http.StatusForbidden)
+	return false
+}
+
+// allowMedia checks that the request's API key may send files, for routes
+// that send text unless given a media path, and writes a 403 response if not
+func allowMedia(w http.ResponseWriter, r *http.Request) bool {
+	if k := auth.FromRequest(r); k == nil || auth.HasScope(k, auth.ScopeSendMedia) {
+		return true
+	}
+	http.Error(w, fmt.Sprintf("Forbidden: API key lacks the %s scope", auth.ScopeSendMedia), http.StatusForbidden)
+	return false
+}
+
+// apiKeyID parses the id path variable, writing a 400 response if invalid
+func apiKeyID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeAPIKeyError maps key store errors to HTTP status codes
+func writeAPIKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidKeyRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "API key not found", http.StatusNotFound)
+	default:
+		log.Printf("❌ API key operation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleCreateAPIKey creates an API key
+// @Summary Create an API key
+// @Description Create a key with the given scopes: read:messages, send:text, send:media, mcp or admin (which grants all). Keys restricted to allowed_recipients may only send to those contacts or groups. The key is returned once and only its hash is stored.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body auth.CreateRequest true "Key name, scopes and optional recipients and expiry"
+// @Success 201 {object} CreateAPIKeyResponse "The new key"
+// @Failure 400 {object} map[string]string "Invalid name, scope or recipient"
+// @Router /api/keys [post]
+func HandleCreateAPIKey(w http.ResponseWriter, r *http.Request, store *auth.Store) {
+	var req auth.CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.CreatedBy = requesterFromRequest(r)
+
+	k, key, err := store.Create(&req)
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{Key: key, APIKey: k})
+}
+
+// HandleListAPIKeys lists the API keys
+// @Summary List API keys
+// @Description Every key, including revoked and expired ones, newest first. Keys are identified by their prefix; the keys themselves cannot be retrieved.
+// @Tags Auth
+// @Produce json
+// @Success 200 {array} models.APIKey "API keys"
+// @Router /api/keys [get]
+func HandleListAPIKeys(w http.ResponseWriter, r *http.Request, store *auth.Store) {
+	keys, err := store.List()
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// HandleGetAPIKey describes an API key
+// @Summary Get an API key
+// @Tags Auth
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} models.APIKey "API key"
+// @Failure 404 {object} map[string]string "API key not found"
+// @Router /api/keys/{id} [get]
+func HandleGetAPIKey(w http.ResponseWriter, r *http.Request, store *auth.Store) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+	k, err := store.Get(id)
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(k)
+}
+
+// HandleRevokeAPIKey revokes an API key
+// @Summary Revoke an API key
+// @Description The key stops working immediately. It stays listed with its revocation time.
+// @Tags Auth
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} models.APIKey "Revoked key"
+// @Failure 404 {object} map[string]string "API key not found"
+// @Router /api/keys/{id} [delete]
+func HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request, store *auth.Store) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+	k, err := store.Revoke(id)
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(k)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/models"
+)
+
+// auditFilter parses the filters shared by the audit endpoints
+func auditFilter(w http.ResponseWriter, r *http.Request) (models.AuditFilter, bool) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Account:   query.Get("account"),
+		ActorType: query.Get("actor_type"),
+		Actor:     query.Get("actor"),
+		Action:    query.Get("action"),
+		Recipient: query.Get("recipient"),
+		Status:    query.Get("status"),
+	}
+	for name, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s, use RFC 3339", name), http.StatusBadRequest)
+				return filter, false
+			}
+			*dst = &t
+		}
+	}
+	if before := query.Get("before_id"); before != "" {
+		id, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid before_id", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.BeforeID = id
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.Limit = n
+	}
+	return filter, true
+}
+
+// HandleListAudit lists audit log entries
+// @Summary List audit log entries
+// @Description Who did what, newest first: API requests with the API key that made them, messages queued, blocked, sent and failed with their send policy decision, bot replies with the LLM model and tool calls, and admin chat commands. Message text is never recorded.
+// @Tags Audit
+// @Produce json
+// @Param account query string false "Only entries of this account"
+// @Param actor_type query string false "Only entries by api_key, anonymous, bot, admin_chat or system actors"
+// @Param actor query string false "Only entries by this API key name or JID"
+// @Param action query string false "Only this action, such as api.request, message.queued, message.blocked, message.sent, message.failed or bot.reply"
+// @Param recipient query string false "Only entries about this JID"
+// @Param status query string false "Only ok, denied or error entries"
+// @Param since query string false "Only entries at or after this time (RFC 3339)"
+// @Param until query string false "Only entries before this time (RFC 3339)"
+// @Param before_id query int false "Only entries older than this ID, for paging"
+// @Param limit query int false "Maximum number of entries (default 100)"
+// @Success 200 {array} models.AuditEntry "Entries"
+// @Failure 400 {object} map[string]string "Invalid filter"
+// @Router /api/audit [get]
+func HandleListAudit(w http.ResponseWriter, r *http.Request, auditLog *audit.Log) {
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+
+	entries, err := auditLog.Query(filter)
+	if err != nil {
+		log.Printf("❌ Failed to query audit log: %v", err)
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []*models.AuditEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// HandleExportAudit streams audit log entries as JSON Lines
+// @Summary Export the audit log
+// @Description Download the entries matching the filters, oldest first, one JSON object per line. Without a limit every matching entry is exported.
+// @Tags Audit
+// @Produce json
+// @Param account query string false "Only entries of this account"
+// @Param actor_type query string false "Only entries by api_key, anonymous, bot, admin_chat or system actors"
+// @Param actor query string false "Only entries by this API key name or JID"
+// @Param action query string false "Only this action"
+// @Param recipient query string false "Only entries about this JID"
+// @Param status query string false "Only ok, denied or error entries"
+// @Param since query string false "Only entries at or after this time (RFC 3339)"
+// @Param until query string false "Only entries before this time (RFC 3339)"
+// @Param limit query int false "Maximum number of entries"
+// @Success 200 {file} file "Audit log as JSON Lines"
+// @Failure 400 {object} map[string]string "Invalid filter"
+// @Router /api/audit/export [get]
+func HandleExportAudit(w http.ResponseWriter, r *http.Request, auditLog *audit.Log) {
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("audit-%s.jsonl", time.Now().Format("20060102-150405"))))
+
+	if err := auditLog.Export(w, filter); err != nil {
+		// Errors after streaming has started can only be logged; the status is already sent
+		log.Printf("❌ Failed to export audit log: %v", err)
+	}
+}
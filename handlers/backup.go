@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-go-mcp/accounts"
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/backup"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// RestoreResponse represents the response from a restore operation
+type RestoreResponse struct {
+	Success  bool             `json:"success" example:"true"`
+	Message  string           `json:"message" example:"Backup restored, reconnecting with the restored sessions"`
+	Manifest *backup.Manifest `json:"manifest,omitempty"`
+}
+
+// HandleBackup streams a snapshot of the session store and of the message
+// database and media directory of every account
+// @Summary Create a backup
+// @Description Stream a gzip-compressed tar archive with a consistent snapshot of the session store shared by the accounts, and of the message database and media directory of every account. The account parameter is ignored.
+// @Tags Admin
+// @Produce application/gzip
+// @Success 200 {file} file "Backup archive"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/admin/backup [post]
+func HandleBackup(w http.ResponseWriter, r *http.Request, manager *accounts.Manager) {
+	filename := fmt.Sprintf("whatsapp-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	log.Printf("💾 Creating backup %s", filename)
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	manifest, err := manager.Backup(w)
+	if err != nil {
+		// Headers are already sent, so the client sees a truncated archive
+		log.Printf("❌ Failed to create backup: %v", err)
+		return
+	}
+
+	log.Printf("✅ Backup created with %d files", len(manifest.Files))
+}
+
+// HandleRestore restores a backup archive produced by HandleBackup
+// @Summary Restore a backup
+// @Description Validate a backup archive against its manifest and restore every account from it. Refused unless every account is disconnected and not pairing; no reconnection is attempted during the restore, and the accounts reconnect with the restored sessions afterwards. The account parameter is ignored.
+// @Tags Admin
+// @Accept application/gzip
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file false "Backup archive (when using multipart/form-data)"
+// @Success 200 {object} RestoreResponse "Backup restored"
+// @Failure 400 {object} RestoreResponse "Invalid backup archive"
+// @Failure 409 {object} RestoreResponse "An account is connected or a restore is in progress"
+// @Failure 500 {object} RestoreResponse "Restored, but the accounts could not be reloaded"
+// @Router /api/admin/restore [post]
+func HandleRestore(w http.ResponseWriter, r *http.Request, manager *accounts.Manager) {
+	var archive io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			log.Printf("❌ Failed to get uploaded backup: %v", err)
+			http.Error(w, "Failed to get uploaded file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		archive = file
+	}
+
+	log.Printf("💾 Restoring backup")
+
+	w.Header().Set("Content-Type", "application/json")
+	manifest, restart, err := manager.Restore(archive)
+	if manifest != nil {
+		// Recorded once the response is written, in the audit log that the
+		// restore leaves alone
+		audit.FromRequest(r).Details = map[string]string{
+			"backup_created_at": manifest.CreatedAt.Format(time.RFC3339),
+			"files":             strconv.Itoa(len(manifest.Files)),
+		}
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, whatsapp.ErrClientConnected):
+			status = http.StatusConflict
+			err = fmt.Errorf("refusing to restore while an account is connected, connecting or pairing: %w", err)
+		case errors.Is(err, whatsapp.ErrRestoreInProgress):
+			status = http.StatusConflict
+		case manifest != nil:
+			// Restored, but the accounts could not be reloaded
+			status = http.StatusInternalServerError
+		}
+		log.Printf("❌ Failed to restore backup: %v", err)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(RestoreResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	message := "Backup restored, reconnecting with the restored sessions"
+	if restart {
+		message = "Backup restored, restart the server to load the restored accounts"
+	}
+	log.Printf("✅ Backup restored (%d files)", len(manifest.Files))
+	json.NewEncoder(w).Encode(RestoreResponse{
+		Success:  true,
+		Message:  message,
+		Manifest: manifest,
+	})
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/broadcast"
+	"whatsapp-go-mcp/models"
+)
+
+// broadcastID parses the {id} path variable
+func broadcastID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid broadcast ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeBroadcastError maps broadcast errors to HTTP status codes
+func writeBroadcastError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, broadcast.ErrInvalidBroadcast):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, broadcast.ErrInvalidState):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Broadcast not found", http.StatusNotFound)
+	default:
+		log.Printf("❌ Broadcast operation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleCreateBroadcast starts a broadcast
+// @Summary Start a broadcast
+// @Description Send a message template to a list of JIDs or phone numbers and/or the contacts matching a search query. {{variable}} placeholders are filled per recipient from its variables, the stored contact (name, phone) and the broadcast defaults. Messages go out one at a time through the outbox, delay_seconds (default 5) plus up to jitter_seconds (default 3) apart.
+// @Tags Broadcasts
+// @Accept json
+// @Produce json
+// @Param request body broadcast.Request true "Broadcast"
+// @Success 201 {object} models.Broadcast "Broadcast with progress"
+// @Failure 400 {object} map[string]string "Invalid broadcast or missing template variables"
+// @Failure 403 {object} map[string]string "Sends need approval and the API key is not an admin key"
+// @Router /api/broadcasts [post]
+func HandleCreateBroadcast(w http.ResponseWriter, r *http.Request, broadcasts *broadcast.Manager) {
+	var req broadcast.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.CreatedBy = requesterFromRequest(r)
+
+	// Keys restricted to some recipients cannot reach contacts found by a search
+	if req.Query != "" && !AllowRecipient(w, r, "contacts matching "+strconv.Quote(req.Query)) {
+		return
+	}
+	for _, recipient := range req.Recipients {
+		if !AllowRecipient(w, r, recipient.To) {
+			return
+		}
+	}
+	if req.MediaPath != "" && !allowMedia(w, r) {
+		return
+	}
+
+	b, err := broadcasts.Create(&req)
+	if err != nil {
+		writeBroadcastError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(b)
+}
+
+// HandleListBroadcasts lists broadcasts
+// @Summary List broadcasts
+// @Tags Broadcasts
+// @Produce json
+// @Param status query string false "Filter by status: running, paused, cancelled or completed"
+// @Success 200 {array} models.Broadcast "Broadcasts with progress, newest first"
+// @Router /api/broadcasts [get]
+func HandleListBroadcasts(w http.ResponseWriter, r *http.Request, broadcasts *broadcast.Manager) {
+	list, err := broadcasts.List(r.URL.Query().Get("status"))
+	if err != nil {
+		writeBroadcastError(w, err)
+		return
+	}
+	if list == nil {
+		list = []*models.Broadcast{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleGetBroadcast reports the progress of a broadcast
+// @Summary Get broadcast progress
+// @Tags Broadcasts
+// @Produce json
+// @Param id path int true "Broadcast ID"
+// @Success 200 {object} models.Broadcast "Broadcast with progress"
+// @Failure 404 {object} map[string]string "Broadcast not found"
+// @Router /api/broadcasts/{id} [get]
+func HandleGetBroadcast(w http.ResponseWriter, r *http.Request, broadcasts *broadcast.Manager) {
+	id, ok := broadcastID(w, r)
+	if !ok {
+		return
+	}
+	b, err := broadcasts.Get(id)
+	if err != nil {
+		writeBroadcastError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// HandleGetBroadcastRecipients lists the recipients of a broadcast
+// @Summary List broadcast recipients
+// @Description Per-recipient status: pending, queued, sending, sent, failed or skipped
+// @Tags Broadcasts
+// @Produce json
+// @Param id path int true "Broadcast ID"
+// @Param status query string false "Filter by status"
+// @Success 200 {array} models.BroadcastRecipient "Recipients"
+// @Failure 404 {object} map[string]string "Broadcast not found"
+// @Router /api/broadcasts/{id}/recipients [get]
+func HandleGetBroadcastRecipients(w http.ResponseWriter, r *http.Request, broadcasts *broadcast.Manager) {
+	id, ok := broadcastID(w, r)
+	if !ok {
+		return
+	}
+	recipients, err := broadcasts.Recipients(id, r.URL.Query().Get("status"))
+	if err != nil {
+		writeBroadcastError(w, err)
+		return
+	}
+	if recipients == nil {
+		recipients = []*models.BroadcastRecipient{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recipients)
+}
+
+// HandleBroadcastAction pauses, resumes or cancels a broadcast
+// @Summary Pause, resume or cancel a broadcast
+// @Description Pausing stops after the message being sent. Cancelling skips every recipient not reached yet.
+// @Tags Broadcasts
+// @Produce json
+// @Param id path int true "Broadcast ID"
+// @Param action path string true "pause, resume or cancel"
+// @Success 200 {object} models.Broadcast "Broadcast with progress"
+// @Failure 404 {object} map[string]string "Broadcast not found"
+// @Failure 409 {object} map[string]string "Broadcast cannot be changed in its current state"
+// @Router /api/broadcasts/{id}/{action} [post]
+func HandleBroadcastAction(w http.ResponseWriter, r *http.Request, broadcasts *broadcast.Manager) {
+	id, ok := broadcastID(w, r)
+	if !ok {
+		return
+	}
+
+	var b *models.Broadcast
+	var err error
+	switch mux.Vars(r)["action"] {
+	case "pause":
+		b, err = broadcasts.Pause(id)
+	case "resume":
+		b, err = broadcasts.Resume(id)
+	case "cancel":
+		b, err = broadcasts.Cancel(id)
+	default:
+		http.Error(w, "Unknown action (use pause, resume or cancel)", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeBroadcastError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"whatsapp-go-mcp/config"
+)
+
+// HandleGetConfig shows the configuration the server is running with
+// @Summary Show the configuration
+// @Description Every setting with its value and where it came from: default, file, env or flag. Secrets such as LLAMASTACK_API_KEY and ENCRYPTION_KEK show as [redacted] when set.
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} config.View "Configuration"
+// @Router /api/admin/config [get]
+func HandleGetConfig(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg.Redacted())
+}
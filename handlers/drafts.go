@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/accounts"
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/drafts"
+	"whatsapp-go-mcp/models"
+)
+
+// DraftResponse is a draft with its review preview
+type DraftResponse struct {
+	*models.Draft
+	Preview string `json:"preview" example:"Draft #12 (pending)\nTo: 353851234567@s.whatsapp.net\nKind: text\n\nYour order has shipped."`
+}
+
+// DraftMessageRequest is a text message to draft; it has the same body as
+// /api/send-message
+type DraftMessageRequest struct {
+	Recipient string `json:"recipient" example:"353851234567@s.whatsapp.net"`
+	Message   string `json:"message" example:"Your order has shipped."`
+}
+
+// EditDraftRequest replaces the text of a draft
+type EditDraftRequest struct {
+	Text string `json:"text" example:"Your order shipped today."`
+}
+
+// RejectDraftRequest discards a draft
+type RejectDraftRequest struct {
+	Reason string `json:"reason,omitempty" example:"Wrong tone"`
+}
+
+// draftID parses the {id} path variable
+func draftID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid draft ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeDraftError maps draft errors to HTTP status codes. Errors queueing an
+// approved draft are mapped like those of a direct send.
+func writeDraftError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, drafts.ErrInvalidDraft):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, drafts.ErrNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Draft not found", http.StatusNotFound)
+	default:
+		WriteOutboxError(w, err)
+	}
+}
+
+// writeDraft writes a draft and its preview, and notes it in the audit log
+// entry of the request
+func writeDraft(w http.ResponseWriter, r *http.Request, status int, d *models.Draft) {
+	entry := audit.FromRequest(r)
+	entry.Recipient, entry.OutboxID = d.Recipient, d.OutboxID
+	entry.Details = map[string]string{"draft_id": strconv.FormatInt(d.ID, 10), "draft_status": d.Status}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(DraftResponse{Draft: d, Preview: drafts.Preview(d)})
+}
+
+// HandleDraftMessage parks a text message for approval. It serves
+// /api/send-message when APPROVAL_MODE is api or all.
+func HandleDraftMessage(w http.ResponseWriter, r *http.Request, manager *drafts.Manager) {
+	var req DraftMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !AllowRecipient(w, r, req.Recipient) {
+		return
+	}
+
+	d := &models.Draft{
+		Recipient:   req.Recipient,
+		Kind:        models.OutboxText,
+		Text:        req.Message,
+		Source:      models.DraftFromAPI,
+		RequestedBy: requesterFromRequest(r),
+	}
+	if err := manager.Create(d); err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	writeDraft(w, r, http.StatusAccepted, d)
+}
+
+// HandleDraftVoiceNote parks an uploaded voice note for approval. It serves
+// /api/send-voice-note when APPROVAL_MODE is api or all.
+func HandleDraftVoiceNote(w http.ResponseWriter, r *http.Request, manager *drafts.Manager) {
+	recipient, filename, path, ok := receiveVoiceNote(w, r)
+	if !ok {
+		return
+	}
+	defer os.Remove(path)
+
+	upload, err := os.Open(path)
+	if err != nil {
+		log.Printf("❌ Failed to open uploaded voice note: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer upload.Close()
+
+	d := &models.Draft{
+		Recipient:   recipient,
+		Kind:        models.OutboxAudio,
+		MediaPath:   path,
+		Filename:    filename,
+		Source:      models.DraftFromAPI,
+		RequestedBy: requesterFromRequest(r),
+	}
+	if err := manager.CreateUpload(d, upload); err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	writeDraft(w, r, http.StatusAccepted, d)
+}
+
+// HandleDraftSend parks a /send voice message for approval when
+// APPROVAL_MODE is api or all
+func HandleDraftSend(w http.ResponseWriter, r *http.Request, account *accounts.Account) {
+	req, mediaPath, cleanup, ok := resolveSendRequest(w, r, account.Client)
+	if !ok {
+		return
+	}
+	defer cleanup()
+
+	d := &models.Draft{
+		Recipient:   req.Recipient,
+		Kind:        models.OutboxAudio,
+		MediaPath:   mediaPath,
+		Source:      models.DraftFromAPI,
+		RequestedBy: requesterFromRequest(r),
+	}
+	if err := account.Drafts.Create(d); err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	writeDraft(w, r, http.StatusAccepted, d)
+}
+
+// HandleListDrafts lists drafts
+// @Summary List drafts
+// @Description Messages waiting for approval and those already reviewed, oldest first
+// @Tags Drafts
+// @Produce json
+// @Param status query string false "Only drafts with this status: pending, approved or rejected"
+// @Success 200 {array} DraftResponse "Drafts"
+// @Router /api/drafts [get]
+func HandleListDrafts(w http.ResponseWriter, r *http.Request, manager *drafts.Manager) {
+	list, err := manager.List(r.URL.Query().Get("status"))
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	response := make([]DraftResponse, 0, len(list))
+	for _, d := range list {
+		response = append(response, DraftResponse{Draft: d, Preview: drafts.Preview(d)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetDraft returns a draft
+// @Summary Get a draft
+// @Description The preview shows the message as it will be sent and, once edited, a line diff against the text as drafted
+// @Tags Drafts
+// @Produce json
+// @Param id path int true "Draft ID"
+// @Success 200 {object} DraftResponse "Draft"
+// @Failure 404 {object} map[string]string "Draft not found"
+// @Router /api/drafts/{id} [get]
+func HandleGetDraft(w http.ResponseWriter, r *http.Request, manager *drafts.Manager) {
+	id, ok := draftID(w, r)
+	if !ok {
+		return
+	}
+	d, err := manager.Get(id)
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	writeDraft(w, r, http.StatusOK, d)
+}
+
+// HandleEditDraft replaces the text of a pending draft
+// @Summary Edit a draft
+// @Description Replace the text, or the caption of a file, before approving it. The text as drafted is kept for the diff.
+// @Tags Drafts
+// @Accept json
+// @Produce json
+// @Param id path int true "Draft ID"
+// @Param request body EditDraftRequest true "New text"
+// @Success 200 {object} DraftResponse "Edited draft"
+// @Failure 400 {object} map[string]string "Invalid text"
+// @Failure 404 {object} map[string]string "Draft not found"
+// @Failure 409 {object} map[string]string "Draft has already been reviewed"
+// @Router /api/drafts/{id} [put]
+func HandleEditDraft(w http.ResponseWriter, r *http.Request, manager *drafts.Manager) {
+	id, ok := draftID(w, r)
+	if !ok {
+		return
+	}
+	var req EditDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	d, err := manager.Edit(id, req.Text, requesterFromRequest(r))
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	writeDraft(w, r, http.StatusOK, d)
+}
+
+// HandleApproveDraft sends a pending draft
+// @Summary Approve a draft
+// @Description Hand the draft to the outbox, where it is checked against the send policy and rate limits like any other message. If it cannot be queued the draft stays pending with the error recorded.
+// @Tags Drafts
+// @Produce json
+// @Param id path int true "Draft ID"
+// @Success 200 {object} DraftResponse "Approved draft with its outbox_id"
+// @Failure 403 {object} map[string]string "Recipient blocked by the send policy"
+// @Failure 404 {object} map[string]string "Draft not found"
+// @Failure 409 {object} map[string]string "Draft has already been reviewed"
+// @Failure 429 {object} map[string]string "Send rate limit exceeded; see Retry-After"
+// @Router /api/drafts/{id}/approve [post]
+func HandleApproveDraft(w http.ResponseWriter, r *http.Request, manager *drafts.Manager) {
+	id, ok := draftID(w, r)
+	if !ok {
+		return
+	}
+	d, err := manager.Approve(id, requesterFromRequest(r))
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	writeDraft(w, r, http.StatusOK, d)
+}
+
+// HandleRejectDraft discards a pending draft
+// @Summary Reject a draft
+// @Tags Drafts
+// @Accept json
+// @Produce json
+// @Param id path int true "Draft ID"
+// @Param request body RejectDraftRequest false "Why the draft was rejected"
+// @Success 200 {object} DraftResponse "Rejected draft"
+// @Failure 404 {object} map[string]string "Draft not found"
+// @Failure 409 {object} map[string]string "Draft has already been reviewed"
+// @Router /api/drafts/{id}/reject [post]
+func HandleRejectDraft(w http.ResponseWriter, r *http.Request, manager *drafts.Manager) {
+	id, ok := draftID(w, r)
+	if !ok {
+		return
+	}
+	var req RejectDraftRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	d, err := manager.Reject(id, requesterFromRequest(r), req.Reason)
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	writeDraft(w, r, http.StatusOK, d)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// HandleRotateEncryption re-encrypts stored data with the active encryption key
+// @Summary Rotate the encryption-at-rest key
+// @Description Re-encrypt message content and media files with the active key from the keyfile or ENCRYPTION_KEK
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} whatsapp.EncryptionRotationResult "Rotation summary"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/admin/encryption/rotate [post]
+func HandleRotateEncryption(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	log.Printf("🔐 Rotating encryption keys")
+
+	result, err := client.RotateEncryption()
+	if err != nil {
+		log.Printf("❌ Failed to rotate encryption keys: %v", err)
+		http.Error(w, "Failed to rotate encryption keys: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("✅ Encryption rotated to key %s (%d rows, %d files)",
+		result.ActiveKeyID, result.RowsRotated, result.FilesRotated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
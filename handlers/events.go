@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"whatsapp-go-mcp/stream"
+)
+
+// streamKeepAlive is how often idle streams are pinged so proxies keep them open
+const streamKeepAlive = 15 * time.Second
+
+// upgrader upgrades /api/ws requests. Origins are not restricted since the API
+// has no cookie-based authentication.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// streamSubscription parses the filter and resume position of a stream request
+// and subscribes to the hub
+func streamSubscription(w http.ResponseWriter, r *http.Request, hub *stream.Hub) (*stream.Subscriber, []*stream.Record, bool) {
+	query := r.URL.Query()
+	filter := stream.ParseFilter(query.Get("types"), query.Get("chat_jid"))
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	var after int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		after = id
+	}
+
+	sub, replay, err := hub.Subscribe(filter, after)
+	if err != nil {
+		log.Printf("❌ Failed to subscribe to event stream: %v", err)
+		http.Error(w, "Failed to subscribe to events", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return sub, replay, true
+}
+
+// HandleEvents streams events as Server-Sent Events
+// @Summary Stream events (SSE)
+// @Description Stream message, receipt, presence, group and connection events as Server-Sent Events. Reconnecting clients resume after the Last-Event-ID header from a ring buffer of recent events.
+// @Tags Events
+// @Produce text/event-stream
+// @Param types query string false "Comma-separated event types to receive (default: all)"
+// @Param chat_jid query string false "Comma-separated chat JIDs to receive events for (default: all)"
+// @Param last_event_id query int false "Resume after this event ID (alternative to the Last-Event-ID header)"
+// @Success 200 {object} stream.Record "Event stream"
+// @Router /api/events [get]
+func HandleEvents(w http.ResponseWriter, r *http.Request, hub *stream.Hub) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, replay, ok := streamSubscription(w, r, hub)
+	if !ok {
+		return
+	}
+	defer hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(rec *stream.Record) error {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", rec.ID, rec.Type, data)
+		return err
+	}
+
+	for _, rec := range replay {
+		if err := write(rec); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case rec, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := write(rec); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// HandleWebSocket streams events over a WebSocket
+// @Summary Stream events (WebSocket)
+// @Description Stream message, receipt, presence, group and connection events as JSON text frames over a WebSocket. Supports the same filters and resume position as /api/events.
+// @Tags Events
+// @Param types query string false "Comma-separated event types to receive (default: all)"
+// @Param chat_jid query string false "Comma-separated chat JIDs to receive events for (default: all)"
+// @Param last_event_id query int false "Resume after this event ID"
+// @Success 101 {object} stream.Record "Switching protocols"
+// @Router /api/ws [get]
+func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *stream.Hub) {
+	sub, replay, ok := streamSubscription(w, r, hub)
+	if !ok {
+		return
+	}
+	defer hub.Unsubscribe(sub)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("❌ WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Read in the background to handle control frames and notice the client leaving
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(rec *stream.Record) error {
+		conn.SetWriteDeadline(time.Now().Add(streamKeepAlive))
+		return conn.WriteJSON(rec)
+	}
+
+	for _, rec := range replay {
+		if err := write(rec); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case rec, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, resume with last_event_id"),
+					time.Now().Add(time.Second))
+				return
+			}
+			if err := write(rec); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamKeepAlive)); err != nil {
+				return
+			}
+		}
+	}
+}
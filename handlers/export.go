@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// HandleExportChat streams the history of a chat as a transcript
+// @Summary Export chat
+// @Description Download the full history of a chat as WhatsApp-style text (txt), one message per line (jsonl) or a self-contained HTML transcript with inline images (html)
+// @Tags Chats
+// @Produce plain
+// @Produce json
+// @Produce html
+// @Param jid path string true "Chat JID or phone number"
+// @Param format query string false "Export format: txt, jsonl or html" default(txt)
+// @Success 200 {file} file "Chat transcript"
+// @Failure 400 {object} map[string]string "Invalid JID or format"
+// @Failure 500 {object} map[string]string "Export failed"
+// @Router /api/chats/{jid}/export [get]
+func HandleExportChat(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	jid := mux.Vars(r)["jid"]
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = whatsapp.ExportFormatText
+	}
+
+	contentType, err := whatsapp.ExportContentType(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("📤 Exporting chat %s as %s", jid, format)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("chat-%s-%s.%s", strings.Split(jid, "@")[0], time.Now().Format("20060102-150405"), format)))
+
+	out := &startedWriter{ResponseWriter: w}
+	if err := client.ExportChat(jid, format, out); err != nil {
+		log.Printf("❌ Failed to export chat: %v", err)
+		if out.started {
+			// The status and part of the transcript are already sent, so the
+			// export can only be cut short
+			entry := audit.FromRequest(r)
+			entry.Status, entry.Error = models.AuditError, err.Error()
+			return
+		}
+		w.Header().Del("Content-Disposition")
+		status := http.StatusInternalServerError
+		if errors.Is(err, whatsapp.ErrInvalidContactJID) || errors.Is(err, whatsapp.ErrUnsupportedExportFormat) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, "Failed to export chat: "+err.Error(), status)
+		return
+	}
+}
+
+// startedWriter records whether any of a streamed response has been written
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (s *startedWriter) Write(b []byte) (int, error) {
+	s.started = true
+	return s.ResponseWriter.Write(b)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// ChatBotRequest represents the request body for changing the bot mode of a chat
+type ChatBotRequest struct {
+	Mode         string `json:"mode" example:"paused"`
+	PauseMinutes int    `json:"pause_minutes,omitempty" example:"60"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// writeChatBotError maps handoff errors to HTTP status codes
+func writeChatBotError(w http.ResponseWriter, err error) {
+	if errors.Is(err, whatsapp.ErrInvalidBotMode) || errors.Is(err, whatsapp.ErrInvalidChatJID) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("❌ Chat bot state operation failed: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// HandleGetChatBot returns whether the bot answers in a chat
+// @Summary Get chat bot mode
+// @Description Get the bot mode of a chat: auto, paused (until paused_until) or human_only
+// @Tags Handoff
+// @Produce json
+// @Param jid path string true "Chat JID or phone number"
+// @Success 200 {object} models.ChatBotState "Bot state"
+// @Failure 400 {object} map[string]string "Invalid JID"
+// @Router /api/chats/{jid}/bot [get]
+func HandleGetChatBot(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	state, err := client.ChatBotState(mux.Vars(r)["jid"])
+	if err != nil {
+		writeChatBotError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// HandleSetChatBot changes whether the bot answers in a chat
+// @Summary Set chat bot mode
+// @Description Hand a chat over to staff or back to the bot. "paused" silences the bot for pause_minutes (default: the configured handoff pause), "human_only" until the mode is set back to "auto".
+// @Tags Handoff
+// @Accept json
+// @Produce json
+// @Param jid path string true "Chat JID or phone number"
+// @Param request body ChatBotRequest true "Bot mode"
+// @Success 200 {object} models.ChatBotState "Updated bot state"
+// @Failure 400 {object} map[string]string "Invalid mode or JID"
+// @Router /api/chats/{jid}/bot [put]
+func HandleSetChatBot(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	var req ChatBotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.PauseMinutes < 0 {
+		http.Error(w, "pause_minutes must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	state, err := client.SetChatBotMode(mux.Vars(r)["jid"], req.Mode,
+		time.Duration(req.PauseMinutes)*time.Minute, req.Reason, requesterFromRequest(r))
+	if err != nil {
+		writeChatBotError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
@@ -1,30 +1,67 @@
 package handlers
 
 import (
-	"fmt"
+	"encoding/json"
 	"net/http"
 	"time"
+
+	"whatsapp-go-mcp/health"
+	"whatsapp-go-mcp/whatsapp"
 )
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status string `json:"status" example:"healthy"`
-	Time   string `json:"time" example:"2025-09-24T23:56:42+02:00"`
+	Status   string                   `json:"status" example:"healthy"`
+	Time     string                   `json:"time" example:"2025-09-24T23:56:42+02:00"`
+	WhatsApp whatsapp.ConnectionState `json:"whatsapp"`
 }
 
 // HandleHealth handles health check requests
 // @Summary Health check endpoint
-// @Description Returns the current health status of the server
+// @Description Returns the current health status of the server and the state of the WhatsApp connection: pairing, connecting, connected, disconnected (reconnecting with backoff), logged_out or stream_replaced
 // @Tags System
 // @Accept json
 // @Produce json
 // @Success 200 {object} HealthResponse "Server is healthy"
 // @Router /health [get]
-func HandleHealth(w http.ResponseWriter, r *http.Request) {
+func HandleHealth(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
 	w.Header().Set("Content-Type", "application/json")
 	response := HealthResponse{
-		Status: "healthy",
-		Time:   time.Now().Format(time.RFC3339),
+		Status:   "healthy",
+		Time:     time.Now().Format(time.RFC3339),
+		WhatsApp: client.ConnectionState(),
 	}
-	fmt.Fprintf(w, `{"status":"%s","time":"%s"}`, response.Status, response.Time)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleLiveness reports whether the process is alive
+// @Summary Liveness probe
+// @Description Checks that the server responds and its database answers. WhatsApp and external services are not checked, since restarting the pod would not fix them.
+// @Tags System
+// @Produce json
+// @Success 200 {object} health.Report "Alive"
+// @Failure 503 {object} health.Report "A critical check failed"
+// @Router /healthz/live [get]
+func HandleLiveness(w http.ResponseWriter, r *http.Request, probes *health.Probes) {
+	writeHealthReport(w, probes.Liveness(r.Context()))
+}
+
+// HandleReadiness reports whether the server can serve traffic
+// @Summary Readiness probe
+// @Description Checks the WhatsApp connection and login state, that the message database accepts writes and free space in the media directory of every account, and whether the TTS, STT and LlamaStack endpoints answer. The status is fail (503) if a critical check fails, warn if only optional checks fail, and pass otherwise.
+// @Tags System
+// @Produce json
+// @Success 200 {object} health.Report "Ready"
+// @Failure 503 {object} health.Report "A critical check failed"
+// @Router /healthz/ready [get]
+func HandleReadiness(w http.ResponseWriter, r *http.Request, probes *health.Probes) {
+	writeHealthReport(w, probes.Readiness(r.Context()))
+}
+
+// writeHealthReport writes a probe report with its HTTP status
+func writeHealthReport(w http.ResponseWriter, report *health.Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(report.HTTPStatus())
+	json.NewEncoder(w).Encode(report)
 }
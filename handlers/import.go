@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/chatimport"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// HandleImportChat imports a chat exported from the phone
+// @Summary Import chat export
+// @Description Import the .txt transcript or .zip archive written by the phone's "Export chat" into a chat. Re-importing the same export is idempotent, and messages already received live are skipped.
+// @Tags Chats
+// @Accept multipart/form-data
+// @Accept application/zip
+// @Accept plain
+// @Produce json
+// @Param jid path string true "Chat JID or phone number"
+// @Param file formData file false "Exported chat (when using multipart/form-data)"
+// @Param self query string false "Name the export uses for your own messages (default: the device push name)"
+// @Param date_order query string false "Date field order of the export: dmy, mdy or ymd (default: detected)"
+// @Param tz query string false "IANA time zone of the phone that made the export (default: server time zone)"
+// @Success 200 {object} whatsapp.ImportResult "Import summary"
+// @Failure 400 {object} map[string]string "Invalid JID or export"
+// @Failure 500 {object} map[string]string "Import failed"
+// @Router /api/chats/{jid}/import [post]
+func HandleImportChat(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	jid := mux.Vars(r)["jid"]
+	query := r.URL.Query()
+
+	opts := whatsapp.ImportOptions{
+		Self:      query.Get("self"),
+		DateOrder: chatimport.DateOrder(query.Get("date_order")),
+	}
+	switch opts.DateOrder {
+	case chatimport.DateOrderAuto, chatimport.DateOrderDMY, chatimport.DateOrderMDY, chatimport.DateOrderYMD:
+	default:
+		http.Error(w, "date_order must be dmy, mdy or ymd", http.StatusBadRequest)
+		return
+	}
+	if tz := query.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "Invalid time zone: "+tz, http.StatusBadRequest)
+			return
+		}
+		opts.Location = loc
+	}
+
+	var upload io.Reader = r.Body
+	filename := "export"
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			log.Printf("❌ Failed to get uploaded chat export: %v", err)
+			http.Error(w, "Failed to get uploaded file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		upload = file
+		filename = filepath.Base(header.Filename)
+	}
+
+	// Zip archives need random access, so the upload is spooled to disk. The
+	// original file name is kept since Android names the transcript after the chat.
+	tempDir, err := os.MkdirTemp("", "chat-import-")
+	if err != nil {
+		http.Error(w, "Failed to create temp directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	exportPath := filepath.Join(tempDir, filename)
+	dst, err := os.Create(exportPath)
+	if err != nil {
+		http.Error(w, "Failed to create temp file", http.StatusInternalServerError)
+		return
+	}
+	_, err = io.Copy(dst, upload)
+	dst.Close()
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("📥 Importing chat export %s into %s", filename, jid)
+
+	result, err := client.ImportChat(jid, exportPath, opts)
+	if err != nil {
+		log.Printf("❌ Failed to import chat: %v", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, whatsapp.ErrInvalidContactJID) || errors.Is(err, whatsapp.ErrInvalidExport) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, "Failed to import chat: "+err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/ratelimit"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// IdempotencyKeyHeader is the request header that makes a send safe to retry:
+// a repeated request with the same key returns the original message instead
+// of sending it again
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// WriteOutboxError maps errors from queueing a message to HTTP status codes
+func WriteOutboxError(w http.ResponseWriter, err error) {
+	var limited *whatsapp.RateLimitError
+	switch {
+	case errors.Is(err, whatsapp.ErrInvalidRecipient):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, whatsapp.ErrIdempotencyConflict):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, whatsapp.ErrSendDenied), errors.Is(err, whatsapp.ErrApprovalRequired):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.As(err, &limited):
+		ratelimit.Reject(w, err.Error(), limited.RetryAfter)
+	default:
+		log.Printf("❌ Failed to queue message: %v", err)
+		http.Error(w, "Failed to send message", http.StatusInternalServerError)
+	}
+}
+
+// AuditQueued adds the outbox entry of a send request to its audit entry
+func AuditQueued(r *http.Request, m *models.OutboxMessage) {
+	entry := audit.FromRequest(r)
+	entry.Recipient, entry.OutboxID, entry.MessageID = m.Recipient, m.ID, m.MessageID
+}
+
+// OutboxStatusCode returns the HTTP status for a send request: 200 once the
+// message was sent, 202 while it waits in the outbox and 500 if it failed
+func OutboxStatusCode(m *models.OutboxMessage) int {
+	switch m.Status {
+	case models.OutboxSent:
+		return http.StatusOK
+	case models.OutboxFailed:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusAccepted
+	}
+}
+
+// HandleGetOutboxMessage returns the delivery state of a queued message
+// @Summary Get outbox message status
+// @Description Get the delivery state of a message sent through the outbox: queued, sending, sent or failed
+// @Tags API
+// @Produce json
+// @Param id path int true "Outbox message ID"
+// @Success 200 {object} models.OutboxMessage "Outbox message"
+// @Failure 404 {object} map[string]string "Message not found"
+// @Router /api/outbox/{id} [get]
+func HandleGetOutboxMessage(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid outbox message ID", http.StatusBadRequest)
+		return
+	}
+
+	m, err := client.OutboxMessage(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Outbox message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load outbox message %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
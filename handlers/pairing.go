@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// PairPhoneRequest represents a request for a phone-number pairing code
+type PairPhoneRequest struct {
+	Phone string `json:"phone" example:"+353851234567"`
+}
+
+// PairPhoneResponse holds the code to enter on the phone
+type PairPhoneResponse struct {
+	Code string `json:"code" example:"ABCD-EFGH"`
+}
+
+// writePairingError maps pairing errors to HTTP status codes
+func writePairingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, whatsapp.ErrAlreadyPaired):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, whatsapp.ErrInvalidPhone):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, whatsapp.ErrNoQRCode):
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		log.Printf("❌ Pairing failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
+
+// HandleGetPairingQR returns the QR code to link the device
+// @Summary Get the pairing QR code
+// @Description Returns the current QR code to scan with WhatsApp > Settings > Linked Devices > Link a Device, starting a pairing if none is running. Codes rotate every 20 to 60 seconds and pairing stops after about 160 seconds; fetching the QR code again starts a new pairing.
+// @Tags Pairing
+// @Produce png
+// @Produce image/svg+xml
+// @Produce json
+// @Param format query string false "png (default), svg or raw"
+// @Success 200 {object} whatsapp.QRCode "QR code image, or the raw code with its expiry for format=raw"
+// @Failure 409 {object} map[string]string "Device is already paired"
+// @Failure 503 {object} map[string]string "No QR code received yet"
+// @Router /api/pairing/qr [get]
+func HandleGetPairingQR(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" && format != "raw" {
+		http.Error(w, "Invalid format (use png, svg or raw)", http.StatusBadRequest)
+		return
+	}
+
+	code, err := client.PairingQR(r.Context())
+	if err != nil {
+		writePairingError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Expires", code.ExpiresAt.UTC().Format(http.TimeFormat))
+	switch format {
+	case "raw":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(code)
+	case "svg":
+		svg, err := code.SVG()
+		if err != nil {
+			writePairingError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(svg))
+	default:
+		png, err := code.PNG()
+		if err != nil {
+			writePairingError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}
+}
+
+// HandlePairPhone requests a phone-number pairing code
+// @Summary Get a pairing code for a phone number
+// @Description Returns an 8-character code to enter on the phone under WhatsApp > Settings > Linked Devices > Link a Device > Link with Phone Number Instead. The phone also shows a notification asking for the code. The number must include the country code.
+// @Tags Pairing
+// @Accept json
+// @Produce json
+// @Param request body PairPhoneRequest true "Phone number of the account to link"
+// @Success 200 {object} PairPhoneResponse "Pairing code"
+// @Failure 400 {object} map[string]string "Invalid phone number"
+// @Failure 409 {object} map[string]string "Device is already paired"
+// @Failure 503 {object} map[string]string "Pairing could not be started yet"
+// @Router /api/pairing/phone [post]
+func HandlePairPhone(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	var req PairPhoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Phone == "" {
+		http.Error(w, "phone is required", http.StatusBadRequest)
+		return
+	}
+
+	code, err := client.PairPhone(r.Context(), req.Phone)
+	if err != nil {
+		writePairingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(PairPhoneResponse{Code: code})
+}
+
+// HandlePairingStatus reports whether the device is paired
+// @Summary Get the pairing status
+// @Description Reports whether a session is stored, the linked JID, whether a pairing is running, when the current QR code expires and the connection state
+// @Tags Pairing
+// @Produce json
+// @Success 200 {object} whatsapp.PairingStatus "Pairing status"
+// @Router /api/pairing/status [get]
+func HandlePairingStatus(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client.PairingStatus())
+}
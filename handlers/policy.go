@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/policy"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// ApproveContactRequest approves a number for first contact
+type ApproveContactRequest struct {
+	JID string `json:"jid" example:"+353851234567"`
+}
+
+// writePolicyError maps send policy errors to HTTP status codes
+func writePolicyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, whatsapp.ErrInvalidRecipient):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Contact is not approved", http.StatusNotFound)
+	default:
+		log.Printf("❌ Send policy operation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleGetSendPolicy returns the send policy
+// @Summary Get the send policy
+// @Description The allow and deny lists every outgoing message is checked against, set with SEND_ALLOW, SEND_DENY and SEND_APPROVE_FIRST_CONTACT
+// @Tags Send Policy
+// @Produce json
+// @Success 200 {object} policy.Rules "Send policy"
+// @Router /api/policy [get]
+func HandleGetSendPolicy(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	rules := client.SendPolicy()
+	if rules == nil {
+		rules = &policy.Rules{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// HandleListSendDecisions lists send policy decisions
+// @Summary List send policy decisions
+// @Description The audit trail of send policy decisions, newest first
+// @Tags Send Policy
+// @Produce json
+// @Param recipient query string false "Only decisions about this JID or phone number"
+// @Param decision query string false "Only allowed, denied or needs_approval decisions"
+// @Param limit query int false "Maximum number of decisions (default 100)"
+// @Success 200 {array} models.SendDecision "Decisions"
+// @Failure 400 {object} map[string]string "Invalid recipient or limit"
+// @Router /api/policy/decisions [get]
+func HandleListSendDecisions(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	filter := models.SendDecisionFilter{
+		Recipient: r.URL.Query().Get("recipient"),
+		Decision:  r.URL.Query().Get("decision"),
+		Limit:     100,
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	decisions, err := client.SendDecisions(filter)
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	if decisions == nil {
+		decisions = []*models.SendDecision{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decisions)
+}
+
+// HandleApproveContact approves a number for first contact
+// @Summary Approve a number for first contact
+// @Description With SEND_APPROVE_FIRST_CONTACT set, numbers that have never written to us can only be messaged once approved
+// @Tags Send Policy
+// @Accept json
+// @Produce json
+// @Param request body ApproveContactRequest true "Number to approve"
+// @Success 201 {object} models.ApprovedContact "Approved number"
+// @Failure 400 {object} map[string]string "Invalid JID"
+// @Router /api/policy/approved-contacts [post]
+func HandleApproveContact(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	var req ApproveContactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	contact, err := client.ApproveContact(req.JID, requesterFromRequest(r))
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contact)
+}
+
+// HandleListApprovedContacts lists the numbers approved for first contact
+// @Summary List approved numbers
+// @Tags Send Policy
+// @Produce json
+// @Success 200 {array} models.ApprovedContact "Approved numbers, newest first"
+// @Router /api/policy/approved-contacts [get]
+func HandleListApprovedContacts(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	contacts, err := client.ApprovedContacts()
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	if contacts == nil {
+		contacts = []*models.ApprovedContact{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contacts)
+}
+
+// HandleRevokeContactApproval withdraws a first-contact approval
+// @Summary Withdraw a first-contact approval
+// @Tags Send Policy
+// @Param jid path string true "Contact JID or phone number"
+// @Success 204 "Approval withdrawn"
+// @Failure 404 {object} map[string]string "Contact is not approved"
+// @Router /api/policy/approved-contacts/{jid} [delete]
+func HandleRevokeContactApproval(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	if err := client.RevokeContactApproval(mux.Vars(r)["jid"]); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/auth"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// requesterFromRequest identifies who issued an API request for audit
+// records: the API key's name when there is one, and the client address
+func requesterFromRequest(r *http.Request) string {
+	address := r.RemoteAddr
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		address = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if k := auth.FromRequest(r); k != nil {
+		return fmt.Sprintf("api-key:%s (%s)", k.Name, address)
+	}
+	return address
+}
+
+// HandleExportContactData exports everything held about a contact
+// @Summary Export contact data
+// @Description Download a zip with all messages, chats, the contact row, transcripts, LLM conversation history and media held about a contact
+// @Tags Privacy
+// @Produce application/zip
+// @Param jid path string true "Contact JID or phone number"
+// @Success 200 {file} file "Zip archive with data.json and media files"
+// @Failure 400 {object} map[string]string "Invalid JID"
+// @Router /api/contacts/{jid}/export [get]
+func HandleExportContactData(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	jid := mux.Vars(r)["jid"]
+	log.Printf("📦 Exporting data for %s", jid)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("contact-export-%s-%s.zip", strings.Split(jid, "@")[0], time.Now().Format("20060102-150405"))))
+
+	if err := client.ExportContactData(jid, w, "api", requesterFromRequest(r)); err != nil {
+		log.Printf("❌ Failed to export contact data: %v", err)
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Failed to export contact data: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// HandleEraseContactData erases everything held about a contact
+// @Summary Erase contact data
+// @Description Delete all messages, chats, the contact row, transcripts, media files and LLM conversation history held about a contact
+// @Tags Privacy
+// @Produce json
+// @Param jid path string true "Contact JID or phone number"
+// @Success 200 {object} whatsapp.ContactErasureResult "Erasure summary"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/contacts/{jid} [delete]
+func HandleEraseContactData(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	jid := mux.Vars(r)["jid"]
+	log.Printf("🗑️ Erasing data for %s", jid)
+
+	result, err := client.EraseContactData(jid, "api", requesterFromRequest(r))
+	if err != nil {
+		log.Printf("❌ Failed to erase contact data: %v", err)
+		http.Error(w, "Failed to erase contact data: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleListDataRequests lists audited export and erasure requests
+// @Summary List data requests
+// @Description List the audit trail of contact data exports and erasures
+// @Tags Privacy
+// @Produce json
+// @Param jid query string false "Filter by contact JID"
+// @Success 200 {array} models.DataRequest "Data requests"
+// @Router /api/data-requests [get]
+func HandleListDataRequests(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	requests, err := client.GetDataRequests(r.URL.Query().Get("jid"))
+	if err != nil {
+		log.Printf("❌ Failed to list data requests: %v", err)
+		http.Error(w, "Failed to list data requests", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/rules"
+)
+
+// RuleRequest represents the request body for creating or updating a rule
+type RuleRequest struct {
+	Name       string                `json:"name" example:"Out of office"`
+	Priority   int                   `json:"priority"`
+	Enabled    *bool                 `json:"enabled,omitempty"`
+	Conditions models.RuleConditions `json:"conditions"`
+	Actions    []models.RuleAction   `json:"actions"`
+}
+
+// toRule converts the request to a rule; rules are enabled unless disabled explicitly
+func (req *RuleRequest) toRule() *models.Rule {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return &models.Rule{
+		Name:       req.Name,
+		Priority:   req.Priority,
+		Enabled:    enabled,
+		Conditions: req.Conditions,
+		Actions:    req.Actions,
+	}
+}
+
+// RuleDryRunRequest represents the request body for dry-running a rule
+type RuleDryRunRequest struct {
+	RuleID  int64        `json:"rule_id,omitempty"`
+	Rule    *RuleRequest `json:"rule,omitempty"`
+	ChatJID string       `json:"chat_jid,omitempty"`
+	Limit   int          `json:"limit,omitempty" example:"200"`
+}
+
+// ruleID parses the {id} path variable
+func ruleID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeRuleError maps rules engine errors to HTTP status codes
+func writeRuleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rules.ErrInvalidRule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Rule not found", http.StatusNotFound)
+	default:
+		log.Printf("❌ Rule operation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleCreateRule creates an auto-reply rule
+// @Summary Create rule
+// @Description Create an auto-reply rule. Conditions cover chats, senders, a regex, media types, business hours and first message from a contact; actions are reply, voice, forward, webhook, llm and stop.
+// @Tags Rules
+// @Accept json
+// @Produce json
+// @Param request body RuleRequest true "Rule"
+// @Success 201 {object} models.Rule "Created rule"
+// @Failure 400 {object} map[string]string "Invalid rule"
+// @Router /api/rules [post]
+func HandleCreateRule(w http.ResponseWriter, r *http.Request, engine *rules.Engine) {
+	var req RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	rule := req.toRule()
+	if err := engine.Create(rule); err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	if created, err := engine.Get(rule.ID); err == nil {
+		rule = created
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// HandleListRules lists auto-reply rules
+// @Summary List rules
+// @Description List auto-reply rules in evaluation order
+// @Tags Rules
+// @Produce json
+// @Success 200 {array} models.Rule "Rules"
+// @Router /api/rules [get]
+func HandleListRules(w http.ResponseWriter, r *http.Request, engine *rules.Engine) {
+	list, err := engine.List()
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	if list == nil {
+		list = []*models.Rule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleGetRule returns an auto-reply rule
+// @Summary Get rule
+// @Tags Rules
+// @Produce json
+// @Param id path int true "Rule ID"
+// @Success 200 {object} models.Rule "Rule"
+// @Failure 404 {object} map[string]string "Rule not found"
+// @Router /api/rules/{id} [get]
+func HandleGetRule(w http.ResponseWriter, r *http.Request, engine *rules.Engine) {
+	id, ok := ruleID(w, r)
+	if !ok {
+		return
+	}
+	rule, err := engine.Get(id)
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// HandleUpdateRule replaces an auto-reply rule
+// @Summary Update rule
+// @Tags Rules
+// @Accept json
+// @Produce json
+// @Param id path int true "Rule ID"
+// @Param request body RuleRequest true "Rule"
+// @Success 200 {object} models.Rule "Updated rule"
+// @Failure 400 {object} map[string]string "Invalid rule"
+// @Failure 404 {object} map[string]string "Rule not found"
+// @Router /api/rules/{id} [put]
+func HandleUpdateRule(w http.ResponseWriter, r *http.Request, engine *rules.Engine) {
+	id, ok := ruleID(w, r)
+	if !ok {
+		return
+	}
+	var req RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	rule := req.toRule()
+	rule.ID = id
+	if err := engine.Update(rule); err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	if updated, err := engine.Get(id); err == nil {
+		rule = updated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// HandleDeleteRule removes an auto-reply rule
+// @Summary Delete rule
+// @Tags Rules
+// @Param id path int true "Rule ID"
+// @Success 204 "Rule deleted"
+// @Failure 404 {object} map[string]string "Rule not found"
+// @Router /api/rules/{id} [delete]
+func HandleDeleteRule(w http.ResponseWriter, r *http.Request, engine *rules.Engine) {
+	id, ok := ruleID(w, r)
+	if !ok {
+		return
+	}
+	if err := engine.Delete(id); err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDryRunRule evaluates a rule against stored messages without running its actions
+// @Summary Dry-run rule
+// @Description Evaluate a saved rule (rule_id) or an unsaved one (rule) against the most recent stored incoming messages, optionally from one chat, and list the messages it would match. No action is run.
+// @Tags Rules
+// @Accept json
+// @Produce json
+// @Param request body RuleDryRunRequest true "Rule and messages to evaluate"
+// @Success 200 {array} rules.DryRunMatch "Matching messages"
+// @Failure 400 {object} map[string]string "Invalid rule"
+// @Failure 404 {object} map[string]string "Rule not found"
+// @Router /api/rules/dry-run [post]
+func HandleDryRunRule(w http.ResponseWriter, r *http.Request, engine *rules.Engine) {
+	var req RuleDryRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = 200
+	}
+
+	var rule *models.Rule
+	switch {
+	case req.Rule != nil:
+		rule = req.Rule.toRule()
+	case req.RuleID != 0:
+		saved, err := engine.Get(req.RuleID)
+		if err != nil {
+			writeRuleError(w, err)
+			return
+		}
+		rule = saved
+	default:
+		http.Error(w, "rule or rule_id is required", http.StatusBadRequest)
+		return
+	}
+
+	matches, err := engine.DryRun(rule, req.ChatJID, req.Limit)
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/scheduler"
+)
+
+// ScheduledMessageRequest represents the request body for creating or
+// editing a scheduled message. Give either send_at or cron.
+type ScheduledMessageRequest struct {
+	Recipient string `json:"recipient" example:"353851234567@s.whatsapp.net"`
+	Kind      string `json:"kind,omitempty" example:"text"` // text (default), voice or file
+	Text      string `json:"text,omitempty" example:"Reminder: your appointment is today at 11:00"`
+	MediaPath string `json:"media_path,omitempty" example:"brochure.pdf"`
+	SendAt    string `json:"send_at,omitempty" example:"2025-10-20T09:00"` // RFC 3339, or local time in timezone
+	Cron      string `json:"cron,omitempty" example:"0 9 * * mon-fri"`
+	Timezone  string `json:"timezone,omitempty" example:"Europe/Dublin"`
+}
+
+// localTimeLayouts are accepted for send_at without a UTC offset
+var localTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// toScheduledMessage converts the request to a scheduled message. A send_at
+// without a UTC offset is read in the schedule's time zone.
+func (req *ScheduledMessageRequest) toScheduledMessage() (*models.ScheduledMessage, error) {
+	m := &models.ScheduledMessage{
+		Recipient: req.Recipient,
+		Kind:      req.Kind,
+		Text:      req.Text,
+		MediaPath: req.MediaPath,
+		Cron:      req.Cron,
+		Timezone:  req.Timezone,
+	}
+	if req.SendAt == "" {
+		return m, nil
+	}
+
+	loc := time.UTC
+	if req.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(req.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: unknown time zone %q", scheduler.ErrInvalidSchedule, req.Timezone)
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, req.SendAt); err == nil {
+		m.SendAt = &t
+		return m, nil
+	}
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, req.SendAt, loc); err == nil {
+			m.SendAt = &t
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid send_at %q (use RFC 3339 or YYYY-MM-DDTHH:MM)", scheduler.ErrInvalidSchedule, req.SendAt)
+}
+
+// scheduledMessageID parses the {id} path variable
+func scheduledMessageID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid scheduled message ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeScheduleError maps scheduler errors to HTTP status codes
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrInvalidSchedule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, scheduler.ErrNotActive):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Scheduled message not found", http.StatusNotFound)
+	default:
+		log.Printf("❌ Scheduled message operation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleCreateScheduledMessage schedules a message
+// @Summary Schedule a message
+// @Description Send a text, voice note or file once at send_at, or repeatedly on a cron recurrence ("minute hour day month weekday", e.g. "0 9 * * mon-fri") in the given time zone. When due, the message goes through the outbox.
+// @Tags Scheduled Messages
+// @Accept json
+// @Produce json
+// @Param request body ScheduledMessageRequest true "Scheduled message"
+// @Success 201 {object} models.ScheduledMessage "Scheduled message"
+// @Failure 400 {object} map[string]string "Invalid schedule"
+// @Failure 403 {object} map[string]string "Sends need approval and the API key is not an admin key"
+// @Router /api/scheduled-messages [post]
+func HandleCreateScheduledMessage(w http.ResponseWriter, r *http.Request, sched *scheduler.Scheduler) {
+	var req ScheduledMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	m, err := req.toScheduledMessage()
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	if !AllowRecipient(w, r, m.Recipient) || (m.MediaPath != "" && !allowMedia(w, r)) {
+		return
+	}
+	m.CreatedBy = requesterFromRequest(r)
+
+	if err := sched.Create(m); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	log.Printf("⏰ Scheduled %s message %d to %s, next run %s", m.Kind, m.ID, m.Recipient, m.NextRunAt.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(m)
+}
+
+// HandleListScheduledMessages lists scheduled messages
+// @Summary List scheduled messages
+// @Tags Scheduled Messages
+// @Produce json
+// @Param status query string false "Filter by status: active, completed, cancelled or failed"
+// @Success 200 {array} models.ScheduledMessage "Scheduled messages"
+// @Router /api/scheduled-messages [get]
+func HandleListScheduledMessages(w http.ResponseWriter, r *http.Request, sched *scheduler.Scheduler) {
+	list, err := sched.List(r.URL.Query().Get("status"))
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	if list == nil {
+		list = []*models.ScheduledMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleGetScheduledMessage returns a scheduled message
+// @Summary Get scheduled message
+// @Tags Scheduled Messages
+// @Produce json
+// @Param id path int true "Scheduled message ID"
+// @Success 200 {object} models.ScheduledMessage "Scheduled message"
+// @Failure 404 {object} map[string]string "Scheduled message not found"
+// @Router /api/scheduled-messages/{id} [get]
+func HandleGetScheduledMessage(w http.ResponseWriter, r *http.Request, sched *scheduler.Scheduler) {
+	id, ok := scheduledMessageID(w, r)
+	if !ok {
+		return
+	}
+	m, err := sched.Get(id)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// HandleUpdateScheduledMessage edits an active scheduled message
+// @Summary Edit scheduled message
+// @Description Replace the recipient, content and timing of an active scheduled message. Omit media_path to keep the stored voice note or file.
+// @Tags Scheduled Messages
+// @Accept json
+// @Produce json
+// @Param id path int true "Scheduled message ID"
+// @Param request body ScheduledMessageRequest true "Scheduled message"
+// @Success 200 {object} models.ScheduledMessage "Updated scheduled message"
+// @Failure 400 {object} map[string]string "Invalid schedule"
+// @Failure 403 {object} map[string]string "Sends need approval and the API key is not an admin key"
+// @Failure 404 {object} map[string]string "Scheduled message not found"
+// @Failure 409 {object} map[string]string "Scheduled message is no longer active"
+// @Router /api/scheduled-messages/{id} [put]
+func HandleUpdateScheduledMessage(w http.ResponseWriter, r *http.Request, sched *scheduler.Scheduler) {
+	id, ok := scheduledMessageID(w, r)
+	if !ok {
+		return
+	}
+	var req ScheduledMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	m, err := req.toScheduledMessage()
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	if !AllowRecipient(w, r, m.Recipient) || (m.MediaPath != "" && !allowMedia(w, r)) {
+		return
+	}
+	m.ID = id
+
+	if err := sched.Update(m); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	updated, err := sched.Get(id)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// HandleCancelScheduledMessage cancels a scheduled message
+// @Summary Cancel scheduled message
+// @Description Stop an active scheduled message from being sent. The record is kept with status cancelled.
+// @Tags Scheduled Messages
+// @Produce json
+// @Param id path int true "Scheduled message ID"
+// @Success 200 {object} models.ScheduledMessage "Cancelled scheduled message"
+// @Failure 404 {object} map[string]string "Scheduled message not found"
+// @Failure 409 {object} map[string]string "Scheduled message is no longer active"
+// @Router /api/scheduled-messages/{id} [delete]
+func HandleCancelScheduledMessage(w http.ResponseWriter, r *http.Request, sched *scheduler.Scheduler) {
+	id, ok := scheduledMessageID(w, r)
+	if !ok {
+		return
+	}
+	m, err := sched.Cancel(id)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
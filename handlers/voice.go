@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"whatsapp-go-mcp/models"
 	"whatsapp-go-mcp/whatsapp"
 )
 
@@ -23,6 +24,8 @@ type SendVoiceNoteRequest struct {
 // SendVoiceNoteResponse represents the response from voice note sending
 type SendVoiceNoteResponse struct {
 	Success   bool   `json:"success" example:"true"`
+	ID        int64  `json:"id,omitempty" example:"42"`
+	Status    string `json:"status,omitempty" example:"sent"`
 	Recipient string `json:"recipient" example:"1234567890@s.whatsapp.net"`
 	Filename  string `json:"filename" example:"voice_note.ogg"`
 	Timestamp string `json:"timestamp" example:"2025-09-25T00:50:40+02:00"`
@@ -31,31 +34,72 @@ type SendVoiceNoteResponse struct {
 
 // HandleSendVoiceNote handles voice note upload and sending
 // @Summary Send a voice note via WhatsApp
-// @Description Upload and send an audio file as a WhatsApp voice message
+// @Description Upload and send an audio file as a WhatsApp voice message. If it cannot be sent right away it stays in the outbox and is retried. With APPROVAL_MODE set to api or all the voice note is drafted instead and the response is the draft (202).
 // @Tags API
 // @Accept multipart/form-data
 // @Produce json
+// @Param Idempotency-Key header string false "Key that makes the request safe to retry"
 // @Param recipient formData string true "Recipient JID"
 // @Param file formData file true "Audio file (.ogg opus format)"
 // @Success 200 {object} SendVoiceNoteResponse "Voice note sent successfully"
+// @Success 202 {object} SendVoiceNoteResponse "Voice note queued for delivery"
 // @Failure 400 {object} map[string]string "Bad request"
 // @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 403 {object} map[string]string "Recipient blocked by the send policy or the API key"
+// @Failure 429 {object} map[string]string "Send rate limit exceeded; see Retry-After"
 // @Router /api/send-voice-note [post]
 func HandleSendVoiceNote(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
+	recipient, filename, path, ok := receiveVoiceNote(w, r)
+	if !ok {
+		return
+	}
+	defer os.Remove(path) // Clean up temp file
+
+	// Send voice note
+	log.Printf("📤 Sending voice note to %s: %s", recipient, filename)
+	queued, err := client.QueueAudio(recipient, path, r.Header.Get(IdempotencyKeyHeader))
+	if err != nil {
+		WriteOutboxError(w, err)
+		return
+	}
+
+	response := SendVoiceNoteResponse{
+		Success:   queued.Status != models.OutboxFailed,
+		ID:        queued.ID,
+		Status:    queued.Status,
+		Recipient: recipient,
+		Filename:  filename,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Error:     queued.LastError,
+	}
+	log.Printf("✅ Voice note to %s is %s (outbox %d)", recipient, queued.Status, queued.ID)
+	w.Header().Set("Content-Type", "application/json")
+	AuditQueued(r, queued)
+	w.WriteHeader(OutboxStatusCode(queued))
+	json.NewEncoder(w).Encode(response)
+}
+
+// receiveVoiceNote reads the recipient and audio file of a voice note upload,
+// saving the file to a temporary path the caller must remove. It writes the
+// error response and reports false if the upload is invalid.
+func receiveVoiceNote(w http.ResponseWriter, r *http.Request) (recipient, filename, path string, ok bool) {
 	// Parse multipart form (max 32MB)
 	err := r.ParseMultipartForm(32 << 20) // 32MB
 	if err != nil {
 		log.Printf("❌ Failed to parse multipart form: %v", err)
 		http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
-		return
+		return "", "", "", false
 	}
 
 	// Get recipient from form
-	recipient := r.FormValue("recipient")
+	recipient = r.FormValue("recipient")
 	if recipient == "" {
 		log.Printf("❌ Missing recipient parameter")
 		http.Error(w, "Missing recipient parameter", http.StatusBadRequest)
-		return
+		return "", "", "", false
+	}
+	if !AllowRecipient(w, r, recipient) {
+		return "", "", "", false
 	}
 
 	// Get uploaded file
@@ -63,7 +107,7 @@ func HandleSendVoiceNote(w http.ResponseWriter, r *http.Request, client *whatsap
 	if err != nil {
 		log.Printf("❌ Failed to get uploaded file: %v", err)
 		http.Error(w, "Failed to get uploaded file", http.StatusBadRequest)
-		return
+		return "", "", "", false
 	}
 	defer file.Close()
 
@@ -71,7 +115,7 @@ func HandleSendVoiceNote(w http.ResponseWriter, r *http.Request, client *whatsap
 	if !isValidAudioFile(header.Filename) {
 		log.Printf("❌ Invalid audio file type: %s", header.Filename)
 		http.Error(w, "Invalid audio file type. Supported formats: .ogg, .opus, .mp3, .wav, .m4a, .aac, .flac, .wma, .mp4, .3gp, .amr", http.StatusBadRequest)
-		return
+		return "", "", "", false
 	}
 
 	// Create temporary file
@@ -79,153 +123,146 @@ func HandleSendVoiceNote(w http.ResponseWriter, r *http.Request, client *whatsap
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		log.Printf("❌ Failed to create temp directory: %v", err)
 		http.Error(w, "Failed to create temp directory", http.StatusInternalServerError)
-		return
+		return "", "", "", false
 	}
 
 	tempFile, err := os.CreateTemp(tempDir, "voice_note_*.ogg")
 	if err != nil {
 		log.Printf("❌ Failed to create temp file: %v", err)
 		http.Error(w, "Failed to create temp file", http.StatusInternalServerError)
-		return
+		return "", "", "", false
 	}
-	defer os.Remove(tempFile.Name()) // Clean up temp file
 	defer tempFile.Close()
 
 	// Copy uploaded file to temp file
 	_, err = io.Copy(tempFile, file)
 	if err != nil {
 		log.Printf("❌ Failed to copy file: %v", err)
+		os.Remove(tempFile.Name())
 		http.Error(w, "Failed to copy file", http.StatusInternalServerError)
-		return
-	}
-
-	// Send voice note
-	log.Printf("📤 Sending voice note to %s: %s", recipient, header.Filename)
-	err = client.SendAudioMessage(recipient, tempFile.Name())
-	if err != nil {
-		log.Printf("❌ Failed to send voice note: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		response := SendVoiceNoteResponse{
-			Success:   false,
-			Recipient: recipient,
-			Filename:  header.Filename,
-			Error:     err.Error(),
-		}
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	log.Printf("✅ Voice note sent successfully")
-
-	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	response := SendVoiceNoteResponse{
-		Success:   true,
-		Recipient: recipient,
-		Filename:  header.Filename,
-		Timestamp: time.Now().Format(time.RFC3339),
+		return "", "", "", false
 	}
-	log.Printf("✅ Voice note sent successfully to %s", recipient)
-	json.NewEncoder(w).Encode(response)
+	return recipient, header.Filename, tempFile.Name(), true
 }
 
 // SendRequest represents a request to send media (Python-style API)
 type SendRequest struct {
 	Recipient string `json:"recipient" example:"1234567890@s.whatsapp.net"`
-	MediaPath string `json:"media_path" example:"/path/to/audio/file.ogg"`
+	MediaPath string `json:"media_path" example:"audio/file.ogg"`
 }
 
 // SendResponse represents the response from send operation
 type SendResponse struct {
 	Success bool   `json:"success" example:"true"`
+	ID      int64  `json:"id,omitempty" example:"42"`
+	Status  string `json:"status,omitempty" example:"sent"`
 	Message string `json:"message" example:"Voice message sent successfully"`
 }
 
 // HandleSend handles the Python-style /send endpoint
 // @Summary Send a voice message via WhatsApp (Python-style API)
-// @Description Send an audio file as a WhatsApp voice message using media_path parameter
+// @Description Send an audio file as a WhatsApp voice message using media_path parameter. If it cannot be sent right away it stays in the outbox and is retried. With APPROVAL_MODE set to api or all the voice message is drafted instead and the response is the draft (202).
 // @Tags API
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Key that makes the request safe to retry"
 // @Param request body SendRequest true "Send request with recipient and media_path"
 // @Success 200 {object} SendResponse "Voice message sent successfully"
+// @Success 202 {object} SendResponse "Voice message queued for delivery"
 // @Failure 400 {object} map[string]string "Bad request"
 // @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 403 {object} map[string]string "Recipient blocked by the send policy or the API key"
+// @Failure 429 {object} map[string]string "Send rate limit exceeded; see Retry-After"
 // @Router /send [post]
 func HandleSend(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
-	var req SendRequest
+	req, mediaPath, cleanup, ok := resolveSendRequest(w, r, client)
+	if !ok {
+		return
+	}
+	defer cleanup()
+
+	// Send voice message using WhatsApp client
+	log.Printf("📤 Sending voice message to %s: %s", req.Recipient, mediaPath)
+	queued, err := client.QueueAudio(req.Recipient, mediaPath, r.Header.Get(IdempotencyKeyHeader))
+	if err != nil {
+		WriteOutboxError(w, err)
+		return
+	}
+
+	response := SendResponse{
+		Success: queued.Status != models.OutboxFailed,
+		ID:      queued.ID,
+		Status:  queued.Status,
+	}
+	switch queued.Status {
+	case models.OutboxSent:
+		response.Message = "Voice message sent successfully"
+	case models.OutboxFailed:
+		response.Message = fmt.Sprintf("Failed to send voice message: %s", queued.LastError)
+	default:
+		response.Message = "Voice message queued for delivery"
+	}
+	log.Printf("✅ Voice message to %s is %s (outbox %d)", req.Recipient, queued.Status, queued.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	AuditQueued(r, queued)
+	w.WriteHeader(OutboxStatusCode(queued))
+	json.NewEncoder(w).Encode(response)
+}
+
+// resolveSendRequest decodes a /send request, checks its media path and
+// converts the file to Opus OGG if needed. cleanup removes the converted copy.
+// It writes the error response and reports false if the request is invalid.
+func resolveSendRequest(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) (req SendRequest, mediaPath string, cleanup func(), ok bool) {
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("❌ Failed to decode request: %v", err)
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+		return req, "", nil, false
 	}
 
 	// Validate input
 	if req.Recipient == "" {
 		log.Printf("❌ Missing recipient parameter")
 		http.Error(w, "Recipient must be provided", http.StatusBadRequest)
-		return
+		return req, "", nil, false
+	}
+	if !AllowRecipient(w, r, req.Recipient) {
+		return req, "", nil, false
 	}
 
 	if req.MediaPath == "" {
 		log.Printf("❌ Missing media_path parameter")
 		http.Error(w, "Media path must be provided", http.StatusBadRequest)
-		return
+		return req, "", nil, false
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(req.MediaPath); os.IsNotExist(err) {
-		log.Printf("❌ Media file not found: %s", req.MediaPath)
-		http.Error(w, fmt.Sprintf("Media file not found: %s", req.MediaPath), http.StatusBadRequest)
-		return
+	// Only files inside the media directory may be sent
+	mediaPath, err := client.CheckMediaPath(req.MediaPath)
+	if err != nil {
+		log.Printf("❌ Media file not allowed: %s: %v", req.MediaPath, err)
+		http.Error(w, fmt.Sprintf("Media file not found in the media directory: %s", req.MediaPath), http.StatusBadRequest)
+		return req, "", nil, false
 	}
 
 	// Convert to Opus OGG if needed (matching Python implementation)
-	mediaPath := req.MediaPath
-	if !strings.HasSuffix(strings.ToLower(req.MediaPath), ".ogg") {
-		log.Printf("🔄 Converting file to Opus OGG format: %s", req.MediaPath)
+	if !strings.HasSuffix(strings.ToLower(mediaPath), ".ogg") {
+		log.Printf("🔄 Converting file to Opus OGG format: %s", mediaPath)
 
-		convertedPath, err := convertToOpusOGG(req.MediaPath)
+		convertedPath, err := convertToOpusOGG(mediaPath)
 		if err != nil {
 			log.Printf("❌ Error converting file to opus ogg: %v", err)
 			http.Error(w, fmt.Sprintf("Error converting file to opus ogg. You likely need to install ffmpeg: %v", err), http.StatusInternalServerError)
-			return
+			return req, "", nil, false
 		}
-		mediaPath = convertedPath
 
 		// Clean up converted file after sending
-		defer func() {
+		return req, convertedPath, func() {
 			if err := os.Remove(convertedPath); err != nil {
 				log.Printf("⚠️ Failed to clean up converted file: %v", err)
 			}
-		}()
-	}
-
-	// Send voice message using WhatsApp client
-	log.Printf("📤 Sending voice message to %s: %s", req.Recipient, mediaPath)
-	err := client.SendAudioMessage(req.Recipient, mediaPath)
-	if err != nil {
-		log.Printf("❌ Failed to send voice message: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		response := SendResponse{
-			Success: false,
-			Message: fmt.Sprintf("Failed to send voice message: %v", err),
-		}
-		json.NewEncoder(w).Encode(response)
-		return
+		}, true
 	}
-
-	log.Printf("✅ Voice message sent successfully")
-
-	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	response := SendResponse{
-		Success: true,
-		Message: "Voice message sent successfully",
-	}
-	json.NewEncoder(w).Encode(response)
+	return req, mediaPath, func() {}, true
 }
 
 // convertToOpusOGG converts any audio file to Opus OGG format
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/webhooks"
+)
+
+// WebhookRequest represents the request body for creating or updating a webhook
+type WebhookRequest struct {
+	URL        string   `json:"url" example:"https://crm.example.com/whatsapp"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types,omitempty" example:"message"`
+	ChatJIDs   []string `json:"chat_jids,omitempty"`
+	Enabled    *bool    `json:"enabled,omitempty"`
+}
+
+// toWebhook converts the request to a webhook; webhooks are enabled unless disabled explicitly
+func (req *WebhookRequest) toWebhook() *models.Webhook {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return &models.Webhook{
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: req.EventTypes,
+		ChatJIDs:   req.ChatJIDs,
+		Enabled:    enabled,
+	}
+}
+
+// webhookID parses the {id} path variable
+func webhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeWebhookError maps dispatcher errors to HTTP status codes
+func writeWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidWebhook):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+	default:
+		log.Printf("❌ Webhook operation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleCreateWebhook creates a webhook subscription
+// @Summary Create webhook
+// @Description Subscribe a URL to message, receipt, presence, group and connection events. Deliveries are signed with HMAC-SHA256 in the X-Webhook-Signature header. The secret is only returned on creation; a random one is generated if omitted.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param request body WebhookRequest true "Webhook subscription"
+// @Success 201 {object} models.Webhook "Created webhook, including its secret"
+// @Failure 400 {object} map[string]string "Invalid webhook"
+// @Router /api/webhooks [post]
+func HandleCreateWebhook(w http.ResponseWriter, r *http.Request, dispatcher *webhooks.Dispatcher) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	webhook := req.toWebhook()
+	if err := dispatcher.Create(webhook); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// HandleListWebhooks lists webhook subscriptions
+// @Summary List webhooks
+// @Description List webhook subscriptions. Secrets are not included.
+// @Tags Webhooks
+// @Produce json
+// @Success 200 {array} models.Webhook "Webhooks"
+// @Router /api/webhooks [get]
+func HandleListWebhooks(w http.ResponseWriter, r *http.Request, dispatcher *webhooks.Dispatcher) {
+	list, err := dispatcher.List()
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	for _, webhook := range list {
+		webhook.Secret = ""
+	}
+	if list == nil {
+		list = []*models.Webhook{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleGetWebhook returns a webhook subscription
+// @Summary Get webhook
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.Webhook "Webhook"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Router /api/webhooks/{id} [get]
+func HandleGetWebhook(w http.ResponseWriter, r *http.Request, dispatcher *webhooks.Dispatcher) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	webhook, err := dispatcher.Get(id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	webhook.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// HandleUpdateWebhook replaces the settings of a webhook subscription
+// @Summary Update webhook
+// @Description Replace the URL, filters and enabled state of a webhook. The secret is kept unless a new one is given.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param request body WebhookRequest true "Webhook subscription"
+// @Success 200 {object} models.Webhook "Updated webhook"
+// @Failure 400 {object} map[string]string "Invalid webhook"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Router /api/webhooks/{id} [put]
+func HandleUpdateWebhook(w http.ResponseWriter, r *http.Request, dispatcher *webhooks.Dispatcher) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	webhook := req.toWebhook()
+	webhook.ID = id
+	if err := dispatcher.Update(webhook); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	if updated, err := dispatcher.Get(id); err == nil {
+		webhook = updated
+	}
+	webhook.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// HandleDeleteWebhook removes a webhook subscription
+// @Summary Delete webhook
+// @Description Remove a webhook subscription and its delivery queue
+// @Tags Webhooks
+// @Param id path int true "Webhook ID"
+// @Success 204 "Webhook deleted"
+// @Failure 404 {object} map[string]string "Webhook not found"
+// @Router /api/webhooks/{id} [delete]
+func HandleDeleteWebhook(w http.ResponseWriter, r *http.Request, dispatcher *webhooks.Dispatcher) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	if err := dispatcher.Delete(id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListWebhookDeliveries lists recent deliveries of a webhook
+// @Summary List webhook deliveries
+// @Description List the most recent deliveries of a webhook with their status, attempts and last error
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param status query string false "Filter by status: pending, delivered or failed"
+// @Param limit query int false "Maximum number of deliveries" default(50)
+// @Success 200 {array} models.WebhookDelivery "Deliveries"
+// @Router /api/webhooks/{id}/deliveries [get]
+func HandleListWebhookDeliveries(w http.ResponseWriter, r *http.Request, dispatcher *webhooks.Dispatcher) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := dispatcher.Deliveries(id, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*models.WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// HandleRetryWebhookDelivery queues a failed delivery again
+// @Summary Retry webhook delivery
+// @Description Put a delivery that failed after all attempts back into the queue
+// @Tags Webhooks
+// @Param id path int true "Webhook ID"
+// @Param delivery path int true "Delivery ID"
+// @Success 202 "Delivery queued"
+// @Failure 404 {object} map[string]string "No failed delivery with that ID"
+// @Router /api/webhooks/{id}/deliveries/{delivery}/retry [post]
+func HandleRetryWebhookDelivery(w http.ResponseWriter, r *http.Request, dispatcher *webhooks.Dispatcher) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(mux.Vars(r)["delivery"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+	if err := dispatcher.Retry(id, deliveryID); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
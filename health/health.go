@@ -0,0 +1,197 @@
+// Package health runs the component checks behind the liveness and readiness
+// probes. Each check reports pass, warn, fail or skip; a failing critical
+// check makes the whole report fail, anything else only degrades it.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// Check and report statuses
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// checkTimeout bounds a single check
+const checkTimeout = 3 * time.Second
+
+// Check is a named component check
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) Result
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name       string                 `json:"name"`
+	Status     string                 `json:"status"`
+	Critical   bool                   `json:"critical"`
+	Message    string                 `json:"message,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+}
+
+// Report is the outcome of a set of checks
+type Report struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Checks []Result  `json:"checks"`
+}
+
+// HTTPStatus returns 503 if a critical check failed and 200 otherwise
+func (r *Report) HTTPStatus() int {
+	if r.Status == StatusFail {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Run runs the checks concurrently, each bounded by a timeout, and returns
+// the results in the order given
+func Run(ctx context.Context, checks ...Check) *Report {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			result := check.Run(ctx)
+			result.Name, result.Critical = check.Name, check.Critical
+			result.DurationMS = time.Since(start).Milliseconds()
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusPass, Time: time.Now(), Checks: results}
+	for _, result := range results {
+		switch {
+		case result.Status == StatusFail && result.Critical:
+			report.Status = StatusFail
+		case (result.Status == StatusFail || result.Status == StatusWarn) && report.Status == StatusPass:
+			report.Status = StatusWarn
+		}
+	}
+	return report
+}
+
+// WhatsApp checks that the client is connected and logged in. Waiting for a
+// pairing, including after a logout, is a warning so the pod stays reachable
+// for linking over /api/pairing.
+func WhatsApp(client *whatsapp.Client) Check {
+	return Check{Name: "whatsapp", Critical: true, Run: func(ctx context.Context) Result {
+		state := client.ConnectionState()
+		details := map[string]interface{}{"state": state.State, "since": state.Since}
+		if state.Reason != "" {
+			details["reason"] = state.Reason
+		}
+		switch {
+		case state.State == whatsapp.StateConnected && client.IsLoggedIn():
+			return Result{Status: StatusPass, Details: details}
+		case state.State == whatsapp.StatePairing || state.State == whatsapp.StateLoggedOut:
+			return Result{Status: StatusWarn, Message: "waiting for the device to be paired", Details: details}
+		default:
+			return Result{Status: StatusFail, Message: "not connected to WhatsApp", Details: details}
+		}
+	}}
+}
+
+// DatabaseWritable checks that the message database accepts writes
+func DatabaseWritable(db *models.Database) Check {
+	return Check{Name: "database", Critical: true, Run: func(ctx context.Context) Result {
+		if err := db.CheckWritable(ctx); err != nil {
+			return Result{Status: StatusFail, Message: err.Error()}
+		}
+		return Result{Status: StatusPass}
+	}}
+}
+
+// DatabaseResponsive checks that the message database answers a query
+func DatabaseResponsive(db *models.Database) Check {
+	return Check{Name: "database", Critical: true, Run: func(ctx context.Context) Result {
+		if err := db.Ping(ctx); err != nil {
+			return Result{Status: StatusFail, Message: err.Error()}
+		}
+		return Result{Status: StatusPass}
+	}}
+}
+
+// DiskSpace checks that the file system holding dir has at least minFree
+// bytes available
+func DiskSpace(name, dir string, minFree uint64) Check {
+	return Check{Name: name, Critical: true, Run: func(ctx context.Context) Result {
+		free, total, err := diskSpace(dir)
+		if err != nil {
+			return Result{Status: StatusFail, Message: err.Error()}
+		}
+		details := map[string]interface{}{"path": dir, "free_bytes": free, "total_bytes": total, "min_free_bytes": minFree}
+		if free < minFree {
+			return Result{Status: StatusFail, Message: fmt.Sprintf("only %d MB free", free/(1<<20)), Details: details}
+		}
+		return Result{Status: StatusPass, Details: details}
+	}}
+}
+
+// Endpoint checks that an HTTP dependency answers. Any response below 500
+// counts, since services differ in what they return for a bare GET. An empty
+// URL means the dependency is not configured and the check is skipped.
+func Endpoint(name, url string, critical bool) Check {
+	return Check{Name: name, Critical: critical, Run: func(ctx context.Context) Result {
+		if url == "" {
+			return Result{Status: StatusSkip, Message: "not configured"}
+		}
+		details := map[string]interface{}{"url": url}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return Result{Status: StatusFail, Message: err.Error(), Details: details}
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return Result{Status: StatusFail, Message: err.Error(), Details: details}
+		}
+		resp.Body.Close()
+		details["status_code"] = resp.StatusCode
+		if resp.StatusCode >= 500 {
+			return Result{Status: StatusFail, Message: resp.Status, Details: details}
+		}
+		return Result{Status: StatusPass, Details: details}
+	}}
+}
+
+// Probes holds the checks behind the liveness and readiness endpoints
+type Probes struct {
+	Live  []Check
+	Ready []Check
+	// ReadyEach returns readiness checks built on every run, for components
+	// that come and go such as accounts
+	ReadyEach func() []Check
+}
+
+// Liveness runs the liveness checks
+func (p *Probes) Liveness(ctx context.Context) *Report {
+	return Run(ctx, p.Live...)
+}
+
+// Readiness runs the readiness checks
+func (p *Probes) Readiness(ctx context.Context) *Report {
+	checks := p.Ready
+	if p.ReadyEach != nil {
+		checks = append(p.ReadyEach(), checks...)
+	}
+	return Run(ctx, checks...)
+}
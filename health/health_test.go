@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func result(status string) func(context.Context) Result {
+	return func(context.Context) Result { return Result{Status: status} }
+}
+
+func TestRunAggregatesStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		checks []Check
+		want   string
+		code   int
+	}{
+		{"all pass", []Check{{Name: "a", Critical: true, Run: result(StatusPass)}, {Name: "b", Run: result(StatusSkip)}}, StatusPass, http.StatusOK},
+		{"optional fails", []Check{{Name: "a", Critical: true, Run: result(StatusPass)}, {Name: "b", Run: result(StatusFail)}}, StatusWarn, http.StatusOK},
+		{"critical warns", []Check{{Name: "a", Critical: true, Run: result(StatusWarn)}}, StatusWarn, http.StatusOK},
+		{"critical fails", []Check{{Name: "a", Critical: true, Run: result(StatusFail)}, {Name: "b", Run: result(StatusWarn)}}, StatusFail, http.StatusServiceUnavailable},
+	} {
+		report := Run(context.Background(), tc.checks...)
+		if report.Status != tc.want || report.HTTPStatus() != tc.code {
+			t.Errorf("%s: got %s/%d, want %s/%d", tc.name, report.Status, report.HTTPStatus(), tc.want, tc.code)
+		}
+		if len(report.Checks) != len(tc.checks) || report.Checks[0].Name != "a" {
+			t.Errorf("%s: results out of order: %+v", tc.name, report.Checks)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}))
+	defer ok.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	for url, want := range map[string]string{
+		ok.URL:     StatusPass,
+		broken.URL: StatusFail,
+		down.URL:   StatusFail,
+		"":         StatusSkip,
+	} {
+		if got := Endpoint("tts", url, false).Run(context.Background()); got.Status != want {
+			t.Errorf("Endpoint(%q) = %s (%s), want %s", url, got.Status, got.Message, want)
+		}
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if got := DiskSpace("media_disk", dir, 1).Run(context.Background()); got.Status != StatusPass {
+		t.Errorf("DiskSpace with 1 byte required = %s (%s)", got.Status, got.Message)
+	}
+	if got := DiskSpace("media_disk", dir, 1<<62).Run(context.Background()); got.Status != StatusFail {
+		t.Errorf("DiskSpace with 4 EiB required = %s", got.Status)
+	}
+	if got := DiskSpace("media_disk", dir+"/missing", 1).Run(context.Background()); got.Status != StatusFail {
+		t.Errorf("DiskSpace of a missing directory = %s", got.Status)
+	}
+}
+
+func TestReadinessRunsChecksBuiltOnEveryRun(t *testing.T) {
+	accounts := []string{"whatsapp"}
+	p := &Probes{
+		Ready: []Check{{Name: "tts", Run: result(StatusPass)}},
+		ReadyEach: func() []Check {
+			var checks []Check
+			for i, name := range accounts {
+				status := StatusPass
+				if i > 0 {
+					status = StatusFail
+				}
+				checks = append(checks, Check{Name: name, Critical: true, Run: result(status)})
+			}
+			return checks
+		},
+	}
+	if report := p.Readiness(context.Background()); report.Status != StatusPass || len(report.Checks) != 2 {
+		t.Fatalf("one account: %s with %d checks, want pass with 2", report.Status, len(report.Checks))
+	}
+
+	// An account added later is checked too
+	accounts = append(accounts, "whatsapp:sales")
+	report := p.Readiness(context.Background())
+	if report.Status != StatusFail || len(report.Checks) != 3 || report.Checks[1].Name != "whatsapp:sales" {
+		t.Errorf("two accounts: %s with %+v, want the failing sales account to fail readiness", report.Status, report.Checks)
+	}
+	if len(p.Ready) != 1 {
+		t.Errorf("Ready was changed to %d checks", len(p.Ready))
+	}
+}
@@ -0,0 +1,272 @@
+// Package hours describes when the business is open: a weekly schedule in a
+// time zone, with holidays and special opening hours on given dates. It also
+// holds what the bot does outside those hours.
+package hours
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lookaround bounds how far back or ahead the schedule is searched for the
+// previous closing or next opening
+const lookaround = 14
+
+// dayNames maps the day names used in schedules to weekdays
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window is an opening window within a day, in minutes after midnight
+type Window struct {
+	Start int
+	End   int
+}
+
+// Calendar is a weekly opening schedule with date exceptions
+type Calendar struct {
+	Location *time.Location
+	weekly   [7][]Window
+	special  map[string][]Window // by "2006-01-02"; empty means closed all day
+}
+
+// Parse builds a calendar. The schedule lists days or day ranges with their
+// windows, separated by semicolons:
+//
+//	mon-fri 09:00-12:30,13:30-17:30; sat 10:00-14:00
+//
+// Days not listed are closed. Exceptions list dates that are closed, or open
+// with their own windows instead of the weekly ones:
+//
+//	2025-12-25; 2025-12-26; 2025-12-24 09:00-13:00
+func Parse(timezone, schedule, exceptions string) (*Calendar, error) {
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", timezone)
+		}
+	}
+	c := &Calendar{Location: loc, special: make(map[string][]Window)}
+
+	for _, entry := range splitEntries(schedule) {
+		days, spec, _ := strings.Cut(entry, " ")
+		weekdays, err := parseDays(days)
+		if err != nil {
+			return nil, err
+		}
+		windows, err := parseWindows(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+		if len(windows) == 0 {
+			return nil, fmt.Errorf("%q: missing opening hours", entry)
+		}
+		for _, day := range weekdays {
+			c.weekly[day] = append(c.weekly[day], windows...)
+			sortWindows(c.weekly[day])
+		}
+	}
+
+	for _, entry := range splitEntries(exceptions) {
+		date, spec, _ := strings.Cut(entry, " ")
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("invalid date %q (use YYYY-MM-DD)", date)
+		}
+		windows, err := parseWindows(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+		c.special[date] = windows
+	}
+	return c, nil
+}
+
+func splitEntries(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ";") {
+		if entry = strings.Join(strings.Fields(entry), " "); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parseDays parses "mon", "mon-fri" or "fri-mon" into weekdays
+func parseDays(value string) ([]time.Weekday, error) {
+	first, last, isRange := strings.Cut(strings.ToLower(value), "-")
+	from, ok := dayNames[first]
+	if !ok {
+		return nil, fmt.Errorf("unknown day %q (use mon, tue, wed, thu, fri, sat, sun)", first)
+	}
+	if !isRange {
+		return []time.Weekday{from}, nil
+	}
+	to, ok := dayNames[last]
+	if !ok {
+		return nil, fmt.Errorf("unknown day %q (use mon, tue, wed, thu, fri, sat, sun)", last)
+	}
+	days := []time.Weekday{from}
+	for day := from; day != to; {
+		day = (day + 1) % 7
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// parseWindows parses comma-separated "HH:MM-HH:MM" windows
+func parseWindows(value string) ([]Window, error) {
+	var windows []Window
+	for _, spec := range strings.Split(value, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		from, to, _ := strings.Cut(spec, "-")
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if end <= start {
+			return nil, fmt.Errorf("window %s must end after it starts", spec)
+		}
+		windows = append(windows, Window{Start: start, End: end})
+	}
+	sortWindows(windows)
+	return windows, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight; "24:00" is the end of the day
+func parseClock(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func sortWindows(windows []Window) {
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Start < windows[j].Start })
+}
+
+// windowsOn returns the opening windows of a local date
+func (c *Calendar) windowsOn(date time.Time) []Window {
+	if windows, ok := c.special[date.Format("2006-01-02")]; ok {
+		return windows
+	}
+	return c.weekly[date.Weekday()]
+}
+
+// at returns the time minutes after the local midnight of date
+func (c *Calendar) at(date time.Time, minutes int) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), minutes/60, minutes%60, 0, 0, c.Location)
+}
+
+// IsOpen reports whether t falls within opening hours
+func (c *Calendar) IsOpen(t time.Time) bool {
+	local := t.In(c.Location)
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range c.windowsOn(local) {
+		if minute >= w.Start && minute < w.End {
+			return true
+		}
+	}
+	return false
+}
+
+// ClosedSince returns when the closed period containing t began, which
+// identifies the period. It returns the zero time if the business is open at t.
+func (c *Calendar) ClosedSince(t time.Time) time.Time {
+	if c.IsOpen(t) {
+		return time.Time{}
+	}
+	local := t.In(c.Location)
+	for d := 0; d <= lookaround; d++ {
+		date := local.AddDate(0, 0, -d)
+		windows := c.windowsOn(date)
+		for i := len(windows) - 1; i >= 0; i-- {
+			if end := c.at(date, windows[i].End); !end.After(t) {
+				return end
+			}
+		}
+	}
+	return c.at(local.AddDate(0, 0, -lookaround), 0)
+}
+
+// NextOpen returns when the business next opens after t, or the zero time
+// if it does not open within two weeks
+func (c *Calendar) NextOpen(t time.Time) time.Time {
+	local := t.In(c.Location)
+	for d := 0; d <= lookaround; d++ {
+		date := local.AddDate(0, 0, d)
+		for _, w := range c.windowsOn(date) {
+			if start := c.at(date, w.Start); start.After(t) {
+				return start
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// BotMode is how the LlamaStack bot behaves outside business hours
+type BotMode string
+
+// Bot modes
+const (
+	BotOn         BotMode = "on"         // answer as usual
+	BotOff        BotMode = "off"        // do not answer
+	BotRestricted BotMode = "restricted" // answer general questions without tools
+)
+
+// ParseBotMode parses a bot mode, defaulting to BotOn
+func ParseBotMode(value string) (BotMode, error) {
+	switch mode := BotMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return BotOn, nil
+	case BotOn, BotOff, BotRestricted:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown bot mode %q (use on, off or restricted)", value)
+	}
+}
+
+// RestrictedInstructions replace the bot instructions in restricted mode
+const RestrictedInstructions = `You are a helpful banking assistant. It is currently outside business hours and you have no access to customer data or tools.
+Answer general questions briefly. For anything about the customer's own accounts, transactions or personal details, explain that this can only be handled during business hours and do not guess.`
+
+// Policy is the business-hours behaviour of the client
+type Policy struct {
+	Calendar *Calendar
+	// AwayMessage is sent once per contact per closed period; "{next_open}"
+	// is replaced with the next opening time. Empty disables away messages.
+	AwayMessage string
+	// AfterHoursBot is the bot mode outside business hours
+	AfterHoursBot BotMode
+}
+
+// BotMode returns the bot mode at time t
+func (p *Policy) BotMode(t time.Time) BotMode {
+	if p == nil || p.Calendar == nil || p.Calendar.IsOpen(t) {
+		return BotOn
+	}
+	return p.AfterHoursBot
+}
+
+// FormatAwayMessage returns the away message for a message received at t
+func (p *Policy) FormatAwayMessage(t time.Time) string {
+	next := "soon"
+	if open := p.Calendar.NextOpen(t); !open.IsZero() {
+		next = open.Format("Mon 2 Jan 15:04")
+	}
+	return strings.ReplaceAll(p.AwayMessage, "{next_open}", next)
+}
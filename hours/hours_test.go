@@ -0,0 +1,117 @@
+package hours
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+)
+
+func dublinCalendar(t *testing.T) (*Calendar, *time.Location) {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Dublin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	c, err := Parse("Europe/Dublin", "mon-fri 09:00-12:30,13:30-17:30; sat 10:00-14:00", "2025-12-25; 2025-12-24 09:00-13:00")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return c, loc
+}
+
+func TestIsOpen(t *testing.T) {
+	c, loc := dublinCalendar(t)
+	for _, tc := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2025, 12, 22, 9, 0, 0, 0, loc), true},    // Monday opening
+		{time.Date(2025, 12, 22, 13, 0, 0, 0, loc), false},  // lunch
+		{time.Date(2025, 12, 22, 17, 30, 0, 0, loc), false}, // closing
+		{time.Date(2025, 12, 20, 11, 0, 0, 0, loc), true},   // Saturday
+		{time.Date(2025, 12, 21, 11, 0, 0, 0, loc), false},  // Sunday
+		{time.Date(2025, 12, 24, 14, 0, 0, 0, loc), false},  // Christmas Eve closes early
+		{time.Date(2025, 12, 25, 10, 0, 0, 0, loc), false},  // Christmas Day
+		{time.Date(2025, 12, 22, 3, 0, 0, 0, time.UTC), false},
+	} {
+		if got := c.IsOpen(tc.at); got != tc.want {
+			t.Errorf("IsOpen(%s) = %v, want %v", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestClosedSinceAndNextOpen(t *testing.T) {
+	c, loc := dublinCalendar(t)
+
+	// Friday night and Sunday morning belong to the period that started at
+	// Saturday's closing, not Friday's
+	friday := time.Date(2025, 12, 19, 23, 0, 0, 0, loc)
+	sunday := time.Date(2025, 12, 21, 3, 0, 0, 0, loc)
+	if got, want := c.ClosedSince(friday), time.Date(2025, 12, 19, 17, 30, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("ClosedSince(Friday night) = %s, want %s", got, want)
+	}
+	if got, want := c.ClosedSince(sunday), time.Date(2025, 12, 20, 14, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("ClosedSince(Sunday) = %s, want %s", got, want)
+	}
+	if got, want := c.NextOpen(sunday), time.Date(2025, 12, 22, 9, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("NextOpen(Sunday) = %s, want %s", got, want)
+	}
+	if !c.ClosedSince(time.Date(2025, 12, 22, 10, 0, 0, 0, loc)).IsZero() {
+		t.Error("ClosedSince should be zero while open")
+	}
+
+	// Christmas Day is skipped when looking for the next opening
+	if got, want := c.NextOpen(time.Date(2025, 12, 24, 14, 0, 0, 0, loc)), time.Date(2025, 12, 26, 9, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("NextOpen(Christmas Eve) = %s, want %s", got, want)
+	}
+}
+
+func TestAwayNoticeOncePerClosedPeriod(t *testing.T) {
+	c, loc := dublinCalendar(t)
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	const contact = "353851234567@s.whatsapp.net"
+	claims := 0
+	for _, at := range []time.Time{
+		time.Date(2025, 12, 22, 18, 0, 0, 0, loc),  // Monday evening
+		time.Date(2025, 12, 23, 3, 0, 0, 0, loc),   // same night
+		time.Date(2025, 12, 23, 12, 45, 0, 0, loc), // Tuesday lunch
+	} {
+		ok, err := db.ClaimAwayNotice(contact, c.ClosedSince(at))
+		if err != nil {
+			t.Fatalf("ClaimAwayNotice: %v", err)
+		}
+		if ok {
+			claims++
+		}
+	}
+	if claims != 2 {
+		t.Errorf("away message would be sent %d times, want 2", claims)
+	}
+}
+
+func TestParseRejectsInvalidSchedules(t *testing.T) {
+	for _, tc := range []struct{ timezone, schedule, exceptions string }{
+		{"Mars/Olympus", "mon 09:00-17:00", ""},
+		{"", "someday 09:00-17:00", ""},
+		{"", "mon 17:00-09:00", ""},
+		{"", "mon 9am-5pm", ""},
+		{"", "mon", ""},
+		{"", "mon 09:00-17:00", "25/12/2025"},
+	} {
+		if _, err := Parse(tc.timezone, tc.schedule, tc.exceptions); err == nil {
+			t.Errorf("expected %+v to be rejected", tc)
+		}
+	}
+	if _, err := ParseBotMode("sometimes"); err == nil {
+		t.Error("expected unknown bot mode to be rejected")
+	}
+}
@@ -20,14 +20,23 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"whatsapp-go-mcp/accounts"
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/auth"
+	"whatsapp-go-mcp/backup"
+	"whatsapp-go-mcp/config"
 	"whatsapp-go-mcp/handlers"
+	"whatsapp-go-mcp/ratelimit"
 	"whatsapp-go-mcp/whatsapp"
 
 	"github.com/gorilla/mux"
@@ -112,14 +121,96 @@ func handleSearchContacts(w http.ResponseWriter, r *http.Request, client *whatsa
 	json.NewEncoder(w).Encode(result)
 }
 
+// publicRoutes need no API key: probes and the API documentation
+var publicRoutes = map[string]bool{
+	"/health":        true,
+	"/healthz/live":  true,
+	"/healthz/ready": true,
+	"/openapi":       true,
+	"/openapi.json":  true,
+	"/openapi.yaml":  true,
+	"/swagger-ui":    true,
+	"/swagger-ui/":   true,
+}
+
+// routeScopes maps "METHOD /path/template" to the API key scope it needs.
+// Routes not listed here need the admin scope.
+var routeScopes = map[string]string{
+	"POST /api/list-messages":                                auth.ScopeReadMessages,
+	"POST /api/search-contacts":                              auth.ScopeReadMessages,
+	"GET /api/outbox/{id}":                                   auth.ScopeReadMessages,
+	"GET /api/scheduled-messages":                            auth.ScopeReadMessages,
+	"GET /api/scheduled-messages/{id}":                       auth.ScopeReadMessages,
+	"GET /api/broadcasts":                                    auth.ScopeReadMessages,
+	"GET /api/broadcasts/{id}":                               auth.ScopeReadMessages,
+	"GET /api/broadcasts/{id}/recipients":                    auth.ScopeReadMessages,
+	"GET /api/chats/{jid}/export":                            auth.ScopeReadMessages,
+	"GET /api/events":                                        auth.ScopeReadMessages,
+	"GET /api/ws":                                            auth.ScopeReadMessages,
+	"POST /api/send-message":                                 auth.ScopeSendText,
+	"POST /api/scheduled-messages":                           auth.ScopeSendText,
+	"PUT /api/scheduled-messages/{id}":                       auth.ScopeSendText,
+	"DELETE /api/scheduled-messages/{id}":                    auth.ScopeSendText,
+	"POST /api/broadcasts":                                   auth.ScopeSendText,
+	"POST /api/broadcasts/{id}/{action:pause|resume|cancel}": auth.ScopeSendText,
+	"POST /api/send-voice-note":                              auth.ScopeSendMedia,
+	"POST /send":                                             auth.ScopeSendMedia,
+}
+
+// routeScope returns the scope a request needs, or "" for public routes
+func routeScope(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return auth.ScopeAdmin
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return auth.ScopeAdmin
+	}
+	if publicRoutes[template] {
+		return ""
+	}
+	if scope, ok := routeScopes[r.Method+" "+template]; ok {
+		return scope
+	}
+	return auth.ScopeAdmin
+}
+
+// sendingKey returns the API key ID to rate limit a request by, or "" for
+// requests that do not send messages
+func sendingKey(r *http.Request) string {
+	k := auth.FromRequest(r)
+	if k == nil {
+		return ""
+	}
+	if scope := routeScope(r); scope != auth.ScopeSendText && scope != auth.ScopeSendMedia {
+		return ""
+	}
+	return strconv.FormatInt(k.ID, 10)
+}
+
+// auditAccount notes the account a request acts on in its audit log entry
+func auditAccount(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		audit.FromRequest(r).Account = accounts.FromRequest(r).Name
+		next.ServeHTTP(w, r)
+	})
+}
+
 // handleSendMessage handles direct HTTP requests to send messages
 // @Summary Send a WhatsApp message
-// @Description Send a message to a WhatsApp contact or group
+// @Description Send a message to a WhatsApp contact or group. If it cannot be sent right away it stays in the outbox and is retried; poll /api/outbox/{id} for its status. With APPROVAL_MODE set to api or all the message is drafted instead and the response is the draft (202).
 // @Tags API
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Key that makes the request safe to retry"
 // @Param request body SendMessageRequest true "Send message request"
 // @Success 200 {object} map[string]interface{} "Message sent confirmation"
+// @Success 202 {object} map[string]interface{} "Message queued for delivery"
+// @Failure 400 {object} map[string]string "Invalid recipient"
+// @Failure 422 {object} map[string]string "Idempotency key reused for a different request"
+// @Failure 403 {object} map[string]string "Recipient blocked by the send policy or the API key"
+// @Failure 429 {object} map[string]string "Send rate limit exceeded; see Retry-After"
 // @Router /api/send-message [post]
 func handleSendMessage(w http.ResponseWriter, r *http.Request, client *whatsapp.Client) {
 	var req SendMessageRequest
@@ -127,85 +218,363 @@ func handleSendMessage(w http.ResponseWriter, r *http.Request, client *whatsapp.
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if !handlers.AllowRecipient(w, r, req.Recipient) {
+		return
+	}
 
-	// Call the WhatsApp client directly
-	err := client.SendMessage(req.Recipient, req.Message)
+	// Queue the message; it is sent right away if connected
+	queued, err := client.QueueText(req.Recipient, req.Message, r.Header.Get(handlers.IdempotencyKeyHeader))
 	if err != nil {
-		log.Printf("❌ Failed to send message: %v", err)
-		http.Error(w, "Failed to send message", http.StatusInternalServerError)
+		handlers.WriteOutboxError(w, err)
 		return
 	}
 
-	// Return success response
+	// Return the delivery state
 	response := map[string]interface{}{
-		"status":    "sent",
+		"id":        queued.ID,
+		"status":    queued.Status,
 		"recipient": req.Recipient,
 		"message":   req.Message,
 		"timestamp": time.Now().Format(time.RFC3339),
 	}
+	if queued.LastError != "" {
+		response["error"] = queued.LastError
+	}
 
 	w.Header().Set("Content-Type", "application/json")
+	handlers.AuditQueued(r, queued)
+	w.WriteHeader(handlers.OutboxStatusCode(queued))
 	json.NewEncoder(w).Encode(response)
 }
 
 func main() {
-	// Get configuration from environment variables
-	dbPath := os.Getenv("WHATSAPP_DB_PATH")
-	if dbPath == "" {
-		dbPath = "./whatsapp.db"
+	cfg, args, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage()
+		return
 	}
-
-	mediaDir := os.Getenv("WHATSAPP_MEDIA_DIR")
-	if mediaDir == "" {
-		mediaDir = "./media"
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Run a CLI subcommand instead of the server if one was given
+	if runCommand(cfg, args) {
+		return
 	}
 
-	// Create WhatsApp client
-	ttsUrl := os.Getenv("TTS_URL")
-	if ttsUrl == "" {
-		ttsUrl = "http://localhost:8001/text-to-speech"
-	}
-	sttUrl := os.Getenv("STT_URL")
-	client, err := whatsapp.NewClient(dbPath, mediaDir, ttsUrl, sttUrl)
+	// Load every account. Each has its own message database, media directory
+	// and workers; the default account uses the configured paths.
+	manager, err := accounts.NewManager(accounts.Options{
+		DBPath:       cfg.DBPath,
+		MediaDir:     cfg.MediaDir,
+		QRCodeDir:    cfg.QRCodeDir,
+		Config:       cfg,
+		EventLogSize: cfg.EventLogSize,
+		ApprovalMode: cfg.ApprovalMode,
+		AdminChat:    cfg.ApprovalAdminChat,
+		Configure: func(client *whatsapp.Client) error {
+			return configureClient(cfg, client)
+		},
+	})
 	if err != nil {
-		log.Fatalf("Failed to create WhatsApp client: %v", err)
+		log.Fatalf("Failed to load WhatsApp accounts: %v", err)
 	}
-	defer client.Close()
+	defer manager.Close()
 
-	// Connect to WhatsApp
-	ctx := context.Background()
-	if err := client.Connect(ctx); err != nil {
-		log.Fatalf("Failed to connect to WhatsApp: %v", err)
+	// Record that a server owns the state files so offline restores refuse to run
+	if err := backup.WriteLockFile(lockFilePath(cfg)); err != nil {
+		log.Printf("⚠️ Failed to write lock file: %v", err)
+	}
+	defer backup.RemoveLockFile(lockFilePath(cfg))
+
+	// Background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// API keys are kept with the default account
+	apiKeys := auth.NewStore(manager.Default().Client.Database())
+	if cfg.AuthDisabled {
+		log.Printf("⚠️ AUTH_DISABLED is set: the API is open to anyone who can reach it")
+	} else if ok, err := apiKeys.HasActiveKeys(); err != nil {
+		log.Printf("⚠️ Failed to check for API keys: %v", err)
+	} else if !ok {
+		log.Printf("🔐 No API keys exist, so every API request will be refused. Create one with: %s create-api-key -name admin", os.Args[0])
 	}
 
-	// Create router with gorilla/mux
+	// Create router with gorilla/mux. Every request but the public ones is
+	// audited, including those refused. Requests need an API key with the
+	// scope of their route, and act on the account named by their account
+	// parameter, or on the default account.
+	auditLog := manager.AuditLog()
 	router := mux.NewRouter()
+	router.Use(auditLog.Middleware(func(r *http.Request) bool { return routeScope(r) == "" }))
+	if !cfg.AuthDisabled {
+		router.Use(apiKeys.Middleware(routeScope))
+		router.Use(ratelimit.New(ratelimit.PerMinute(cfg.RateLimitPerKey)).Middleware(sendingKey))
+	}
+	router.Use(manager.Middleware)
+	router.Use(auditAccount)
 
 	// Add routes
-	router.HandleFunc("/health", handlers.HandleHealth).Methods("GET")
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleHealth(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	probes := newProbes(cfg, manager)
+	router.HandleFunc("/healthz/live", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleLiveness(w, r, probes)
+	}).Methods("GET")
+	router.HandleFunc("/healthz/ready", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleReadiness(w, r, probes)
+	}).Methods("GET")
+
+	// API key endpoints
+	router.HandleFunc("/api/keys", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleCreateAPIKey(w, r, apiKeys)
+	}).Methods("POST")
+	router.HandleFunc("/api/keys", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListAPIKeys(w, r, apiKeys)
+	}).Methods("GET")
+	router.HandleFunc("/api/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetAPIKey(w, r, apiKeys)
+	}).Methods("GET")
+	router.HandleFunc("/api/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleRevokeAPIKey(w, r, apiKeys)
+	}).Methods("DELETE")
+
+	// Account endpoints, to serve several numbers
+	router.HandleFunc("/api/accounts", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleCreateAccount(w, r, manager)
+	}).Methods("POST")
+	router.HandleFunc("/api/accounts", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListAccounts(w, r, manager)
+	}).Methods("GET")
+	router.HandleFunc("/api/accounts/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetAccount(w, r, manager)
+	}).Methods("GET")
+	router.HandleFunc("/api/accounts/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleDeleteAccount(w, r, manager)
+	}).Methods("DELETE")
+
+	// Pairing endpoints, to link the device from a browser
+	router.HandleFunc("/api/pairing/qr", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetPairingQR(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	router.HandleFunc("/api/pairing/phone", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandlePairPhone(w, r, accounts.FromRequest(r).Client)
+	}).Methods("POST")
+	router.HandleFunc("/api/pairing/status", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandlePairingStatus(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
 
 	// API endpoints for direct HTTP access to WhatsApp functionality
 	router.HandleFunc("/api/list-messages", func(w http.ResponseWriter, r *http.Request) {
-		handleListMessages(w, r, client)
+		handleListMessages(w, r, accounts.FromRequest(r).Client)
 	}).Methods("POST")
 	router.HandleFunc("/api/search-contacts", func(w http.ResponseWriter, r *http.Request) {
-		handleSearchContacts(w, r, client)
+		handleSearchContacts(w, r, accounts.FromRequest(r).Client)
 	}).Methods("POST")
 	router.HandleFunc("/api/send-message", func(w http.ResponseWriter, r *http.Request) {
-		handleSendMessage(w, r, client)
+		account := accounts.FromRequest(r)
+		if account.Drafts.HoldsAPISends() {
+			handlers.HandleDraftMessage(w, r, account.Drafts)
+			return
+		}
+		handleSendMessage(w, r, account.Client)
+	}).Methods("POST")
+	router.HandleFunc("/api/outbox/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetOutboxMessage(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	router.HandleFunc("/api/scheduled-messages", func(w http.ResponseWriter, r *http.Request) {
+		account := accounts.FromRequest(r)
+		if !handlers.AllowWithoutApproval(w, r, account.Drafts.HoldsAPISends()) {
+			return
+		}
+		handlers.HandleCreateScheduledMessage(w, r, account.Scheduler)
+	}).Methods("POST")
+	router.HandleFunc("/api/scheduled-messages", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListScheduledMessages(w, r, accounts.FromRequest(r).Scheduler)
+	}).Methods("GET")
+	router.HandleFunc("/api/scheduled-messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetScheduledMessage(w, r, accounts.FromRequest(r).Scheduler)
+	}).Methods("GET")
+	router.HandleFunc("/api/scheduled-messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		account := accounts.FromRequest(r)
+		if !handlers.AllowWithoutApproval(w, r, account.Drafts.HoldsAPISends()) {
+			return
+		}
+		handlers.HandleUpdateScheduledMessage(w, r, account.Scheduler)
+	}).Methods("PUT")
+	router.HandleFunc("/api/scheduled-messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleCancelScheduledMessage(w, r, accounts.FromRequest(r).Scheduler)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/broadcasts", func(w http.ResponseWriter, r *http.Request) {
+		account := accounts.FromRequest(r)
+		if !handlers.AllowWithoutApproval(w, r, account.Drafts.HoldsAPISends()) {
+			return
+		}
+		handlers.HandleCreateBroadcast(w, r, account.Broadcasts)
+	}).Methods("POST")
+	router.HandleFunc("/api/broadcasts", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListBroadcasts(w, r, accounts.FromRequest(r).Broadcasts)
+	}).Methods("GET")
+	router.HandleFunc("/api/broadcasts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetBroadcast(w, r, accounts.FromRequest(r).Broadcasts)
+	}).Methods("GET")
+	router.HandleFunc("/api/broadcasts/{id}/recipients", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetBroadcastRecipients(w, r, accounts.FromRequest(r).Broadcasts)
+	}).Methods("GET")
+	router.HandleFunc("/api/broadcasts/{id}/{action:pause|resume|cancel}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleBroadcastAction(w, r, accounts.FromRequest(r).Broadcasts)
 	}).Methods("POST")
 	router.HandleFunc("/api/send-voice-note", func(w http.ResponseWriter, r *http.Request) {
-		handlers.HandleSendVoiceNote(w, r, client)
+		account := accounts.FromRequest(r)
+		if account.Drafts.HoldsAPISends() {
+			handlers.HandleDraftVoiceNote(w, r, account.Drafts)
+			return
+		}
+		handlers.HandleSendVoiceNote(w, r, account.Client)
+	}).Methods("POST")
+
+	// Drafts waiting for approval
+	router.HandleFunc("/api/drafts", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListDrafts(w, r, accounts.FromRequest(r).Drafts)
+	}).Methods("GET")
+	router.HandleFunc("/api/drafts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetDraft(w, r, accounts.FromRequest(r).Drafts)
+	}).Methods("GET")
+	router.HandleFunc("/api/drafts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleEditDraft(w, r, accounts.FromRequest(r).Drafts)
+	}).Methods("PUT")
+	router.HandleFunc("/api/drafts/{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleApproveDraft(w, r, accounts.FromRequest(r).Drafts)
+	}).Methods("POST")
+	router.HandleFunc("/api/drafts/{id}/reject", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleRejectDraft(w, r, accounts.FromRequest(r).Drafts)
 	}).Methods("POST")
 
+	router.HandleFunc("/api/chats/{jid}/export", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleExportChat(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	router.HandleFunc("/api/chats/{jid}/import", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleImportChat(w, r, accounts.FromRequest(r).Client)
+	}).Methods("POST")
+	router.HandleFunc("/api/chats/{jid}/bot", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetChatBot(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	router.HandleFunc("/api/chats/{jid}/bot", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleSetChatBot(w, r, accounts.FromRequest(r).Client)
+	}).Methods("PUT")
+
+	// Privacy endpoints for per-contact data export and erasure
+	router.HandleFunc("/api/contacts/{jid}/export", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleExportContactData(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	router.HandleFunc("/api/contacts/{jid}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleEraseContactData(w, r, accounts.FromRequest(r).Client)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/data-requests", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListDataRequests(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+
+	// Live event stream
+	router.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleEvents(w, r, accounts.FromRequest(r).Events)
+	}).Methods("GET")
+	router.HandleFunc("/api/ws", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleWebSocket(w, r, accounts.FromRequest(r).Events)
+	}).Methods("GET")
+
+	// Webhook subscriptions
+	router.HandleFunc("/api/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleCreateWebhook(w, r, accounts.FromRequest(r).Webhooks)
+	}).Methods("POST")
+	router.HandleFunc("/api/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListWebhooks(w, r, accounts.FromRequest(r).Webhooks)
+	}).Methods("GET")
+	router.HandleFunc("/api/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetWebhook(w, r, accounts.FromRequest(r).Webhooks)
+	}).Methods("GET")
+	router.HandleFunc("/api/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleUpdateWebhook(w, r, accounts.FromRequest(r).Webhooks)
+	}).Methods("PUT")
+	router.HandleFunc("/api/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleDeleteWebhook(w, r, accounts.FromRequest(r).Webhooks)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/webhooks/{id}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListWebhookDeliveries(w, r, accounts.FromRequest(r).Webhooks)
+	}).Methods("GET")
+	router.HandleFunc("/api/webhooks/{id}/deliveries/{delivery}/retry", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleRetryWebhookDelivery(w, r, accounts.FromRequest(r).Webhooks)
+	}).Methods("POST")
+
+	// Auto-reply rules
+	router.HandleFunc("/api/rules", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleCreateRule(w, r, accounts.FromRequest(r).Client.Rules())
+	}).Methods("POST")
+	router.HandleFunc("/api/rules", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListRules(w, r, accounts.FromRequest(r).Client.Rules())
+	}).Methods("GET")
+	router.HandleFunc("/api/rules/dry-run", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleDryRunRule(w, r, accounts.FromRequest(r).Client.Rules())
+	}).Methods("POST")
+	router.HandleFunc("/api/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetRule(w, r, accounts.FromRequest(r).Client.Rules())
+	}).Methods("GET")
+	router.HandleFunc("/api/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleUpdateRule(w, r, accounts.FromRequest(r).Client.Rules())
+	}).Methods("PUT")
+	router.HandleFunc("/api/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleDeleteRule(w, r, accounts.FromRequest(r).Client.Rules())
+	}).Methods("DELETE")
+
+	// Admin endpoints
+	router.HandleFunc("/api/admin/config", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetConfig(w, r, cfg)
+	}).Methods("GET")
+	router.HandleFunc("/api/admin/encryption/rotate", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleRotateEncryption(w, r, accounts.FromRequest(r).Client)
+	}).Methods("POST")
+
+	router.HandleFunc("/api/admin/backup", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleBackup(w, r, manager)
+	}).Methods("POST")
+	router.HandleFunc("/api/admin/restore", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleRestore(w, r, manager)
+	}).Methods("POST")
+
+	// Send policy endpoints
+	router.HandleFunc("/api/policy", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGetSendPolicy(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	router.HandleFunc("/api/policy/decisions", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListSendDecisions(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	router.HandleFunc("/api/policy/approved-contacts", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleApproveContact(w, r, accounts.FromRequest(r).Client)
+	}).Methods("POST")
+	router.HandleFunc("/api/policy/approved-contacts", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListApprovedContacts(w, r, accounts.FromRequest(r).Client)
+	}).Methods("GET")
+	router.HandleFunc("/api/policy/approved-contacts/{jid}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleRevokeContactApproval(w, r, accounts.FromRequest(r).Client)
+	}).Methods("DELETE")
+
+	// Audit log endpoints
+	router.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleListAudit(w, r, auditLog)
+	}).Methods("GET")
+	router.HandleFunc("/api/audit/export", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleExportAudit(w, r, auditLog)
+	}).Methods("GET")
+
 	// Python-style API endpoint
 	router.HandleFunc("/send", func(w http.ResponseWriter, r *http.Request) {
-		handlers.HandleSend(w, r, client)
+		account := accounts.FromRequest(r)
+		if account.Drafts.HoldsAPISends() {
+			handlers.HandleDraftSend(w, r, account)
+			return
+		}
+		handlers.HandleSend(w, r, account.Client)
 	}).Methods("POST")
 
 	// OpenAPI 3.0 documentation
@@ -230,19 +599,59 @@ func main() {
 
 	// Create HTTP server
 	httpServer := &http.Server{
-		Addr:    ":" + port,
+		Addr:    ":" + cfg.Port,
 		Handler: router,
 	}
 
 	// Start HTTP server with all routes
 	go func() {
-		log.Printf("Starting WhatsApp server on port %s", port)
+		log.Printf("Starting WhatsApp server on port %s", cfg.Port)
 		log.Printf("Available endpoints:")
 		log.Printf("🔌 - GET /health - Health check")
+		log.Printf("🔌 - POST/GET /api/keys - Create and list API keys")
+		log.Printf("🔌 - GET/DELETE /api/keys/{id} - Get or revoke an API key")
+		log.Printf("🔌 - POST/GET /api/accounts - Add and list WhatsApp accounts")
+		log.Printf("🔌 - GET/DELETE /api/accounts/{name} - Get or remove an account")
+		log.Printf("🔌 - Add ?account={name} to any other endpoint to act on that account")
+		log.Printf("🔌 - GET /api/pairing/qr - Pairing QR code (png, svg or raw)")
+		log.Printf("🔌 - POST /api/pairing/phone - Pairing code for a phone number")
+		log.Printf("🔌 - GET /api/pairing/status - Pairing status")
 		log.Printf("🔌 - POST /api/list-messages - List messages from a chat")
 		log.Printf("🔌 - POST /api/search-contacts - Search for contacts")
 		log.Printf("🔌 - POST /api/send-message - Send a WhatsApp message")
 		log.Printf("🔌 - POST /api/send-voice-note - Send a voice note (multipart/form-data)")
+		log.Printf("🔌 - GET /api/outbox/{id} - Delivery status of a queued message")
+		log.Printf("🔌 - POST/GET /api/scheduled-messages - Schedule and list one-off or recurring messages")
+		log.Printf("🔌 - GET/PUT/DELETE /api/scheduled-messages/{id} - Get, edit or cancel a scheduled message")
+		log.Printf("🔌 - POST/GET /api/broadcasts - Start and list broadcasts")
+		log.Printf("🔌 - GET /api/broadcasts/{id} - Broadcast progress")
+		log.Printf("🔌 - GET /api/broadcasts/{id}/recipients - Per-recipient broadcast status")
+		log.Printf("🔌 - POST /api/broadcasts/{id}/pause|resume|cancel - Control a broadcast")
+		log.Printf("🔌 - GET /api/chats/{jid}/export - Export a chat as txt, jsonl or html")
+		log.Printf("🔌 - POST /api/chats/{jid}/import - Import a chat exported from the phone (.txt or .zip)")
+		log.Printf("🔌 - GET/PUT /api/chats/{jid}/bot - Get or change whether the bot answers in a chat")
+		log.Printf("🔌 - GET /api/contacts/{jid}/export - Export everything held about a contact")
+		log.Printf("🔌 - DELETE /api/contacts/{jid} - Erase everything held about a contact")
+		log.Printf("🔌 - GET /api/data-requests - List audited export and erasure requests")
+		log.Printf("🔌 - GET /api/events - Live event stream (Server-Sent Events)")
+		log.Printf("🔌 - GET /api/ws - Live event stream (WebSocket)")
+		log.Printf("🔌 - POST/GET /api/webhooks - Create and list webhook subscriptions")
+		log.Printf("🔌 - GET/PUT/DELETE /api/webhooks/{id} - Manage a webhook subscription")
+		log.Printf("🔌 - GET /api/webhooks/{id}/deliveries - List recent webhook deliveries")
+		log.Printf("🔌 - POST /api/webhooks/{id}/deliveries/{delivery}/retry - Retry a failed delivery")
+		log.Printf("🔌 - POST/GET /api/rules - Create and list auto-reply rules")
+		log.Printf("🔌 - GET/PUT/DELETE /api/rules/{id} - Manage an auto-reply rule")
+		log.Printf("🔌 - POST /api/rules/dry-run - Evaluate a rule against stored messages")
+		log.Printf("🔌 - GET /api/admin/config - Configuration with secrets redacted")
+		log.Printf("🔌 - POST /api/admin/encryption/rotate - Re-encrypt stored data with the active key")
+		log.Printf("🔌 - POST /api/admin/backup - Download a backup archive")
+		log.Printf("🔌 - POST /api/admin/restore - Restore a backup archive (every account must be disconnected)")
+		log.Printf("🔌 - GET /api/policy - Send policy allow and deny lists")
+		log.Printf("🔌 - GET /api/policy/decisions - Audit trail of send policy decisions")
+		log.Printf("🔌 - POST/GET /api/policy/approved-contacts - Approve and list numbers for first contact")
+		log.Printf("🔌 - DELETE /api/policy/approved-contacts/{jid} - Withdraw a first-contact approval")
+		log.Printf("🔌 - GET /api/audit - Query the audit log")
+		log.Printf("🔌 - GET /api/audit/export - Export the audit log as JSON Lines")
 		log.Printf("🔌 - POST /send - Send voice message (Python-style API with media_path)")
 		log.Printf("🔌 - GET /openapi - OpenAPI 3.0 documentation (Interactive UI)")
 		log.Printf("🔌 - GET /openapi.json - OpenAPI 3.0 specification (JSON)")
@@ -252,6 +661,10 @@ func main() {
 		}
 	}()
 
+	// Connect every account once the server is up, so that a device without a
+	// session can be paired over HTTP
+	manager.Start(workerCtx)
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Account is a WhatsApp number served by the process
+type Account struct {
+	Name      string    `json:"name"`
+	JID       string    `json:"jid,omitempty"` // empty until the account is paired
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// accountSchema creates the account registry. It lives in the session store
+// database, next to the paired devices it refers to, rather than in any one
+// account's message database.
+var accountSchema = []string{
+	`CREATE TABLE IF NOT EXISTS accounts (
+		name TEXT PRIMARY KEY,
+		jid TEXT,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+}
+
+// AccountStore keeps the registry of accounts
+type AccountStore struct {
+	db *sql.DB
+}
+
+// NewAccountStore creates the account registry in db if needed
+func NewAccountStore(db *sql.DB) (*AccountStore, error) {
+	for _, stmt := range accountSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &AccountStore{db: db}, nil
+}
+
+// CreateAccount registers an account. It fails if the name is taken.
+func (s *AccountStore) CreateAccount(account *Account) error {
+	account.CreatedAt = time.Now().UTC()
+	_, err := s.db.Exec("INSERT INTO accounts (name, jid, created_by, created_at) VALUES (?, ?, ?, ?)",
+		account.Name, nullString(account.JID), account.CreatedBy, account.CreatedAt)
+	return err
+}
+
+// GetAccounts returns every registered account, oldest first
+func (s *AccountStore) GetAccounts() ([]*Account, error) {
+	rows, err := s.db.Query("SELECT name, jid, created_by, created_at FROM accounts ORDER BY created_at, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*Account
+	for rows.Next() {
+		var a Account
+		var jid sql.NullString
+		if err := rows.Scan(&a.Name, &jid, &a.CreatedBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.JID = jid.String
+		accounts = append(accounts, &a)
+	}
+	return accounts, rows.Err()
+}
+
+// SetAccountJID records the JID an account is paired with; an empty JID
+// records that it is not paired
+func (s *AccountStore) SetAccountJID(name, jid string) error {
+	_, err := s.db.Exec("UPDATE accounts SET jid = ? WHERE name = ?", nullString(jid), name)
+	return err
+}
+
+// DeleteAccount removes an account from the registry
+func (s *AccountStore) DeleteAccount(name string) error {
+	result, err := s.db.Exec("DELETE FROM accounts WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// APIKey is a key for the HTTP API. Only a hash of the key is stored; the
+// prefix identifies it in listings and logs.
+type APIKey struct {
+	ID                int64      `json:"id"`
+	Name              string     `json:"name"`
+	Prefix            string     `json:"prefix"`
+	Hash              string     `json:"-"`
+	Scopes            []string   `json:"scopes"`
+	AllowedRecipients []string   `json:"allowed_recipients"` // empty means any recipient
+	CreatedBy         string     `json:"created_by,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt        *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+}
+
+// apiKeySchema creates the API key table. Scopes and allowed recipients are
+// stored as JSON.
+var apiKeySchema = []string{
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL DEFAULT '[]',
+		allowed_recipients TEXT NOT NULL DEFAULT '[]',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		revoked_at DATETIME
+	);`,
+}
+
+const apiKeyColumns = "id, name, prefix, hash, scopes, allowed_recipients, created_by, created_at, expires_at, last_used_at, revoked_at"
+
+// CreateAPIKey stores a new API key
+func (d *Database) CreateAPIKey(k *APIKey) error {
+	scopes, err := json.Marshal(nonNil(k.Scopes))
+	if err != nil {
+		return err
+	}
+	recipients, err := json.Marshal(nonNil(k.AllowedRecipients))
+	if err != nil {
+		return err
+	}
+	k.CreatedAt = time.Now().UTC()
+	result, err := d.db.Exec(`INSERT INTO api_keys (name, prefix, hash, scopes, allowed_recipients, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.Name, k.Prefix, k.Hash, string(scopes), string(recipients), k.CreatedBy, k.CreatedAt, k.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	k.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetAPIKey returns an API key by ID
+func (d *Database) GetAPIKey(id int64) (*APIKey, error) {
+	return scanAPIKey(d.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+}
+
+// GetAPIKeyByHash returns the API key with the given hash, including revoked
+// and expired keys
+func (d *Database) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	return scanAPIKey(d.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE hash = ?", hash))
+}
+
+// GetAPIKeys returns every API key, newest first
+func (d *Database) GetAPIKeys() ([]*APIKey, error) {
+	rows, err := d.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// CountActiveAPIKeys returns the number of keys that are neither revoked nor expired
+func (d *Database) CountActiveAPIKeys() (int, error) {
+	var n int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM api_keys WHERE revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)",
+		time.Now().UTC()).Scan(&n)
+	return n, err
+}
+
+// TouchAPIKey records that a key was used. To spare the database a write on
+// every request, the time is only updated once per minute.
+func (d *Database) TouchAPIKey(id int64) error {
+	now := time.Now().UTC()
+	_, err := d.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		now, id, now.Add(-time.Minute))
+	return err
+}
+
+// RevokeAPIKey revokes a key. Revoking a revoked key keeps the first time.
+func (d *Database) RevokeAPIKey(id int64) error {
+	result, err := d.db.Exec("UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?", time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// scanAPIKey reads an API key row
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var k APIKey
+	var scopes, recipients string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &scopes, &recipients, &k.CreatedBy, &k.CreatedAt,
+		&expiresAt, &lastUsedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &k.Scopes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(recipients), &k.AllowedRecipients); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return &k, nil
+}
+
+// nonNil returns an empty slice for nil, so that it is stored as [] rather than null
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
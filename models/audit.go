@@ -0,0 +1,291 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Audit entry statuses
+const (
+	AuditOK     = "ok"
+	AuditDenied = "denied" // refused by authentication, an API key scope or the send policy
+	AuditError  = "error"
+)
+
+// Audit actor types
+const (
+	ActorAPIKey    = "api_key"    // a request made with an API key
+	ActorAnonymous = "anonymous"  // a request without a valid API key, or with AUTH_DISABLED
+	ActorBot       = "bot"        // the LlamaStack bot
+	ActorAdminChat = "admin_chat" // a command written in the approval admin chat
+	ActorSystem    = "system"     // workers such as the outbox, scheduler and broadcasts
+)
+
+// AuditEntry records one action taken through the API, by the bot or by a
+// worker. Message text is never recorded.
+type AuditEntry struct {
+	ID         int64             `json:"id"`
+	Time       time.Time         `json:"time"`
+	Account    string            `json:"account,omitempty"`
+	ActorType  string            `json:"actor_type"`
+	Actor      string            `json:"actor,omitempty"` // API key name or JID
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Action     string            `json:"action"`         // such as api.request, message.queued or bot.reply
+	Tool       string            `json:"tool,omitempty"` // API route, or the LlamaStack API used
+	Recipient  string            `json:"recipient,omitempty"`
+	MessageID  string            `json:"message_id,omitempty"` // WhatsApp message ID
+	OutboxID   int64             `json:"outbox_id,omitempty"`
+	Model      string            `json:"model,omitempty"`
+	ToolCalls  []string          `json:"tool_calls,omitempty"` // tools called by the LLM
+	Decision   string            `json:"decision,omitempty"`   // send policy decision
+	Status     string            `json:"status"`
+	HTTPStatus int               `json:"http_status,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+}
+
+// AuditFilter selects audit entries. Empty fields match everything.
+type AuditFilter struct {
+	Account   string
+	ActorType string
+	Actor     string
+	Action    string
+	Recipient string
+	Status    string
+	Since     *time.Time
+	Until     *time.Time
+	BeforeID  int64 // only entries older than this one, for paging
+	Limit     int
+}
+
+// NewAuditDatabase opens the audit log. It is kept in a database of its own,
+// apart from the message databases, so that restoring a backup cannot roll
+// it back.
+func NewAuditDatabase(dbPath string) (*Database, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range auditSchema {
+		if _, err := db.Exec(query); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &Database{db: db}, nil
+}
+
+// MoveAuditLog moves the audit log that earlier versions kept in a message
+// database into the audit database, and returns how many entries were moved.
+// Entries are only copied while the audit database is empty; the old table
+// is dropped either way, since one restored from a backup is out of date.
+func (d *Database) MoveAuditLog(from *Database) (int, error) {
+	var found int
+	if err := from.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'audit_log'`).Scan(&found); err != nil || found == 0 {
+		return 0, err
+	}
+	var empty bool
+	if err := d.db.QueryRow(`SELECT NOT EXISTS (SELECT 1 FROM audit_log)`).Scan(&empty); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	if empty {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+		rows, err := from.db.Query("SELECT " + auditColumns + " FROM audit_log ORDER BY id ASC")
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			values := make([]interface{}, 18)
+			for i := range values {
+				values[i] = new(interface{})
+			}
+			if err := rows.Scan(values...); err != nil {
+				return 0, err
+			}
+			if _, err := tx.Exec("INSERT INTO audit_log ("+auditColumns+`)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, values...); err != nil {
+				return 0, err
+			}
+			moved++
+		}
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	// Dropping the table drops its append-only triggers with it
+	_, err := from.db.Exec("DROP TABLE audit_log")
+	return moved, err
+}
+
+// auditSchema creates the audit log. Triggers make it append-only: rows can
+// be inserted but never changed or deleted.
+var auditSchema = []string{
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time DATETIME NOT NULL,
+		account TEXT NOT NULL DEFAULT '',
+		actor_type TEXT NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		remote_addr TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		tool TEXT NOT NULL DEFAULT '',
+		recipient TEXT NOT NULL DEFAULT '',
+		message_id TEXT NOT NULL DEFAULT '',
+		outbox_id INTEGER NOT NULL DEFAULT 0,
+		model TEXT NOT NULL DEFAULT '',
+		tool_calls TEXT NOT NULL DEFAULT '',
+		decision TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		http_status INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT ''
+	);`,
+	"CREATE INDEX IF NOT EXISTS idx_audit_log_time ON audit_log(time);",
+	"CREATE INDEX IF NOT EXISTS idx_audit_log_recipient ON audit_log(recipient, id);",
+	"CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, id);",
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+}
+
+const auditColumns = `id, time, account, actor_type, actor, remote_addr, action, tool, recipient, message_id,
+	outbox_id, model, tool_calls, decision, status, http_status, error, details`
+
+// RecordAudit appends an entry to the audit log
+func (d *Database) RecordAudit(e *AuditEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	toolCalls, details := "", ""
+	if len(e.ToolCalls) > 0 {
+		encoded, err := json.Marshal(e.ToolCalls)
+		if err != nil {
+			return err
+		}
+		toolCalls = string(encoded)
+	}
+	if len(e.Details) > 0 {
+		encoded, err := json.Marshal(e.Details)
+		if err != nil {
+			return err
+		}
+		details = string(encoded)
+	}
+
+	result, err := d.db.Exec(`INSERT INTO audit_log (time, account, actor_type, actor, remote_addr, action, tool,
+		recipient, message_id, outbox_id, model, tool_calls, decision, status, http_status, error, details)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time, e.Account, e.ActorType, e.Actor, e.RemoteAddr, e.Action, e.Tool, e.Recipient, e.MessageID,
+		e.OutboxID, e.Model, toolCalls, e.Decision, e.Status, e.HTTPStatus, e.Error, details)
+	if err != nil {
+		return err
+	}
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetAuditEntries returns entries matching filter, newest first
+func (d *Database) GetAuditEntries(filter AuditFilter) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	err := d.scanAudit(filter, "DESC", func(e *AuditEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// EachAuditEntry calls fn for every entry matching filter, oldest first,
+// without loading them all into memory
+func (d *Database) EachAuditEntry(filter AuditFilter, fn func(*AuditEntry) error) error {
+	return d.scanAudit(filter, "ASC", fn)
+}
+
+// scanAudit queries the audit log and calls fn for every entry
+func (d *Database) scanAudit(filter AuditFilter, order string, fn func(*AuditEntry) error) error {
+	query := "SELECT " + auditColumns + " FROM audit_log WHERE 1 = 1"
+	var args []interface{}
+	for _, f := range []struct {
+		column, value string
+	}{
+		{"account", filter.Account},
+		{"actor_type", filter.ActorType},
+		{"actor", filter.Actor},
+		{"action", filter.Action},
+		{"recipient", filter.Recipient},
+		{"status", filter.Status},
+	} {
+		if f.value != "" {
+			query += " AND " + f.column + " = ?"
+			args = append(args, f.value)
+		}
+	}
+	if filter.Since != nil {
+		query += " AND time >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		query += " AND time < ?"
+		args = append(args, filter.Until.UTC())
+	}
+	if filter.BeforeID > 0 {
+		query += " AND id < ?"
+		args = append(args, filter.BeforeID)
+	}
+	query += " ORDER BY id " + order
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scanAuditEntry reads an audit log row
+func scanAuditEntry(row rowScanner) (*AuditEntry, error) {
+	e := &AuditEntry{}
+	var toolCalls, details string
+	if err := row.Scan(&e.ID, &e.Time, &e.Account, &e.ActorType, &e.Actor, &e.RemoteAddr, &e.Action, &e.Tool,
+		&e.Recipient, &e.MessageID, &e.OutboxID, &e.Model, &toolCalls, &e.Decision, &e.Status, &e.HTTPStatus,
+		&e.Error, &details); err != nil {
+		return nil, err
+	}
+	if toolCalls != "" {
+		if err := json.Unmarshal([]byte(toolCalls), &e.ToolCalls); err != nil {
+			return nil, err
+		}
+	}
+	if details != "" {
+		if err := json.Unmarshal([]byte(details), &e.Details); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	db, err := NewAuditDatabase(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatalf("NewAuditDatabase: %v", err)
+	}
+	defer db.Close()
+
+	const alice = "353851111111@s.whatsapp.net"
+	for _, e := range []*AuditEntry{
+		{ActorType: ActorAPIKey, Actor: "crm", Action: "message.queued", Recipient: alice, Status: AuditOK, ToolCalls: []string{"github.search"}},
+		{ActorType: ActorSystem, Action: "message.blocked", Recipient: alice, Decision: "denied", Status: AuditDenied},
+		{ActorType: ActorBot, Action: "bot.reply", Recipient: "353852222222@s.whatsapp.net", Status: AuditOK},
+	} {
+		if err := db.RecordAudit(e); err != nil {
+			t.Fatalf("RecordAudit: %v", err)
+		}
+	}
+
+	if _, err := db.db.Exec("UPDATE audit_log SET status = 'ok'"); err == nil {
+		t.Error("audit entries could be changed")
+	}
+	if _, err := db.db.Exec("DELETE FROM audit_log"); err == nil {
+		t.Error("audit entries could be deleted")
+	}
+
+	entries, err := db.GetAuditEntries(AuditFilter{Recipient: alice})
+	if err != nil {
+		t.Fatalf("GetAuditEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != "message.blocked" || entries[1].ToolCalls[0] != "github.search" {
+		t.Errorf("entries for %s = %+v, want both, newest first", alice, entries)
+	}
+	if entries, _ := db.GetAuditEntries(AuditFilter{BeforeID: entries[0].ID, Limit: 1}); len(entries) != 1 || entries[0].Action != "message.queued" {
+		t.Errorf("paging returned %+v", entries)
+	}
+}
+
+func TestMoveAuditLogOutOfMessageDatabase(t *testing.T) {
+	dir := t.TempDir()
+	messages, err := NewDatabase(filepath.Join(dir, "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer messages.Close()
+	// The audit log as earlier versions kept it
+	for _, query := range auditSchema {
+		if _, err := messages.db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, action := range []string{"api.request", "message.queued"} {
+		if err := messages.RecordAudit(&AuditEntry{ActorType: ActorSystem, Action: action, Status: AuditOK, Details: map[string]string{"n": action}}); err != nil {
+			t.Fatalf("RecordAudit: %v", err)
+		}
+	}
+
+	db, err := NewAuditDatabase(filepath.Join(dir, "audit.db"))
+	if err != nil {
+		t.Fatalf("NewAuditDatabase: %v", err)
+	}
+	defer db.Close()
+	if moved, err := db.MoveAuditLog(messages); err != nil || moved != 2 {
+		t.Fatalf("MoveAuditLog = %d, %v; want 2 entries", moved, err)
+	}
+	entries, err := db.GetAuditEntries(AuditFilter{})
+	if err != nil || len(entries) != 2 || entries[0].Action != "message.queued" || entries[0].Details["n"] != "message.queued" {
+		t.Errorf("moved entries = %+v, %v", entries, err)
+	}
+	if moved, err := db.MoveAuditLog(messages); err != nil || moved != 0 {
+		t.Errorf("second MoveAuditLog = %d, %v; want nothing to move", moved, err)
+	}
+}
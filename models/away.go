@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// awayNoticeRetention is how long sent away notices are remembered
+const awayNoticeRetention = 30 * 24 * time.Hour
+
+// awayNoticeSchema creates the table recording which contacts were sent the
+// away message in which closed period. Times are stored in UTC.
+var awayNoticeSchema = []string{
+	`CREATE TABLE IF NOT EXISTS away_notices (
+		contact_jid TEXT NOT NULL,
+		window_start DATETIME NOT NULL,
+		sent_at DATETIME NOT NULL,
+		PRIMARY KEY (contact_jid, window_start)
+	);`,
+}
+
+// ClaimAwayNotice records that a contact is being sent the away message for
+// the closed period starting at windowStart. It reports false if the contact
+// was already sent one for that period. Notices past retention are dropped.
+func (d *Database) ClaimAwayNotice(contactJID string, windowStart time.Time) (bool, error) {
+	now := time.Now().UTC()
+	if _, err := d.db.Exec("DELETE FROM away_notices WHERE sent_at < ?", now.Add(-awayNoticeRetention)); err != nil {
+		return false, err
+	}
+
+	result, err := d.db.Exec(`
+	INSERT OR IGNORE INTO away_notices (contact_jid, window_start, sent_at)
+	VALUES (?, ?, ?)`, contactJID, windowStart.UTC(), now)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
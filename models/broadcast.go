@@ -0,0 +1,411 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Broadcast is a message sent to many recipients, one at a time
+type Broadcast struct {
+	ID         int64              `json:"id"`
+	Name       string             `json:"name,omitempty"`
+	Template   string             `json:"template"`
+	MediaPath  string             `json:"-"` // copy of the attached file
+	Filename   string             `json:"filename,omitempty"`
+	Status     string             `json:"status"`
+	Delay      int                `json:"delay_seconds"`
+	Jitter     int                `json:"jitter_seconds"`
+	NextSendAt time.Time          `json:"next_send_at"`
+	CreatedBy  string             `json:"created_by,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	Progress   *BroadcastProgress `json:"progress,omitempty"`
+}
+
+// BroadcastRecipient is one recipient of a broadcast with its rendered message
+type BroadcastRecipient struct {
+	ID          int64      `json:"id"`
+	BroadcastID int64      `json:"broadcast_id"`
+	Recipient   string     `json:"recipient"`
+	Text        string     `json:"-"` // rendered message, dropped once queued
+	Status      string     `json:"status"`
+	OutboxID    int64      `json:"outbox_id,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	QueuedAt    *time.Time `json:"queued_at,omitempty"`
+}
+
+// BroadcastProgress counts the recipients of a broadcast by status
+type BroadcastProgress struct {
+	Total   int `json:"total"`
+	Pending int `json:"pending"`
+	Queued  int `json:"queued"`
+	Sending int `json:"sending"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// Broadcast states
+const (
+	BroadcastRunning   = "running"
+	BroadcastPaused    = "paused"
+	BroadcastCancelled = "cancelled"
+	BroadcastCompleted = "completed"
+)
+
+// Broadcast recipient states. Once a message is handed to the outbox, the
+// reported status is that of the outbox entry: queued, sending, sent or failed.
+const (
+	RecipientPending = "pending"
+	RecipientQueued  = "queued"
+	RecipientFailed  = "failed"
+	RecipientSkipped = "skipped"
+)
+
+// broadcastSchema creates the broadcast tables. A recipient appears at most
+// once per broadcast. Times are stored in UTC.
+var broadcastSchema = []string{
+	`CREATE TABLE IF NOT EXISTS broadcasts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL DEFAULT '',
+		template TEXT NOT NULL,
+		media_path TEXT NOT NULL DEFAULT '',
+		filename TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'running',
+		delay_seconds INTEGER NOT NULL,
+		jitter_seconds INTEGER NOT NULL DEFAULT 0,
+		next_send_at DATETIME NOT NULL,
+		created_by TEXT,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		finished_at DATETIME
+	);`,
+	`CREATE TABLE IF NOT EXISTS broadcast_recipients (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		broadcast_id INTEGER NOT NULL REFERENCES broadcasts(id),
+		recipient TEXT NOT NULL,
+		text TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		outbox_id INTEGER,
+		error TEXT,
+		queued_at DATETIME,
+		UNIQUE(broadcast_id, recipient)
+	);`,
+	"CREATE INDEX IF NOT EXISTS idx_broadcasts_status ON broadcasts(status);",
+	"CREATE INDEX IF NOT EXISTS idx_broadcast_recipients_status ON broadcast_recipients(broadcast_id, status);",
+	"CREATE INDEX IF NOT EXISTS idx_broadcast_recipients_recipient ON broadcast_recipients(recipient);",
+}
+
+const broadcastColumns = `id, name, template, media_path, filename, status, delay_seconds, jitter_seconds,
+	next_send_at, created_by, created_at, updated_at, finished_at`
+
+// recipientStatus is the reported status of a recipient: that of its outbox
+// entry once queued
+const recipientStatus = "COALESCE(o.status, r.status)"
+
+// CreateBroadcast stores a running broadcast and its recipients in a single
+// transaction. The template and rendered messages are encrypted at rest.
+func (d *Database) CreateBroadcast(b *Broadcast, recipients []*BroadcastRecipient) error {
+	template, err := d.encrypt(b.Template)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.Exec(`
+	INSERT INTO broadcasts (name, template, media_path, filename, status, delay_seconds, jitter_seconds,
+		next_send_at, created_by, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.Name, template, b.MediaPath, b.Filename, BroadcastRunning, b.Delay, b.Jitter, now, b.CreatedBy, now, now)
+	if err != nil {
+		return err
+	}
+	if b.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO broadcast_recipients (broadcast_id, recipient, text, status) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range recipients {
+		text, err := d.encrypt(r.Text)
+		if err != nil {
+			return err
+		}
+		result, err := stmt.Exec(b.ID, r.Recipient, text, RecipientPending)
+		if err != nil {
+			return err
+		}
+		if r.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		r.BroadcastID, r.Status = b.ID, RecipientPending
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	b.Status, b.NextSendAt, b.CreatedAt, b.UpdatedAt = BroadcastRunning, now, now, now
+	return nil
+}
+
+// GetBroadcast retrieves a broadcast by ID with its progress
+func (d *Database) GetBroadcast(id int64) (*Broadcast, error) {
+	b, err := d.scanBroadcast(d.db.QueryRow("SELECT "+broadcastColumns+" FROM broadcasts WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	if b.Progress, err = d.GetBroadcastProgress(id); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetBroadcasts lists broadcasts with their progress, newest first,
+// optionally filtered by status
+func (d *Database) GetBroadcasts(status string) ([]*Broadcast, error) {
+	query := "SELECT " + broadcastColumns + " FROM broadcasts"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC"
+
+	broadcasts, err := d.queryBroadcasts(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range broadcasts {
+		if b.Progress, err = d.GetBroadcastProgress(b.ID); err != nil {
+			return nil, err
+		}
+	}
+	return broadcasts, nil
+}
+
+// GetNextRunningBroadcast returns the oldest running broadcast. Broadcasts
+// run one at a time so their pacing adds up.
+func (d *Database) GetNextRunningBroadcast() (*Broadcast, error) {
+	return d.scanBroadcast(d.db.QueryRow("SELECT "+broadcastColumns+` FROM broadcasts
+	WHERE status = ? ORDER BY id ASC LIMIT 1`, BroadcastRunning))
+}
+
+// GetFinishedBroadcastsWithMedia returns cancelled and completed broadcasts
+// whose attached file has not been removed yet
+func (d *Database) GetFinishedBroadcastsWithMedia() ([]*Broadcast, error) {
+	return d.queryBroadcasts("SELECT "+broadcastColumns+` FROM broadcasts
+	WHERE status IN (?, ?) AND media_path != ''`, BroadcastCancelled, BroadcastCompleted)
+}
+
+// ClearBroadcastMedia forgets the attached file of a broadcast
+func (d *Database) ClearBroadcastMedia(id int64) error {
+	_, err := d.db.Exec("UPDATE broadcasts SET media_path = '' WHERE id = ?", id)
+	return err
+}
+
+// UpdateBroadcastStatus moves a broadcast to status if it is currently in
+// one of the from states, and reports whether it did. Resuming makes the
+// next message due immediately; cancelling skips the remaining recipients.
+func (d *Database) UpdateBroadcastStatus(id int64, status string, from ...string) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var finished interface{}
+	if status == BroadcastCancelled || status == BroadcastCompleted {
+		finished = now
+	}
+	query := "UPDATE broadcasts SET status = ?, updated_at = ?, finished_at = ?"
+	args := []interface{}{status, now, finished}
+	if status == BroadcastRunning {
+		query += ", next_send_at = ?"
+		args = append(args, now)
+	}
+	query += " WHERE id = ? AND status IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(from)), ", ") + ")"
+	args = append(args, id)
+	for _, s := range from {
+		args = append(args, s)
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if status == BroadcastCancelled {
+		if _, err := tx.Exec(`
+		UPDATE broadcast_recipients SET status = ?, text = '' WHERE broadcast_id = ? AND status = ?`,
+			RecipientSkipped, id, RecipientPending); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// SetBroadcastNextSend records when the next message of a broadcast is due
+func (d *Database) SetBroadcastNextSend(id int64, next time.Time) error {
+	_, err := d.db.Exec("UPDATE broadcasts SET next_send_at = ? WHERE id = ?", next.UTC(), id)
+	return err
+}
+
+// GetNextPendingBroadcastRecipient returns the next recipient of a broadcast
+// still waiting for its message
+func (d *Database) GetNextPendingBroadcastRecipient(broadcastID int64) (*BroadcastRecipient, error) {
+	r := &BroadcastRecipient{BroadcastID: broadcastID, Status: RecipientPending}
+	err := d.db.QueryRow(`
+	SELECT id, recipient, text FROM broadcast_recipients
+	WHERE broadcast_id = ? AND status = ?
+	ORDER BY id ASC LIMIT 1`, broadcastID, RecipientPending).Scan(&r.ID, &r.Recipient, &r.Text)
+	if err != nil {
+		return nil, err
+	}
+	if r.Text, err = d.decrypt(r.Text); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RecordBroadcastSend records that a recipient's message was handed to the
+// outbox, or why it could not be. The rendered message is dropped either way.
+func (d *Database) RecordBroadcastSend(id, outboxID int64, sendError string) error {
+	if sendError != "" {
+		_, err := d.db.Exec(`
+		UPDATE broadcast_recipients SET status = ?, error = ?, text = '' WHERE id = ?`, RecipientFailed, sendError, id)
+		return err
+	}
+	_, err := d.db.Exec(`
+	UPDATE broadcast_recipients SET status = ?, outbox_id = ?, queued_at = ?, text = '' WHERE id = ?`,
+		RecipientQueued, outboxID, time.Now().UTC(), id)
+	return err
+}
+
+// GetBroadcastProgress counts the recipients of a broadcast by reported status
+func (d *Database) GetBroadcastProgress(broadcastID int64) (*BroadcastProgress, error) {
+	rows, err := d.db.Query(`
+	SELECT `+recipientStatus+`, COUNT(*) FROM broadcast_recipients AS r
+	LEFT JOIN outbox AS o ON o.id = r.outbox_id
+	WHERE r.broadcast_id = ?
+	GROUP BY 1`, broadcastID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p := &BroadcastProgress{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		p.Total += n
+		switch status {
+		case RecipientPending:
+			p.Pending += n
+		case OutboxQueued:
+			p.Queued += n
+		case OutboxSending:
+			p.Sending += n
+		case OutboxSent:
+			p.Sent += n
+		case OutboxFailed:
+			p.Failed += n
+		case RecipientSkipped:
+			p.Skipped += n
+		}
+	}
+	return p, rows.Err()
+}
+
+// GetBroadcastRecipients lists the recipients of a broadcast with their
+// reported status, optionally filtered by it
+func (d *Database) GetBroadcastRecipients(broadcastID int64, status string) ([]*BroadcastRecipient, error) {
+	query := `
+	SELECT r.id, r.recipient, ` + recipientStatus + `, r.outbox_id, COALESCE(o.last_error, r.error), r.queued_at
+	FROM broadcast_recipients AS r
+	LEFT JOIN outbox AS o ON o.id = r.outbox_id
+	WHERE r.broadcast_id = ?`
+	args := []interface{}{broadcastID}
+	if status != "" {
+		query += " AND " + recipientStatus + " = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY r.id ASC"
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []*BroadcastRecipient
+	for rows.Next() {
+		r := &BroadcastRecipient{BroadcastID: broadcastID}
+		var outboxID sql.NullInt64
+		var lastError sql.NullString
+		var queuedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.Recipient, &r.Status, &outboxID, &lastError, &queuedAt); err != nil {
+			return nil, err
+		}
+		r.OutboxID = outboxID.Int64
+		r.Error = lastError.String
+		r.QueuedAt = timeOrNil(queuedAt)
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// queryBroadcasts runs a query returning broadcast rows
+func (d *Database) queryBroadcasts(query string, args ...interface{}) ([]*Broadcast, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var broadcasts []*Broadcast
+	for rows.Next() {
+		b, err := d.scanBroadcast(rows)
+		if err != nil {
+			return nil, err
+		}
+		broadcasts = append(broadcasts, b)
+	}
+	return broadcasts, rows.Err()
+}
+
+// scanBroadcast reads a broadcast row and decrypts its template
+func (d *Database) scanBroadcast(row rowScanner) (*Broadcast, error) {
+	b := &Broadcast{}
+	var createdBy sql.NullString
+	var finishedAt sql.NullTime
+	if err := row.Scan(&b.ID, &b.Name, &b.Template, &b.MediaPath, &b.Filename, &b.Status, &b.Delay, &b.Jitter,
+		&b.NextSendAt, &createdBy, &b.CreatedAt, &b.UpdatedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	b.CreatedBy = createdBy.String
+	b.FinishedAt = timeOrNil(finishedAt)
+
+	template, err := d.decrypt(b.Template)
+	if err != nil {
+		return nil, err
+	}
+	b.Template = template
+	return b, nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 )
 
@@ -41,7 +42,8 @@ type Chat struct {
 
 // Database represents the database connection and operations
 type Database struct {
-	db *sql.DB
+	db  *sql.DB
+	enc *Encryptor
 }
 
 // NewDatabase creates a new database connection
@@ -110,6 +112,19 @@ func (d *Database) initTables() error {
 
 	queries := []string{createMessagesTable, createContactsTable, createChatsTable}
 	queries = append(queries, createIndexes...)
+	queries = append(queries, privacySchema...)
+	queries = append(queries, webhookSchema...)
+	queries = append(queries, eventLogSchema...)
+	queries = append(queries, rulesSchema...)
+	queries = append(queries, awayNoticeSchema...)
+	queries = append(queries, handoffSchema...)
+	queries = append(queries, outboxSchema...)
+	queries = append(queries, scheduledMessageSchema...)
+	queries = append(queries, broadcastSchema...)
+	queries = append(queries, healthSchema...)
+	queries = append(queries, apiKeySchema...)
+	queries = append(queries, policySchema...)
+	queries = append(queries, draftSchema...)
 
 	for _, query := range queries {
 		if _, err := d.db.Exec(query); err != nil {
@@ -117,7 +132,21 @@ func (d *Database) initTables() error {
 		}
 	}
 
-	return nil
+	// Columns added to tables that databases may already hold
+	return d.addColumn("outbox", "body_digest", "TEXT NOT NULL DEFAULT ''")
+}
+
+// addColumn adds a column to an existing table unless it is already there
+func (d *Database) addColumn(table, column, definition string) error {
+	var n int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := d.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
 }
 
 // Close closes the database connection
@@ -125,6 +154,31 @@ func (d *Database) Close() error {
 	return d.db.Close()
 }
 
+// SetEncryptor enables transparent encryption of message content and chat
+// previews. Passing nil disables encryption for new writes.
+func (d *Database) SetEncryptor(enc *Encryptor) {
+	d.enc = enc
+}
+
+// encrypt seals a value if encryption is enabled
+func (d *Database) encrypt(value string) (string, error) {
+	if d.enc == nil {
+		return value, nil
+	}
+	return d.enc.EncryptString(value)
+}
+
+// decrypt opens a value sealed by encrypt, passing plaintext values through
+func (d *Database) decrypt(value string) (string, error) {
+	if d.enc == nil {
+		if IsEncryptedString(value) {
+			return "", ErrNoEncryptionKey
+		}
+		return value, nil
+	}
+	return d.enc.DecryptString(value)
+}
+
 // StoreMessage stores a message in the database
 func (d *Database) StoreMessage(msg *Message) error {
 	query := `
@@ -132,7 +186,12 @@ func (d *Database) StoreMessage(msg *Message) error {
 	(time, sender, content, is_from_me, media_type, filename, chat_jid, message_id)
 	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := d.db.Exec(query, msg.Time, msg.Sender, msg.Content, msg.IsFromMe,
+	content, err := d.encrypt(msg.Content)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(query, msg.Time, msg.Sender, content, msg.IsFromMe,
 		msg.MediaType, msg.Filename, msg.ChatJID, msg.MessageID)
 	return err
 }
@@ -160,6 +219,9 @@ func (d *Database) GetMessages(chatJID string, limit int, offset int) ([]*Messag
 		if err != nil {
 			return nil, err
 		}
+		if msg.Content, err = d.decrypt(msg.Content); err != nil {
+			return nil, err
+		}
 		messages = append(messages, msg)
 	}
 
@@ -181,6 +243,9 @@ func (d *Database) GetMessageByID(messageID string) (*Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	if msg.Content, err = d.decrypt(msg.Content); err != nil {
+		return nil, err
+	}
 	return msg, nil
 }
 
@@ -201,6 +266,9 @@ func (d *Database) GetLastMessageWithContact(contactJID string) (*Message, error
 	if err != nil {
 		return nil, err
 	}
+	if msg.Content, err = d.decrypt(msg.Content); err != nil {
+		return nil, err
+	}
 	return msg, nil
 }
 
@@ -252,7 +320,12 @@ func (d *Database) StoreChat(chat *Chat) error {
 	(jid, name, last_message, last_message_time, unread_count, is_group, is_archived, is_muted)
 	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := d.db.Exec(query, chat.JID, chat.Name, chat.LastMessage,
+	lastMessage, err := d.encrypt(chat.LastMessage)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(query, chat.JID, chat.Name, lastMessage,
 		chat.LastMessageTime, chat.UnreadCount, chat.IsGroup, chat.IsArchived, chat.IsMuted)
 	return err
 }
@@ -279,6 +352,9 @@ func (d *Database) GetChats() ([]*Chat, error) {
 		if err != nil {
 			return nil, err
 		}
+		if chat.LastMessage, err = d.decrypt(chat.LastMessage); err != nil {
+			return nil, err
+		}
 		chats = append(chats, chat)
 	}
 
@@ -300,6 +376,9 @@ func (d *Database) GetChatByJID(jid string) (*Chat, error) {
 	if err != nil {
 		return nil, err
 	}
+	if chat.LastMessage, err = d.decrypt(chat.LastMessage); err != nil {
+		return nil, err
+	}
 	return chat, nil
 }
 
@@ -327,8 +406,157 @@ func (d *Database) GetChatsByContact(contactJID string) ([]*Chat, error) {
 		if err != nil {
 			return nil, err
 		}
+		if chat.LastMessage, err = d.decrypt(chat.LastMessage); err != nil {
+			return nil, err
+		}
 		chats = append(chats, chat)
 	}
 
 	return chats, nil
 }
+
+// RotateEncryption re-encrypts message content, chat previews, transcripts,
+// queued webhook payloads, the event log, the outbox, scheduled messages,
+// broadcasts and drafts with the active encryption key. Plaintext rows are encrypted and rows
+// sealed with an older key are re-wrapped. It returns the number of rows rewritten.
+func (d *Database) RotateEncryption() (int, error) {
+	if d.enc == nil {
+		return 0, fmt.Errorf("encryption is not enabled")
+	}
+
+	rotated := 0
+	targets := []struct {
+		table, key, column string
+	}{
+		{"messages", "id", "content"},
+		{"chats", "jid", "last_message"},
+		{"transcripts", "message_id", "text"},
+		{"webhooks", "id", "secret"},
+		{"webhook_deliveries", "id", "payload"},
+		{"event_log", "id", "payload"},
+		{"outbox", "id", "body"},
+		{"scheduled_messages", "id", "text"},
+		{"broadcasts", "id", "template"},
+		{"broadcast_recipients", "id", "text"},
+		{"drafts", "id", "text"},
+		{"drafts", "id", "original_text"},
+	}
+
+	for _, target := range targets {
+		rows, err := d.db.Query(fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IS NOT NULL AND %s != ''",
+			target.key, target.column, target.table, target.column, target.column))
+		if err != nil {
+			return rotated, err
+		}
+
+		type update struct {
+			key   interface{}
+			value string
+		}
+		var updates []update
+		for rows.Next() {
+			var key interface{}
+			var value string
+			if err := rows.Scan(&key, &value); err != nil {
+				rows.Close()
+				return rotated, err
+			}
+			newValue, changed, err := d.enc.RotateString(value)
+			if err != nil {
+				rows.Close()
+				return rotated, fmt.Errorf("failed to rotate %s %v: %w", target.table, key, err)
+			}
+			if changed {
+				updates = append(updates, update{key: key, value: newValue})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rotated, err
+		}
+
+		tx, err := d.db.Begin()
+		if err != nil {
+			return rotated, err
+		}
+		query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?", target.table, target.column, target.key)
+		for _, u := range updates {
+			if _, err := tx.Exec(query, u.value, u.key); err != nil {
+				tx.Rollback()
+				return rotated, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return rotated, err
+		}
+		rotated += len(updates)
+	}
+
+	return rotated, nil
+}
+
+// iterateBatchSize is the number of messages IterateMessages reads at a time
+const iterateBatchSize = 500
+
+// IterateMessages calls fn for every message in a chat in chronological
+// order. Messages are read in batches, keyed on (time, id), so large chats
+// are never held in memory and no read is open while fn runs; a read held
+// open for a whole export would make every write fail with "database is
+// locked".
+func (d *Database) IterateMessages(chatJID string, fn func(*Message) error) error {
+	var last *Message
+	for {
+		batch, err := d.messagesAfter(chatJID, last, iterateBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, msg := range batch {
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return nil
+		}
+		last = batch[len(batch)-1]
+	}
+}
+
+// messagesAfter returns up to limit messages of a chat that come after last
+// in chronological order, or the first ones if last is nil
+func (d *Database) messagesAfter(chatJID string, last *Message, limit int) ([]*Message, error) {
+	query := `
+	SELECT id, time, sender, content, is_from_me, media_type, filename, chat_jid, message_id
+	FROM messages 
+	WHERE chat_jid = ?`
+	args := []interface{}{chatJID}
+	if last != nil {
+		query += ` AND (time > ? OR (time = ? AND id > ?))`
+		args = append(args, last.Time, last.Time, last.ID)
+	}
+	query += `
+	ORDER BY time ASC, id ASC
+	LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		msg := &Message{}
+		err := rows.Scan(&msg.ID, &msg.Time, &msg.Sender, &msg.Content,
+			&msg.IsFromMe, &msg.MediaType, &msg.Filename, &msg.ChatJID, &msg.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Content, err = d.decrypt(msg.Content); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
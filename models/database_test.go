@@ -0,0 +1,56 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestIterateMessagesAllowsWritesWhileExporting(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	const chat, other = "353851111111@s.whatsapp.net", "353852222222@s.whatsapp.net"
+	start := time.Date(2025, 10, 20, 9, 0, 0, 0, time.UTC)
+	total := iterateBatchSize*2 + 7
+	for i := 0; i < total; i++ {
+		// Messages share timestamps across batch boundaries
+		if err := db.StoreMessage(&Message{
+			Time:      start.Add(time.Duration(i/3) * time.Second),
+			Sender:    chat,
+			Content:   fmt.Sprintf("message %d", i),
+			ChatJID:   chat,
+			MessageID: fmt.Sprintf("m%d", i),
+		}); err != nil {
+			t.Fatalf("StoreMessage: %v", err)
+		}
+	}
+
+	seen := 0
+	err = db.IterateMessages(chat, func(msg *Message) error {
+		if want := fmt.Sprintf("message %d", seen); msg.Content != want {
+			return fmt.Errorf("got %q, want %q", msg.Content, want)
+		}
+		seen++
+		// New messages keep arriving while a chat is exported
+		return db.StoreMessage(&Message{
+			Time:      time.Now(),
+			Sender:    other,
+			Content:   "hello",
+			ChatJID:   other,
+			MessageID: fmt.Sprintf("incoming-%d", seen),
+		})
+	})
+	if err != nil {
+		t.Fatalf("IterateMessages: %v", err)
+	}
+	if seen != total {
+		t.Errorf("iterated %d messages, want %d", seen, total)
+	}
+}
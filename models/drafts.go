@@ -0,0 +1,190 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Draft statuses
+const (
+	DraftPending  = "pending"  // waiting for review
+	DraftApproved = "approved" // queued in the outbox
+	DraftRejected = "rejected" // will not be sent
+)
+
+// Draft sources
+const (
+	DraftFromAPI = "api" // a send request made through the API
+	DraftFromBot = "bot" // a reply written by the LlamaStack agent
+)
+
+// Draft is an outgoing message waiting for a person to approve it
+type Draft struct {
+	ID           int64      `json:"id"`
+	Recipient    string     `json:"recipient"`
+	Kind         string     `json:"kind"` // text, audio or file, as in the outbox
+	Text         string     `json:"text"`
+	OriginalText string     `json:"original_text"` // the text as drafted, before any edits
+	MediaPath    string     `json:"-"`
+	Filename     string     `json:"filename,omitempty"`
+	Source       string     `json:"source"`
+	RequestedBy  string     `json:"requested_by,omitempty"`
+	Status       string     `json:"status"`
+	EditedBy     string     `json:"edited_by,omitempty"`
+	ReviewedBy   string     `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	RejectReason string     `json:"reject_reason,omitempty"`
+	OutboxID     int64      `json:"outbox_id,omitempty"`
+	LastError    string     `json:"last_error,omitempty"` // why the last approval could not be queued
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// draftSchema creates the draft table. Text is encrypted at rest.
+var draftSchema = []string{
+	`CREATE TABLE IF NOT EXISTS drafts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		text TEXT NOT NULL DEFAULT '',
+		original_text TEXT NOT NULL DEFAULT '',
+		media_path TEXT NOT NULL DEFAULT '',
+		filename TEXT NOT NULL DEFAULT '',
+		source TEXT NOT NULL,
+		requested_by TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		edited_by TEXT NOT NULL DEFAULT '',
+		reviewed_by TEXT NOT NULL DEFAULT '',
+		reviewed_at DATETIME,
+		reject_reason TEXT NOT NULL DEFAULT '',
+		outbox_id INTEGER,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`,
+	"CREATE INDEX IF NOT EXISTS idx_drafts_status ON drafts(status, id);",
+}
+
+const draftColumns = `id, recipient, kind, text, original_text, media_path, filename, source, requested_by, status,
+	edited_by, reviewed_by, reviewed_at, reject_reason, outbox_id, last_error, created_at, updated_at`
+
+// CreateDraft stores a new pending draft
+func (d *Database) CreateDraft(draft *Draft) error {
+	text, err := d.encrypt(draft.Text)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	result, err := d.db.Exec(`
+	INSERT INTO drafts (recipient, kind, text, original_text, media_path, filename, source, requested_by,
+		status, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		draft.Recipient, draft.Kind, text, text, draft.MediaPath, draft.Filename, draft.Source,
+		draft.RequestedBy, DraftPending, now, now)
+	if err != nil {
+		return err
+	}
+	draft.ID, err = result.LastInsertId()
+	draft.OriginalText = draft.Text
+	draft.Status = DraftPending
+	draft.CreatedAt, draft.UpdatedAt = now, now
+	return err
+}
+
+// GetDraft returns a draft by ID
+func (d *Database) GetDraft(id int64) (*Draft, error) {
+	return d.scanDraft(d.db.QueryRow("SELECT "+draftColumns+" FROM drafts WHERE id = ?", id))
+}
+
+// GetDrafts returns drafts with the given status, or all drafts, oldest first
+func (d *Database) GetDrafts(status string) ([]*Draft, error) {
+	query := "SELECT " + draftColumns + " FROM drafts"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id"
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []*Draft
+	for rows.Next() {
+		draft, err := d.scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, draft)
+	}
+	return drafts, rows.Err()
+}
+
+// EditDraft replaces the text of a pending draft. It reports false if the
+// draft is no longer pending.
+func (d *Database) EditDraft(id int64, text, editedBy string) (bool, error) {
+	sealed, err := d.encrypt(text)
+	if err != nil {
+		return false, err
+	}
+	result, err := d.db.Exec("UPDATE drafts SET text = ?, edited_by = ?, updated_at = ? WHERE id = ? AND status = ?",
+		sealed, editedBy, time.Now().UTC(), id, DraftPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ReviewDraft moves a pending draft to approved or rejected. It reports
+// false if the draft is no longer pending, so that it is only reviewed once.
+func (d *Database) ReviewDraft(id int64, status, reviewedBy, rejectReason string) (bool, error) {
+	now := time.Now().UTC()
+	result, err := d.db.Exec(`UPDATE drafts SET status = ?, reviewed_by = ?, reviewed_at = ?, reject_reason = ?,
+		last_error = '', updated_at = ? WHERE id = ? AND status = ?`,
+		status, reviewedBy, now, rejectReason, now, id, DraftPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RecordDraftQueued records the outbox entry of an approved draft
+func (d *Database) RecordDraftQueued(id, outboxID int64) error {
+	_, err := d.db.Exec("UPDATE drafts SET outbox_id = ?, updated_at = ? WHERE id = ?", outboxID, time.Now().UTC(), id)
+	return err
+}
+
+// ReopenDraft returns an approved draft that could not be queued to pending
+func (d *Database) ReopenDraft(id int64, lastError string) error {
+	_, err := d.db.Exec(`UPDATE drafts SET status = ?, reviewed_by = '', reviewed_at = NULL, last_error = ?, updated_at = ?
+		WHERE id = ?`, DraftPending, lastError, time.Now().UTC(), id)
+	return err
+}
+
+// scanDraft reads a draft row and decrypts its text
+func (d *Database) scanDraft(row rowScanner) (*Draft, error) {
+	draft := &Draft{}
+	var reviewedAt sql.NullTime
+	var outboxID sql.NullInt64
+	if err := row.Scan(&draft.ID, &draft.Recipient, &draft.Kind, &draft.Text, &draft.OriginalText, &draft.MediaPath,
+		&draft.Filename, &draft.Source, &draft.RequestedBy, &draft.Status, &draft.EditedBy, &draft.ReviewedBy,
+		&reviewedAt, &draft.RejectReason, &outboxID, &draft.LastError, &draft.CreatedAt, &draft.UpdatedAt); err != nil {
+		return nil, err
+	}
+	draft.ReviewedAt = timeOrNil(reviewedAt)
+	draft.OutboxID = outboxID.Int64
+
+	var err error
+	if draft.Text, err = d.decrypt(draft.Text); err != nil {
+		return nil, err
+	}
+	if draft.OriginalText, err = d.decrypt(draft.OriginalText); err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
@@ -0,0 +1,383 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// encryptedPrefix marks database values sealed by an Encryptor
+	encryptedPrefix = "enc:v1:"
+	// keySize is the size of both key-encryption keys and data keys (AES-256)
+	keySize = 32
+)
+
+// encryptedFileMagic is written at the start of every encrypted media file
+var encryptedFileMagic = []byte("WAENC1\n")
+
+// ErrNoEncryptionKey is returned when encrypted data is read without a matching key
+var ErrNoEncryptionKey = errors.New("encrypted data found but no matching encryption key is configured")
+
+// Encryptor provides envelope encryption for message content and media files.
+// Every value is sealed with a fresh random data key (DEK), and the DEK itself
+// is wrapped with a key-encryption key (KEK). Rotating the KEK only requires
+// re-wrapping the DEKs, the payloads themselves are left untouched.
+type Encryptor struct {
+	keys     map[string][]byte
+	activeID string
+}
+
+// NewEncryptor creates an encryptor from a set of KEKs indexed by key ID.
+// New data is always sealed with the KEK identified by activeID.
+func NewEncryptor(keys map[string][]byte, activeID string) (*Encryptor, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no encryption keys provided")
+	}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid encryption key ID %q", id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("encryption key %q must be %d bytes, got %d", id, keySize, len(key))
+		}
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active encryption key %q not found", activeID)
+	}
+	return &Encryptor{keys: keys, activeID: activeID}, nil
+}
+
+// LoadEncryptor loads KEKs from a keyfile and/or an environment-provided value.
+// Both use the same format: one "<id>:<base64 key>" entry per line (the env
+// value may also separate entries with commas). A bare base64 key is given
+// the ID "default". The last key loaded becomes the active key unless
+// activeID is set explicitly.
+func LoadEncryptor(keyFile, envKEK, activeID string) (*Encryptor, error) {
+	keys := make(map[string][]byte)
+	lastID := ""
+
+	addEntry := func(entry string) error {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			return nil
+		}
+		id, encoded := "default", entry
+		if idx := strings.Index(entry, ":"); idx >= 0 {
+			id, encoded = strings.TrimSpace(entry[:idx]), strings.TrimSpace(entry[idx+1:])
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid base64 for encryption key %q: %w", id, err)
+		}
+		keys[id] = key
+		lastID = id
+		return nil
+	}
+
+	if keyFile != "" {
+		file, err := os.Open(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open encryption keyfile: %w", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if err := addEntry(scanner.Text()); err != nil {
+				return nil, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read encryption keyfile: %w", err)
+		}
+	}
+
+	for _, entry := range strings.FieldsFunc(envKEK, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if err := addEntry(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if activeID == "" {
+		activeID = lastID
+	}
+	return NewEncryptor(keys, activeID)
+}
+
+// ActiveKeyID returns the ID of the KEK used for new data
+func (e *Encryptor) ActiveKeyID() string {
+	return e.activeID
+}
+
+// Seal encrypts plaintext into a self-describing envelope:
+// len(keyID) | keyID | nonce | wrapped DEK | nonce | ciphertext
+func (e *Encryptor) Seal(plaintext []byte) ([]byte, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrapped, err := gcmSeal(e.keys[e.activeID], dek, []byte(e.activeID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	ciphertext, err := gcmSeal(dek, plaintext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	return e.buildEnvelope(wrapped, ciphertext), nil
+}
+
+// Open decrypts an envelope produced by Seal
+func (e *Encryptor) Open(envelope []byte) ([]byte, error) {
+	keyID, dek, ciphertext, err := e.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcmOpen(dek, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data sealed with key %q: %w", keyID, err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap re-wraps the data key of an envelope with the active KEK, leaving
+// the encrypted payload unchanged
+func (e *Encryptor) Rewrap(envelope []byte) ([]byte, error) {
+	keyID, dek, ciphertext, err := e.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if keyID == e.activeID {
+		return envelope, nil
+	}
+
+	wrapped, err := gcmSeal(e.keys[e.activeID], dek, []byte(e.activeID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return e.buildEnvelope(wrapped, ciphertext), nil
+}
+
+// buildEnvelope assembles an envelope for a DEK wrapped with the active KEK
+func (e *Encryptor) buildEnvelope(wrapped, ciphertext []byte) []byte {
+	envelope := make([]byte, 0, 1+len(e.activeID)+len(wrapped)+len(ciphertext))
+	envelope = append(envelope, byte(len(e.activeID)))
+	envelope = append(envelope, e.activeID...)
+	envelope = append(envelope, wrapped...)
+	envelope = append(envelope, ciphertext...)
+	return envelope
+}
+
+// unwrap parses an envelope and recovers its data key
+func (e *Encryptor) unwrap(envelope []byte) (string, []byte, []byte, error) {
+	if len(envelope) < 1 {
+		return "", nil, nil, fmt.Errorf("envelope too short")
+	}
+	idLen := int(envelope[0])
+	wrappedLen := 12 + keySize + 16 // nonce + DEK + GCM tag
+	if len(envelope) < 1+idLen+wrappedLen {
+		return "", nil, nil, fmt.Errorf("envelope too short")
+	}
+
+	keyID := string(envelope[1 : 1+idLen])
+	kek, ok := e.keys[keyID]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("%w (key ID %q)", ErrNoEncryptionKey, keyID)
+	}
+
+	wrapped := envelope[1+idLen : 1+idLen+wrappedLen]
+	dek, err := gcmOpen(kek, wrapped, []byte(keyID))
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to unwrap data key with key %q: %w", keyID, err)
+	}
+
+	return keyID, dek, envelope[1+idLen+wrappedLen:], nil
+}
+
+// envelopeKeyID returns the KEK ID recorded in an envelope
+func envelopeKeyID(envelope []byte) string {
+	if len(envelope) < 1 || len(envelope) < 1+int(envelope[0]) {
+		return ""
+	}
+	return string(envelope[1 : 1+int(envelope[0])])
+}
+
+// EncryptString seals a database value. Empty strings are stored as-is.
+func (e *Encryptor) EncryptString(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	envelope, err := e.Seal([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(envelope), nil
+}
+
+// DecryptString opens a database value. Values that were never encrypted are
+// returned unchanged so plaintext rows written before encryption was enabled
+// stay readable until they are migrated.
+func (e *Encryptor) DecryptString(value string) (string, error) {
+	if !IsEncryptedString(value) {
+		return value, nil
+	}
+	envelope, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	plaintext, err := e.Open(envelope)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// RotateString returns the value sealed with the active KEK, encrypting it if
+// it was stored in plaintext. The boolean reports whether the value changed.
+func (e *Encryptor) RotateString(value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if !IsEncryptedString(value) {
+		encrypted, err := e.EncryptString(value)
+		return encrypted, err == nil, err
+	}
+
+	envelope, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", false, fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if envelopeKeyID(envelope) == e.activeID {
+		return value, false, nil
+	}
+	rewrapped, err := e.Rewrap(envelope)
+	if err != nil {
+		return "", false, err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(rewrapped), true, nil
+}
+
+// IsEncryptedString reports whether a database value was sealed by an Encryptor
+func IsEncryptedString(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// WriteFile encrypts data and writes it to path
+func (e *Encryptor) WriteFile(path string, data []byte, perm os.FileMode) error {
+	envelope, err := e.Seal(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(append([]byte{}, encryptedFileMagic...), envelope...), perm)
+}
+
+// ReadFile reads a file written by WriteFile. Plaintext files are returned unchanged.
+func (e *Encryptor) ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, encryptedFileMagic) {
+		return data, nil
+	}
+	return e.Open(data[len(encryptedFileMagic):])
+}
+
+// RotateFile makes sure a file is sealed with the active KEK, encrypting it
+// in place if it is still plaintext. It reports whether the file was rewritten.
+func (e *Encryptor) RotateFile(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var envelope []byte
+	if bytes.HasPrefix(data, encryptedFileMagic) {
+		current := data[len(encryptedFileMagic):]
+		if envelopeKeyID(current) == e.activeID {
+			return false, nil
+		}
+		if envelope, err = e.Rewrap(current); err != nil {
+			return false, err
+		}
+	} else if envelope, err = e.Seal(data); err != nil {
+		return false, err
+	}
+
+	// Write to a temporary file first so a crash never leaves a half-written file
+	tmpPath := path + ".rotating"
+	if err := os.WriteFile(tmpPath, append(append([]byte{}, encryptedFileMagic...), envelope...), info.Mode().Perm()); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	return true, nil
+}
+
+// IsEncryptedFile reports whether a file was written by an Encryptor
+func IsEncryptedFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, len(encryptedFileMagic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, encryptedFileMagic)
+}
+
+// gcmSeal encrypts data with AES-GCM and prepends the random nonce
+func gcmSeal(key, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// gcmOpen decrypts data produced by gcmSeal
+func gcmOpen(key, sealed, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func randomKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+func TestEncryptorRoundTripAndRotation(t *testing.T) {
+	oldKey, newKey := randomKey(t), randomKey(t)
+
+	oldEnc, err := NewEncryptor(map[string][]byte{"k1": oldKey}, "k1")
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+
+	sealed, err := oldEnc.EncryptString("transfer 100 EUR")
+	if err != nil {
+		t.Fatalf("EncryptString: %v", err)
+	}
+	if !IsEncryptedString(sealed) || strings.Contains(sealed, "transfer") {
+		t.Fatalf("value was not encrypted: %q", sealed)
+	}
+
+	rotatedEnc, err := NewEncryptor(map[string][]byte{"k1": oldKey, "k2": newKey}, "k2")
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+
+	rotated, changed, err := rotatedEnc.RotateString(sealed)
+	if err != nil || !changed {
+		t.Fatalf("RotateString: changed=%v err=%v", changed, err)
+	}
+
+	// The rotated value must be readable with only the new key
+	newOnly, err := NewEncryptor(map[string][]byte{"k2": newKey}, "k2")
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	plaintext, err := newOnly.DecryptString(rotated)
+	if err != nil || plaintext != "transfer 100 EUR" {
+		t.Fatalf("DecryptString after rotation = %q, %v", plaintext, err)
+	}
+
+	if _, err := newOnly.DecryptString(sealed); err == nil {
+		t.Fatalf("expected value sealed with a missing key to fail")
+	}
+
+	// Plaintext values pass through unchanged
+	if plain, err := newOnly.DecryptString("legacy row"); err != nil || plain != "legacy row" {
+		t.Fatalf("DecryptString(plaintext) = %q, %v", plain, err)
+	}
+}
+
+func TestEncryptedFiles(t *testing.T) {
+	dir := t.TempDir()
+	enc, err := NewEncryptor(map[string][]byte{"k1": randomKey(t)}, "k1")
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+
+	path := filepath.Join(dir, "voice.ogg")
+	data := []byte("OggS fake audio payload")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	changed, err := enc.RotateFile(path)
+	if err != nil || !changed {
+		t.Fatalf("RotateFile: changed=%v err=%v", changed, err)
+	}
+	if !IsEncryptedFile(path) {
+		t.Fatalf("file was not encrypted in place")
+	}
+
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, data) {
+		t.Fatalf("encrypted file still contains plaintext")
+	}
+
+	decrypted, err := enc.ReadFile(path)
+	if err != nil || !bytes.Equal(decrypted, data) {
+		t.Fatalf("ReadFile = %q, %v", decrypted, err)
+	}
+}
+
+func TestDatabaseEncryptionIsTransparent(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	// A row written before encryption was enabled
+	legacy := &Message{Time: time.Now(), Sender: "a@s.whatsapp.net", Content: "old secret",
+		MediaType: "text", ChatJID: "a@s.whatsapp.net", MessageID: "m1"}
+	if err := db.StoreMessage(legacy); err != nil {
+		t.Fatalf("StoreMessage: %v", err)
+	}
+
+	enc, err := NewEncryptor(map[string][]byte{"k1": randomKey(t)}, "k1")
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	db.SetEncryptor(enc)
+
+	if err := db.StoreMessage(&Message{Time: time.Now(), Sender: "a@s.whatsapp.net", Content: "new secret",
+		MediaType: "text", ChatJID: "a@s.whatsapp.net", MessageID: "m2"}); err != nil {
+		t.Fatalf("StoreMessage: %v", err)
+	}
+
+	if rotated, err := db.RotateEncryption(); err != nil || rotated != 1 {
+		t.Fatalf("RotateEncryption = %d, %v", rotated, err)
+	}
+
+	var raw string
+	if err := db.db.QueryRow("SELECT content FROM messages WHERE message_id = 'm1'").Scan(&raw); err != nil {
+		t.Fatalf("query raw content: %v", err)
+	}
+	if !IsEncryptedString(raw) {
+		t.Fatalf("legacy row was not migrated: %q", raw)
+	}
+
+	messages, err := db.GetMessages("a@s.whatsapp.net", 10, 0)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	contents := map[string]bool{}
+	for _, msg := range messages {
+		contents[msg.Content] = true
+	}
+	if !contents["old secret"] || !contents["new secret"] {
+		t.Fatalf("unexpected decrypted contents: %v", contents)
+	}
+}
+
+func TestWebhookSecretsAreEncrypted(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	// A webhook created before encryption was enabled
+	legacy := &Webhook{URL: "https://crm.example.com/hook", Secret: "old-signing-secret", Enabled: true}
+	if err := db.CreateWebhook(legacy); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	enc, err := NewEncryptor(map[string][]byte{"k1": randomKey(t)}, "k1")
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	db.SetEncryptor(enc)
+	created := &Webhook{URL: "https://erp.example.com/hook", Secret: "new-signing-secret", Enabled: true}
+	if err := db.CreateWebhook(created); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	if rotated, err := db.RotateEncryption(); err != nil || rotated != 1 {
+		t.Fatalf("RotateEncryption = %d, %v; want the legacy secret encrypted", rotated, err)
+	}
+
+	for _, w := range []*Webhook{legacy, created} {
+		var raw string
+		if err := db.db.QueryRow("SELECT secret FROM webhooks WHERE id = ?", w.ID).Scan(&raw); err != nil {
+			t.Fatalf("query raw secret: %v", err)
+		}
+		if !IsEncryptedString(raw) {
+			t.Errorf("secret of webhook %d stored in plaintext: %q", w.ID, raw)
+		}
+		got, err := db.GetWebhook(w.ID)
+		if err != nil {
+			t.Fatalf("GetWebhook: %v", err)
+		}
+		if got.Secret != w.Secret {
+			t.Errorf("webhook %d secret = %q, want %q", w.ID, got.Secret, w.Secret)
+		}
+	}
+}
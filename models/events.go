@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoggedEvent is an event kept in the event log for stream replay
+type LoggedEvent struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	ChatJID   string    `json:"chat_jid,omitempty"`
+	Sender    string    `json:"sender,omitempty"`
+	Payload   string    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// eventLogSchema creates the ring buffer of recent events
+var eventLogSchema = []string{
+	`CREATE TABLE IF NOT EXISTS event_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		chat_jid TEXT,
+		sender TEXT,
+		payload TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+}
+
+// AppendEvent adds an event to the event log and drops the oldest entries
+// beyond capacity. The payload is encrypted at rest.
+func (d *Database) AppendEvent(evt *LoggedEvent, capacity int) error {
+	payload, err := d.encrypt(evt.Payload)
+	if err != nil {
+		return err
+	}
+
+	result, err := d.db.Exec(`
+	INSERT INTO event_log (type, chat_jid, sender, payload)
+	VALUES (?, ?, ?, ?)`, evt.Type, evt.ChatJID, evt.Sender, payload)
+	if err != nil {
+		return err
+	}
+	if evt.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec("DELETE FROM event_log WHERE id <= ?", evt.ID-int64(capacity))
+	return err
+}
+
+// GetEventsAfter returns logged events with an ID greater than afterID, oldest first
+func (d *Database) GetEventsAfter(afterID int64, limit int) ([]*LoggedEvent, error) {
+	rows, err := d.db.Query(`
+	SELECT id, type, chat_jid, sender, payload, created_at
+	FROM event_log
+	WHERE id > ?
+	ORDER BY id ASC
+	LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return d.scanEvents(rows)
+}
+
+// GetEventsByContact returns the logged events in a chat with a contact or
+// sent by it, oldest first
+func (d *Database) GetEventsByContact(jid string) ([]*LoggedEvent, error) {
+	clause, args := senderMatches("sender", jid)
+	rows, err := d.db.Query(`
+	SELECT id, type, chat_jid, sender, payload, created_at
+	FROM event_log
+	WHERE chat_jid = ? OR `+clause+`
+	ORDER BY id ASC`, append([]interface{}{jid}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return d.scanEvents(rows)
+}
+
+// scanEvents reads event rows, decrypting their payloads, and closes rows
+func (d *Database) scanEvents(rows *sql.Rows) ([]*LoggedEvent, error) {
+	defer rows.Close()
+
+	var events []*LoggedEvent
+	for rows.Next() {
+		evt := &LoggedEvent{}
+		err := rows.Scan(&evt.ID, &evt.Type, &evt.ChatJID, &evt.Sender, &evt.Payload, &evt.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if evt.Payload, err = d.decrypt(evt.Payload); err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Bot modes of a chat
+const (
+	BotModeAuto      = "auto"       // the bot answers
+	BotModePaused    = "paused"     // the bot is silent until PausedUntil
+	BotModeHumanOnly = "human_only" // the bot is silent until switched back to auto
+)
+
+// ChatBotState is whether the bot answers in a chat
+type ChatBotState struct {
+	ChatJID     string     `json:"chat_jid"`
+	Mode        string     `json:"mode"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	UpdatedBy   string     `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Active reports whether the bot answers in the chat at time t. An expired
+// pause counts as auto.
+func (s *ChatBotState) Active(t time.Time) bool {
+	switch s.Mode {
+	case BotModeHumanOnly:
+		return false
+	case BotModePaused:
+		return s.PausedUntil != nil && !t.Before(*s.PausedUntil)
+	default:
+		return true
+	}
+}
+
+// handoffSchema creates the per-chat bot state table. Chats without a row are
+// in auto mode. Times are stored in UTC.
+var handoffSchema = []string{
+	`CREATE TABLE IF NOT EXISTS chat_bot_state (
+		chat_jid TEXT PRIMARY KEY,
+		mode TEXT NOT NULL,
+		paused_until DATETIME,
+		reason TEXT,
+		updated_by TEXT,
+		updated_at DATETIME NOT NULL
+	);`,
+}
+
+// GetChatBotState returns the bot state of a chat, auto if none was set
+func (d *Database) GetChatBotState(chatJID string) (*ChatBotState, error) {
+	state := &ChatBotState{ChatJID: chatJID}
+	var pausedUntil sql.NullTime
+	var reason, updatedBy sql.NullString
+	err := d.db.QueryRow(`
+	SELECT mode, paused_until, reason, updated_by, updated_at
+	FROM chat_bot_state WHERE chat_jid = ?`, chatJID).Scan(
+		&state.Mode, &pausedUntil, &reason, &updatedBy, &state.UpdatedAt)
+	if err == sql.ErrNoRows {
+		state.Mode = BotModeAuto
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pausedUntil.Valid {
+		state.PausedUntil = &pausedUntil.Time
+	}
+	state.Reason = reason.String
+	state.UpdatedBy = updatedBy.String
+	return state, nil
+}
+
+// SetChatBotState stores the bot state of a chat
+func (d *Database) SetChatBotState(state *ChatBotState) error {
+	var pausedUntil interface{}
+	if state.PausedUntil != nil {
+		pausedUntil = state.PausedUntil.UTC()
+	}
+	state.UpdatedAt = time.Now().UTC()
+	_, err := d.db.Exec(`
+	INSERT OR REPLACE INTO chat_bot_state (chat_jid, mode, paused_until, reason, updated_by, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)`, state.ChatJID, state.Mode, pausedUntil, state.Reason, state.UpdatedBy, state.UpdatedAt)
+	return err
+}
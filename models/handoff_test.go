@@ -0,0 +1,49 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestChatBotStatePauseExpires(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	const chat = "353851234567@s.whatsapp.net"
+	state, err := db.GetChatBotState(chat)
+	if err != nil {
+		t.Fatalf("GetChatBotState: %v", err)
+	}
+	if state.Mode != BotModeAuto || !state.Active(time.Now()) {
+		t.Fatalf("new chat should be in auto mode, got %+v", state)
+	}
+
+	until := time.Now().Add(time.Hour)
+	if err := db.SetChatBotState(&ChatBotState{ChatJID: chat, Mode: BotModePaused, PausedUntil: &until, UpdatedBy: "phone"}); err != nil {
+		t.Fatalf("SetChatBotState: %v", err)
+	}
+	state, err = db.GetChatBotState(chat)
+	if err != nil {
+		t.Fatalf("GetChatBotState: %v", err)
+	}
+	if state.PausedUntil == nil || state.PausedUntil.Sub(until).Abs() > time.Second {
+		t.Errorf("paused_until = %v, want %v", state.PausedUntil, until)
+	}
+	if state.Active(time.Now()) {
+		t.Error("bot should be quiet while paused")
+	}
+	if !state.Active(until.Add(time.Second)) {
+		t.Error("bot should answer again once the pause expires")
+	}
+
+	human := &ChatBotState{Mode: BotModeHumanOnly}
+	if human.Active(time.Now().Add(24 * time.Hour)) {
+		t.Error("human_only chats should stay quiet")
+	}
+}
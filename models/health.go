@@ -0,0 +1,28 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// healthSchema creates a one-row table written by readiness probes to prove
+// the database accepts writes
+var healthSchema = []string{
+	`CREATE TABLE IF NOT EXISTS health_probe (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		checked_at DATETIME NOT NULL
+	);`,
+}
+
+// Ping checks that the database answers a query
+func (d *Database) Ping(ctx context.Context) error {
+	var one int
+	return d.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// CheckWritable checks that the database accepts writes by updating the
+// health probe row
+func (d *Database) CheckWritable(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, "INSERT OR REPLACE INTO health_probe (id, checked_at) VALUES (1, ?)", time.Now().UTC())
+	return err
+}
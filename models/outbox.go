@@ -0,0 +1,250 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// OutboxMessage is an outbound message waiting for, or past, delivery
+type OutboxMessage struct {
+	ID             int64      `json:"id"`
+	IdempotencyKey string     `json:"idempotency_key,omitempty"`
+	Recipient      string     `json:"recipient"`
+	Kind           string     `json:"kind"` // "text", "audio" or "file"
+	Body           string     `json:"-"`    // text, or caption of a file
+	BodyDigest     string     `json:"-"`    // SHA-256 of Body and MediaDigest for idempotent messages, kept once the body is dropped
+	MediaDigest    string     `json:"-"`    // SHA-256 of the file content, set when queueing an idempotent file
+	MediaPath      string     `json:"-"`    // queued copy of an audio file or file
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastError      string     `json:"last_error,omitempty"`
+	MessageID      string     `json:"message_id,omitempty"` // WhatsApp message ID once sent
+	CreatedAt      time.Time  `json:"created_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+}
+
+// Outbox message kinds
+const (
+	OutboxText  = "text"
+	OutboxAudio = "audio"
+	OutboxFile  = "file"
+)
+
+// Outbox message states
+const (
+	OutboxQueued  = "queued"
+	OutboxSending = "sending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// outboxSchema creates the outbound message queue. Idempotency keys are
+// optional but unique when given. Queue times are stored in UTC.
+var outboxSchema = []string{
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		idempotency_key TEXT,
+		recipient TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		body TEXT NOT NULL DEFAULT '',
+		body_digest TEXT NOT NULL DEFAULT '',
+		media_path TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'queued',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_error TEXT,
+		message_id TEXT,
+		created_at DATETIME NOT NULL,
+		sent_at DATETIME
+	);`,
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_idempotency_key ON outbox(idempotency_key) WHERE idempotency_key IS NOT NULL;",
+	"CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox(status, next_attempt_at);",
+	"CREATE INDEX IF NOT EXISTS idx_outbox_recipient ON outbox(recipient, status);",
+}
+
+const outboxColumns = `id, idempotency_key, recipient, kind, body, body_digest, media_path, status, attempts,
+	next_attempt_at, last_error, message_id, created_at, sent_at`
+
+// EnqueueOutboxMessage adds a message to the outbox. If its idempotency key
+// was used before, nothing is queued and the earlier message is returned with
+// created set to false. The body is encrypted at rest; messages with an
+// idempotency key also keep a digest of it to recognise retries after the
+// body is dropped.
+func (d *Database) EnqueueOutboxMessage(m *OutboxMessage) (stored *OutboxMessage, created bool, err error) {
+	body, err := d.encrypt(m.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	var key interface{}
+	m.BodyDigest = ""
+	if m.IdempotencyKey != "" {
+		key = m.IdempotencyKey
+		m.BodyDigest = OutboxBodyDigest(m.Body, m.MediaDigest)
+	}
+
+	now := time.Now().UTC()
+	result, err := d.db.Exec(`
+	INSERT OR IGNORE INTO outbox (idempotency_key, recipient, kind, body, body_digest, media_path, status, next_attempt_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, key, m.Recipient, m.Kind, body, m.BodyDigest, m.MediaPath, OutboxQueued, now, now)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, false, err
+	} else if n == 0 {
+		existing, err := d.GetOutboxMessageByKey(m.IdempotencyKey)
+		return existing, false, err
+	}
+
+	m.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, false, err
+	}
+	m.Status = OutboxQueued
+	m.NextAttemptAt = now
+	m.CreatedAt = now
+	return m, true, nil
+}
+
+// OutboxBodyDigest returns the digest stored for the body of an idempotent
+// outbox message, and for the content of its file if it has one
+func OutboxBodyDigest(body, mediaDigest string) string {
+	if mediaDigest != "" {
+		body += "\x00" + mediaDigest
+	}
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetOutboxMessage retrieves an outbox message by ID
+func (d *Database) GetOutboxMessage(id int64) (*OutboxMessage, error) {
+	row := d.db.QueryRow("SELECT "+outboxColumns+" FROM outbox WHERE id = ?", id)
+	return d.scanOutboxMessage(row)
+}
+
+// GetOutboxMessageByKey retrieves an outbox message by idempotency key
+func (d *Database) GetOutboxMessageByKey(key string) (*OutboxMessage, error) {
+	row := d.db.QueryRow("SELECT "+outboxColumns+" FROM outbox WHERE idempotency_key = ?", key)
+	return d.scanOutboxMessage(row)
+}
+
+// GetDueOutboxMessages returns queued messages whose next attempt is due,
+// oldest first
+func (d *Database) GetDueOutboxMessages(now time.Time, limit int) ([]*OutboxMessage, error) {
+	rows, err := d.db.Query("SELECT "+outboxColumns+` FROM outbox
+	WHERE status = ? AND next_attempt_at <= ?
+	ORDER BY id ASC
+	LIMIT ?`, OutboxQueued, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*OutboxMessage
+	for rows.Next() {
+		m, err := d.scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetOutboxMediaPaths lists the queued files of a recipient's
+// undelivered messages
+func (d *Database) GetOutboxMediaPaths(recipient string) ([]string, error) {
+	rows, err := d.db.Query(`
+	SELECT media_path FROM outbox WHERE recipient = ? AND media_path != ''`, recipient)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// ClaimOutboxMessage marks a queued message as being sent. It reports false
+// if the message is no longer queued or an older message to the same
+// recipient has not been delivered yet, so messages arrive in order.
+func (d *Database) ClaimOutboxMessage(id int64) (bool, error) {
+	result, err := d.db.Exec(`
+	UPDATE outbox SET status = ?
+	WHERE id = ? AND status = ? AND NOT EXISTS (
+		SELECT 1 FROM outbox AS earlier
+		WHERE earlier.recipient = outbox.recipient AND earlier.id < outbox.id AND earlier.status IN (?, ?)
+	)`, OutboxSending, id, OutboxQueued, OutboxQueued, OutboxSending)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// MarkOutboxSent records a successful delivery. The body and media path are
+// dropped since the sent message is stored in the messages table.
+func (d *Database) MarkOutboxSent(id int64, attempts int, messageID string) error {
+	_, err := d.db.Exec(`
+	UPDATE outbox SET status = ?, attempts = ?, message_id = ?, body = '', media_path = '', last_error = NULL, sent_at = ?
+	WHERE id = ?`, OutboxSent, attempts, messageID, time.Now().UTC(), id)
+	return err
+}
+
+// MarkOutboxAttemptFailed records a failed attempt. The message is retried at
+// next, or marked failed for good when next is the zero time.
+func (d *Database) MarkOutboxAttemptFailed(id int64, attempts int, lastError string, next time.Time) error {
+	if next.IsZero() {
+		_, err := d.db.Exec(`
+		UPDATE outbox SET status = ?, attempts = ?, last_error = ?, body = '', media_path = ''
+		WHERE id = ?`, OutboxFailed, attempts, lastError, id)
+		return err
+	}
+	_, err := d.db.Exec(`
+	UPDATE outbox SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?
+	WHERE id = ?`, OutboxQueued, attempts, lastError, next.UTC(), id)
+	return err
+}
+
+// RequeueInterruptedOutboxMessages puts messages that were being sent when
+// the server stopped back into the queue
+func (d *Database) RequeueInterruptedOutboxMessages() (int64, error) {
+	result, err := d.db.Exec("UPDATE outbox SET status = ? WHERE status = ?", OutboxQueued, OutboxSending)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanOutboxMessage reads an outbox row and decrypts its body
+func (d *Database) scanOutboxMessage(row rowScanner) (*OutboxMessage, error) {
+	m := &OutboxMessage{}
+	var key, lastError, messageID sql.NullString
+	var sentAt sql.NullTime
+	if err := row.Scan(&m.ID, &key, &m.Recipient, &m.Kind, &m.Body, &m.BodyDigest, &m.MediaPath, &m.Status, &m.Attempts,
+		&m.NextAttemptAt, &lastError, &messageID, &m.CreatedAt, &sentAt); err != nil {
+		return nil, err
+	}
+	m.IdempotencyKey = key.String
+	m.LastError = lastError.String
+	m.MessageID = messageID.String
+	if sentAt.Valid {
+		m.SentAt = &sentAt.Time
+	}
+	body, err := d.decrypt(m.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.Body = body
+	return m, nil
+}
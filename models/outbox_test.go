@@ -0,0 +1,93 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOutboxIdempotencyAndOrdering(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	const alice, bob = "353851111111@s.whatsapp.net", "353852222222@s.whatsapp.net"
+	enqueue := func(recipient, body, key string) (*OutboxMessage, bool) {
+		t.Helper()
+		m, created, err := db.EnqueueOutboxMessage(&OutboxMessage{Recipient: recipient, Kind: OutboxText, Body: body, IdempotencyKey: key})
+		if err != nil {
+			t.Fatalf("EnqueueOutboxMessage: %v", err)
+		}
+		return m, created
+	}
+	claim := func(m *OutboxMessage) bool {
+		t.Helper()
+		ok, err := db.ClaimOutboxMessage(m.ID)
+		if err != nil {
+			t.Fatalf("ClaimOutboxMessage: %v", err)
+		}
+		return ok
+	}
+
+	first, created := enqueue(alice, "first", "order-1")
+	if !created {
+		t.Fatal("first message should be queued")
+	}
+	if again, created := enqueue(alice, "first", "order-1"); created || again.ID != first.ID || again.Body != "first" {
+		t.Errorf("repeated idempotency key queued a new message: %+v", again)
+	}
+	second, _ := enqueue(alice, "second", "")
+	other, _ := enqueue(bob, "hello", "")
+
+	// A message waits for older messages to the same recipient, but not for
+	// messages to others
+	if claim(second) {
+		t.Error("second message claimed before the first was sent")
+	}
+	if !claim(other) {
+		t.Error("message to another recipient should not wait")
+	}
+	if !claim(first) || claim(first) {
+		t.Error("first message should be claimed exactly once")
+	}
+
+	// A failed attempt goes back into the queue with backoff and still holds
+	// up later messages
+	next := time.Now().Add(time.Minute)
+	if err := db.MarkOutboxAttemptFailed(first.ID, 1, "not connected", next); err != nil {
+		t.Fatalf("MarkOutboxAttemptFailed: %v", err)
+	}
+	if due, err := db.GetDueOutboxMessages(time.Now(), 10); err != nil || len(due) != 1 || due[0].ID != second.ID {
+		t.Errorf("due messages = %+v (%v), want only the second", due, err)
+	}
+	if claim(second) {
+		t.Error("second message claimed while the first is waiting for a retry")
+	}
+
+	if !claim(first) {
+		t.Fatal("first message should be claimable again")
+	}
+	if err := db.MarkOutboxSent(first.ID, 2, "3EB0ABCDEF"); err != nil {
+		t.Fatalf("MarkOutboxSent: %v", err)
+	}
+	if !claim(second) {
+		t.Error("second message should be claimable once the first was sent")
+	}
+
+	sent, err := db.GetOutboxMessage(first.ID)
+	if err != nil {
+		t.Fatalf("GetOutboxMessage: %v", err)
+	}
+	if sent.Status != OutboxSent || sent.Attempts != 2 || sent.MessageID != "3EB0ABCDEF" || sent.Body != "" || sent.SentAt == nil {
+		t.Errorf("sent message = %+v", sent)
+	}
+
+	// Messages that were being sent when the server stopped are requeued
+	if n, err := db.RequeueInterruptedOutboxMessages(); err != nil || n != 2 {
+		t.Errorf("RequeueInterruptedOutboxMessages = %d, %v; want 2", n, err)
+	}
+}
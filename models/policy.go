@@ -0,0 +1,157 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SendDecision records whether the send policy let a message through
+type SendDecision struct {
+	ID        int64     `json:"id"`
+	Recipient string    `json:"recipient"`
+	Kind      string    `json:"kind"`     // text, audio or file
+	Decision  string    `json:"decision"` // allowed, denied or needs_approval
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ApprovedContact is a number approved for first contact
+type ApprovedContact struct {
+	JID        string    `json:"jid"`
+	ApprovedBy string    `json:"approved_by,omitempty"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// SendDecisionFilter selects send decisions. Empty fields match everything.
+type SendDecisionFilter struct {
+	Recipient string
+	Decision  string
+	Limit     int
+}
+
+// policySchema creates the send decision trail and the approved contacts
+var policySchema = []string{
+	`CREATE TABLE IF NOT EXISTS send_decisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		decision TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_send_decisions_recipient ON send_decisions(recipient, created_at);`,
+	`CREATE TABLE IF NOT EXISTS approved_contacts (
+		jid TEXT PRIMARY KEY,
+		approved_by TEXT NOT NULL DEFAULT '',
+		approved_at DATETIME NOT NULL
+	);`,
+}
+
+// RecordSendDecision appends a decision to the trail
+func (d *Database) RecordSendDecision(decision *SendDecision) error {
+	decision.CreatedAt = time.Now().UTC()
+	result, err := d.db.Exec(`INSERT INTO send_decisions (recipient, kind, decision, reason, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		decision.Recipient, decision.Kind, decision.Decision, decision.Reason, decision.CreatedAt)
+	if err != nil {
+		return err
+	}
+	decision.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetSendDecisions returns decisions matching filter, newest first
+func (d *Database) GetSendDecisions(filter SendDecisionFilter) ([]*SendDecision, error) {
+	query := "SELECT id, recipient, kind, decision, reason, created_at FROM send_decisions WHERE 1 = 1"
+	var args []interface{}
+	if filter.Recipient != "" {
+		query += " AND recipient = ?"
+		args = append(args, filter.Recipient)
+	}
+	if filter.Decision != "" {
+		query += " AND decision = ?"
+		args = append(args, filter.Decision)
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []*SendDecision
+	for rows.Next() {
+		decision := &SendDecision{}
+		if err := rows.Scan(&decision.ID, &decision.Recipient, &decision.Kind, &decision.Decision,
+			&decision.Reason, &decision.CreatedAt); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, rows.Err()
+}
+
+// ApproveContact approves a number for first contact. Approving it again
+// keeps the first approval.
+func (d *Database) ApproveContact(contact *ApprovedContact) error {
+	contact.ApprovedAt = time.Now().UTC()
+	_, err := d.db.Exec("INSERT OR IGNORE INTO approved_contacts (jid, approved_by, approved_at) VALUES (?, ?, ?)",
+		contact.JID, contact.ApprovedBy, contact.ApprovedAt)
+	return err
+}
+
+// DeleteContactApproval withdraws the approval of a number
+func (d *Database) DeleteContactApproval(jid string) error {
+	result, err := d.db.Exec("DELETE FROM approved_contacts WHERE jid = ?", jid)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetApprovedContacts returns the approved numbers, newest first
+func (d *Database) GetApprovedContacts() ([]*ApprovedContact, error) {
+	rows, err := d.db.Query("SELECT jid, approved_by, approved_at FROM approved_contacts ORDER BY approved_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []*ApprovedContact
+	for rows.Next() {
+		contact := &ApprovedContact{}
+		if err := rows.Scan(&contact.JID, &contact.ApprovedBy, &contact.ApprovedAt); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+// GetContactApproval returns the first-contact approval of a number
+func (d *Database) GetContactApproval(jid string) (*ApprovedContact, error) {
+	contact := &ApprovedContact{}
+	err := d.db.QueryRow("SELECT jid, approved_by, approved_at FROM approved_contacts WHERE jid = ?", jid).
+		Scan(&contact.JID, &contact.ApprovedBy, &contact.ApprovedAt)
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// IsKnownContact reports whether a number has written to us or was approved
+// for first contact
+func (d *Database) IsKnownContact(jid string) (bool, error) {
+	var known bool
+	err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM approved_contacts WHERE jid = ?)
+		OR EXISTS (SELECT 1 FROM messages WHERE chat_jid = ? AND is_from_me = 0)`, jid, jid).Scan(&known)
+	return known, err
+}
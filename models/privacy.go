@@ -0,0 +1,285 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Transcript represents the speech-to-text transcription of a voice message
+type Transcript struct {
+	MessageID string    `json:"message_id"`
+	ChatJID   string    `json:"chat_jid"`
+	Sender    string    `json:"sender"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DataRequest is an audit record of a data export or erasure request
+type DataRequest struct {
+	ID          int64     `json:"id"`
+	JID         string    `json:"jid"`
+	Type        string    `json:"type"`   // "export" or "erase"
+	Source      string    `json:"source"` // "api" or "cli"
+	RequestedBy string    `json:"requested_by"`
+	Status      string    `json:"status"` // "completed" or "failed"
+	Details     string    `json:"details"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// privacySchema creates the tables used for transcripts and data request auditing
+var privacySchema = []string{
+	`CREATE TABLE IF NOT EXISTS transcripts (
+		message_id TEXT PRIMARY KEY,
+		chat_jid TEXT NOT NULL,
+		sender TEXT NOT NULL,
+		text TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	`CREATE TABLE IF NOT EXISTS data_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		jid TEXT NOT NULL,
+		type TEXT NOT NULL,
+		source TEXT NOT NULL,
+		requested_by TEXT,
+		status TEXT NOT NULL,
+		details TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	"CREATE INDEX IF NOT EXISTS idx_transcripts_chat_jid ON transcripts(chat_jid);",
+	"CREATE INDEX IF NOT EXISTS idx_data_requests_jid ON data_requests(jid);",
+}
+
+// senderMatches returns a WHERE clause fragment and arguments matching a
+// sender column against a contact JID, including messages sent from any of
+// the contact's linked devices (user:device@server)
+func senderMatches(column, jid string) (string, []interface{}) {
+	user, server, found := strings.Cut(jid, "@")
+	if !found {
+		return column + " = ?", []interface{}{jid}
+	}
+	return "(" + column + " = ? OR " + column + " LIKE ?)", []interface{}{jid, user + ":%@" + server}
+}
+
+// isContact reports whether a JID is the contact or one of its linked
+// devices, the Go counterpart of senderMatches
+func isContact(value, jid string) bool {
+	if value == jid {
+		return true
+	}
+	user, server, found := strings.Cut(jid, "@")
+	return found && strings.HasPrefix(value, user+":") && strings.HasSuffix(value, "@"+server)
+}
+
+// StoreTranscript stores the transcription of a voice message
+func (d *Database) StoreTranscript(t *Transcript) error {
+	text, err := d.encrypt(t.Text)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`
+	INSERT OR REPLACE INTO transcripts (message_id, chat_jid, sender, text)
+	VALUES (?, ?, ?, ?)`, t.MessageID, t.ChatJID, t.Sender, text)
+	return err
+}
+
+// GetMessagesByContact retrieves all messages exchanged with a contact, both in
+// the direct chat and sent by the contact in groups
+func (d *Database) GetMessagesByContact(jid string) ([]*Message, error) {
+	clause, args := senderMatches("sender", jid)
+	query := `
+	SELECT id, time, sender, content, is_from_me, media_type, filename, chat_jid, message_id
+	FROM messages
+	WHERE chat_jid = ? OR ` + clause + `
+	ORDER BY time ASC`
+
+	rows, err := d.db.Query(query, append([]interface{}{jid}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		msg := &Message{}
+		err := rows.Scan(&msg.ID, &msg.Time, &msg.Sender, &msg.Content,
+			&msg.IsFromMe, &msg.MediaType, &msg.Filename, &msg.ChatJID, &msg.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Content, err = d.decrypt(msg.Content); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// GetTranscriptsByContact retrieves voice message transcripts from or to a contact
+func (d *Database) GetTranscriptsByContact(jid string) ([]*Transcript, error) {
+	clause, args := senderMatches("sender", jid)
+	rows, err := d.db.Query(`
+	SELECT message_id, chat_jid, sender, text, created_at
+	FROM transcripts
+	WHERE chat_jid = ? OR `+clause+`
+	ORDER BY created_at ASC`, append([]interface{}{jid}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transcripts []*Transcript
+	for rows.Next() {
+		t := &Transcript{}
+		if err := rows.Scan(&t.MessageID, &t.ChatJID, &t.Sender, &t.Text, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if t.Text, err = d.decrypt(t.Text); err != nil {
+			return nil, err
+		}
+		transcripts = append(transcripts, t)
+	}
+
+	return transcripts, rows.Err()
+}
+
+// GetContact retrieves a contact by JID
+func (d *Database) GetContact(jid string) (*Contact, error) {
+	contact := &Contact{}
+	err := d.db.QueryRow(`
+	SELECT jid, name, push_name, is_group, is_blocked
+	FROM contacts
+	WHERE jid = ?`, jid).Scan(&contact.JID, &contact.Name, &contact.PushName,
+		&contact.IsGroup, &contact.IsBlocked)
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// ErasureCounts reports how many rows were removed by EraseContact
+type ErasureCounts struct {
+	Messages    int64 `json:"messages"`
+	Chats       int64 `json:"chats"`
+	Contacts    int64 `json:"contacts"`
+	Transcripts int64 `json:"transcripts"`
+	AwayNotices int64 `json:"away_notices"`
+	BotStates   int64 `json:"bot_states"`
+	Outbox      int64 `json:"outbox"`
+	Scheduled   int64 `json:"scheduled_messages"`
+	Broadcasts  int64 `json:"broadcast_recipients"`
+	Drafts      int64 `json:"drafts"`
+	// Queued and failed webhook deliveries of events about the contact
+	WebhookDeliveries int64 `json:"webhook_deliveries"`
+	Events            int64 `json:"events"` // kept for /api/events replay
+	SendDecisions     int64 `json:"send_decisions"`
+	ContactApprovals  int64 `json:"contact_approvals"`
+}
+
+// EraseContact deletes every message, chat, contact row, transcript, away
+// notice, bot state, outbox entry, scheduled message, broadcast recipient,
+// draft, logged event, send decision, first-contact approval and webhook
+// delivery held about a contact in a single transaction
+func (d *Database) EraseContact(jid string) (*ErasureCounts, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := &ErasureCounts{}
+	clause, args := senderMatches("sender", jid)
+	matchArgs := append([]interface{}{jid}, args...)
+
+	deletes := []struct {
+		query string
+		args  []interface{}
+		count *int64
+	}{
+		{"DELETE FROM messages WHERE chat_jid = ? OR " + clause, matchArgs, &counts.Messages},
+		{"DELETE FROM transcripts WHERE chat_jid = ? OR " + clause, matchArgs, &counts.Transcripts},
+		{"DELETE FROM chats WHERE jid = ?", []interface{}{jid}, &counts.Chats},
+		{"DELETE FROM contacts WHERE jid = ?", []interface{}{jid}, &counts.Contacts},
+		{"DELETE FROM away_notices WHERE contact_jid = ?", []interface{}{jid}, &counts.AwayNotices},
+		{"DELETE FROM chat_bot_state WHERE chat_jid = ?", []interface{}{jid}, &counts.BotStates},
+		{"DELETE FROM outbox WHERE recipient = ?", []interface{}{jid}, &counts.Outbox},
+		{"DELETE FROM scheduled_messages WHERE recipient = ?", []interface{}{jid}, &counts.Scheduled},
+		{"DELETE FROM broadcast_recipients WHERE recipient = ?", []interface{}{jid}, &counts.Broadcasts},
+		{"DELETE FROM drafts WHERE recipient = ?", []interface{}{jid}, &counts.Drafts},
+		{"DELETE FROM event_log WHERE chat_jid = ? OR " + clause, matchArgs, &counts.Events},
+		{"DELETE FROM send_decisions WHERE recipient = ?", []interface{}{jid}, &counts.SendDecisions},
+		{"DELETE FROM approved_contacts WHERE jid = ?", []interface{}{jid}, &counts.ContactApprovals},
+	}
+	for _, del := range deletes {
+		result, err := tx.Exec(del.query, del.args...)
+		if err != nil {
+			return nil, err
+		}
+		if *del.count, err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+
+	deliveries, err := d.webhookDeliveriesByContact(tx, jid)
+	if err != nil {
+		return nil, err
+	}
+	for _, delivery := range deliveries {
+		if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE id = ?", delivery.ID); err != nil {
+			return nil, err
+		}
+		counts.WebhookDeliveries++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// RecordDataRequest appends a data request to the audit table
+func (d *Database) RecordDataRequest(req *DataRequest) error {
+	result, err := d.db.Exec(`
+	INSERT INTO data_requests (jid, type, source, requested_by, status, details)
+	VALUES (?, ?, ?, ?, ?, ?)`, req.JID, req.Type, req.Source, req.RequestedBy, req.Status, req.Details)
+	if err != nil {
+		return err
+	}
+	req.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetDataRequests lists audited data requests, optionally filtered by JID
+func (d *Database) GetDataRequests(jid string) ([]*DataRequest, error) {
+	query := `
+	SELECT id, jid, type, source, requested_by, status, details, created_at
+	FROM data_requests`
+	var args []interface{}
+	if jid != "" {
+		query += " WHERE jid = ?"
+		args = append(args, jid)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []*DataRequest
+	for rows.Next() {
+		req := &DataRequest{}
+		var requestedBy, details sql.NullString
+		if err := rows.Scan(&req.ID, &req.JID, &req.Type, &req.Source, &requestedBy,
+			&req.Status, &details, &req.CreatedAt); err != nil {
+			return nil, err
+		}
+		req.RequestedBy = requestedBy.String
+		req.Details = details.String
+		requests = append(requests, req)
+	}
+
+	return requests, rows.Err()
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestEraseContactRemovesEverythingAboutIt(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+
+	const alice, bob = "353851111111@s.whatsapp.net", "353852222222@s.whatsapp.net"
+	const group = "120363012345678901@g.us"
+	for _, msg := range []*Message{
+		{Time: time.Now(), Sender: alice, Content: "hi", ChatJID: alice, MessageID: "a1"},
+		{Time: time.Now(), Sender: "353851111111:3@s.whatsapp.net", Content: "from my laptop", ChatJID: group, MessageID: "a2"},
+		{Time: time.Now(), Sender: bob, Content: "hello", ChatJID: bob, MessageID: "b1"},
+	} {
+		if err := db.StoreMessage(msg); err != nil {
+			t.Fatalf("StoreMessage: %v", err)
+		}
+	}
+
+	hook := &Webhook{URL: "https://crm.example.com/hook", Secret: "s"}
+	if err := db.CreateWebhook(hook); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	for _, payload := range []string{
+		`{"type":"message","chat_jid":"` + alice + `","sender":"` + alice + `","data":{"content":"hi"}}`,
+		`{"type":"message","chat_jid":"` + group + `","sender":"353851111111:3@s.whatsapp.net","data":{}}`,
+		`{"type":"message","chat_jid":"` + bob + `","sender":"` + bob + `","data":{"content":"hello"}}`,
+	} {
+		if err := db.EnqueueWebhookDelivery(&WebhookDelivery{WebhookID: hook.ID, EventType: "message", Payload: payload, NextAttemptAt: time.Now()}); err != nil {
+			t.Fatalf("EnqueueWebhookDelivery: %v", err)
+		}
+	}
+
+	for _, evt := range []*LoggedEvent{
+		{Type: "message", ChatJID: alice, Sender: alice, Payload: `{"content":"hi"}`},
+		{Type: "presence", Sender: "353851111111:3@s.whatsapp.net", Payload: `{"available":true}`},
+		{Type: "message", ChatJID: bob, Sender: bob, Payload: `{"content":"hello"}`},
+	} {
+		if err := db.AppendEvent(evt, 100); err != nil {
+			t.Fatalf("AppendEvent: %v", err)
+		}
+	}
+
+	for _, recipient := range []string{alice, alice, bob} {
+		if err := db.RecordSendDecision(&SendDecision{Recipient: recipient, Kind: OutboxText, Decision: "allowed"}); err != nil {
+			t.Fatalf("RecordSendDecision: %v", err)
+		}
+	}
+	if err := db.ApproveContact(&ApprovedContact{JID: alice, ApprovedBy: "admin"}); err != nil {
+		t.Fatalf("ApproveContact: %v", err)
+	}
+
+	if deliveries, err := db.GetWebhookDeliveriesByContact(alice); err != nil || len(deliveries) != 2 {
+		t.Fatalf("GetWebhookDeliveriesByContact = %d, %v; want 2", len(deliveries), err)
+	}
+
+	counts, err := db.EraseContact(alice)
+	if err != nil {
+		t.Fatalf("EraseContact: %v", err)
+	}
+	if counts.Messages != 2 || counts.WebhookDeliveries != 2 || counts.Events != 2 ||
+		counts.SendDecisions != 2 || counts.ContactApprovals != 1 {
+		t.Errorf("counts = %+v, want 2 messages, webhook deliveries, events and send decisions and 1 approval", counts)
+	}
+
+	if messages, _ := db.GetMessagesByContact(alice); len(messages) != 0 {
+		t.Errorf("%d messages left", len(messages))
+	}
+	if events, _ := db.GetEventsByContact(alice); len(events) != 0 {
+		t.Errorf("%d logged events left", len(events))
+	}
+	if decisions, _ := db.GetSendDecisions(SendDecisionFilter{Recipient: alice}); len(decisions) != 0 {
+		t.Errorf("%d send decisions left", len(decisions))
+	}
+	if known, _ := db.IsKnownContact(alice); known {
+		t.Error("the first-contact approval was kept")
+	}
+	if deliveries, _ := db.GetWebhookDeliveriesByContact(alice); len(deliveries) != 0 {
+		t.Errorf("%d webhook deliveries left", len(deliveries))
+	}
+	if deliveries, _ := db.GetWebhookDeliveriesByContact(bob); len(deliveries) != 1 {
+		t.Errorf("other contacts' deliveries were erased: %d left, want 1", len(deliveries))
+	}
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Rule is an auto-reply rule: when every condition matches an incoming
+// message, the actions run in order
+type Rule struct {
+	ID         int64          `json:"id"`
+	Name       string         `json:"name"`
+	Priority   int            `json:"priority"` // lower runs first
+	Enabled    bool           `json:"enabled"`
+	Conditions RuleConditions `json:"conditions"`
+	Actions    []RuleAction   `json:"actions"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// RuleConditions are the conditions of a rule. Empty conditions match every message.
+type RuleConditions struct {
+	ChatJIDs      []string        `json:"chat_jids,omitempty"`
+	Senders       []string        `json:"senders,omitempty"`
+	Regex         string          `json:"regex,omitempty"`
+	MediaTypes    []string        `json:"media_types,omitempty"`
+	BusinessHours *HoursCondition `json:"business_hours,omitempty"`
+	FirstMessage  bool            `json:"first_message,omitempty"` // no earlier message from the sender in the chat
+}
+
+// HoursCondition matches messages received within, or with Outside set
+// outside, a daily time window on the given days
+type HoursCondition struct {
+	Timezone string   `json:"timezone,omitempty"` // IANA name, default UTC
+	Days     []string `json:"days,omitempty"`     // "mon".."sun", default every day
+	Start    string   `json:"start"`              // "09:00"
+	End      string   `json:"end"`                // "17:30"; before Start for overnight windows
+	Outside  bool     `json:"outside,omitempty"`
+}
+
+// RuleAction is a step run when a rule matches
+type RuleAction struct {
+	Type    string `json:"type"`               // see the RuleAction* constants
+	Text    string `json:"text,omitempty"`     // reply and voice
+	ChatJID string `json:"chat_jid,omitempty"` // forward
+	URL     string `json:"url,omitempty"`      // webhook
+}
+
+// Rule action types
+const (
+	RuleActionReply   = "reply"
+	RuleActionVoice   = "voice"
+	RuleActionForward = "forward"
+	RuleActionWebhook = "webhook"
+	RuleActionLLM     = "llm"
+	RuleActionStop    = "stop"
+)
+
+// rulesSchema creates the auto-reply rules table. Conditions and actions are
+// stored as JSON.
+var rulesSchema = []string{
+	`CREATE TABLE IF NOT EXISTS rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		conditions TEXT NOT NULL DEFAULT '{}',
+		actions TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	"CREATE INDEX IF NOT EXISTS idx_rules_priority ON rules(priority, id);",
+}
+
+// CreateRule stores a new rule
+func (d *Database) CreateRule(rule *Rule) error {
+	conditions, actions, err := marshalRule(rule)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.Exec(`
+	INSERT INTO rules (name, priority, enabled, conditions, actions)
+	VALUES (?, ?, ?, ?, ?)`, rule.Name, rule.Priority, rule.Enabled, conditions, actions)
+	if err != nil {
+		return err
+	}
+	rule.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateRule replaces a rule
+func (d *Database) UpdateRule(rule *Rule) error {
+	conditions, actions, err := marshalRule(rule)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.Exec(`
+	UPDATE rules SET name = ?, priority = ?, enabled = ?, conditions = ?, actions = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?`, rule.Name, rule.Priority, rule.Enabled, conditions, actions, rule.ID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// DeleteRule removes a rule
+func (d *Database) DeleteRule(id int64) error {
+	result, err := d.db.Exec("DELETE FROM rules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// GetRule retrieves a rule by ID
+func (d *Database) GetRule(id int64) (*Rule, error) {
+	row := d.db.QueryRow(`
+	SELECT id, name, priority, enabled, conditions, actions, created_at, updated_at
+	FROM rules WHERE id = ?`, id)
+	return scanRule(row)
+}
+
+// GetRules lists all rules in evaluation order
+func (d *Database) GetRules() ([]*Rule, error) {
+	rows, err := d.db.Query(`
+	SELECT id, name, priority, enabled, conditions, actions, created_at, updated_at
+	FROM rules ORDER BY priority ASC, id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*Rule
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// HasEarlierMessage reports whether a sender wrote in a chat before the given time
+func (d *Database) HasEarlierMessage(chatJID, sender string, before time.Time) (bool, error) {
+	var exists bool
+	err := d.db.QueryRow(`
+	SELECT EXISTS(SELECT 1 FROM messages WHERE chat_jid = ? AND sender = ? AND is_from_me = 0 AND time < ?)`,
+		chatJID, sender, before).Scan(&exists)
+	return exists, err
+}
+
+// GetRecentMessages returns the most recent messages, newest first, from one
+// chat or from all chats when chatJID is empty
+func (d *Database) GetRecentMessages(chatJID string, limit int) ([]*Message, error) {
+	query := `
+	SELECT id, time, sender, content, is_from_me, media_type, filename, chat_jid, message_id
+	FROM messages`
+	var args []interface{}
+	if chatJID != "" {
+		query += " WHERE chat_jid = ?"
+		args = append(args, chatJID)
+	}
+	query += " ORDER BY time DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		msg := &Message{}
+		if err := rows.Scan(&msg.ID, &msg.Time, &msg.Sender, &msg.Content,
+			&msg.IsFromMe, &msg.MediaType, &msg.Filename, &msg.ChatJID, &msg.MessageID); err != nil {
+			return nil, err
+		}
+		if msg.Content, err = d.decrypt(msg.Content); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// scanRule reads a rule row
+func scanRule(row rowScanner) (*Rule, error) {
+	rule := &Rule{}
+	var conditions, actions string
+	if err := row.Scan(&rule.ID, &rule.Name, &rule.Priority, &rule.Enabled,
+		&conditions, &actions, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(conditions), &rule.Conditions); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(actions), &rule.Actions); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// marshalRule encodes the conditions and actions of a rule for storage
+func marshalRule(rule *Rule) (string, string, error) {
+	if rule.Actions == nil {
+		rule.Actions = []RuleAction{}
+	}
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return "", "", err
+	}
+	actions, err := json.Marshal(rule.Actions)
+	if err != nil {
+		return "", "", err
+	}
+	return string(conditions), string(actions), nil
+}
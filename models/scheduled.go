@@ -0,0 +1,246 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ScheduledMessage is a message sent once at a given time, or repeatedly on
+// a cron recurrence
+type ScheduledMessage struct {
+	ID           int64      `json:"id"`
+	Recipient    string     `json:"recipient"`
+	Kind         string     `json:"kind"`           // "text", "voice" or "file"
+	Text         string     `json:"text,omitempty"` // message text, or caption of a file
+	MediaPath    string     `json:"-"`              // copy of the voice note or file
+	Filename     string     `json:"filename,omitempty"`
+	SendAt       *time.Time `json:"send_at,omitempty"` // one-off schedules
+	Cron         string     `json:"cron,omitempty"`    // recurring schedules
+	Timezone     string     `json:"timezone"`
+	NextRunAt    *time.Time `json:"next_run_at,omitempty"`
+	Status       string     `json:"status"`
+	RunCount     int        `json:"run_count"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastOutboxID int64      `json:"last_outbox_id,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	CreatedBy    string     `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Scheduled message kinds
+const (
+	ScheduledText  = "text"
+	ScheduledVoice = "voice"
+	ScheduledFile  = "file"
+)
+
+// Scheduled message states
+const (
+	ScheduleActive    = "active"
+	ScheduleCompleted = "completed"
+	ScheduleCancelled = "cancelled"
+	ScheduleFailed    = "failed"
+)
+
+// scheduledMessageSchema creates the scheduled message table. Times are
+// stored in UTC; the time zone of a schedule is kept for its recurrence.
+var scheduledMessageSchema = []string{
+	`CREATE TABLE IF NOT EXISTS scheduled_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		text TEXT NOT NULL DEFAULT '',
+		media_path TEXT NOT NULL DEFAULT '',
+		filename TEXT NOT NULL DEFAULT '',
+		send_at DATETIME,
+		cron TEXT NOT NULL DEFAULT '',
+		timezone TEXT NOT NULL DEFAULT 'UTC',
+		next_run_at DATETIME,
+		status TEXT NOT NULL DEFAULT 'active',
+		run_count INTEGER NOT NULL DEFAULT 0,
+		last_run_at DATETIME,
+		last_outbox_id INTEGER,
+		last_error TEXT,
+		created_by TEXT,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`,
+	"CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(status, next_run_at);",
+}
+
+const scheduledMessageColumns = `id, recipient, kind, text, media_path, filename, send_at, cron, timezone,
+	next_run_at, status, run_count, last_run_at, last_outbox_id, last_error, created_by, created_at, updated_at`
+
+// CreateScheduledMessage stores a new scheduled message. The text is
+// encrypted at rest.
+func (d *Database) CreateScheduledMessage(m *ScheduledMessage) error {
+	text, err := d.encrypt(m.Text)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	result, err := d.db.Exec(`
+	INSERT INTO scheduled_messages (recipient, kind, text, media_path, filename, send_at, cron, timezone,
+		next_run_at, status, created_by, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.Recipient, m.Kind, text, m.MediaPath, m.Filename, utcOrNil(m.SendAt), m.Cron, m.Timezone,
+		utcOrNil(m.NextRunAt), m.Status, m.CreatedBy, now, now)
+	if err != nil {
+		return err
+	}
+	m.ID, err = result.LastInsertId()
+	m.CreatedAt, m.UpdatedAt = now, now
+	return err
+}
+
+// UpdateScheduledMessage replaces the content, timing and state of a
+// scheduled message
+func (d *Database) UpdateScheduledMessage(m *ScheduledMessage) error {
+	text, err := d.encrypt(m.Text)
+	if err != nil {
+		return err
+	}
+	m.UpdatedAt = time.Now().UTC()
+	result, err := d.db.Exec(`
+	UPDATE scheduled_messages SET recipient = ?, kind = ?, text = ?, media_path = ?, filename = ?, send_at = ?,
+		cron = ?, timezone = ?, next_run_at = ?, status = ?, updated_at = ?
+	WHERE id = ?`,
+		m.Recipient, m.Kind, text, m.MediaPath, m.Filename, utcOrNil(m.SendAt),
+		m.Cron, m.Timezone, utcOrNil(m.NextRunAt), m.Status, m.UpdatedAt, m.ID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// RecordScheduledRun records that a scheduled message was handed to the
+// outbox, or failed to be, and when it runs next. The status is left alone
+// if it is empty.
+func (d *Database) RecordScheduledRun(id, outboxID int64, lastError string, next *time.Time, status string) error {
+	var outbox interface{}
+	if outboxID != 0 {
+		outbox = outboxID
+	}
+	_, err := d.db.Exec(`
+	UPDATE scheduled_messages SET run_count = run_count + 1, last_run_at = ?, last_outbox_id = COALESCE(?, last_outbox_id),
+		last_error = NULLIF(?, ''), next_run_at = ?, status = COALESCE(NULLIF(?, ''), status), updated_at = ?
+	WHERE id = ?`, time.Now().UTC(), outbox, lastError, utcOrNil(next), status, time.Now().UTC(), id)
+	return err
+}
+
+// DeferScheduledRun moves the next run of a scheduled message that could not
+// be handed to the outbox yet, without counting it as a run
+func (d *Database) DeferScheduledRun(id int64, next time.Time, lastError string) error {
+	_, err := d.db.Exec(`
+	UPDATE scheduled_messages SET last_error = NULLIF(?, ''), next_run_at = ?, updated_at = ?
+	WHERE id = ? AND status = ?`, lastError, next.UTC(), time.Now().UTC(), id, ScheduleActive)
+	return err
+}
+
+// GetScheduledMessage retrieves a scheduled message by ID
+func (d *Database) GetScheduledMessage(id int64) (*ScheduledMessage, error) {
+	row := d.db.QueryRow("SELECT "+scheduledMessageColumns+" FROM scheduled_messages WHERE id = ?", id)
+	return d.scanScheduledMessage(row)
+}
+
+// GetScheduledMessages lists scheduled messages, optionally filtered by status
+func (d *Database) GetScheduledMessages(status string) ([]*ScheduledMessage, error) {
+	query := "SELECT " + scheduledMessageColumns + " FROM scheduled_messages"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id ASC"
+	return d.queryScheduledMessages(query, args...)
+}
+
+// GetDueScheduledMessages returns active scheduled messages whose next run is due
+func (d *Database) GetDueScheduledMessages(now time.Time, limit int) ([]*ScheduledMessage, error) {
+	return d.queryScheduledMessages("SELECT "+scheduledMessageColumns+` FROM scheduled_messages
+	WHERE status = ? AND next_run_at <= ?
+	ORDER BY next_run_at ASC, id ASC
+	LIMIT ?`, ScheduleActive, now.UTC(), limit)
+}
+
+// GetScheduledMediaPaths lists the stored files of a recipient's scheduled messages
+func (d *Database) GetScheduledMediaPaths(recipient string) ([]string, error) {
+	rows, err := d.db.Query(`
+	SELECT media_path FROM scheduled_messages WHERE recipient = ? AND media_path != ''`, recipient)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// queryScheduledMessages runs a query returning scheduled message rows
+func (d *Database) queryScheduledMessages(query string, args ...interface{}) ([]*ScheduledMessage, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*ScheduledMessage
+	for rows.Next() {
+		m, err := d.scanScheduledMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// scanScheduledMessage reads a scheduled message row and decrypts its text
+func (d *Database) scanScheduledMessage(row rowScanner) (*ScheduledMessage, error) {
+	m := &ScheduledMessage{}
+	var sendAt, nextRunAt, lastRunAt sql.NullTime
+	var lastOutboxID sql.NullInt64
+	var lastError, createdBy sql.NullString
+	if err := row.Scan(&m.ID, &m.Recipient, &m.Kind, &m.Text, &m.MediaPath, &m.Filename, &sendAt, &m.Cron,
+		&m.Timezone, &nextRunAt, &m.Status, &m.RunCount, &lastRunAt, &lastOutboxID, &lastError, &createdBy,
+		&m.CreatedAt, &m.UpdatedAt); err != nil {
+		return nil, err
+	}
+	m.SendAt = timeOrNil(sendAt)
+	m.NextRunAt = timeOrNil(nextRunAt)
+	m.LastRunAt = timeOrNil(lastRunAt)
+	m.LastOutboxID = lastOutboxID.Int64
+	m.LastError = lastError.String
+	m.CreatedBy = createdBy.String
+
+	text, err := d.decrypt(m.Text)
+	if err != nil {
+		return nil, err
+	}
+	m.Text = text
+	return m, nil
+}
+
+// utcOrNil converts an optional time for storage
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// timeOrNil converts an optional stored time
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
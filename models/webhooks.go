@@ -0,0 +1,388 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Webhook is a subscription that receives events over HTTP
+type Webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"` // empty means all event types
+	ChatJIDs   []string  `json:"chat_jids"`   // empty means all chats
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is a queued or attempted delivery of an event to a webhook
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	WebhookID     int64      `json:"webhook_id"`
+	EventType     string     `json:"event_type"`
+	Payload       string     `json:"payload,omitempty"`
+	Status        string     `json:"status"` // "pending", "delivered" or "failed"
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// webhookSchema creates the webhook subscription and delivery queue tables.
+// Queue times are stored in UTC so they compare correctly as text.
+var webhookSchema = []string{
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		event_types TEXT NOT NULL DEFAULT '[]',
+		chat_jids TEXT NOT NULL DEFAULT '[]',
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks(id),
+		event_type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME
+	);`,
+	"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);",
+	"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);",
+}
+
+// CreateWebhook stores a new webhook subscription
+func (d *Database) CreateWebhook(w *Webhook) error {
+	eventTypes, chatJIDs, err := marshalWebhookFilters(w)
+	if err != nil {
+		return err
+	}
+	secret, err := d.encrypt(w.Secret)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.Exec(`
+	INSERT INTO webhooks (url, secret, event_types, chat_jids, enabled)
+	VALUES (?, ?, ?, ?, ?)`, w.URL, secret, eventTypes, chatJIDs, w.Enabled)
+	if err != nil {
+		return err
+	}
+	w.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateWebhook replaces the settings of a webhook subscription
+func (d *Database) UpdateWebhook(w *Webhook) error {
+	eventTypes, chatJIDs, err := marshalWebhookFilters(w)
+	if err != nil {
+		return err
+	}
+	secret, err := d.encrypt(w.Secret)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.Exec(`
+	UPDATE webhooks SET url = ?, secret = ?, event_types = ?, chat_jids = ?, enabled = ?
+	WHERE id = ?`, w.URL, secret, eventTypes, chatJIDs, w.Enabled, w.ID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// DeleteWebhook removes a webhook subscription and its delivery queue
+func (d *Database) DeleteWebhook(id int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetWebhook retrieves a webhook subscription by ID
+func (d *Database) GetWebhook(id int64) (*Webhook, error) {
+	row := d.db.QueryRow(`
+	SELECT id, url, secret, event_types, chat_jids, enabled, created_at
+	FROM webhooks WHERE id = ?`, id)
+	return d.scanWebhook(row)
+}
+
+// GetWebhooks lists all webhook subscriptions
+func (d *Database) GetWebhooks() ([]*Webhook, error) {
+	rows, err := d.db.Query(`
+	SELECT id, url, secret, event_types, chat_jids, enabled, created_at
+	FROM webhooks ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*Webhook
+	for rows.Next() {
+		w, err := d.scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// EnqueueWebhookDelivery adds an event to a webhook's delivery queue. The
+// payload is encrypted at rest since it may contain message content.
+func (d *Database) EnqueueWebhookDelivery(delivery *WebhookDelivery) error {
+	payload, err := d.encrypt(delivery.Payload)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.Exec(`
+	INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, next_attempt_at)
+	VALUES (?, ?, ?, ?, ?)`, delivery.WebhookID, delivery.EventType, payload, DeliveryPending, delivery.NextAttemptAt.UTC())
+	if err != nil {
+		return err
+	}
+	delivery.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is due
+func (d *Database) GetDueWebhookDeliveries(now time.Time, limit int) ([]*WebhookDelivery, error) {
+	rows, err := d.db.Query(`
+	SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE status = ? AND next_attempt_at <= ?
+	ORDER BY next_attempt_at ASC, id ASC
+	LIMIT ?`, DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return d.scanWebhookDeliveries(rows, true)
+}
+
+// GetWebhookDeliveries lists the most recent deliveries of a webhook,
+// optionally filtered by status. Payloads are not included.
+func (d *Database) GetWebhookDeliveries(webhookID int64, status string, limit int) ([]*WebhookDelivery, error) {
+	query := `
+	SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE webhook_id = ?`
+	args := []interface{}{webhookID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return d.scanWebhookDeliveries(rows, false)
+}
+
+// GetWebhookDeliveriesByContact returns the queued and failed deliveries of
+// events in a chat with a contact or sent by it, with their payloads
+func (d *Database) GetWebhookDeliveriesByContact(jid string) ([]*WebhookDelivery, error) {
+	return d.webhookDeliveriesByContact(d.db, jid)
+}
+
+// webhookDeliveriesByContact finds the deliveries about a contact. The chat
+// and sender of an event are only in its encrypted payload, so payloads are
+// matched here rather than in SQL. Delivered events have their payload
+// dropped and hold nothing about the contact.
+func (d *Database) webhookDeliveriesByContact(q queryer, jid string) ([]*WebhookDelivery, error) {
+	rows, err := q.Query(`
+	SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE payload != ''
+	ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries, err := d.scanWebhookDeliveries(rows, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*WebhookDelivery
+	for _, delivery := range deliveries {
+		var evt struct {
+			ChatJID string `json:"chat_jid"`
+			Sender  string `json:"sender"`
+		}
+		if err := json.Unmarshal([]byte(delivery.Payload), &evt); err != nil {
+			continue
+		}
+		if isContact(evt.ChatJID, jid) || isContact(evt.Sender, jid) {
+			matched = append(matched, delivery)
+		}
+	}
+	return matched, nil
+}
+
+// MarkWebhookDelivered records a successful delivery. The payload is dropped
+// so delivered message content is not kept around.
+func (d *Database) MarkWebhookDelivered(id int64, attempts int) error {
+	_, err := d.db.Exec(`
+	UPDATE webhook_deliveries SET status = ?, attempts = ?, payload = '', last_error = NULL, delivered_at = ?
+	WHERE id = ?`, DeliveryDelivered, attempts, time.Now().UTC(), id)
+	return err
+}
+
+// MarkWebhookAttemptFailed records a failed attempt. The delivery is retried
+// at next, or marked failed for good when next is the zero time.
+func (d *Database) MarkWebhookAttemptFailed(id int64, attempts int, lastError string, next time.Time) error {
+	status := DeliveryPending
+	if next.IsZero() {
+		status = DeliveryFailed
+		next = time.Now()
+	}
+	_, err := d.db.Exec(`
+	UPDATE webhook_deliveries SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?
+	WHERE id = ?`, status, attempts, lastError, next.UTC(), id)
+	return err
+}
+
+// PostponeWebhookDeliveries moves the pending deliveries of a webhook that
+// are due before until to until, so they stay behind a failed delivery
+// being retried
+func (d *Database) PostponeWebhookDeliveries(webhookID int64, until time.Time) error {
+	_, err := d.db.Exec(`
+	UPDATE webhook_deliveries SET next_attempt_at = ?
+	WHERE webhook_id = ? AND status = ? AND next_attempt_at < ?`, until.UTC(), webhookID, DeliveryPending, until.UTC())
+	return err
+}
+
+// RetryWebhookDelivery puts a failed delivery back into the queue
+func (d *Database) RetryWebhookDelivery(webhookID, id int64) error {
+	result, err := d.db.Exec(`
+	UPDATE webhook_deliveries SET status = ?, next_attempt_at = ?
+	WHERE id = ? AND webhook_id = ? AND status = ?`, DeliveryPending, time.Now().UTC(), id, webhookID, DeliveryFailed)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// scanWebhook reads a webhook row, decrypting its secret
+func (d *Database) scanWebhook(row rowScanner) (*Webhook, error) {
+	w := &Webhook{}
+	var eventTypes, chatJIDs string
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &eventTypes, &chatJIDs, &w.Enabled, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	secret, err := d.decrypt(w.Secret)
+	if err != nil {
+		return nil, err
+	}
+	w.Secret = secret
+	if err := json.Unmarshal([]byte(eventTypes), &w.EventTypes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(chatJIDs), &w.ChatJIDs); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// scanWebhookDeliveries reads delivery rows, decrypting payloads if requested
+func (d *Database) scanWebhookDeliveries(rows *sql.Rows, withPayload bool) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		delivery := &WebhookDelivery{}
+		var lastError sql.NullString
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &delivery.Payload,
+			&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &lastError,
+			&delivery.CreatedAt, &deliveredAt); err != nil {
+			return nil, err
+		}
+		delivery.LastError = lastError.String
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		if withPayload {
+			payload, err := d.decrypt(delivery.Payload)
+			if err != nil {
+				return nil, err
+			}
+			delivery.Payload = payload
+		} else {
+			delivery.Payload = ""
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// marshalWebhookFilters encodes the filter lists of a webhook for storage
+func marshalWebhookFilters(w *Webhook) (string, string, error) {
+	if w.EventTypes == nil {
+		w.EventTypes = []string{}
+	}
+	if w.ChatJIDs == nil {
+		w.ChatJIDs = []string{}
+	}
+	eventTypes, err := json.Marshal(w.EventTypes)
+	if err != nil {
+		return "", "", err
+	}
+	chatJIDs, err := json.Marshal(w.ChatJIDs)
+	if err != nil {
+		return "", "", err
+	}
+	return string(eventTypes), string(chatJIDs), nil
+}
+
+// requireAffected returns sql.ErrNoRows if a statement changed nothing
+func requireAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
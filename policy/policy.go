@@ -0,0 +1,186 @@
+// Package policy decides whether a message may be sent to a recipient.
+// Recipients are matched against allow and deny lists of numbers, country
+// prefixes and group JIDs; groups must always be allowed explicitly, and
+// first contact with a new number can be made to wait for a person's approval.
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Decisions about a send
+const (
+	Allowed       = "allowed"
+	Denied        = "denied"
+	NeedsApproval = "needs_approval"
+)
+
+// Pattern is an allow or deny list entry: a JID, a phone number, or a number
+// prefix ending in * such as +353*
+type Pattern struct {
+	raw    string
+	jid    string // exact JID, for JIDs and phone numbers
+	prefix string // leading digits of a number, for prefixes
+}
+
+// ParsePattern parses an allow or deny list entry
+func ParsePattern(s string) (Pattern, error) {
+	s = strings.TrimSpace(s)
+	p := Pattern{raw: s}
+	switch {
+	case strings.Contains(s, "@"):
+		jid, err := types.ParseJID(s)
+		if err != nil || jid.User == "" {
+			return p, fmt.Errorf("invalid JID %q", s)
+		}
+		p.jid = jid.ToNonAD().String()
+	case strings.HasSuffix(s, "*"):
+		p.prefix = digits(strings.TrimSuffix(s, "*"))
+		if p.prefix == "" {
+			return p, fmt.Errorf("invalid number prefix %q", s)
+		}
+	default:
+		number := digits(s)
+		if len(number) < 7 {
+			return p, fmt.Errorf("invalid phone number %q", s)
+		}
+		p.jid = types.NewJID(number, types.DefaultUserServer).String()
+	}
+	return p, nil
+}
+
+// String returns the entry as written
+func (p Pattern) String() string {
+	return p.raw
+}
+
+// MarshalText encodes the entry as written
+func (p Pattern) MarshalText() ([]byte, error) {
+	return []byte(p.raw), nil
+}
+
+// Matches reports whether the pattern covers a recipient. Number prefixes
+// only cover phone numbers, never groups.
+func (p Pattern) Matches(jid types.JID) bool {
+	if p.prefix != "" {
+		return jid.Server == types.DefaultUserServer && strings.HasPrefix(jid.User, p.prefix)
+	}
+	return jid.ToNonAD().String() == p.jid
+}
+
+// Rules is a send policy
+type Rules struct {
+	// Allow lists the groups that may be messaged and, if it names any
+	// numbers or prefixes, the only numbers that may be messaged
+	Allow []Pattern `json:"allow"`
+	Deny  []Pattern `json:"deny"` // never messaged, even if allowed
+	// Always lists chats the server itself writes to, such as the approval
+	// admin chat and the handoff staff group. They are always allowed and,
+	// unlike the allow list, do not restrict which other numbers may be
+	// messaged.
+	Always []Pattern `json:"always,omitempty"`
+	// ApproveFirstContact holds messages to numbers that have never written
+	// to us until a person approves them
+	ApproveFirstContact bool `json:"approve_first_contact"`
+}
+
+// Parse builds rules from comma-separated allow and deny lists
+func Parse(allow, deny string, approveFirstContact bool) (*Rules, error) {
+	rules := &Rules{ApproveFirstContact: approveFirstContact}
+	var err error
+	if rules.Allow, err = parseList(allow); err != nil {
+		return nil, fmt.Errorf("invalid allow list: %w", err)
+	}
+	if rules.Deny, err = parseList(deny); err != nil {
+		return nil, fmt.Errorf("invalid deny list: %w", err)
+	}
+	return rules, nil
+}
+
+// Check decides whether a message may be sent to jid, with the reason for
+// the decision. known reports whether the number has written to us or was
+// approved, and is only called when first contact needs approval.
+func (r *Rules) Check(jid types.JID, known func() (bool, error)) (decision, reason string) {
+	for _, p := range r.Always {
+		if p.Matches(jid) {
+			return Allowed, fmt.Sprintf("%s is always allowed", p)
+		}
+	}
+	for _, p := range r.Deny {
+		if p.Matches(jid) {
+			return Denied, fmt.Sprintf("matches deny entry %s", p)
+		}
+	}
+
+	allowedBy := ""
+	for _, p := range r.Allow {
+		if p.Matches(jid) {
+			allowedBy = p.String()
+			break
+		}
+	}
+	if jid.Server == types.GroupServer {
+		if allowedBy == "" {
+			return Denied, "groups must be on the allow list"
+		}
+		return Allowed, fmt.Sprintf("matches allow entry %s", allowedBy)
+	}
+	if allowedBy == "" && r.restrictsNumbers() {
+		return Denied, "not on the allow list"
+	}
+
+	if r.ApproveFirstContact {
+		ok, err := known()
+		if err != nil {
+			return Denied, fmt.Sprintf("could not check for earlier contact: %v", err)
+		}
+		if !ok {
+			return NeedsApproval, "first contact with this number needs approval"
+		}
+	}
+
+	if allowedBy != "" {
+		return Allowed, fmt.Sprintf("matches allow entry %s", allowedBy)
+	}
+	return Allowed, "no rule restricts this recipient"
+}
+
+// restrictsNumbers reports whether the allow list names any numbers. Groups
+// on it only allow those groups.
+func (r *Rules) restrictsNumbers() bool {
+	for _, p := range r.Allow {
+		if !strings.HasSuffix(p.jid, "@"+types.GroupServer) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseList parses a comma-separated list of patterns
+func parseList(list string) ([]Pattern, error) {
+	var patterns []Pattern
+	for _, entry := range strings.Split(list, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		p, err := ParsePattern(entry)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// digits returns the digits in s
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
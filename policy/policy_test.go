@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func mustParseJID(t *testing.T, s string) types.JID {
+	t.Helper()
+	jid, err := types.ParseJID(s)
+	if err != nil {
+		t.Fatalf("ParseJID(%q): %v", s, err)
+	}
+	return jid
+}
+
+func TestCheck(t *testing.T) {
+	rules, err := Parse("+353*, 447700900123, 120363012345678901@g.us", "+353 85 999 9999", false)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	for recipient, want := range map[string]string{
+		"353851234567@s.whatsapp.net":    Allowed, // country prefix
+		"447700900123@s.whatsapp.net":    Allowed, // exact number
+		"447700900124@s.whatsapp.net":    Denied,  // not on the allow list
+		"353859999999@s.whatsapp.net":    Denied,  // deny wins over allow
+		"120363012345678901@g.us":        Allowed, // allowed group
+		"120363099999999999@g.us":        Denied,  // other groups
+		"353851234567:12@s.whatsapp.net": Allowed, // device JIDs match their user
+	} {
+		got, reason := rules.Check(mustParseJID(t, recipient), nil)
+		if got != want {
+			t.Errorf("Check(%s) = %s (%s), want %s", recipient, got, reason, want)
+		}
+	}
+}
+
+func TestGroupsOnAllowListDoNotRestrictNumbers(t *testing.T) {
+	rules, err := Parse("120363012345678901@g.us", "", false)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got, reason := rules.Check(mustParseJID(t, "447700900124@s.whatsapp.net"), nil); got != Allowed {
+		t.Errorf("number denied by a group-only allow list: %s", reason)
+	}
+
+	open := &Rules{}
+	if got, _ := open.Check(mustParseJID(t, "120363012345678901@g.us"), nil); got != Denied {
+		t.Error("groups should need to be allowed explicitly")
+	}
+}
+
+func TestFirstContactNeedsApproval(t *testing.T) {
+	rules := &Rules{ApproveFirstContact: true}
+	jid := mustParseJID(t, "447700900123@s.whatsapp.net")
+
+	if got, _ := rules.Check(jid, func() (bool, error) { return false, nil }); got != NeedsApproval {
+		t.Errorf("new number = %s, want %s", got, NeedsApproval)
+	}
+	if got, _ := rules.Check(jid, func() (bool, error) { return true, nil }); got != Allowed {
+		t.Errorf("known number = %s, want %s", got, Allowed)
+	}
+
+	if _, err := Parse("+353 85", "", false); err == nil {
+		t.Error("Parse accepted a number that is too short")
+	}
+}
+
+func TestAlwaysAllowedChatsDoNotRestrictNumbers(t *testing.T) {
+	rules, err := Parse("", "+353 85 999 9999", false)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	adminChat, err := ParsePattern("+353 85 999 9999")
+	if err != nil {
+		t.Fatalf("ParsePattern: %v", err)
+	}
+	staffGroup, err := ParsePattern("120363012345678901@g.us")
+	if err != nil {
+		t.Fatalf("ParsePattern: %v", err)
+	}
+	rules.Always = append(rules.Always, adminChat, staffGroup)
+
+	for recipient, want := range map[string]string{
+		"353859999999@s.whatsapp.net": Allowed, // admin chat, even though denied
+		"120363012345678901@g.us":     Allowed, // staff group
+		"447700900123@s.whatsapp.net": Allowed, // customers are not restricted
+		"120363099999999999@g.us":     Denied,  // other groups still need the allow list
+	} {
+		got, reason := rules.Check(mustParseJID(t, recipient), nil)
+		if got != want {
+			t.Errorf("Check(%s) = %s (%s), want %s", recipient, got, reason, want)
+		}
+	}
+}
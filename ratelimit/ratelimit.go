@@ -0,0 +1,155 @@
+// Package ratelimit implements token buckets kept per key, such as an API
+// key or a recipient JID.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limit allows Events per Per, in bursts of up to Events. A zero limit
+// allows everything.
+type Limit struct {
+	Events int
+	Per    time.Duration
+}
+
+// PerMinute returns a limit of n events per minute
+func PerMinute(n int) Limit {
+	return Limit{Events: n, Per: time.Minute}
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Events > 0 && l.Per > 0
+}
+
+// String describes the limit, e.g. "20 per 1m0s"
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d per %s", l.Events, l.Per)
+}
+
+// pruneInterval is how often buckets that have refilled are forgotten
+const pruneInterval = time.Minute
+
+// Limiter keeps a token bucket per key. A nil Limiter allows everything.
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New creates a limiter applying limit to every key
+func New(limit Limit) *Limiter {
+	return &Limiter{limit: limit, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Limit returns the limit applied to every key
+func (l *Limiter) Limit() Limit {
+	if l == nil {
+		return Limit{}
+	}
+	return l.limit
+}
+
+// Allow takes a token from the bucket of key. If the bucket is empty it
+// reports how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || !l.limit.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.prune(now)
+
+	b := l.refill(key, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) * float64(l.limit.Per) / float64(l.limit.Events))
+	return false, wait
+}
+
+// Refund returns a token taken by Allow, for when a later check refused the
+// event after all
+func (l *Limiter) Refund(key string) {
+	if l == nil || !l.limit.Enabled() {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(key, l.now())
+	b.tokens = math.Min(b.tokens+1, float64(l.limit.Events))
+}
+
+// refill returns the bucket of key with the tokens earned since its last use
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Events), updated: now}
+		l.buckets[key] = b
+		return b
+	}
+	earned := now.Sub(b.updated).Seconds() * float64(l.limit.Events) / l.limit.Per.Seconds()
+	b.tokens = math.Min(b.tokens+earned, float64(l.limit.Events))
+	b.updated = now
+	return b
+}
+
+// prune forgets buckets that have refilled, which behave like new ones
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.limit.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware limits requests per key as returned by key; an empty key is not
+// limited. Requests over the limit get 429 with a Retry-After header.
+func (l *Limiter) Middleware(key func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if k := key(r); k != "" {
+				if ok, wait := l.Allow(k); !ok {
+					Reject(w, fmt.Sprintf("Rate limit of %s exceeded", l.limit), wait)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Reject writes a 429 response telling the client when to retry
+func Reject(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterRefillsOverTime(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := New(Limit{Events: 3, Per: time.Minute})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("event %d refused within the burst", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("fourth event allowed")
+	}
+	if wait != 20*time.Second {
+		t.Errorf("retry after %s, want 20s", wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("other keys should have their own bucket")
+	}
+
+	now = now.Add(20 * time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("token not refilled after 20s")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("only one token should have been refilled")
+	}
+
+	l.Refund("a")
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("refunded token not available")
+	}
+
+	var unlimited *Limiter
+	if ok, _ := unlimited.Allow("a"); !ok {
+		t.Error("nil limiter should allow everything")
+	}
+}
+
+func TestMiddlewareRejectsWithRetryAfter(t *testing.T) {
+	l := New(PerMinute(1))
+	handler := l.Middleware(func(r *http.Request) string {
+		return r.Header.Get("X-Client")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(client string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/send-message", nil)
+		r.Header.Set("X-Client", client)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("a"); w.Code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", w.Code)
+	}
+	w := request("a")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	for i := 0; i < 3; i++ {
+		if w := request(""); w.Code != http.StatusOK {
+			t.Errorf("request without a key = %d, want 200", w.Code)
+		}
+	}
+}
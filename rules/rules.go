@@ -0,0 +1,402 @@
+// Package rules evaluates auto-reply rules stored in the message database
+// against incoming messages. A rule matches when all of its conditions hold,
+// and its actions then run in order.
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-go-mcp/models"
+)
+
+// ErrInvalidRule is returned when a rule fails validation
+var ErrInvalidRule = errors.New("invalid rule")
+
+// webhookTimeout bounds a webhook action
+const webhookTimeout = 10 * time.Second
+
+// weekdays maps day names used in business hours to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Executor performs the actions of matching rules
+type Executor interface {
+	SendMessage(chatJID, text string) error
+	SendVoiceReply(chatJID, text string) error
+	ForwardMessage(msg *models.Message, chatJID string) error
+	ReplyWithLLM(chatJID, content string) error
+}
+
+// compiledRule is a rule with its regex and time zone resolved
+type compiledRule struct {
+	*models.Rule
+	regex    *regexp.Regexp
+	location *time.Location
+}
+
+// Engine evaluates the enabled rules against incoming messages
+type Engine struct {
+	db    *models.Database
+	exec  Executor
+	http  *http.Client
+	mu    sync.RWMutex
+	rules []*compiledRule // enabled rules in evaluation order
+}
+
+// NewEngine creates an engine that runs actions with exec
+func NewEngine(db *models.Database, exec Executor) (*Engine, error) {
+	e := &Engine{
+		db:   db,
+		exec: exec,
+		http: &http.Client{Timeout: webhookTimeout},
+	}
+	if err := e.reload(); err != nil {
+		return nil, fmt.Errorf("failed to load rules: %w", err)
+	}
+	return e, nil
+}
+
+// Evaluate runs the actions of every enabled rule matching an incoming
+// message, in priority order, until a stop action. It reports whether any
+// rule matched, in which case the message should not be handled further.
+// Messages sent from this account are never matched.
+func (e *Engine) Evaluate(ctx context.Context, msg *models.Message) bool {
+	if msg.IsFromMe {
+		return false
+	}
+
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	matched := false
+	for _, rule := range rules {
+		ok, err := e.matches(rule, msg)
+		if err != nil {
+			log.Printf("❌ Failed to evaluate rule %d (%s): %v", rule.ID, rule.Name, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		log.Printf("📏 Rule %d (%s) matched message %s", rule.ID, rule.Name, msg.MessageID)
+		matched = true
+		if stop := e.run(ctx, rule, msg); stop {
+			break
+		}
+	}
+	return matched
+}
+
+// run performs the actions of a matched rule and reports whether a stop
+// action was reached. A failed action is logged and the next one still runs.
+func (e *Engine) run(ctx context.Context, rule *compiledRule, msg *models.Message) bool {
+	for _, action := range rule.Actions {
+		var err error
+		switch action.Type {
+		case models.RuleActionReply:
+			err = e.exec.SendMessage(msg.ChatJID, action.Text)
+		case models.RuleActionVoice:
+			err = e.exec.SendVoiceReply(msg.ChatJID, action.Text)
+		case models.RuleActionForward:
+			err = e.exec.ForwardMessage(msg, action.ChatJID)
+		case models.RuleActionWebhook:
+			err = e.callWebhook(ctx, rule, action.URL, msg)
+		case models.RuleActionLLM:
+			err = e.exec.ReplyWithLLM(msg.ChatJID, msg.Content)
+		case models.RuleActionStop:
+			return true
+		}
+		if err != nil {
+			log.Printf("❌ Rule %d (%s) %s action failed: %v", rule.ID, rule.Name, action.Type, err)
+		}
+	}
+	return false
+}
+
+// callWebhook posts the matched message to a URL
+func (e *Engine) callWebhook(ctx context.Context, rule *compiledRule, target string, msg *models.Message) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"rule_id":   rule.ID,
+		"rule_name": rule.Name,
+		"message":   msg,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "whatsapp-go-mcp-rules")
+
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// matches reports whether all conditions of a rule hold for a message
+func (e *Engine) matches(rule *compiledRule, msg *models.Message) (bool, error) {
+	cond := rule.Conditions
+	if len(cond.ChatJIDs) > 0 && !contains(cond.ChatJIDs, msg.ChatJID) {
+		return false, nil
+	}
+	if len(cond.Senders) > 0 && !contains(cond.Senders, msg.Sender) {
+		return false, nil
+	}
+	if len(cond.MediaTypes) > 0 && !contains(cond.MediaTypes, msg.MediaType) {
+		return false, nil
+	}
+	if rule.regex != nil && !rule.regex.MatchString(msg.Content) {
+		return false, nil
+	}
+	if cond.BusinessHours != nil && !withinHours(cond.BusinessHours, rule.location, msg.Time) {
+		return false, nil
+	}
+	if cond.FirstMessage {
+		earlier, err := e.db.HasEarlierMessage(msg.ChatJID, msg.Sender, msg.Time)
+		if err != nil || earlier {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// withinHours reports whether t falls in the window of a business hours
+// condition, or outside of it if the condition says so
+func withinHours(hours *models.HoursCondition, loc *time.Location, t time.Time) bool {
+	local := t.In(loc)
+	start, _ := parseClock(hours.Start)
+	end, _ := parseClock(hours.End)
+	minute := local.Hour()*60 + local.Minute()
+
+	// For overnight windows such as 22:00-06:00, the early hours belong to
+	// the window that started the day before
+	day := local.Weekday()
+	var inside bool
+	if start <= end {
+		inside = minute >= start && minute < end
+	} else if minute >= start {
+		inside = true
+	} else if minute < end {
+		inside = true
+		day = (day + 6) % 7
+	}
+	if inside && len(hours.Days) > 0 {
+		inside = false
+		for _, name := range hours.Days {
+			if weekdays[strings.ToLower(name)] == day {
+				inside = true
+			}
+		}
+	}
+	return inside != hours.Outside
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// DryRunMatch is a stored message a rule would have matched
+type DryRunMatch struct {
+	Message *models.Message     `json:"message"`
+	Actions []models.RuleAction `json:"actions"`
+}
+
+// DryRun evaluates a rule against the most recent stored incoming messages,
+// from one chat or all chats, without running any action. The rule does not
+// need to be saved or enabled.
+func (e *Engine) DryRun(rule *models.Rule, chatJID string, limit int) ([]*DryRunMatch, error) {
+	compiled, err := compile(rule)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := e.db.GetRecentMessages(chatJID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*DryRunMatch{}
+	for _, msg := range messages {
+		if msg.IsFromMe {
+			continue
+		}
+		ok, err := e.matches(compiled, msg)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, &DryRunMatch{Message: msg, Actions: rule.Actions})
+		}
+	}
+	return matches, nil
+}
+
+// reload refreshes the cached list of enabled rules
+func (e *Engine) reload() error {
+	all, err := e.db.GetRules()
+	if err != nil {
+		return err
+	}
+	var enabled []*compiledRule
+	for _, rule := range all {
+		if !rule.Enabled {
+			continue
+		}
+		compiled, err := compile(rule)
+		if err != nil {
+			log.Printf("⚠️ Skipping rule %d (%s): %v", rule.ID, rule.Name, err)
+			continue
+		}
+		enabled = append(enabled, compiled)
+	}
+
+	e.mu.Lock()
+	e.rules = enabled
+	e.mu.Unlock()
+	return nil
+}
+
+// compile validates a rule and resolves its regex and time zone
+func compile(rule *models.Rule) (*compiledRule, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidRule, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(rule.Name) == "" {
+		return nil, invalid("name is required")
+	}
+	if len(rule.Actions) == 0 {
+		return nil, invalid("at least one action is required")
+	}
+
+	compiled := &compiledRule{Rule: rule, location: time.UTC}
+	cond := rule.Conditions
+	if cond.Regex != "" {
+		re, err := regexp.Compile(cond.Regex)
+		if err != nil {
+			return nil, invalid("regex: %v", err)
+		}
+		compiled.regex = re
+	}
+	if hours := cond.BusinessHours; hours != nil {
+		if hours.Timezone != "" {
+			loc, err := time.LoadLocation(hours.Timezone)
+			if err != nil {
+				return nil, invalid("unknown time zone %q", hours.Timezone)
+			}
+			compiled.location = loc
+		}
+		if _, err := parseClock(hours.Start); err != nil {
+			return nil, invalid("business_hours.start must be HH:MM")
+		}
+		if _, err := parseClock(hours.End); err != nil {
+			return nil, invalid("business_hours.end must be HH:MM")
+		}
+		for _, day := range hours.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return nil, invalid("unknown day %q (use mon, tue, wed, thu, fri, sat, sun)", day)
+			}
+		}
+	}
+
+	for _, action := range rule.Actions {
+		switch action.Type {
+		case models.RuleActionReply, models.RuleActionVoice:
+			if action.Text == "" {
+				return nil, invalid("%s action requires text", action.Type)
+			}
+		case models.RuleActionForward:
+			if action.ChatJID == "" {
+				return nil, invalid("forward action requires chat_jid")
+			}
+		case models.RuleActionWebhook:
+			u, err := url.Parse(action.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, invalid("webhook action requires an absolute http or https url")
+			}
+		case models.RuleActionLLM, models.RuleActionStop:
+		default:
+			return nil, invalid("unknown action type %q", action.Type)
+		}
+	}
+	return compiled, nil
+}
+
+// Create validates and stores a new rule
+func (e *Engine) Create(rule *models.Rule) error {
+	if _, err := compile(rule); err != nil {
+		return err
+	}
+	if err := e.db.CreateRule(rule); err != nil {
+		return err
+	}
+	log.Printf("📏 Rule %d (%s) created", rule.ID, rule.Name)
+	return e.reload()
+}
+
+// Update validates and replaces a rule
+func (e *Engine) Update(rule *models.Rule) error {
+	if _, err := compile(rule); err != nil {
+		return err
+	}
+	if err := e.db.UpdateRule(rule); err != nil {
+		return err
+	}
+	return e.reload()
+}
+
+// Delete removes a rule
+func (e *Engine) Delete(id int64) error {
+	if err := e.db.DeleteRule(id); err != nil {
+		return err
+	}
+	log.Printf("📏 Rule %d deleted", id)
+	return e.reload()
+}
+
+// Get returns a rule by ID
+func (e *Engine) Get(id int64) (*models.Rule, error) {
+	return e.db.GetRule(id)
+}
+
+// List returns all rules in evaluation order
+func (e *Engine) List() ([]*models.Rule, error) {
+	return e.db.GetRules()
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+)
+
+const (
+	chatJID = "353851234567@s.whatsapp.net"
+	sender  = "353851234567@s.whatsapp.net"
+)
+
+// recorder is an Executor that records the actions it is asked to run
+type recorder struct {
+	actions []string
+}
+
+func (r *recorder) SendMessage(chatJID, text string) error {
+	r.actions = append(r.actions, "reply:"+text)
+	return nil
+}
+
+func (r *recorder) SendVoiceReply(chatJID, text string) error {
+	r.actions = append(r.actions, "voice:"+text)
+	return nil
+}
+
+func (r *recorder) ForwardMessage(msg *models.Message, chatJID string) error {
+	r.actions = append(r.actions, "forward:"+chatJID)
+	return nil
+}
+
+func (r *recorder) ReplyWithLLM(chatJID, content string) error {
+	r.actions = append(r.actions, "llm")
+	return nil
+}
+
+func newTestEngine(t *testing.T) (*Engine, *models.Database, *recorder) {
+	t.Helper()
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	exec := &recorder{}
+	e, err := NewEngine(db, exec)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return e, db, exec
+}
+
+func message(id, content string, at time.Time) *models.Message {
+	return &models.Message{MessageID: id, ChatJID: chatJID, Sender: sender, Content: content, MediaType: "text", Time: at}
+}
+
+func TestEvaluateRunsMatchingRulesInOrderUntilStop(t *testing.T) {
+	e, _, exec := newTestEngine(t)
+	for _, rule := range []*models.Rule{
+		{Name: "pricing", Priority: 2, Enabled: true,
+			Conditions: models.RuleConditions{Regex: `(?i)\bprice\b`},
+			Actions:    []models.RuleAction{{Type: "reply", Text: "See our price list"}, {Type: "stop"}}},
+		{Name: "escalate", Priority: 1, Enabled: true,
+			Conditions: models.RuleConditions{ChatJIDs: []string{chatJID}, MediaTypes: []string{"text"}},
+			Actions:    []models.RuleAction{{Type: "forward", ChatJID: "120363000000000000@g.us"}}},
+		{Name: "never", Priority: 3, Enabled: true,
+			Actions: []models.RuleAction{{Type: "llm"}}},
+		{Name: "disabled", Priority: 0, Enabled: false,
+			Actions: []models.RuleAction{{Type: "voice", Text: "hi"}}},
+	} {
+		if err := e.Create(rule); err != nil {
+			t.Fatalf("Create %s: %v", rule.Name, err)
+		}
+	}
+
+	if !e.Evaluate(context.Background(), message("A", "What is the price?", time.Now())) {
+		t.Fatal("expected a rule to match")
+	}
+	want := []string{"forward:120363000000000000@g.us", "reply:See our price list"}
+	if fmt.Sprint(exec.actions) != fmt.Sprint(want) {
+		t.Errorf("actions = %v, want %v", exec.actions, want)
+	}
+
+	exec.actions = nil
+	fromMe := message("B", "price", time.Now())
+	fromMe.IsFromMe = true
+	if e.Evaluate(context.Background(), fromMe) || len(exec.actions) != 0 {
+		t.Errorf("own message matched: %v", exec.actions)
+	}
+}
+
+func TestFirstMessageAndDryRun(t *testing.T) {
+	e, db, _ := newTestEngine(t)
+	start := time.Date(2025, 3, 3, 10, 0, 0, 0, time.UTC)
+	for i, content := range []string{"hello", "are you there?", "hello again"} {
+		if err := db.StoreMessage(message(fmt.Sprintf("M%d", i), content, start.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatalf("StoreMessage: %v", err)
+		}
+	}
+
+	rule := &models.Rule{Name: "welcome", Enabled: true,
+		Conditions: models.RuleConditions{FirstMessage: true, Regex: "hello"},
+		Actions:    []models.RuleAction{{Type: "reply", Text: "Welcome!"}}}
+	matches, err := e.DryRun(rule, "", 10)
+	if err != nil {
+		t.Fatalf("DryRun: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Message.MessageID != "M0" {
+		t.Errorf("dry run matched %+v, want only the first message", matches)
+	}
+}
+
+func TestWithinHours(t *testing.T) {
+	dublin, err := time.LoadLocation("Europe/Dublin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	office := &models.HoursCondition{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:30"}
+	night := &models.HoursCondition{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+
+	for _, tc := range []struct {
+		hours *models.HoursCondition
+		at    time.Time
+		want  bool
+	}{
+		{office, time.Date(2025, 7, 7, 9, 0, 0, 0, dublin), true},    // Monday opening
+		{office, time.Date(2025, 7, 7, 17, 30, 0, 0, dublin), false}, // Monday closing
+		{office, time.Date(2025, 7, 5, 12, 0, 0, 0, dublin), false},  // Saturday
+		{office, time.Date(2025, 7, 7, 8, 30, 0, 0, time.UTC), true}, // 09:30 in Dublin
+		{night, time.Date(2025, 7, 5, 3, 0, 0, 0, dublin), true},     // Friday night, early Saturday
+		{night, time.Date(2025, 7, 4, 3, 0, 0, 0, dublin), false},    // Thursday night
+	} {
+		if got := withinHours(tc.hours, dublin, tc.at); got != tc.want {
+			t.Errorf("withinHours(%s-%s, %s) = %v, want %v", tc.hours.Start, tc.hours.End, tc.at, got, tc.want)
+		}
+	}
+
+	outside := *office
+	outside.Outside = true
+	if !withinHours(&outside, dublin, time.Date(2025, 7, 5, 12, 0, 0, 0, dublin)) {
+		t.Error("outside hours condition did not match on Saturday")
+	}
+}
+
+func TestCreateRejectsInvalidRules(t *testing.T) {
+	e, _, _ := newTestEngine(t)
+	for _, rule := range []*models.Rule{
+		{Name: "", Actions: []models.RuleAction{{Type: "stop"}}},
+		{Name: "no actions"},
+		{Name: "bad regex", Conditions: models.RuleConditions{Regex: "("}, Actions: []models.RuleAction{{Type: "stop"}}},
+		{Name: "bad action", Actions: []models.RuleAction{{Type: "sms"}}},
+		{Name: "empty reply", Actions: []models.RuleAction{{Type: "reply"}}},
+		{Name: "bad webhook", Actions: []models.RuleAction{{Type: "webhook", URL: "/hook"}}},
+		{Name: "bad hours", Conditions: models.RuleConditions{BusinessHours: &models.HoursCondition{Start: "9am", End: "17:00"}},
+			Actions: []models.RuleAction{{Type: "stop"}}},
+	} {
+		if err := e.Create(rule); err == nil {
+			t.Errorf("expected rule %q to be rejected", rule.Name)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Package scheduler sends messages at a future time or on a cron-like
+// recurrence. Schedules are stored in the message database and survive
+// restarts; when one is due its message is handed to the client's outbox,
+// which takes care of delivery and retries.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/models"
+)
+
+const (
+	// pollInterval is how often schedules are checked for due runs
+	pollInterval = 15 * time.Second
+	// batchSize is the maximum number of schedules run per poll
+	batchSize = 50
+)
+
+// Errors returned when managing schedules
+var (
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	ErrNotActive       = errors.New("scheduled message is no longer active")
+)
+
+// rateLimitError is returned by a Sender that refuses a message over a send
+// limit. It is implemented by *whatsapp.RateLimitError.
+type rateLimitError interface {
+	error
+	RetryDelay() time.Duration
+}
+
+// Sender queues messages for delivery and decides which files may be sent.
+// It is implemented by *whatsapp.Client.
+type Sender interface {
+	QueueText(recipient, text, idempotencyKey string) (*models.OutboxMessage, error)
+	QueueAudio(recipient, filePath, idempotencyKey string) (*models.OutboxMessage, error)
+	QueueFile(recipient, filePath, caption, idempotencyKey string) (*models.OutboxMessage, error)
+	CheckMediaPath(path string) (string, error)
+}
+
+// Scheduler stores schedules and sends their messages when due
+type Scheduler struct {
+	db       *models.Database
+	sender   Sender
+	mediaDir string // where voice notes and files of schedules are kept
+	wake     chan struct{}
+}
+
+// New creates a scheduler backed by the message database. Files attached to
+// schedules are copied into mediaDir.
+func New(db *models.Database, sender Sender, mediaDir string) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		sender:   sender,
+		mediaDir: mediaDir,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Run sends due messages until ctx is cancelled. Runs missed while the
+// server was down are sent once on startup.
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Printf("⏰ Message scheduler started")
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.runDue(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// runDue sends every scheduled message that is due at now
+func (s *Scheduler) runDue(now time.Time) {
+	due, err := s.db.GetDueScheduledMessages(now, batchSize)
+	if err != nil {
+		log.Printf("❌ Failed to load scheduled messages: %v", err)
+		return
+	}
+	for _, m := range due {
+		s.run(m, now)
+	}
+}
+
+// run hands one scheduled message to the outbox and works out its next run.
+// The idempotency key ties the outbox entry to this run, so a run is never
+// sent twice even if recording it fails.
+func (s *Scheduler) run(m *models.ScheduledMessage, now time.Time) {
+	key := fmt.Sprintf("schedule-%d-%d", m.ID, m.NextRunAt.Unix())
+	var queued *models.OutboxMessage
+	var err error
+	switch m.Kind {
+	case models.ScheduledVoice:
+		queued, err = s.sender.QueueAudio(m.Recipient, m.MediaPath, key)
+	case models.ScheduledFile:
+		queued, err = s.sender.QueueFile(m.Recipient, m.MediaPath, m.Text, key)
+	default:
+		queued, err = s.sender.QueueText(m.Recipient, m.Text, key)
+	}
+
+	// A rate limited run is not a failure: it is tried again once the limit
+	// allows, under a new key as nothing was queued
+	var limited rateLimitError
+	if errors.As(err, &limited) {
+		log.Printf("🚦 Scheduled message %d to %s is rate limited, retrying in %s", m.ID, m.Recipient, limited.RetryDelay())
+		if err := s.db.DeferScheduledRun(m.ID, now.Add(retryDelay(limited)), err.Error()); err != nil {
+			log.Printf("❌ Failed to defer scheduled message %d: %v", m.ID, err)
+		}
+		return
+	}
+
+	var outboxID int64
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+		log.Printf("❌ Scheduled message %d to %s could not be queued: %v", m.ID, m.Recipient, err)
+	} else {
+		outboxID = queued.ID
+		log.Printf("⏰ Scheduled message %d to %s queued as outbox message %d (%s)", m.ID, m.Recipient, queued.ID, queued.Status)
+	}
+
+	// One-off messages are done; recurring ones continue from now, skipping
+	// runs missed while the server was down
+	var next *time.Time
+	status := ""
+	if m.Cron == "" {
+		status = models.ScheduleCompleted
+		if err != nil {
+			status = models.ScheduleFailed
+		}
+	} else if t, nextErr := nextRun(m, now); nextErr != nil || t.IsZero() {
+		status = models.ScheduleCompleted
+	} else {
+		next = &t
+	}
+	if status != "" {
+		s.removeMedia(m)
+	}
+
+	if err := s.db.RecordScheduledRun(m.ID, outboxID, lastError, next, status); err != nil {
+		log.Printf("❌ Failed to record run of scheduled message %d: %v", m.ID, err)
+	}
+}
+
+// retryDelay returns the wait before a rate limited run is tried again, at
+// least one second so the retry gets a new idempotency key
+func retryDelay(limited rateLimitError) time.Duration {
+	if limited.RetryDelay() < time.Second {
+		return time.Second
+	}
+	return limited.RetryDelay()
+}
+
+// Create validates and stores a new scheduled message. A voice note or file
+// is copied from MediaPath, so the caller may remove it afterwards.
+func (s *Scheduler) Create(m *models.ScheduledMessage) error {
+	if err := s.prepare(m, time.Now()); err != nil {
+		return err
+	}
+	if err := s.attachMedia(m); err != nil {
+		return err
+	}
+	m.Status = models.ScheduleActive
+	if err := s.db.CreateScheduledMessage(m); err != nil {
+		s.removeMedia(m)
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Update replaces an active scheduled message. Leaving MediaPath empty keeps
+// the stored voice note or file.
+func (s *Scheduler) Update(m *models.ScheduledMessage) error {
+	existing, err := s.db.GetScheduledMessage(m.ID)
+	if err != nil {
+		return err
+	}
+	if existing.Status != models.ScheduleActive {
+		return ErrNotActive
+	}
+
+	replaceMedia := m.MediaPath != ""
+	if !replaceMedia {
+		m.MediaPath, m.Filename = existing.MediaPath, existing.Filename
+	}
+	if err := s.prepare(m, time.Now()); err != nil {
+		return err
+	}
+	if replaceMedia {
+		if err := s.attachMedia(m); err != nil {
+			return err
+		}
+	}
+
+	m.Status = models.ScheduleActive
+	if err := s.db.UpdateScheduledMessage(m); err != nil {
+		if replaceMedia {
+			s.removeMedia(m)
+		}
+		return err
+	}
+	if existing.MediaPath != m.MediaPath {
+		s.removeMedia(existing)
+	}
+	s.notify()
+	return nil
+}
+
+// Cancel stops a scheduled message from being sent again
+func (s *Scheduler) Cancel(id int64) (*models.ScheduledMessage, error) {
+	m, err := s.db.GetScheduledMessage(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.Status != models.ScheduleActive {
+		return nil, ErrNotActive
+	}
+
+	m.Status, m.NextRunAt = models.ScheduleCancelled, nil
+	s.removeMedia(m)
+	m.MediaPath = ""
+	if err := s.db.UpdateScheduledMessage(m); err != nil {
+		return nil, err
+	}
+	log.Printf("⏰ Scheduled message %d to %s cancelled", m.ID, m.Recipient)
+	return m, nil
+}
+
+// Get returns a scheduled message by ID
+func (s *Scheduler) Get(id int64) (*models.ScheduledMessage, error) {
+	return s.db.GetScheduledMessage(id)
+}
+
+// List returns scheduled messages, optionally filtered by status
+func (s *Scheduler) List(status string) ([]*models.ScheduledMessage, error) {
+	return s.db.GetScheduledMessages(status)
+}
+
+// notify makes the run loop check for due messages now
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// prepare validates a schedule, normalizes its recipient and time zone and
+// computes its first run after now
+func (s *Scheduler) prepare(m *models.ScheduledMessage, now time.Time) error {
+	jid, err := types.ParseJID(m.Recipient)
+	if err != nil || jid.User == "" {
+		return fmt.Errorf("%w: invalid recipient %q", ErrInvalidSchedule, m.Recipient)
+	}
+	m.Recipient = jid.String()
+
+	switch m.Kind {
+	case "":
+		m.Kind = models.ScheduledText
+		fallthrough
+	case models.ScheduledText:
+		if m.Text == "" {
+			return fmt.Errorf("%w: text is required", ErrInvalidSchedule)
+		}
+		m.MediaPath, m.Filename = "", ""
+	case models.ScheduledVoice, models.ScheduledFile:
+		if m.MediaPath == "" {
+			return fmt.Errorf("%w: media_path is required for %s messages", ErrInvalidSchedule, m.Kind)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q (use text, voice or file)", ErrInvalidSchedule, m.Kind)
+	}
+
+	if m.Timezone == "" {
+		m.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(m.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidSchedule, m.Timezone)
+	}
+
+	switch {
+	case (m.SendAt == nil) == (m.Cron == ""):
+		return fmt.Errorf("%w: give either send_at or cron", ErrInvalidSchedule)
+	case m.SendAt != nil && !m.SendAt.After(now):
+		return fmt.Errorf("%w: send_at is in the past", ErrInvalidSchedule)
+	}
+	next, err := nextRun(m, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if next.IsZero() {
+		return fmt.Errorf("%w: cron expression %q never matches", ErrInvalidSchedule, m.Cron)
+	}
+	m.NextRunAt = &next
+	return nil
+}
+
+// nextRun returns when a schedule runs next after now, or the zero time if
+// it does not
+func nextRun(m *models.ScheduledMessage, now time.Time) (time.Time, error) {
+	if m.Cron == "" {
+		if m.SendAt == nil || !m.SendAt.After(now) {
+			return time.Time{}, nil
+		}
+		return *m.SendAt, nil
+	}
+	cron, err := ParseCron(m.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(m.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cron.Next(now, loc), nil
+}
+
+// attachMedia copies the voice note or file of a schedule into the media
+// directory and points MediaPath at the copy
+func (s *Scheduler) attachMedia(m *models.ScheduledMessage) error {
+	if m.MediaPath == "" {
+		return nil
+	}
+	path, err := s.sender.CheckMediaPath(m.MediaPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(s.mediaDir, 0755); err != nil {
+		return fmt.Errorf("failed to create scheduled media directory: %w", err)
+	}
+	m.Filename = filepath.Base(m.MediaPath)
+	dst := filepath.Join(s.mediaDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), m.Filename))
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	m.MediaPath = dst
+	return nil
+}
+
+// removeMedia deletes the stored voice note or file of a schedule
+func (s *Scheduler) removeMedia(m *models.ScheduledMessage) {
+	if m.MediaPath == "" {
+		return
+	}
+	if err := os.Remove(m.MediaPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("⚠️ Failed to remove scheduled media %s: %v", m.MediaPath, err)
+	}
+}
@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+func dublin(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Dublin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	return loc
+}
+
+func TestCronNext(t *testing.T) {
+	loc := dublin(t)
+	for _, tc := range []struct {
+		expr       string
+		from, want time.Time
+	}{
+		// Friday evening to Monday morning
+		{"0 9 * * mon-fri", time.Date(2025, 10, 17, 18, 0, 0, 0, loc), time.Date(2025, 10, 20, 9, 0, 0, 0, loc)},
+		// A matching time is not repeated
+		{"0 9 * * *", time.Date(2025, 10, 20, 9, 0, 0, 0, loc), time.Date(2025, 10, 21, 9, 0, 0, 0, loc)},
+		{"*/15 8-18 * * *", time.Date(2025, 10, 20, 18, 50, 0, 0, loc), time.Date(2025, 10, 21, 8, 0, 0, 0, loc)},
+		{"30 10 1 jan,jul *", time.Date(2025, 2, 1, 0, 0, 0, 0, loc), time.Date(2025, 7, 1, 10, 30, 0, 0, loc)},
+		// Either day field matches when both are restricted
+		{"0 12 13 * fri", time.Date(2025, 10, 1, 0, 0, 0, 0, loc), time.Date(2025, 10, 3, 12, 0, 0, 0, loc)},
+		{"@monthly", time.Date(2025, 12, 15, 0, 0, 0, 0, loc), time.Date(2026, 1, 1, 0, 0, 0, 0, loc)},
+		// 01:30 does not exist on 30 March 2025 in Dublin and runs when the clock resumes
+		{"30 1 * * *", time.Date(2025, 3, 30, 0, 0, 0, 0, loc), time.Date(2025, 3, 30, 2, 30, 0, 0, loc)},
+	} {
+		c, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tc.expr, err)
+		}
+		if got := c.Next(tc.from, loc); !got.Equal(tc.want) {
+			t.Errorf("%q after %s = %s, want %s", tc.expr, tc.from, got, tc.want)
+		}
+	}
+
+	// 01:30 happens twice on 26 October 2025 in Dublin but runs once
+	c, _ := ParseCron("30 1 * * *")
+	first := c.Next(time.Date(2025, 10, 26, 0, 0, 0, 0, loc), loc)
+	if second := c.Next(first, loc); second.Sub(first) < 24*time.Hour {
+		t.Errorf("repeated hour ran twice: %s and %s", first, second)
+	}
+
+	if never, _ := ParseCron("0 0 30 feb *"); !never.Next(time.Now(), loc).IsZero() {
+		t.Error("30 February should never match")
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 9 * * someday", "0 9 5-1 * *", "*/0 * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}
+
+// fakeSender records queued messages, or refuses them while limited is set
+type fakeSender struct {
+	keys    []string
+	limited *whatsapp.RateLimitError
+}
+
+func (f *fakeSender) queue(recipient, key string) (*models.OutboxMessage, error) {
+	if f.limited != nil {
+		return nil, f.limited
+	}
+	f.keys = append(f.keys, key)
+	return &models.OutboxMessage{ID: int64(len(f.keys)), Recipient: recipient, Status: models.OutboxQueued}, nil
+}
+
+func (f *fakeSender) QueueText(recipient, text, key string) (*models.OutboxMessage, error) {
+	return f.queue(recipient, key)
+}
+
+func (f *fakeSender) QueueAudio(recipient, filePath, key string) (*models.OutboxMessage, error) {
+	return f.queue(recipient, key)
+}
+
+func (f *fakeSender) QueueFile(recipient, filePath, caption, key string) (*models.OutboxMessage, error) {
+	return f.queue(recipient, key)
+}
+
+func (f *fakeSender) CheckMediaPath(path string) (string, error) {
+	return path, nil
+}
+
+func TestSchedulesRunOnceOrRecur(t *testing.T) {
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	sender := &fakeSender{}
+	s := New(db, sender, t.TempDir())
+
+	sendAt := time.Now().Add(time.Hour)
+	once := &models.ScheduledMessage{Recipient: "353851234567@s.whatsapp.net", Text: "Reminder", SendAt: &sendAt}
+	daily := &models.ScheduledMessage{Recipient: "353851234567@s.whatsapp.net", Text: "Good morning", Cron: "0 9 * * *", Timezone: "Europe/Dublin"}
+	for _, m := range []*models.ScheduledMessage{once, daily} {
+		if err := s.Create(m); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	// Nothing is due yet; two days later both are, and the daily message
+	// runs once rather than once per missed day
+	s.runDue(time.Now())
+	if len(sender.keys) != 0 {
+		t.Fatalf("nothing should be sent yet, got %v", sender.keys)
+	}
+	later := time.Now().Add(48 * time.Hour)
+	s.runDue(later)
+	s.runDue(later)
+	if len(sender.keys) != 2 {
+		t.Fatalf("sent %d messages, want 2: %v", len(sender.keys), sender.keys)
+	}
+
+	gotOnce, _ := s.Get(once.ID)
+	if gotOnce.Status != models.ScheduleCompleted || gotOnce.RunCount != 1 || gotOnce.NextRunAt != nil {
+		t.Errorf("one-off message after run: %+v", gotOnce)
+	}
+	gotDaily, _ := s.Get(daily.ID)
+	if gotDaily.Status != models.ScheduleActive || gotDaily.RunCount != 1 || gotDaily.LastOutboxID == 0 ||
+		gotDaily.NextRunAt == nil || !gotDaily.NextRunAt.After(later) {
+		t.Errorf("daily message after run: %+v", gotDaily)
+	}
+
+	if _, err := s.Cancel(daily.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if _, err := s.Cancel(daily.ID); err != ErrNotActive {
+		t.Errorf("cancelling twice = %v, want ErrNotActive", err)
+	}
+	s.runDue(later.Add(48 * time.Hour))
+	if len(sender.keys) != 2 {
+		t.Errorf("cancelled message was sent: %v", sender.keys)
+	}
+}
+
+func TestRateLimitedRunIsRetried(t *testing.T) {
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	sender := &fakeSender{limited: &whatsapp.RateLimitError{Scope: "recipient", RetryAfter: time.Minute}}
+	s := New(db, sender, t.TempDir())
+
+	sendAt := time.Now().Add(time.Hour)
+	m := &models.ScheduledMessage{Recipient: "353851234567@s.whatsapp.net", Text: "Reminder", SendAt: &sendAt}
+	if err := s.Create(m); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	later := sendAt.Add(time.Second)
+	s.runDue(later)
+	got, _ := s.Get(m.ID)
+	if got.Status != models.ScheduleActive || got.RunCount != 0 || got.NextRunAt == nil || !got.NextRunAt.After(later) {
+		t.Fatalf("rate limited message should wait for the limit: %+v", got)
+	}
+
+	sender.limited = nil
+	s.runDue(later.Add(30 * time.Second))
+	if len(sender.keys) != 0 {
+		t.Fatalf("retried before the limit allowed: %v", sender.keys)
+	}
+	s.runDue(later.Add(2 * time.Minute))
+	got, _ = s.Get(m.ID)
+	if len(sender.keys) != 1 || got.Status != models.ScheduleCompleted || got.LastError != "" {
+		t.Errorf("retry after the limit: sent %v, %+v", sender.keys, got)
+	}
+}
+
+func TestCreateRejectsInvalidSchedules(t *testing.T) {
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	s := New(db, &fakeSender{}, t.TempDir())
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	const to = "353851234567@s.whatsapp.net"
+	for _, m := range []*models.ScheduledMessage{
+		{Recipient: to, Text: "no time"},
+		{Recipient: to, Text: "both", SendAt: &future, Cron: "0 9 * * *"},
+		{Recipient: to, Text: "late", SendAt: &past},
+		{Recipient: to, Text: "bad cron", Cron: "every day"},
+		{Recipient: to, Text: "bad zone", Cron: "0 9 * * *", Timezone: "Mars/Olympus"},
+		{Recipient: to, Kind: "voice", SendAt: &future},
+		{Recipient: "", Text: "nobody", SendAt: &future},
+		{Recipient: "353851234567", Text: "not a JID", SendAt: &future},
+	} {
+		if err := s.Create(m); err == nil {
+			t.Errorf("expected %+v to be rejected", m)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package stream fans WhatsApp events out to live clients connected over
+// Server-Sent Events or WebSocket. Events are kept in a small persisted ring
+// buffer so clients can resume from the last event ID they saw.
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+const (
+	// DefaultCapacity is the default number of events kept for replay
+	DefaultCapacity = 1000
+	// subscriberBuffer is the number of events queued for a slow client
+	// before it is disconnected; it can resume with its last event ID
+	subscriberBuffer = 256
+)
+
+// Record is an event as sent to stream clients
+type Record struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	Time    time.Time       `json:"time"`
+	ChatJID string          `json:"chat_jid,omitempty"`
+	Sender  string          `json:"sender,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Filter selects the events a client receives. Empty lists match everything.
+type Filter struct {
+	Types    []string
+	ChatJIDs []string
+}
+
+// ParseFilter builds a filter from comma-separated lists
+func ParseFilter(types, chatJIDs string) Filter {
+	return Filter{Types: splitList(types), ChatJIDs: splitList(chatJIDs)}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Match reports whether a record passes the filter. A chat filter matches
+// the chat of the event or, for presence events, the contact.
+func (f Filter) Match(rec *Record) bool {
+	if len(f.Types) > 0 && !contains(f.Types, rec.Type) {
+		return false
+	}
+	if len(f.ChatJIDs) > 0 && !contains(f.ChatJIDs, rec.ChatJID) && !contains(f.ChatJIDs, rec.Sender) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscriber receives live events matching its filter on C. C is closed when
+// the subscriber falls too far behind or is unsubscribed.
+type Subscriber struct {
+	C      chan *Record
+	filter Filter
+}
+
+// Hub persists published events and fans them out to subscribers
+type Hub struct {
+	db          *models.Database
+	capacity    int
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+}
+
+// NewHub creates a hub that keeps the last capacity events for replay
+func NewHub(db *models.Database, capacity int) *Hub {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Hub{
+		db:          db,
+		capacity:    capacity,
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+// Publish records an event and sends it to matching subscribers. It is meant
+// to be registered with Client.Subscribe and never blocks on slow clients.
+func (h *Hub) Publish(evt whatsapp.Event) {
+	data, err := json.Marshal(evt.Data)
+	if err != nil {
+		log.Printf("❌ Failed to encode %s event for streaming: %v", evt.Type, err)
+		return
+	}
+	rec := &Record{Type: evt.Type, Time: evt.Time, ChatJID: evt.ChatJID, Sender: evt.Sender, Data: data}
+
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("❌ Failed to encode %s event for streaming: %v", evt.Type, err)
+		return
+	}
+	logged := &models.LoggedEvent{Type: rec.Type, ChatJID: rec.ChatJID, Sender: rec.Sender, Payload: string(payload)}
+
+	// Appending and fanning out under the lock keeps IDs in order for every subscriber
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.db.AppendEvent(logged, h.capacity); err != nil {
+		log.Printf("❌ Failed to record %s event: %v", evt.Type, err)
+		return
+	}
+	rec.ID = logged.ID
+
+	for sub := range h.subscribers {
+		if !sub.filter.Match(rec) {
+			continue
+		}
+		select {
+		case sub.C <- rec:
+		default:
+			log.Printf("⚠️ Disconnecting slow event stream client")
+			delete(h.subscribers, sub)
+			close(sub.C)
+		}
+	}
+}
+
+// Subscribe registers a subscriber and returns the logged events after
+// lastEventID that match the filter, to be sent before the live events.
+// Pass a lastEventID of 0 to skip replay.
+func (h *Hub) Subscribe(filter Filter, lastEventID int64) (*Subscriber, []*Record, error) {
+	sub := &Subscriber{C: make(chan *Record, subscriberBuffer), filter: filter}
+
+	// Registering and reading the log under the lock means no event is
+	// missed or sent twice between the replay and the live stream
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replay []*Record
+	if lastEventID > 0 {
+		logged, err := h.db.GetEventsAfter(lastEventID, h.capacity)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, evt := range logged {
+			rec := &Record{}
+			if err := json.Unmarshal([]byte(evt.Payload), rec); err != nil {
+				return nil, nil, err
+			}
+			rec.ID = evt.ID
+			if filter.Match(rec) {
+				replay = append(replay, rec)
+			}
+		}
+	}
+
+	h.subscribers[sub] = struct{}{}
+	return sub, replay, nil
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.C)
+	}
+}
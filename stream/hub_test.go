@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+func newTestHub(t *testing.T, capacity int) *Hub {
+	t.Helper()
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewHub(db, capacity)
+}
+
+func TestReplayFromLastEventID(t *testing.T) {
+	hub := newTestHub(t, 3)
+	for _, chat := range []string{"a@s.whatsapp.net", "b@s.whatsapp.net", "a@s.whatsapp.net", "a@s.whatsapp.net"} {
+		hub.Publish(whatsapp.Event{Type: whatsapp.EventMessage, ChatJID: chat, Data: map[string]string{"chat": chat}})
+	}
+
+	// Only the last 3 events are kept; event 1 has been dropped from the ring buffer
+	sub, replay, err := hub.Subscribe(Filter{}, 1)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer hub.Unsubscribe(sub)
+	if len(replay) != 3 || replay[0].ID != 2 || replay[2].ID != 4 {
+		t.Fatalf("replay = %+v, want events 2-4", replay)
+	}
+	if string(replay[0].Data) != `{"chat":"b@s.whatsapp.net"}` {
+		t.Errorf("replayed data = %s", replay[0].Data)
+	}
+
+	filtered, replay, err := hub.Subscribe(ParseFilter("message", "a@s.whatsapp.net"), 1)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer hub.Unsubscribe(filtered)
+	if len(replay) != 2 {
+		t.Fatalf("filtered replay has %d events, want 2", len(replay))
+	}
+
+	// Live events follow the replay without gaps and respect the filter
+	hub.Publish(whatsapp.Event{Type: whatsapp.EventReceipt, ChatJID: "a@s.whatsapp.net"})
+	hub.Publish(whatsapp.Event{Type: whatsapp.EventMessage, ChatJID: "a@s.whatsapp.net"})
+	if rec := <-sub.C; rec.ID != 5 {
+		t.Errorf("first live event has ID %d, want 5", rec.ID)
+	}
+	if rec := <-filtered.C; rec.ID != 6 || rec.Type != whatsapp.EventMessage {
+		t.Errorf("filtered subscriber got %+v, want message event 6", rec)
+	}
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	hub := newTestHub(t, 10)
+	sub, _, err := hub.Subscribe(Filter{}, 0)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Publish(whatsapp.Event{Type: whatsapp.EventPresence})
+	}
+
+	received := 0
+	for range sub.C {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before disconnect, want %d", received, subscriberBuffer)
+	}
+
+	// Unsubscribing after the hub dropped the subscriber must not panic
+	hub.Unsubscribe(sub)
+}
@@ -0,0 +1,387 @@
+// Package webhooks delivers WhatsApp events to subscribed HTTP endpoints.
+// Events are queued in the message database and delivered by a background
+// worker that signs each request and retries failures with exponential backoff.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret, prefixed with "sha256=".
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// maxAttempts is the number of attempts before a delivery is marked failed
+	maxAttempts = 10
+	// baseRetryDelay is the delay before the first retry; it doubles with every attempt
+	baseRetryDelay = 10 * time.Second
+	// maxRetryDelay caps the delay between attempts
+	maxRetryDelay = time.Hour
+	// pollInterval is how often the queue is checked for retries that became due
+	pollInterval = 5 * time.Second
+	// batchSize is the maximum number of deliveries attempted per poll
+	batchSize = 50
+	// requestTimeout bounds a single delivery attempt
+	requestTimeout = 15 * time.Second
+)
+
+// ErrInvalidWebhook is returned when a webhook subscription fails validation
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// Dispatcher queues events for matching webhooks and delivers them
+type Dispatcher struct {
+	db       *models.Database
+	http     *http.Client
+	wake     chan struct{}
+	mu       sync.RWMutex
+	webhooks []*models.Webhook // enabled subscriptions
+}
+
+// NewDispatcher creates a dispatcher backed by the message database
+func NewDispatcher(db *models.Database) (*Dispatcher, error) {
+	d := &Dispatcher{
+		db:   db,
+		http: &http.Client{Timeout: requestTimeout},
+		wake: make(chan struct{}, 1),
+	}
+	if err := d.reload(); err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	return d, nil
+}
+
+// Handle queues an event for every enabled webhook whose filters match it.
+// It is meant to be registered with Client.Subscribe.
+func (d *Dispatcher) Handle(evt whatsapp.Event) {
+	d.mu.RLock()
+	var targets []*models.Webhook
+	for _, w := range d.webhooks {
+		if matches(w, evt) {
+			targets = append(targets, w)
+		}
+	}
+	d.mu.RUnlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		log.Printf("❌ Failed to encode %s event for webhooks: %v", evt.Type, err)
+		return
+	}
+
+	for _, w := range targets {
+		delivery := &models.WebhookDelivery{
+			WebhookID:     w.ID,
+			EventType:     evt.Type,
+			Payload:       string(payload),
+			NextAttemptAt: time.Now(),
+		}
+		if err := d.db.EnqueueWebhookDelivery(delivery); err != nil {
+			log.Printf("❌ Failed to queue %s event for webhook %d: %v", evt.Type, w.ID, err)
+		}
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// matches reports whether an event passes a webhook's filters. A chat filter
+// matches the chat of the event or, for presence events, the contact.
+func matches(w *models.Webhook, evt whatsapp.Event) bool {
+	if len(w.EventTypes) > 0 && !contains(w.EventTypes, evt.Type) {
+		return false
+	}
+	if len(w.ChatJIDs) > 0 && !contains(w.ChatJIDs, evt.ChatJID) && !contains(w.ChatJIDs, evt.Sender) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Run delivers queued events until ctx is cancelled. Pending deliveries left
+// over from a previous run are picked up on start.
+func (d *Dispatcher) Run(ctx context.Context) {
+	log.Printf("🪝 Webhook dispatcher started")
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue attempts every delivery that is due. Deliveries for the same
+// webhook are sent in order; different webhooks are served concurrently so a
+// slow endpoint does not hold up the others. A webhook's run stops at its
+// first failure, and its remaining deliveries wait for the retry, so a dead
+// endpoint costs one request timeout per retry rather than one per event.
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	deliveries, err := d.db.GetDueWebhookDeliveries(time.Now(), batchSize)
+	if err != nil {
+		log.Printf("❌ Failed to load webhook deliveries: %v", err)
+		return
+	}
+
+	byWebhook := make(map[int64][]*models.WebhookDelivery)
+	for _, delivery := range deliveries {
+		byWebhook[delivery.WebhookID] = append(byWebhook[delivery.WebhookID], delivery)
+	}
+
+	var wg sync.WaitGroup
+	for webhookID, queue := range byWebhook {
+		w, err := d.db.GetWebhook(webhookID)
+		if err != nil {
+			log.Printf("❌ Failed to load webhook %d: %v", webhookID, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(w *models.Webhook, queue []*models.WebhookDelivery) {
+			defer wg.Done()
+			for _, delivery := range queue {
+				if ctx.Err() != nil || !d.attempt(ctx, w, delivery) {
+					return
+				}
+			}
+		}(w, queue)
+	}
+	wg.Wait()
+}
+
+// attempt sends one delivery and records the outcome. It reports whether the
+// delivery succeeded; after a failure the webhook's other pending deliveries
+// are held back until the retry.
+func (d *Dispatcher) attempt(ctx context.Context, w *models.Webhook, delivery *models.WebhookDelivery) bool {
+	attempts := delivery.Attempts + 1
+	err := d.send(ctx, w, delivery)
+	if err == nil {
+		if err := d.db.MarkWebhookDelivered(delivery.ID, attempts); err != nil {
+			log.Printf("❌ Failed to record webhook delivery %d: %v", delivery.ID, err)
+		}
+		return true
+	}
+
+	var next time.Time
+	if attempts < maxAttempts {
+		next = time.Now().Add(retryDelay(attempts))
+		log.Printf("⚠️ Webhook %d delivery %d failed (attempt %d/%d), retrying at %s: %v",
+			w.ID, delivery.ID, attempts, maxAttempts, next.Format(time.RFC3339), err)
+	} else {
+		log.Printf("❌ Webhook %d delivery %d failed after %d attempts: %v", w.ID, delivery.ID, attempts, err)
+	}
+	if err := d.db.MarkWebhookAttemptFailed(delivery.ID, attempts, err.Error(), next); err != nil {
+		log.Printf("❌ Failed to record webhook delivery %d: %v", delivery.ID, err)
+	}
+	if !next.IsZero() {
+		if err := d.db.PostponeWebhookDeliveries(w.ID, next); err != nil {
+			log.Printf("❌ Failed to hold back deliveries of webhook %d: %v", w.ID, err)
+		}
+	}
+	return false
+}
+
+// send POSTs a signed delivery to the webhook URL
+func (d *Dispatcher) send(ctx context.Context, w *models.Webhook, delivery *models.WebhookDelivery) error {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "whatsapp-go-mcp-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, body))
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign computes the signature header value for a delivery body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay returns the backoff before the attempt following the given one
+func retryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+// reload refreshes the cached list of enabled webhooks
+func (d *Dispatcher) reload() error {
+	all, err := d.db.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	var enabled []*models.Webhook
+	for _, w := range all {
+		if w.Enabled {
+			enabled = append(enabled, w)
+		}
+	}
+
+	d.mu.Lock()
+	d.webhooks = enabled
+	d.mu.Unlock()
+	return nil
+}
+
+// Create validates and stores a new webhook. A random secret is generated
+// when none is given.
+func (d *Dispatcher) Create(w *models.Webhook) error {
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+	if err := validate(w); err != nil {
+		return err
+	}
+	if err := d.db.CreateWebhook(w); err != nil {
+		return err
+	}
+	log.Printf("🪝 Webhook %d created for %s", w.ID, w.URL)
+	return d.reload()
+}
+
+// Update validates and replaces the settings of a webhook. The secret is kept
+// when none is given.
+func (d *Dispatcher) Update(w *models.Webhook) error {
+	if w.Secret == "" {
+		existing, err := d.db.GetWebhook(w.ID)
+		if err != nil {
+			return err
+		}
+		w.Secret = existing.Secret
+	}
+	if err := validate(w); err != nil {
+		return err
+	}
+	if err := d.db.UpdateWebhook(w); err != nil {
+		return err
+	}
+	return d.reload()
+}
+
+// Delete removes a webhook and its queued deliveries
+func (d *Dispatcher) Delete(id int64) error {
+	if err := d.db.DeleteWebhook(id); err != nil {
+		return err
+	}
+	log.Printf("🪝 Webhook %d deleted", id)
+	return d.reload()
+}
+
+// Get returns a webhook by ID
+func (d *Dispatcher) Get(id int64) (*models.Webhook, error) {
+	return d.db.GetWebhook(id)
+}
+
+// List returns all webhooks
+func (d *Dispatcher) List() ([]*models.Webhook, error) {
+	return d.db.GetWebhooks()
+}
+
+// Deliveries returns the most recent deliveries of a webhook
+func (d *Dispatcher) Deliveries(webhookID int64, status string, limit int) ([]*models.WebhookDelivery, error) {
+	return d.db.GetWebhookDeliveries(webhookID, status, limit)
+}
+
+// Retry queues a failed delivery again
+func (d *Dispatcher) Retry(webhookID, deliveryID int64) error {
+	if err := d.db.RetryWebhookDelivery(webhookID, deliveryID); err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// validate checks a webhook's URL and filters
+func validate(w *models.Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	for _, eventType := range w.EventTypes {
+		if !contains(whatsapp.EventTypes, eventType) {
+			return fmt.Errorf("%w: unknown event type %q (valid: %s)",
+				ErrInvalidWebhook, eventType, strings.Join(whatsapp.EventTypes, ", "))
+		}
+	}
+	for i, jid := range w.ChatJIDs {
+		w.ChatJIDs[i] = strings.TrimSpace(jid)
+	}
+	return nil
+}
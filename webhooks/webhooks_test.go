@@ -0,0 +1,224 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/whatsapp"
+)
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, *models.Database) {
+	t.Helper()
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	d, err := NewDispatcher(db)
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	return d, db
+}
+
+func TestDeliveryIsSignedAndFiltered(t *testing.T) {
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	d, _ := newTestDispatcher(t)
+	webhook := &models.Webhook{
+		URL:        server.URL,
+		EventTypes: []string{whatsapp.EventMessage},
+		ChatJIDs:   []string{"353851234567@s.whatsapp.net"},
+		Enabled:    true,
+	}
+	if err := d.Create(webhook); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if webhook.Secret == "" {
+		t.Fatal("expected a generated secret")
+	}
+
+	d.Handle(whatsapp.Event{Type: whatsapp.EventMessage, ChatJID: "353851234567@s.whatsapp.net",
+		Data: &models.Message{Content: "hello", MessageID: "ABC"}})
+	d.Handle(whatsapp.Event{Type: whatsapp.EventMessage, ChatJID: "447700900123@s.whatsapp.net"})
+	d.Handle(whatsapp.Event{Type: whatsapp.EventReceipt, ChatJID: "353851234567@s.whatsapp.net"})
+	d.deliverDue(context.Background())
+
+	if len(received) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(received))
+	}
+	req, body := received[0], bodies[0]
+	if req.Header.Get(EventHeader) != whatsapp.EventMessage {
+		t.Errorf("event header = %q", req.Header.Get(EventHeader))
+	}
+	if want := Sign(webhook.Secret, req.Header.Get(TimestampHeader), body); req.Header.Get(SignatureHeader) != want {
+		t.Errorf("signature = %q, want %q", req.Header.Get(SignatureHeader), want)
+	}
+
+	var evt struct {
+		Type string          `json:"type"`
+		Data *models.Message `json:"data"`
+	}
+	if err := json.Unmarshal(body, &evt); err != nil || evt.Data == nil || evt.Data.Content != "hello" {
+		t.Errorf("unexpected payload %s (%v)", body, err)
+	}
+
+	deliveries, err := d.Deliveries(webhook.ID, models.DeliveryDelivered, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Deliveries = %v, %v", deliveries, err)
+	}
+}
+
+func TestFailedDeliveryIsRetriedWithBackoff(t *testing.T) {
+	status := http.StatusInternalServerError
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	d, db := newTestDispatcher(t)
+	webhook := &models.Webhook{URL: server.URL, Enabled: true}
+	if err := d.Create(webhook); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	d.Handle(whatsapp.Event{Type: whatsapp.EventConnection, Data: &whatsapp.ConnectionEvent{State: "connected"}})
+	d.deliverDue(context.Background())
+
+	pending, err := d.Deliveries(webhook.ID, models.DeliveryPending, 10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending deliveries = %v, %v", pending, err)
+	}
+	if pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Errorf("failed attempt not recorded: %+v", pending[0])
+	}
+	if wait := time.Until(pending[0].NextAttemptAt); wait < baseRetryDelay-time.Second {
+		t.Errorf("next attempt in %v, want about %v", wait, baseRetryDelay)
+	}
+
+	// Not due yet, so nothing is sent
+	d.deliverDue(context.Background())
+	if calls != 1 {
+		t.Fatalf("delivery retried before its backoff expired (%d calls)", calls)
+	}
+
+	// Once due, the retry succeeds
+	due, err := db.GetDueWebhookDeliveries(time.Now().Add(baseRetryDelay), 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("GetDueWebhookDeliveries = %v, %v", due, err)
+	}
+	status = http.StatusOK
+	d.attempt(context.Background(), webhook, due[0])
+
+	delivered, err := d.Deliveries(webhook.ID, models.DeliveryDelivered, 10)
+	if err != nil || len(delivered) != 1 || delivered[0].Attempts != 2 {
+		t.Fatalf("delivered = %+v, %v", delivered, err)
+	}
+}
+
+func TestHangingEndpointDoesNotStallOtherWebhooks(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	hangingCalls, healthyCalls := 0, 0
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hangingCalls++
+		mu.Unlock()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hanging.Close()
+	defer close(release)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		healthyCalls++
+		mu.Unlock()
+	}))
+	defer healthy.Close()
+
+	d, _ := newTestDispatcher(t)
+	d.http.Timeout = 200 * time.Millisecond
+	dead := &models.Webhook{URL: hanging.URL, Enabled: true}
+	live := &models.Webhook{URL: healthy.URL, Enabled: true}
+	for _, webhook := range []*models.Webhook{dead, live} {
+		if err := d.Create(webhook); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	const events = 5
+	for i := 0; i < events; i++ {
+		d.Handle(whatsapp.Event{Type: whatsapp.EventConnection, Data: &whatsapp.ConnectionEvent{State: "connected"}})
+	}
+
+	start := time.Now()
+	d.deliverDue(context.Background())
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("batch took %v; the hanging endpoint was waited on for every event", elapsed)
+	}
+	if hangingCalls != 1 || healthyCalls != events {
+		t.Errorf("hanging endpoint got %d requests, healthy one %d; want 1 and %d", hangingCalls, healthyCalls, events)
+	}
+
+	// The rest of the dead webhook's queue waits for its retry
+	d.deliverDue(context.Background())
+	if hangingCalls != 1 {
+		t.Errorf("hanging endpoint retried before its backoff expired (%d requests)", hangingCalls)
+	}
+	pending, err := d.Deliveries(dead.ID, models.DeliveryPending, 10)
+	if err != nil || len(pending) != events {
+		t.Fatalf("pending deliveries = %d, %v; want %d", len(pending), err, events)
+	}
+	for _, delivery := range pending {
+		if time.Until(delivery.NextAttemptAt) < baseRetryDelay-time.Second {
+			t.Errorf("delivery %d is due at %v, before the retry", delivery.ID, delivery.NextAttemptAt)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if retryDelay(1) != baseRetryDelay || retryDelay(3) != 4*baseRetryDelay {
+		t.Errorf("unexpected backoff: %v, %v", retryDelay(1), retryDelay(3))
+	}
+	if retryDelay(maxAttempts*2) != maxRetryDelay {
+		t.Errorf("backoff not capped: %v", retryDelay(maxAttempts*2))
+	}
+}
+
+func TestCreateRejectsInvalidWebhooks(t *testing.T) {
+	d, _ := newTestDispatcher(t)
+	for _, webhook := range []*models.Webhook{
+		{URL: "ftp://example.com/hook"},
+		{URL: "/relative"},
+		{URL: "https://example.com/hook", EventTypes: []string{"typing"}},
+	} {
+		if err := d.Create(webhook); err == nil {
+			t.Errorf("expected %+v to be rejected", webhook)
+		}
+	}
+}
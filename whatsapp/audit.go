@@ -0,0 +1,95 @@
+package whatsapp
+
+import (
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/models"
+)
+
+// SetAuditLog makes the client record queued, blocked, sent and failed
+// messages, bot replies and admin chat commands. It must be called before
+// connecting.
+func (c *Client) SetAuditLog(record audit.Recorder) {
+	c.audit = record
+}
+
+// recordAudit appends an entry to the audit log, if there is one
+func (c *Client) recordAudit(entry *models.AuditEntry) {
+	if c.audit == nil {
+		return
+	}
+	if entry.ActorType == "" {
+		entry.ActorType = models.ActorSystem
+	}
+	c.audit(entry)
+}
+
+// auditOutbox records what happened to an outbox message
+func (c *Client) auditOutbox(action string, m *models.OutboxMessage, decision string, err error) {
+	entry := &models.AuditEntry{
+		Action:    action,
+		Tool:      "outbox",
+		Recipient: m.Recipient,
+		MessageID: m.MessageID,
+		OutboxID:  m.ID,
+		Decision:  decision,
+		Details:   map[string]string{"kind": m.Kind},
+	}
+	if m.IdempotencyKey != "" {
+		entry.Details["idempotency_key"] = m.IdempotencyKey
+	}
+	if err != nil {
+		entry.Status, entry.Error = models.AuditError, err.Error()
+	}
+	c.recordAudit(entry)
+}
+
+// auditBlocked records a message refused by the send policy or rate limits
+func (c *Client) auditBlocked(m *models.OutboxMessage, decision string, err error) {
+	c.recordAudit(&models.AuditEntry{
+		Action:    "message.blocked",
+		Tool:      "outbox",
+		Recipient: m.Recipient,
+		Decision:  decision,
+		Status:    models.AuditDenied,
+		Error:     err.Error(),
+		Details:   map[string]string{"kind": m.Kind},
+	})
+}
+
+// auditBotReply records a reply generated by the LlamaStack bot, with the
+// tools it called. Tool arguments and the reply itself are not recorded.
+func (c *Client) auditBotReply(chatJID, api, model string, toolCalls []string, err error, details map[string]string) {
+	entry := &models.AuditEntry{
+		ActorType: models.ActorBot,
+		Action:    "bot.reply",
+		Tool:      api,
+		Recipient: chatJID,
+		Model:     model,
+		ToolCalls: toolCalls,
+		Details:   details,
+	}
+	if c.replyDrafter != nil {
+		if entry.Details == nil {
+			entry.Details = map[string]string{}
+		}
+		entry.Details["drafted"] = "true"
+	}
+	if err != nil {
+		entry.Status, entry.Error = models.AuditError, err.Error()
+	}
+	c.recordAudit(entry)
+}
+
+// toolCallName names a tool called through the Responses API, such as
+// "github.search_issues" for an MCP tool
+func toolCallName(kind, serverLabel, name, callError string) string {
+	if name == "" {
+		name = kind
+	} else if serverLabel != "" {
+		name = serverLabel + "." + name
+	}
+	if callError != "" {
+		name += " (failed)"
+	}
+	return name
+}
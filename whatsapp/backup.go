@@ -0,0 +1,73 @@
+package whatsapp
+
+import (
+	"errors"
+	"log"
+
+	"go.mau.fi/whatsmeow/store"
+)
+
+// ErrClientConnected is returned when an operation requires the WhatsApp
+// client to be disconnected first
+var ErrClientConnected = errors.New("whatsapp client is connected")
+
+// ErrRestoreInProgress is returned when connecting, pairing or restoring while
+// a backup is being restored
+var ErrRestoreInProgress = errors.New("a backup restore is in progress")
+
+// BeginRestore stops connection attempts while a backup is restored over the
+// state files. It refuses while connected, connecting or pairing. The
+// session store is shared by every account, so every client has to be held
+// before restoring.
+func (c *Client) BeginRestore() error {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	if c.conn.restoring {
+		return ErrRestoreInProgress
+	}
+	if c.IsConnected() || c.conn.state.State == StateConnecting || c.pairingActive() {
+		return ErrClientConnected
+	}
+	c.conn.restoring = true
+	return nil
+}
+
+// EndRestore allows connection attempts again, and reconnects if the client
+// has a session
+func (c *Client) EndRestore() {
+	c.conn.mu.Lock()
+	c.conn.restoring = false
+	c.conn.mu.Unlock()
+	if c.HasSession() && c.ConnectionState().State != StateLoggedOut {
+		c.requestReconnect()
+	}
+}
+
+// restoreActive reports whether a backup is being restored
+func (c *Client) restoreActive() bool {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	return c.conn.restoring
+}
+
+// LoadRestoredDevice replaces the device with one loaded from the restored
+// session store, or with a new unpaired device. whatsmeow keeps the device
+// keys in memory, so reconnecting with the old device would use the keys
+// from before the restore and write them back over the restored ones. It
+// must be called between BeginRestore and EndRestore.
+func (c *Client) LoadRestoredDevice(device *store.Device) {
+	client := newWhatsmeowClient(device)
+	handlerID := client.AddEventHandler(c.eventHandler)
+	c.clientMu.Lock()
+	old, oldHandlerID := c.client, c.eventHandlerID
+	c.client, c.deviceStore, c.eventHandlerID = client, device, handlerID
+	c.clientMu.Unlock()
+	// Outside the lock, as whatsmeow holds its handler lock while our
+	// handler runs and reads the client
+	old.RemoveEventHandler(oldHandlerID)
+	if device.ID != nil {
+		log.Printf("🔄 Loaded device %s from the restored session store", device.ID)
+	} else {
+		c.setConnectionState(StateLoggedOut, "no device in the restored backup", nil)
+	}
+}
@@ -0,0 +1,67 @@
+package whatsapp
+
+import (
+	"errors"
+	"testing"
+
+	"go.mau.fi/whatsmeow/store"
+)
+
+func TestRestoreStopsConnectionAttempts(t *testing.T) {
+	c := &Client{
+		client:  newWhatsmeowClient(&store.Device{}),
+		conn:    newConnectionSupervisor(),
+		pairing: &pairingSession{},
+	}
+
+	if err := c.BeginRestore(); err != nil {
+		t.Fatalf("BeginRestore: %v", err)
+	}
+	if err := c.BeginRestore(); !errors.Is(err, ErrRestoreInProgress) {
+		t.Errorf("second BeginRestore = %v, want ErrRestoreInProgress", err)
+	}
+	if c.startConnecting(nil) {
+		t.Error("a connection attempt started during the restore")
+	}
+	if err := c.StartPairing(); !errors.Is(err, ErrRestoreInProgress) {
+		t.Errorf("StartPairing = %v, want ErrRestoreInProgress", err)
+	}
+	if c.pairingActive() {
+		t.Error("pairing was left active")
+	}
+	c.EndRestore()
+
+	// A connection attempt that started first keeps the restore out
+	if !c.startConnecting(nil) {
+		t.Fatal("connection attempt refused after the restore")
+	}
+	if err := c.BeginRestore(); !errors.Is(err, ErrClientConnected) {
+		t.Errorf("BeginRestore while connecting = %v, want ErrClientConnected", err)
+	}
+}
+
+func TestLoadRestoredDeviceWhileClientInUse(t *testing.T) {
+	c := &Client{
+		client:  newWhatsmeowClient(&store.Device{}),
+		conn:    newConnectionSupervisor(),
+		pairing: &pairingSession{},
+	}
+
+	// Workers and handlers keep using the client while it is replaced; run
+	// with -race to check the swap
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			c.IsConnected()
+			c.HasSession()
+		}
+	}()
+	device := &store.Device{}
+	c.LoadRestoredDevice(device)
+	<-done
+
+	if c.wa().Store != device {
+		t.Error("the restored device was not loaded")
+	}
+}
@@ -0,0 +1,83 @@
+package whatsapp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-go-mcp/bot"
+	"whatsapp-go-mcp/models"
+)
+
+// Router returns the router incoming messages are dispatched to once stored.
+// Handlers can be added to it before connecting.
+func (c *Client) Router() *bot.Router {
+	return c.router
+}
+
+// newRouter creates the router with the built-in commands, the greeting, the
+// voice pipeline and LlamaStack as the fallback for text messages
+func (c *Client) newRouter() *bot.Router {
+	r := bot.NewRouter(c.SendMessage)
+	r.Use(bot.Recover, bot.IgnoreFromMe, bot.Logging)
+
+	r.Command("help", "Show this help", func(ctx *bot.Context) error {
+		return ctx.Reply(ctx.Router().Help(ctx.Message, ctx.IsGroup()))
+	})
+	r.Command("ping", "Test connection", func(ctx *bot.Context) error {
+		return ctx.Reply("Pong! 🏓")
+	})
+	r.Command("time", "Get current time", func(ctx *bot.Context) error {
+		return ctx.Reply(fmt.Sprintf("Current time: %s", time.Now().Format("2006-01-02 15:04:05")))
+	})
+	r.Keyword([]string{"hello", "hi"}, func(ctx *bot.Context) error {
+		return ctx.Reply("Hello! 👋 How can I help you?")
+	})
+
+	r.Fallback(func(ctx *bot.Context) error {
+		log.Printf("🎤 Voice message received - processing with AI agent")
+		c.processVoiceMessage(ctx.Event, ctx.Event.Message.GetAudioMessage())
+		return nil
+	}, bot.OfTypes("voice"))
+	r.Fallback(func(ctx *bot.Context) error {
+		c.processWithLlamaStack(ctx.Message.ChatJID, ctx.Message.Content)
+		return nil
+	})
+	return r
+}
+
+// route dispatches a stored incoming message. Staff replies pause the bot in
+// their chat, and nothing is answered in chats handed over to staff or caught
+// in a loop with another bot. Otherwise requests for a human are escalated, then the auto-reply rules run and, if
+// no rule matched, the away message is sent when closed and the message is
+// passed to the bot handlers.
+func (c *Client) route(evt *events.Message, message *models.Message) {
+	ctx := context.Background()
+	if c.handleAdminChat(message) {
+		return
+	}
+	if message.IsFromMe {
+		c.pauseForStaffReply(message)
+	} else if !c.botActiveIn(message.ChatJID) {
+		log.Printf("🙋 Bot is off in %s, leaving message %s to staff", message.ChatJID, message.MessageID)
+		return
+	} else if !evt.Info.IsGroup && c.detectBotLoop(message) {
+		return
+	} else if c.isEscalationRequest(message) {
+		c.escalateToHuman(message)
+		return
+	}
+
+	if c.rules.Evaluate(ctx, message) {
+		return
+	}
+	if !evt.Info.IsGroup {
+		c.sendAwayMessage(message)
+	}
+	if !c.router.Dispatch(ctx, message, evt) {
+		log.Printf("💬 No bot handler for %s message %s", message.MediaType, message.MessageID)
+	}
+}
@@ -2,21 +2,24 @@ package whatsapp
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"mime"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	llamastack "github.com/llamastack/llama-stack-client-go"
 	"github.com/llamastack/llama-stack-client-go/option"
 	"github.com/llamastack/llama-stack-client-go/packages/param"
-	"github.com/mdp/qrterminal/v3"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/store"
@@ -25,43 +28,96 @@ import (
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
 
+	"whatsapp-go-mcp/audit"
+	"whatsapp-go-mcp/bot"
+	"whatsapp-go-mcp/config"
+	"whatsapp-go-mcp/hours"
 	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/policy"
+	"whatsapp-go-mcp/ratelimit"
+	"whatsapp-go-mcp/rules"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // Client wraps the WhatsApp client with additional functionality
 type Client struct {
-	client              *whatsmeow.Client
+	client              *whatsmeow.Client // replaced by LoadRestoredDevice; read it through wa
 	db                  *models.Database
 	deviceStore         *store.Device
 	eventHandlerID      uint32
+	clientMu            sync.RWMutex // guards client, deviceStore and eventHandlerID
+	dbPath              string
+	messagesDBPath      string
 	mediaDir            string
-	ttsUrl              string
-	sttUrl              string
+	cfg                 *config.Config
+	enc                 *models.Encryptor
 	conversationHistory map[string][]map[string]interface{} // Per-chat conversation history for Responses API
+	historyMu           sync.Mutex
+	subscribers         map[int]func(Event)
+	subscribersMu       sync.RWMutex
+	nextSubscriberID    int
+	router              *bot.Router
+	rules               *rules.Engine
+	hours               *hours.Policy
+	handoff             HandoffSettings
+	escalationPattern   *regexp.Regexp
+	outboxWake          chan struct{}
+	conn                *connectionSupervisor
+	pairing             *pairingSession
+	recipientLimiter    *ratelimit.Limiter // nil until SetSendLimits
+	globalLimiter       *ratelimit.Limiter
+	loopLimiter         *ratelimit.Limiter
+	sendPolicy          *policy.Rules // nil allows every recipient
+	replyDrafter        ReplyDrafter  // nil sends bot replies straight away
+	adminChat           types.JID
+	adminCommands       AdminCommandHandler
+	audit               audit.Recorder // nil records nothing
+}
+
+// NewClient creates a new WhatsApp client for the first device in the session
+// store at cfg.DBPath
+func NewClient(cfg *config.Config) (*Client, error) {
+	container, _, err := OpenDeviceStore(cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	deviceStore, err := container.GetFirstDevice(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return NewAccountClient(deviceStore, cfg.DBPath, cfg.DBPath+"_messages.db", cfg.MediaDir, cfg)
 }
 
-// NewClient creates a new WhatsApp client
-func NewClient(dbPath, mediaDir, ttsUrl, sttUrl string) (*Client, error) {
-	// Create device store
-	ctx := context.Background()
-	logger := waLog.Noop
-	container, err := sqlstore.New(ctx, "sqlite3", "file:"+dbPath+"?_foreign_keys=on", logger)
+// OpenDeviceStore opens the session store holding the paired devices. The
+// returned database handle is shared with the store and can hold other tables
+// that refer to the devices.
+func OpenDeviceStore(dbPath string) (*sqlstore.Container, *sql.DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_foreign_keys=on")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create device store: %w", err)
+		return nil, nil, fmt.Errorf("failed to open device store: %w", err)
+	}
+	container := sqlstore.NewWithDB(db, "sqlite3", waLog.Noop)
+	if err := container.Upgrade(context.Background()); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to create device store: %w", err)
 	}
+	return container, db, nil
+}
 
-	deviceStore, err := container.GetFirstDevice(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get device: %w", err)
+// NewAccountClient creates a WhatsApp client for a device of the session store
+// at sessionDBPath, with its own message database and media directory. The
+// voice services and the LlamaStack bot are set up from cfg; nil uses the
+// defaults.
+func NewAccountClient(deviceStore *store.Device, sessionDBPath, messagesDBPath, mediaDir string, cfg *config.Config) (*Client, error) {
+	if cfg == nil {
+		cfg = config.Defaults()
 	}
 
-	// Create WhatsApp client
-	client := whatsmeow.NewClient(deviceStore, nil)
+	client := newWhatsmeowClient(deviceStore)
 
 	// Create database
-	database, err := models.NewDatabase(dbPath + "_messages.db")
+	database, err := models.NewDatabase(messagesDBPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create database: %w", err)
 	}
@@ -78,10 +134,19 @@ func NewClient(dbPath, mediaDir, ttsUrl, sttUrl string) (*Client, error) {
 		client:              client,
 		db:                  database,
 		deviceStore:         deviceStore,
+		dbPath:              sessionDBPath,
+		messagesDBPath:      messagesDBPath,
 		mediaDir:            mediaDir,
-		ttsUrl:              ttsUrl,
-		sttUrl:              sttUrl,
+		cfg:                 cfg,
 		conversationHistory: conversationHistory,
+		outboxWake:          make(chan struct{}, 1),
+		conn:                newConnectionSupervisor(),
+		pairing:             &pairingSession{},
+	}
+	c.router = c.newRouter()
+	c.SetHandoff(HandoffSettings{PauseDuration: 30 * time.Minute, Keywords: DefaultHandoffKeywords})
+	if c.rules, err = rules.NewEngine(database, c); err != nil {
+		return nil, err
 	}
 
 	// Add event handler
@@ -90,94 +155,133 @@ func NewClient(dbPath, mediaDir, ttsUrl, sttUrl string) (*Client, error) {
 	return c, nil
 }
 
-// Connect connects to WhatsApp
+// newWhatsmeowClient creates the whatsmeow client for a device. Reconnection
+// is handled by Supervise.
+func newWhatsmeowClient(device *store.Device) *whatsmeow.Client {
+	client := whatsmeow.NewClient(device, nil)
+	client.EnableAutoReconnect = false
+	return client
+}
+
+// Connect connects to WhatsApp with the stored session, or starts pairing in
+// the background if there is none
 func (c *Client) Connect(ctx context.Context) error {
 	log.Printf("🔌 Attempting to connect to WhatsApp...")
 
-	if c.client.Store.ID == nil {
-		// No ID stored, new login
-		log.Printf("📱 No stored session found, initiating new login...")
-		qrChan, _ := c.client.GetQRChannel(ctx)
-		err := c.client.Connect()
-		if err != nil {
-			log.Printf("❌ Failed to connect: %v", err)
-			return fmt.Errorf("failed to connect: %w", err)
-		}
-
-		for evt := range qrChan {
-			if evt.Event == "code" {
-				// Display QR code
-				fmt.Println("\n📱 WhatsApp Registration")
-				fmt.Println("Scan the QR code below with WhatsApp:")
-				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
-
-				// Display PIN instructions
-				fmt.Println("\n🔑 Or use Pairing Code (PIN):")
-				fmt.Println("   WhatsApp > Settings > Linked Devices > Link a Device")
-				fmt.Println("   > Link with Phone Number Instead")
-				fmt.Println("   (The PIN will appear on your phone)")
-
-				// Display PIN if detected in event
-				if len(evt.Code) == 8 && isNumeric(evt.Code) {
-					fmt.Println("\n🔑 Pairing Code:", evt.Code)
-				}
-				fmt.Println()
-			} else if evt.Event == "timeout" {
-				fmt.Println("\n⏱️ QR Code expired. Waiting for new code...")
-				fmt.Println("Or use PIN method: WhatsApp > Settings > Linked Devices > Link a Device > Link with Phone Number Instead")
-				log.Printf("⚠️ QR code expired, waiting for new code or pairing code...")
-			} else if evt.Event == "success" {
-				fmt.Println("\n✅ Successfully logged in!")
-				log.Printf("✅ WhatsApp login successful")
-				break
-			} else {
-				log.Printf("📱 QR Channel Event: %s", evt.Event)
-				// Display PIN if detected
-				if evt.Code != "" && len(evt.Code) == 8 && isNumeric(evt.Code) {
-					fmt.Println("\n🔑 Pairing Code:", evt.Code)
-					fmt.Println("Enter this in WhatsApp: Settings > Linked Devices > Link a Device > Link with Phone Number Instead")
-				}
-			}
-		}
-	} else {
-		// Already logged in, just connect
-		log.Printf("🔄 Using stored session, connecting...")
-		err := c.client.Connect()
-		if err != nil {
-			log.Printf("❌ Failed to connect: %v", err)
-			return fmt.Errorf("failed to connect: %w", err)
-		}
-		log.Printf("✅ WhatsApp connected successfully")
+	if c.wa().Store.ID == nil {
+		// No ID stored, new login. Pairing runs in the background so the HTTP
+		// pairing endpoints can serve the QR code.
+		return c.StartPairing()
 	}
 
+	// Already logged in, just connect
+	log.Printf("🔄 Using stored session, connecting...")
+	if !c.startConnecting(nil) {
+		return ErrRestoreInProgress
+	}
+	if err := c.wa().Connect(); err != nil {
+		log.Printf("❌ Failed to connect: %v", err)
+		c.setConnectionState(StateDisconnected, err.Error(), nil)
+		c.requestReconnect()
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	log.Printf("✅ WhatsApp connected successfully")
 	return nil
 }
 
 // Disconnect disconnects from WhatsApp
 func (c *Client) Disconnect() {
-	c.client.Disconnect()
+	c.wa().Disconnect()
 }
 
 // IsConnected checks if the WhatsApp client is connected
 func (c *Client) IsConnected() bool {
-	return c.client.IsConnected()
+	return c.wa().IsConnected()
 }
 
-// EnsureConnected ensures the client is connected, reconnecting if necessary
-func (c *Client) EnsureConnected(ctx context.Context) error {
-	if !c.IsConnected() {
-		log.Printf("⚠️ WhatsApp client not connected, attempting to reconnect...")
-		return c.Connect(ctx)
+// IsLoggedIn checks if the WhatsApp client is connected and authenticated
+func (c *Client) IsLoggedIn() bool {
+	return c.wa().IsLoggedIn()
+}
+
+// JID returns the JID the device is paired with, or an empty string if it is
+// not paired
+func (c *Client) JID() string {
+	if id := c.wa().Store.ID; id != nil {
+		return id.ToNonAD().String()
+	}
+	return ""
+}
+
+// Unlink removes the device from the account, as if it had been removed from
+// Linked Devices on the phone, and deletes its session
+func (c *Client) Unlink(ctx context.Context) error {
+	if c.IsLoggedIn() {
+		return c.wa().Logout(ctx)
+	}
+	c.wa().Disconnect()
+	if c.HasSession() {
+		return c.wa().Store.Delete(ctx)
 	}
 	return nil
 }
 
+// EnsureConnected ensures the client is connected. If it is not, the
+// supervisor is asked to reconnect and EnsureConnected waits a little for it.
+// It never starts pairing: a logged out session returns ErrNotLoggedIn.
+func (c *Client) EnsureConnected(ctx context.Context) error {
+	if c.IsConnected() {
+		return nil
+	}
+	if !c.HasSession() {
+		return ErrNotLoggedIn
+	}
+
+	changes, stop := c.WatchConnection()
+	defer stop()
+	log.Printf("⚠️ WhatsApp client not connected, waiting for reconnection...")
+	c.requestReconnect()
+
+	ctx, cancel := context.WithTimeout(ctx, ensureConnectedTimeout)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ErrNotConnected
+		case s := <-changes:
+			switch s.State {
+			case StateConnected:
+				return nil
+			case StateLoggedOut:
+				return ErrNotLoggedIn
+			case StateStreamReplaced:
+				return ErrNotConnected
+			}
+		}
+	}
+}
+
 // Close closes the client and database
 func (c *Client) Close() error {
-	c.client.RemoveEventHandler(c.eventHandlerID)
+	c.clientMu.RLock()
+	client, handlerID := c.client, c.eventHandlerID
+	c.clientMu.RUnlock()
+	client.RemoveEventHandler(handlerID)
 	return c.db.Close()
 }
 
+// wa returns the whatsmeow client, which a backup restore may replace
+func (c *Client) wa() *whatsmeow.Client {
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+	return c.client
+}
+
+// Database returns the message database used by the client
+func (c *Client) Database() *models.Database {
+	return c.db
+}
+
 // eventHandler handles WhatsApp events
 func (c *Client) eventHandler(evt interface{}) {
 	switch v := evt.(type) {
@@ -190,9 +294,16 @@ func (c *Client) eventHandler(evt interface{}) {
 	case *events.Presence:
 		log.Printf("🔔 Processing presence event")
 		c.handlePresence(v)
+	case *events.Connected, *events.Disconnected, *events.KeepAliveTimeout, *events.KeepAliveRestored,
+		*events.LoggedOut, *events.StreamReplaced, *events.TemporaryBan, *events.ClientOutdated, *events.ConnectFailure:
+		log.Printf("🔔 Processing connection event: %T", evt)
+		c.handleConnectionEvent(evt)
 	default:
 		log.Printf("🔔 Processing unknown event type: %T", evt)
 	}
+
+	// Messages are published once stored, everything else is published here
+	c.publishWhatsAppEvent(evt)
 }
 
 // handleMessage processes incoming messages and routes them to appropriate handlers
@@ -243,7 +354,7 @@ func (c *Client) handleTextMessage(evt *events.Message, content string) {
 		MessageID: info.ID,
 	}
 
-	if err := c.db.StoreMessage(message); err != nil {
+	if err := c.storeMessage(message); err != nil {
 		log.Printf("❌ Failed to store text message: %v", err)
 	} else {
 		log.Printf("✅ Text message stored successfully")
@@ -252,8 +363,8 @@ func (c *Client) handleTextMessage(evt *events.Message, content string) {
 	// Update chat info
 	c.updateChatInfo(info.Chat, content, info.Timestamp)
 
-	// Process text message for commands or auto-replies
-	c.processTextMessage(evt, content)
+	// Hand the message to the bot handlers
+	c.route(evt, message)
 }
 
 // handleAudioMessage processes audio/voice messages
@@ -285,7 +396,7 @@ func (c *Client) handleAudioMessage(evt *events.Message, audioMsg *waE2E.AudioMe
 		MessageID: info.ID,
 	}
 
-	if err := c.db.StoreMessage(message); err != nil {
+	if err := c.storeMessage(message); err != nil {
 		log.Printf("❌ Failed to store audio message: %v", err)
 	} else {
 		log.Printf("✅ Audio message stored successfully")
@@ -294,8 +405,8 @@ func (c *Client) handleAudioMessage(evt *events.Message, audioMsg *waE2E.AudioMe
 	// Update chat info
 	c.updateChatInfo(info.Chat, fmt.Sprintf("[%s Message]", strings.ToUpper(messageType[:1])+messageType[1:]), info.Timestamp)
 
-	// Process audio/voice message
-	c.processAudioMessage(evt, audioMsg, messageType)
+	// Hand the message to the bot handlers
+	c.route(evt, message)
 }
 
 // handleImageMessage processes image messages
@@ -317,7 +428,7 @@ func (c *Client) handleImageMessage(evt *events.Message, imageMsg *waE2E.ImageMe
 		MessageID: info.ID,
 	}
 
-	if err := c.db.StoreMessage(message); err != nil {
+	if err := c.storeMessage(message); err != nil {
 		log.Printf("❌ Failed to store image message: %v", err)
 	} else {
 		log.Printf("✅ Image message stored successfully")
@@ -326,8 +437,8 @@ func (c *Client) handleImageMessage(evt *events.Message, imageMsg *waE2E.ImageMe
 	// Update chat info
 	c.updateChatInfo(info.Chat, caption, info.Timestamp)
 
-	// TODO: Add custom image processing logic here
-	// e.g., OCR, image analysis, etc.
+	// Hand the message to the bot handlers
+	c.route(evt, message)
 }
 
 // handleVideoMessage processes video messages
@@ -349,7 +460,7 @@ func (c *Client) handleVideoMessage(evt *events.Message, videoMsg *waE2E.VideoMe
 		MessageID: info.ID,
 	}
 
-	if err := c.db.StoreMessage(message); err != nil {
+	if err := c.storeMessage(message); err != nil {
 		log.Printf("❌ Failed to store video message: %v", err)
 	} else {
 		log.Printf("✅ Video message stored successfully")
@@ -358,8 +469,8 @@ func (c *Client) handleVideoMessage(evt *events.Message, videoMsg *waE2E.VideoMe
 	// Update chat info
 	c.updateChatInfo(info.Chat, caption, info.Timestamp)
 
-	// TODO: Add custom video processing logic here
-	// e.g., video analysis, thumbnail generation, etc.
+	// Hand the message to the bot handlers
+	c.route(evt, message)
 }
 
 // handleDocumentMessage processes document messages
@@ -382,7 +493,7 @@ func (c *Client) handleDocumentMessage(evt *events.Message, docMsg *waE2E.Docume
 		MessageID: info.ID,
 	}
 
-	if err := c.db.StoreMessage(message); err != nil {
+	if err := c.storeMessage(message); err != nil {
 		log.Printf("❌ Failed to store document message: %v", err)
 	} else {
 		log.Printf("✅ Document message stored successfully")
@@ -391,8 +502,8 @@ func (c *Client) handleDocumentMessage(evt *events.Message, docMsg *waE2E.Docume
 	// Update chat info
 	c.updateChatInfo(info.Chat, caption, info.Timestamp)
 
-	// TODO: Add custom document processing logic here
-	// e.g., file type detection, content extraction, etc.
+	// Hand the message to the bot handlers
+	c.route(evt, message)
 }
 
 // handleUnknownMessage processes unknown message types
@@ -413,7 +524,7 @@ func (c *Client) handleUnknownMessage(evt *events.Message) {
 		MessageID: info.ID,
 	}
 
-	if err := c.db.StoreMessage(message); err != nil {
+	if err := c.storeMessage(message); err != nil {
 		log.Printf("❌ Failed to store unknown message: %v", err)
 	} else {
 		log.Printf("✅ Unknown message stored successfully")
@@ -421,6 +532,9 @@ func (c *Client) handleUnknownMessage(evt *events.Message) {
 
 	// Update chat info
 	c.updateChatInfo(info.Chat, "[Unknown Message Type]", info.Timestamp)
+
+	// Hand the message to the bot handlers
+	c.route(evt, message)
 }
 
 // handleReceipt processes message receipts
@@ -454,7 +568,7 @@ func (c *Client) updateChatInfo(chatJID types.JID, lastMessage string, timestamp
 	} else {
 		// For individual chats, try to get contact name
 		ctx := context.Background()
-		contact, err := c.client.Store.Contacts.GetContact(ctx, chatJID)
+		contact, err := c.wa().Store.Contacts.GetContact(ctx, chatJID)
 		if err == nil && contact.FullName != "" {
 			chat.Name = contact.FullName
 		} else {
@@ -475,7 +589,7 @@ func (c *Client) SearchContacts(query string) ([]*models.Contact, error) {
 
 	// Also search in WhatsApp client's contact list
 	ctx := context.Background()
-	allContacts, err := c.client.Store.Contacts.GetAllContacts(ctx)
+	allContacts, err := c.wa().Store.Contacts.GetAllContacts(ctx)
 	if err != nil {
 		return dbContacts, nil // Return database results if client search fails
 	}
@@ -576,35 +690,32 @@ func (c *Client) GetMessageContext(messageID string, contextSize int) ([]*models
 	return context, nil
 }
 
-// SendMessage sends a WhatsApp message to a specified phone number or group JID
+// SendMessage queues a WhatsApp message to a phone number or group JID and
+// sends it right away if connected. Messages that cannot be sent now are
+// retried by the outbox worker.
 func (c *Client) SendMessage(recipient string, message string) error {
-	// Ensure client is connected before sending
-	ctx := context.Background()
-	if err := c.EnsureConnected(ctx); err != nil {
-		return fmt.Errorf("failed to ensure connection: %w", err)
-	}
-
-	log.Printf("📤 Sending message to %s: %s", recipient, message)
+	_, err := c.QueueText(recipient, message, "")
+	return err
+}
 
-	recipientJID, err := types.ParseJID(recipient)
-	if err != nil {
-		return fmt.Errorf("invalid recipient JID: %w", err)
-	}
+// sendText sends a text message and stores it, returning its WhatsApp message ID
+func (c *Client) sendText(ctx context.Context, recipientJID types.JID, message string) (string, error) {
+	log.Printf("📤 Sending message to %s: %s", recipientJID, message)
 
 	msg := &waE2E.Message{
 		Conversation: &message,
 	}
 
-	resp, err := c.client.SendMessage(ctx, recipientJID, msg)
+	resp, err := c.wa().SendMessage(ctx, recipientJID, msg)
 	if err != nil {
 		log.Printf("❌ Failed to send message: %v", err)
-		return fmt.Errorf("failed to send message: %w", err)
+		return "", fmt.Errorf("failed to send message: %w", err)
 	}
 
 	// Store the sent message in the database
 	sentMessage := &models.Message{
 		Time:      time.Now(),
-		Sender:    c.client.Store.ID.String(), // Our own JID
+		Sender:    c.wa().Store.ID.String(), // Our own JID
 		Content:   message,
 		IsFromMe:  true,
 		MediaType: "text",
@@ -613,7 +724,7 @@ func (c *Client) SendMessage(recipient string, message string) error {
 		MessageID: resp.ID, // Use the actual message ID from WhatsApp response
 	}
 
-	if err := c.db.StoreMessage(sentMessage); err != nil {
+	if err := c.storeMessage(sentMessage); err != nil {
 		log.Printf("⚠️ Failed to store sent message in database: %v", err)
 	} else {
 		log.Printf("✅ Sent message stored in database")
@@ -622,145 +733,168 @@ func (c *Client) SendMessage(recipient string, message string) error {
 	// Update chat info
 	c.updateChatInfo(recipientJID, message, time.Now())
 
-	log.Printf("✅ Message sent successfully to %s", recipient)
-	return nil
+	log.Printf("✅ Message sent successfully to %s", recipientJID)
+	return resp.ID, nil
 }
 
-// SendFile sends a file to a specified recipient
+// SendFile queues an image, video, audio file or document with a caption and
+// sends it right away if connected. Messages that cannot be sent now are
+// retried by the outbox worker.
 func (c *Client) SendFile(recipient string, filePath string, caption string) error {
-	// Ensure client is connected before sending
-	ctx := context.Background()
-	if err := c.EnsureConnected(ctx); err != nil {
-		return fmt.Errorf("failed to ensure connection: %w", err)
-	}
+	_, err := c.QueueFile(recipient, filePath, caption, "")
+	return err
+}
 
-	log.Printf("📤 Sending file to %s: %s (caption: %s)", recipient, filePath, caption)
+// sendFile uploads and sends a file and stores it, returning its WhatsApp
+// message ID. The media type is chosen from the file extension.
+func (c *Client) sendFile(ctx context.Context, recipientJID types.JID, filePath, caption string) (string, error) {
+	log.Printf("📤 Sending file to %s: %s (caption: %s)", recipientJID, originalFileName(filePath), caption)
 
-	recipientJID, err := types.ParseJID(recipient)
+	upload, err := c.readFileUpload(filePath)
 	if err != nil {
-		return fmt.Errorf("invalid recipient JID: %w", err)
+		return "", err
 	}
+	fileData, fileName, mimeType, mediaType := upload.data, upload.fileName, upload.mimeType, upload.mediaType
 
-	// Read file
-	file, err := os.Open(filePath)
+	// Upload media to WhatsApp servers; failed uploads are retried by the outbox
+	uploaded, err := c.wa().Upload(ctx, fileData, upload.uploadType)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		log.Printf("❌ Failed to upload file: %v", err)
+		return "", fmt.Errorf("failed to upload file: %w", err)
 	}
-	defer file.Close()
 
-	// Get file info
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get file info: %w", err)
+	fileLength := uint64(len(fileData))
+	var msg *waE2E.Message
+	switch mediaType {
+	case "image":
+		msg = &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			Caption: &caption, Mimetype: &mimeType, FileLength: &fileLength,
+			URL: &uploaded.URL, DirectPath: &uploaded.DirectPath, MediaKey: uploaded.MediaKey,
+			FileSHA256: uploaded.FileSHA256, FileEncSHA256: uploaded.FileEncSHA256,
+		}}
+	case "video":
+		msg = &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+			Caption: &caption, Mimetype: &mimeType, FileLength: &fileLength,
+			URL: &uploaded.URL, DirectPath: &uploaded.DirectPath, MediaKey: uploaded.MediaKey,
+			FileSHA256: uploaded.FileSHA256, FileEncSHA256: uploaded.FileEncSHA256,
+		}}
+	case "audio":
+		msg = &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			Mimetype: &mimeType, FileLength: &fileLength,
+			URL: &uploaded.URL, DirectPath: &uploaded.DirectPath, MediaKey: uploaded.MediaKey,
+			FileSHA256: uploaded.FileSHA256, FileEncSHA256: uploaded.FileEncSHA256,
+		}}
+	default:
+		msg = &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			Caption: &caption, Mimetype: &mimeType, FileName: &fileName, FileLength: &fileLength,
+			URL: &uploaded.URL, DirectPath: &uploaded.DirectPath, MediaKey: uploaded.MediaKey,
+			FileSHA256: uploaded.FileSHA256, FileEncSHA256: uploaded.FileEncSHA256,
+		}}
 	}
 
-	// Read file content - for now we'll skip the actual file upload
-	// In a real implementation, you would upload the file data
-	_, err = io.ReadAll(file)
+	resp, err := c.wa().SendMessage(ctx, recipientJID, msg)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		log.Printf("❌ Failed to send file: %v", err)
+		return "", fmt.Errorf("failed to send file: %w", err)
 	}
 
-	// Determine media type based on file extension
-	ext := strings.ToLower(filepath.Ext(filePath))
-	var mediaType string
-	var msg *waE2E.Message
+	// Store the sent file in the database
+	content := caption
+	if content == "" {
+		content = fmt.Sprintf("[%s]", fileName)
+	}
+	fileMessage := &models.Message{
+		Time:      time.Now(),
+		Sender:    c.wa().Store.ID.String(), // Our own JID
+		Content:   content,
+		IsFromMe:  true,
+		MediaType: mediaType,
+		Filename:  fileName,
+		ChatJID:   recipientJID.String(),
+		MessageID: resp.ID, // Use the actual message ID from WhatsApp response
+	}
 
-	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
-		mediaType = "image"
-		fileSizePtr := uint64(fileInfo.Size())
-		msg = &waE2E.Message{
-			ImageMessage: &waE2E.ImageMessage{
-				Caption:    &caption,
-				Mimetype:   &mediaType,
-				FileLength: &fileSizePtr,
-			},
-		}
-	case ".mp4", ".avi", ".mov", ".mkv":
-		mediaType = "video"
-		fileSizePtr := uint64(fileInfo.Size())
-		msg = &waE2E.Message{
-			VideoMessage: &waE2E.VideoMessage{
-				Caption:    &caption,
-				Mimetype:   &mediaType,
-				FileLength: &fileSizePtr,
-			},
-		}
-	case ".ogg", ".opus":
-		mediaType = "audio"
-		fileSizePtr := uint64(fileInfo.Size())
-		msg = &waE2E.Message{
-			AudioMessage: &waE2E.AudioMessage{
-				Mimetype:   &mediaType,
-				FileLength: &fileSizePtr,
-			},
-		}
-	default:
-		// Default to document
-		mediaType = "application/octet-stream"
-		fileName := fileInfo.Name()
-		fileSizePtr := uint64(fileInfo.Size())
-		msg = &waE2E.Message{
-			DocumentMessage: &waE2E.DocumentMessage{
-				Caption:    &caption,
-				Mimetype:   &mediaType,
-				FileName:   &fileName,
-				FileLength: &fileSizePtr,
-			},
-		}
+	if err := c.storeMessage(fileMessage); err != nil {
+		log.Printf("⚠️ Failed to store sent file in database: %v", err)
 	}
 
-	_, err = c.client.SendMessage(context.Background(), recipientJID, msg)
-	return err
-}
+	// Update chat info
+	c.updateChatInfo(recipientJID, content, time.Now())
 
-// SendAudioMessage sends an audio file as a WhatsApp voice message
-func (c *Client) SendAudioMessage(recipient string, filePath string) error {
-	// Ensure client is connected before sending
-	ctx := context.Background()
-	if err := c.EnsureConnected(ctx); err != nil {
-		return fmt.Errorf("failed to ensure connection: %w", err)
-	}
+	log.Printf("✅ File sent successfully to %s", recipientJID)
+	return resp.ID, nil
+}
 
-	log.Printf("📤 Sending audio message to %s: %s", recipient, filePath)
+// fileUpload is a file read for sending, with its media type chosen from the
+// file extension
+type fileUpload struct {
+	data       []byte
+	fileName   string
+	mimeType   string
+	mediaType  string // image, video, audio or document
+	uploadType whatsmeow.MediaType
+}
 
-	recipientJID, err := types.ParseJID(recipient)
+// readFileUpload reads a file to send. Files in the media directory may have
+// been encrypted at rest since they were queued, so they are decrypted first.
+func (c *Client) readFileUpload(filePath string) (*fileUpload, error) {
+	fileData, err := c.readMediaFile(filePath)
 	if err != nil {
-		return fmt.Errorf("invalid recipient JID: %w", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Read file
-	file, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+	upload := &fileUpload{data: fileData, fileName: originalFileName(filePath)}
+	ext := strings.ToLower(filepath.Ext(upload.fileName))
+	upload.mimeType = mime.TypeByExtension(ext)
+	if upload.mimeType == "" {
+		upload.mimeType = http.DetectContentType(fileData)
 	}
-	defer file.Close()
 
-	// Get file info
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get file info: %w", err)
+	// Determine media type based on file extension
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		upload.mediaType, upload.uploadType = "image", whatsmeow.MediaImage
+	case ".mp4", ".avi", ".mov", ".mkv":
+		upload.mediaType, upload.uploadType = "video", whatsmeow.MediaVideo
+	case ".ogg", ".opus":
+		upload.mediaType, upload.uploadType = "audio", whatsmeow.MediaAudio
+	default:
+		upload.mediaType, upload.uploadType = "document", whatsmeow.MediaDocument
 	}
+	return upload, nil
+}
 
-	// Read file content
-	fileData, err := io.ReadAll(file)
+// SendAudioMessage queues an audio file as a WhatsApp voice message and sends
+// it right away if connected. Messages that cannot be sent now are retried by
+// the outbox worker.
+func (c *Client) SendAudioMessage(recipient string, filePath string) error {
+	_, err := c.QueueAudio(recipient, filePath, "")
+	return err
+}
+
+// sendAudio uploads and sends a voice message and stores it, returning its
+// WhatsApp message ID
+func (c *Client) sendAudio(ctx context.Context, recipientJID types.JID, filePath string) (string, error) {
+	log.Printf("📤 Sending audio message to %s: %s", recipientJID, filePath)
+
+	// Read file, decrypting it if it was encrypted at rest
+	fileData, err := c.readMediaFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
-	log.Printf("📊 Audio file details - Size: %d bytes, Name: %s", fileInfo.Size(), fileInfo.Name())
+	log.Printf("📊 Audio file details - Size: %d bytes, Name: %s", len(fileData), filepath.Base(filePath))
 
 	// Determine MIME type based on file extension
 	mimeType := getAudioMimeType(filePath)
 	log.Printf("🎵 Detected MIME type: %s", mimeType)
 
 	// Get audio duration using ffprobe
-	duration, err := getAudioDuration(filePath)
+	duration, err := c.mediaAudioDuration(filePath)
 	if err != nil {
 		log.Printf("⚠️ Could not determine audio duration: %v", err)
 		// Estimate duration (rough estimate: assume 1 second per 16KB for opus)
-		estimatedDuration := float64(fileInfo.Size()) / 16000.0
+		estimatedDuration := float64(len(fileData)) / 16000.0
 		if estimatedDuration < 1 {
 			estimatedDuration = 1
 		}
@@ -770,32 +904,16 @@ func (c *Client) SendAudioMessage(recipient string, filePath string) error {
 		log.Printf("⏱️ Audio duration: %.2f seconds", duration)
 	}
 
-	// Upload media to WhatsApp servers with retry logic
-	var uploaded whatsmeow.UploadResponse
-	maxRetries := 3
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		log.Printf("🔄 Upload attempt %d/%d", attempt, maxRetries)
-
-		uploaded, err = c.client.Upload(ctx, fileData, whatsmeow.MediaAudio)
-		if err == nil {
-			log.Printf("✅ Audio file uploaded successfully, URL: %s", uploaded.URL)
-			break
-		}
-
-		log.Printf("❌ Upload attempt %d failed: %v", attempt, err)
-		if attempt < maxRetries {
-			log.Printf("⏳ Retrying in 2 seconds...")
-			time.Sleep(2 * time.Second)
-		}
-	}
-
+	// Upload media to WhatsApp servers; failed uploads are retried by the outbox
+	uploaded, err := c.wa().Upload(ctx, fileData, whatsmeow.MediaAudio)
 	if err != nil {
-		log.Printf("❌ Failed to upload audio file after %d attempts: %v", maxRetries, err)
-		return fmt.Errorf("failed to upload audio file after %d attempts: %w", maxRetries, err)
+		log.Printf("❌ Failed to upload audio file: %v", err)
+		return "", fmt.Errorf("failed to upload audio file: %w", err)
 	}
+	log.Printf("✅ Audio file uploaded successfully, URL: %s", uploaded.URL)
 
 	// Create audio message
-	fileSizePtr := uint64(fileInfo.Size())
+	fileSizePtr := uint64(len(fileData))
 	msg := &waE2E.Message{
 		AudioMessage: &waE2E.AudioMessage{
 			URL:               &uploaded.URL,
@@ -811,25 +929,25 @@ func (c *Client) SendAudioMessage(recipient string, filePath string) error {
 		},
 	}
 
-	resp, err := c.client.SendMessage(ctx, recipientJID, msg)
+	resp, err := c.wa().SendMessage(ctx, recipientJID, msg)
 	if err != nil {
 		log.Printf("❌ Failed to send audio message: %v", err)
-		return fmt.Errorf("failed to send audio message: %w", err)
+		return "", fmt.Errorf("failed to send audio message: %w", err)
 	}
 
 	// Store the sent audio message in the database
 	audioMessage := &models.Message{
 		Time:      time.Now(),
-		Sender:    c.client.Store.ID.String(), // Our own JID
-		Content:   "[Voice Message]",          // Placeholder content for audio messages
+		Sender:    c.wa().Store.ID.String(), // Our own JID
+		Content:   "[Voice Message]",        // Placeholder content for audio messages
 		IsFromMe:  true,
 		MediaType: "voice",
-		Filename:  filepath.Base(filePath),
+		Filename:  originalFileName(filePath),
 		ChatJID:   recipientJID.String(),
 		MessageID: resp.ID, // Use the actual message ID from WhatsApp response
 	}
 
-	if err := c.db.StoreMessage(audioMessage); err != nil {
+	if err := c.storeMessage(audioMessage); err != nil {
 		log.Printf("⚠️ Failed to store sent audio message in database: %v", err)
 	} else {
 		log.Printf("✅ Sent audio message stored in database")
@@ -838,8 +956,8 @@ func (c *Client) SendAudioMessage(recipient string, filePath string) error {
 	// Update chat info
 	c.updateChatInfo(recipientJID, "[Voice Message]", time.Now())
 
-	log.Printf("✅ Audio message sent successfully to %s", recipient)
-	return nil
+	log.Printf("✅ Audio message sent successfully to %s", recipientJID)
+	return resp.ID, nil
 }
 
 // Helper functions for creating pointers
@@ -890,6 +1008,17 @@ func getAudioMimeType(filePath string) string {
 	}
 }
 
+// mediaAudioDuration gets the duration of an audio file in the media
+// directory. ffprobe reads the file itself, so it gets the plaintext.
+func (c *Client) mediaAudioDuration(filePath string) (float64, error) {
+	plainPath, cleanup, err := c.plaintextMediaPath(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+	return getAudioDuration(plainPath)
+}
+
 // getAudioDuration gets the duration of an audio file using ffprobe
 func getAudioDuration(filePath string) (float64, error) {
 	// Use ffprobe to get audio duration
@@ -934,8 +1063,7 @@ func (c *Client) DownloadMedia(messageID string) (string, error) {
 	// For now, return a placeholder path
 	// In a real implementation, you would need to store the actual media data
 	// and provide a way to retrieve it
-	filename := fmt.Sprintf("%s_%s", messageID, msg.Filename)
-	filePath := filepath.Join(c.mediaDir, filename)
+	filePath := filepath.Join(c.mediaDir, mediaFileName(messageID, msg.Filename))
 
 	return filePath, nil
 }
@@ -964,59 +1092,15 @@ func isNumeric(s string) bool {
 	return len(s) > 0
 }
 
-// processTextMessage handles text message processing (commands, auto-replies, etc.)
-func (c *Client) processTextMessage(evt *events.Message, content string) {
+// processVoiceMessage handles the complete voice message processing pipeline
+func (c *Client) processVoiceMessage(evt *events.Message, audioMsg *waE2E.AudioMessage) {
 	info := evt.Info
-	// Skip processing messages from ourselves
-	if info.IsFromMe {
-		return
-	}
 
-	// Convert to lowercase for command matching
-	lowerContent := strings.ToLower(strings.TrimSpace(content))
-
-	// Example command handling
-	switch {
-	case strings.HasPrefix(lowerContent, "/help"):
-		c.sendAutoReply(info.Chat.String(), "Available commands:\n/help - Show this help\n/ping - Test connection\n/time - Get current time")
-	case strings.HasPrefix(lowerContent, "/ping"):
-		c.sendAutoReply(info.Chat.String(), "Pong! 🏓")
-	case strings.HasPrefix(lowerContent, "/time"):
-		currentTime := time.Now().Format("2006-01-02 15:04:05")
-		c.sendAutoReply(info.Chat.String(), fmt.Sprintf("Current time: %s", currentTime))
-	case strings.Contains(lowerContent, "hello") || strings.Contains(lowerContent, "hi"):
-		c.sendAutoReply(info.Chat.String(), "Hello! 👋 How can I help you?")
-	default:
-		// No specific command matched, use LlamaStack to generate response
-		log.Printf("💬 Text message processed: %s", content)
-		c.processWithLlamaStack(evt, content)
-	}
-}
-
-// processAudioMessage handles audio/voice message processing
-func (c *Client) processAudioMessage(evt *events.Message, audioMsg *waE2E.AudioMessage, messageType string) {
-	info := evt.Info
-	// Skip processing messages from ourselves
-	if info.IsFromMe {
+	if c.botMode() == hours.BotOff {
+		log.Printf("🌙 Outside business hours, not answering voice message in %s", info.Chat.String())
 		return
 	}
 
-	log.Printf("🎵 Processing %s message from %s", messageType, info.Sender.String())
-
-	// Different handling for voice vs regular audio
-	if messageType == "voice" {
-		log.Printf("🎤 Voice message received - processing with AI agent")
-		c.processVoiceMessage(evt, audioMsg)
-	} else {
-		log.Printf("🎵 Regular audio message received - could trigger audio analysis")
-		// TODO: Add audio analysis logic here
-	}
-}
-
-// processVoiceMessage handles the complete voice message processing pipeline
-func (c *Client) processVoiceMessage(evt *events.Message, audioMsg *waE2E.AudioMessage) {
-	info := evt.Info
-
 	log.Printf("🎤 Starting voice message processing pipeline")
 
 	// Step 0: Set voice recording presence to indicate we're processing
@@ -1047,8 +1131,18 @@ func (c *Client) processVoiceMessage(evt *events.Message, audioMsg *waE2E.AudioM
 
 	log.Printf("✅ Voice transcribed: %s", transcribedText)
 
+	// Keep the transcript alongside the voice message
+	if err := c.db.StoreTranscript(&models.Transcript{
+		MessageID: info.ID,
+		ChatJID:   info.Chat.String(),
+		Sender:    info.Sender.String(),
+		Text:      transcribedText,
+	}); err != nil {
+		log.Printf("⚠️ Failed to store transcript: %v", err)
+	}
+
 	// Step 3: Process with AI agent
-	responseText, err := c.processWithLlamaStackAgent(transcribedText)
+	responseText, err := c.processWithLlamaStackAgent(info.Chat.String(), transcribedText)
 	if err != nil {
 		log.Printf("❌ Failed to process with AI agent: %v", err)
 		c.clearChatPresence(info.Chat.String()) // Clear presence on error
@@ -1058,6 +1152,13 @@ func (c *Client) processVoiceMessage(evt *events.Message, audioMsg *waE2E.AudioM
 
 	log.Printf("✅ AI agent response: %s", responseText)
 
+	// Drafted replies are reviewed as text rather than as a voice note
+	if c.replyDrafter != nil {
+		c.clearChatPresence(info.Chat.String())
+		c.sendAgentReply(info.Chat.String(), responseText)
+		return
+	}
+
 	// Step 4: Convert response to speech
 	responseAudioPath, err := c.textToSpeech(responseText)
 	if err != nil {
@@ -1116,20 +1217,13 @@ func (c *Client) downloadVoiceMessage(evt *events.Message, audioMsg *waE2E.Audio
 
 	// Download the media using WhatsApp client
 	ctx := context.Background()
-	data, err := c.client.Download(ctx, audioMsg)
+	data, err := c.wa().Download(ctx, audioMsg)
 	if err != nil {
 		return "", fmt.Errorf("failed to download media: %w", err)
 	}
 
-	// Write the downloaded data to file
-	file, err := os.Create(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
-
-	_, err = file.Write(data)
-	if err != nil {
+	// Write the downloaded data to file, encrypted when encryption at rest is on
+	if err := c.writeMediaFile(filePath, data); err != nil {
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -1141,9 +1235,17 @@ func (c *Client) downloadVoiceMessage(evt *events.Message, audioMsg *waE2E.Audio
 func (c *Client) speechToText(audioFilePath string) (string, error) {
 	log.Printf("🎙️ Converting speech to text: %s", audioFilePath)
 
+	// The STT service and whisper read the file themselves, so they get a
+	// decrypted copy when encryption at rest is on
+	plainPath, cleanup, err := c.plaintextMediaPath(audioFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read voice message: %w", err)
+	}
+	defer cleanup()
+
 	// Use OpenAI Whisper API for speech-to-text conversion
 	// You can also use local solutions like whisper.cpp or other STT services
-	transcribedText, err := c.transcribeWithWhisper(audioFilePath)
+	transcribedText, err := c.transcribeWithWhisper(plainPath)
 	if err != nil {
 		return "", fmt.Errorf("speech-to-text conversion failed: %w", err)
 	}
@@ -1155,14 +1257,13 @@ func (c *Client) speechToText(audioFilePath string) (string, error) {
 // transcribeWithWhisper uses external STT service, OpenAI Whisper API, or local whisper for transcription
 func (c *Client) transcribeWithWhisper(audioFilePath string) (string, error) {
 	// Priority 1: Check if external STT service URL is configured
-	if c.sttUrl != "" {
-		log.Printf("🎙️ Using external STT service: %s", c.sttUrl)
+	if c.cfg.STTUrl != "" {
+		log.Printf("🎙️ Using external STT service: %s", c.cfg.STTUrl)
 		return c.transcribeWithExternalService(audioFilePath)
 	}
 
 	// Priority 2: Check if we have OpenAI API key
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey != "" {
+	if c.cfg.OpenAIAPIKey != "" {
 		// TODO: Implement OpenAI Whisper API integration
 		log.Printf("⚠️ OpenAI Whisper API integration not yet implemented, falling back to local whisper")
 		// Fallback to local whisper for now
@@ -1175,15 +1276,21 @@ func (c *Client) transcribeWithWhisper(audioFilePath string) (string, error) {
 
 // transcribeWithExternalService uses an external STT service for transcription
 func (c *Client) transcribeWithExternalService(audioFilePath string) (string, error) {
-	log.Printf("🎙️ Using external STT service: %s", c.sttUrl)
+	log.Printf("🎙️ Using external STT service: %s", c.cfg.STTUrl)
 
-	// Create a temporary file for the response
-	tempResponsePath := filepath.Join(c.mediaDir, fmt.Sprintf("stt_response_%d.txt", time.Now().Unix()))
+	// Create a temporary file for the response, outside the media directory
+	// since it holds the transcript in plaintext
+	tempResponse, err := os.CreateTemp("", "stt_response_*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create STT response file: %w", err)
+	}
+	tempResponse.Close()
+	tempResponsePath := tempResponse.Name()
 	defer os.Remove(tempResponsePath) // Clean up response file
 
 	// Use curl to POST the audio file to the STT service
 	// The service expects a file upload, typically with field name "file" or "audio"
-	cmd := exec.Command("curl", "-X", "POST", "-F", fmt.Sprintf("file=@%s", audioFilePath), c.sttUrl, "--output", tempResponsePath, "-s", "-S")
+	cmd := exec.Command("curl", "-X", "POST", "-F", fmt.Sprintf("file=@%s", audioFilePath), c.cfg.STTUrl, "--output", tempResponsePath, "-s", "-S")
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -1245,11 +1352,13 @@ func (c *Client) transcribeWithLocalWhisper(audioFilePath string) (string, error
 		return "", fmt.Errorf("whisper not found, please install whisper: %w", err)
 	}
 
-	// Create output directory for transcription
-	outputDir := filepath.Join(c.mediaDir, "transcriptions")
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
+	// Create output directory for transcription, outside the media directory
+	// since whisper writes the transcript in plaintext
+	outputDir, err := os.MkdirTemp("", "transcriptions_")
+	if err != nil {
 		return "", fmt.Errorf("failed to create transcription directory: %w", err)
 	}
+	defer os.RemoveAll(outputDir)
 
 	// Run whisper transcription with smaller, faster model
 	// Set a timeout for whisper transcription (5 minutes)
@@ -1275,9 +1384,6 @@ func (c *Client) transcribeWithLocalWhisper(audioFilePath string) (string, error
 		return "", fmt.Errorf("failed to read transcription file: %w", err)
 	}
 
-	// Clean up transcription file
-	os.Remove(outputFile)
-
 	return strings.TrimSpace(string(content)), nil
 }
 
@@ -1301,11 +1407,26 @@ func (c *Client) textToSpeech(text string) (string, error) {
 	filename := fmt.Sprintf("tts_%d.ogg", time.Now().Unix())
 	outputPath := filepath.Join(outputDir, filename)
 
-	// Use local TTS service
-	err := c.generateSpeechWithLocalService(text, outputPath)
+	// Generate the audio in a temporary directory, then store it in the media
+	// directory, encrypted when encryption at rest is on
+	workDir, err := os.MkdirTemp("", "tts_")
 	if err != nil {
+		return "", fmt.Errorf("failed to create TTS work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+	workPath := filepath.Join(workDir, filename)
+
+	// Use local TTS service
+	if err := c.generateSpeechWithLocalService(text, workPath); err != nil {
 		return "", fmt.Errorf("text-to-speech conversion failed: %w", err)
 	}
+	audio, err := os.ReadFile(workPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read generated speech: %w", err)
+	}
+	if err := c.writeMediaFile(outputPath, audio); err != nil {
+		return "", fmt.Errorf("failed to store generated speech: %w", err)
+	}
 
 	log.Printf("✅ Text converted to speech: %s", outputPath)
 	return outputPath, nil
@@ -1320,7 +1441,7 @@ func (c *Client) generateSpeechWithLocalService(text, outputPath string) error {
 	defer os.Remove(tempWavPath) // Clean up temporary WAV file
 
 	// Use curl to call the TTS service
-	cmd := exec.Command("curl", "-X", "POST", "-F", fmt.Sprintf("text=%s", text), c.ttsUrl, "--output", tempWavPath)
+	cmd := exec.Command("curl", "-X", "POST", "-F", fmt.Sprintf("text=%s", text), c.cfg.TTSUrl, "--output", tempWavPath)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("local TTS service call failed: %w", err)
 	}
@@ -1340,7 +1461,7 @@ func (c *Client) generateSpeechWithLocalService(text, outputPath string) error {
 }
 
 // processWithLlamaStackAgent processes transcribed text with LlamaStack agent
-func (c *Client) processWithLlamaStackAgent(transcribedText string) (string, error) {
+func (c *Client) processWithLlamaStackAgent(chatJID, transcribedText string) (string, error) {
 	log.Printf("🤖 Processing transcribed text with LlamaStack agent: %s", transcribedText)
 
 	// Create LlamaStack client
@@ -1356,7 +1477,8 @@ func (c *Client) processWithLlamaStackAgent(transcribedText string) (string, err
 	}
 
 	// Generate response using the agent
-	response, err := c.generateAgentResponse(client, agent.AgentID, transcribedText)
+	response, toolCalls, err := c.generateAgentResponse(client, agent.AgentID, transcribedText)
+	c.auditBotReply(chatJID, "llamastack.agents", modelID, toolCalls, err, map[string]string{"input": "voice"})
 	if err != nil {
 		return "", fmt.Errorf("failed to generate agent response: %w", err)
 	}
@@ -1364,69 +1486,21 @@ func (c *Client) processWithLlamaStackAgent(transcribedText string) (string, err
 	return response, nil
 }
 
-// sendAutoReply sends an automatic reply to a chat
+// sendAutoReply queues an automatic reply to a chat
 func (c *Client) sendAutoReply(chatJID string, message string) {
-	ctx := context.Background()
-	if err := c.EnsureConnected(ctx); err != nil {
-		log.Printf("❌ Failed to ensure connection for auto-reply: %v", err)
-		return
-	}
-
-	recipientJID, err := types.ParseJID(chatJID)
-	if err != nil {
-		log.Printf("❌ Invalid chat JID for auto-reply: %v", err)
-		return
-	}
-
-	msg := &waE2E.Message{
-		Conversation: &message,
-	}
-
-	resp, err := c.client.SendMessage(ctx, recipientJID, msg)
+	queued, err := c.QueueText(chatJID, message, "")
 	if err != nil {
 		log.Printf("❌ Failed to send auto-reply: %v", err)
 		return
 	}
-
-	// Store the auto-reply message in the database
-	autoReplyMessage := &models.Message{
-		Time:      time.Now(),
-		Sender:    c.client.Store.ID.String(), // Our own JID
-		Content:   message,
-		IsFromMe:  true,
-		MediaType: "text",
-		Filename:  "",
-		ChatJID:   chatJID,
-		MessageID: resp.ID, // Use the actual message ID from WhatsApp response
-	}
-
-	if err := c.db.StoreMessage(autoReplyMessage); err != nil {
-		log.Printf("⚠️ Failed to store auto-reply message in database: %v", err)
-	} else {
-		log.Printf("✅ Auto-reply message stored in database")
-	}
-
-	// Update chat info
-	c.updateChatInfo(recipientJID, message, time.Now())
-
-	log.Printf("✅ Auto-reply sent: %s", message)
+	log.Printf("✅ Auto-reply %s: %s", queued.Status, message)
 }
 
 // createLlamaStackClient creates and configures a LlamaStack client
 func (c *Client) createLlamaStackClient() (llamastack.Client, string, error) {
 	log.Printf("🔗 Creating LlamaStack client")
 
-	// Get LlamaStack configuration from environment variables
-	baseURL := os.Getenv("LLAMASTACK_BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://ragathon-team-1-ragathon-team-1.apps.llama-rag-pool-b84hp.aws.rh-ods.com"
-	}
-
-	apiKey := os.Getenv("LLAMASTACK_API_KEY")
-	modelID := os.Getenv("LLAMASTACK_MODEL")
-	if modelID == "" {
-		modelID = "vllm-inference/llama-4-scout-17b-16e-w4a16"
-	}
+	baseURL, apiKey, modelID := c.cfg.LlamaStackBaseURL, c.cfg.LlamaStackAPIKey, c.cfg.LlamaStackModel
 
 	// Ensure model ID has provider prefix if not already present
 	if !strings.Contains(modelID, "/") {
@@ -1505,12 +1579,7 @@ Always make the necessary tool calls first, then provide the user with the actua
 If you need to search for current banking information, use the knowledge search tool. If you need user-specific data, use the MCP tools with the phone number +353 85 148 0072.`
 
 	// Get vector store ID by name
-	vectorStoreName := os.Getenv("VECTOR_STORE_NAME")
-	if vectorStoreName == "" {
-		vectorStoreName = "redbank-kb-vector-store" // Default value
-	}
-
-	vectorStoreID, err := c.getVectorStore(client, vectorStoreName)
+	vectorStoreID, err := c.getVectorStore(client, c.cfg.VectorStoreName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get vector store: %w", err)
 	}
@@ -1535,9 +1604,7 @@ If you need to search for current banking information, use the knowledge search
 	// Use LLAMASTACK_MCP_TOOL_GROUP to reference a registered MCP tool group
 	// MCP_URL and MCP_SERVER_LABEL are kept for reference/documentation purposes
 	// They can be used when registering the tool group via CLI or for future API support
-	mcpUrl := os.Getenv("MCP_URL")
-	mcpServerLabel := os.Getenv("MCP_SERVER_LABEL")
-	mcpToolGroup := os.Getenv("LLAMASTACK_MCP_TOOL_GROUP")
+	mcpUrl, mcpServerLabel, mcpToolGroup := c.cfg.MCPURL, c.cfg.MCPServerLabel, c.cfg.LlamaStackMCPToolGroup
 
 	if mcpToolGroup != "" {
 		log.Printf("🔧 Adding MCP tool group: %s", mcpToolGroup)
@@ -1557,6 +1624,13 @@ If you need to search for current banking information, use the knowledge search
 		log.Printf("💡 Available tool groups: builtin::websearch, builtin::rag")
 	}
 
+	// Outside business hours the bot may be restricted to general answers
+	if c.botMode() == hours.BotRestricted {
+		log.Printf("🌙 Outside business hours, creating agent without tools")
+		instructions = hours.RestrictedInstructions
+		toolgroups = nil
+	}
+
 	// Create agent configuration with available tools
 	agentConfig := llamastack.AgentConfigParam{
 		Instructions: instructions,
@@ -1587,35 +1661,30 @@ If you need to search for current banking information, use the knowledge search
 	return agent, nil
 }
 
-// useResponsesAPI checks if we should use Responses API instead of Agents API
-func (c *Client) useResponsesAPI() bool {
-	useResponses := os.Getenv("LLAMASTACK_USE_RESPONSES_API")
-	return strings.ToLower(useResponses) == "true" || useResponses == "1"
-}
-
 // processWithLlamaStack processes a text message using LlamaStack
-func (c *Client) processWithLlamaStack(evt *events.Message, content string) {
-	info := evt.Info
+func (c *Client) processWithLlamaStack(chatJID, content string) {
+	if c.botMode() == hours.BotOff {
+		log.Printf("🌙 Outside business hours, not answering %s", chatJID)
+		return
+	}
 
 	// Check which API to use
-	if c.useResponsesAPI() {
+	if c.cfg.LlamaStackUseResponsesAPI {
 		log.Printf("🤖 Processing message with LlamaStack Responses API: %s", content)
-		c.processWithLlamaStackResponses(info.Chat.String(), content)
+		c.processWithLlamaStackResponses(chatJID, content)
 	} else {
 		log.Printf("🤖 Processing message with LlamaStack Agents API: %s", content)
-		c.processWithLlamaStackAgents(evt, content)
+		c.processWithLlamaStackAgents(chatJID, content)
 	}
 }
 
 // processWithLlamaStackAgents processes a text message using LlamaStack Agents API
-func (c *Client) processWithLlamaStackAgents(evt *events.Message, content string) {
-	info := evt.Info
-
+func (c *Client) processWithLlamaStackAgents(chatJID, content string) {
 	// Create LlamaStack client
 	client, modelID, err := c.createLlamaStackClient()
 	if err != nil {
 		log.Printf("❌ Failed to create LlamaStack client: %v", err)
-		c.sendAutoReply(info.Chat.String(), "Sorry, I'm having trouble connecting to my AI assistant right now. Please try again later.")
+		c.sendAutoReply(chatJID, "Sorry, I'm having trouble connecting to my AI assistant right now. Please try again later.")
 		return
 	}
 
@@ -1623,14 +1692,15 @@ func (c *Client) processWithLlamaStackAgents(evt *events.Message, content string
 	agent, err := c.createLlamaStackAgent(client, modelID)
 	if err != nil {
 		log.Printf("❌ Failed to create LlamaStack agent: %v", err)
-		c.sendAutoReply(info.Chat.String(), "Sorry, I'm having trouble setting up my AI assistant right now. Please try again later.")
+		c.sendAutoReply(chatJID, "Sorry, I'm having trouble setting up my AI assistant right now. Please try again later.")
 		return
 	}
 
 	log.Printf("✅ Agent created: %s", agent.AgentID)
 
 	// Generate response using the agent
-	response, err := c.generateAgentResponse(client, agent.AgentID, content)
+	response, toolCalls, err := c.generateAgentResponse(client, agent.AgentID, content)
+	c.auditBotReply(chatJID, "llamastack.agents", modelID, toolCalls, err, nil)
 	if err != nil {
 		log.Printf("❌ Failed to generate agent response: %v", err)
 		// Fall back to simple response
@@ -1641,7 +1711,7 @@ func (c *Client) processWithLlamaStackAgents(evt *events.Message, content string
 	}
 
 	// Send the generated response
-	c.sendAutoReply(info.Chat.String(), response)
+	c.sendAgentReply(chatJID, response)
 }
 
 // processWithLlamaStackResponses processes a text message using LlamaStack Responses API
@@ -1655,7 +1725,8 @@ func (c *Client) processWithLlamaStackResponses(chatJID, content string) {
 	}
 
 	// Generate response using Responses API
-	response, err := c.generateResponseResponse(client, modelID, chatJID, content)
+	response, toolCalls, err := c.generateResponseResponse(client, modelID, chatJID, content)
+	c.auditBotReply(chatJID, "llamastack.responses", modelID, toolCalls, err, nil)
 	if err != nil {
 		log.Printf("❌ Failed to generate response: %v", err)
 		// Fall back to simple response
@@ -1666,16 +1737,17 @@ func (c *Client) processWithLlamaStackResponses(chatJID, content string) {
 	}
 
 	// Send the generated response
-	c.sendAutoReply(chatJID, response)
+	c.sendAgentReply(chatJID, response)
 }
 
 // generateResponseResponse generates a response using the LlamaStack Responses API
-func (c *Client) generateResponseResponse(client llamastack.Client, modelID, chatJID, userMessage string) (string, error) {
+func (c *Client) generateResponseResponse(client llamastack.Client, modelID, chatJID, userMessage string) (string, []string, error) {
+	var toolCalls []string // tools the model called, for the audit log
 	log.Printf("🤖 Generating response using Responses API with model: %s", modelID)
 	log.Printf("💬 User message: %s", userMessage)
 
 	// Get model instructions
-	modelInstructions := os.Getenv("MODEL_INSTRUCTIONS")
+	modelInstructions := c.cfg.ModelInstructions
 	if modelInstructions == "" {
 		modelInstructions = `/no_think
 
@@ -1703,7 +1775,9 @@ Just execute tool calls until you have an answer, then provide it.`
 	}
 
 	// Get or initialize conversation history for this chat
+	c.historyMu.Lock()
 	history, exists := c.conversationHistory[chatJID]
+	c.historyMu.Unlock()
 	if !exists {
 		history = []map[string]interface{}{}
 	}
@@ -1715,23 +1789,9 @@ Just execute tool calls until you have an answer, then provide it.`
 	})
 
 	// Get vector store ID
-	vectorStoreName := os.Getenv("VECTOR_STORE_NAME")
-	if vectorStoreName == "" {
-		vectorStoreName = "redbank-kb-vector-store"
-	}
-	vectorStoreID, err := c.getVectorStore(client, vectorStoreName)
+	vectorStoreID, err := c.getVectorStore(client, c.cfg.VectorStoreName)
 	if err != nil {
-		return "", fmt.Errorf("failed to get vector store: %w", err)
-	}
-
-	// Get MCP configuration
-	mcpUrl := os.Getenv("MCP_URL")
-	if mcpUrl == "" {
-		mcpUrl = "http://redbank-mcp-server:8000/mcp"
-	}
-	mcpServerLabel := os.Getenv("MCP_SERVER_LABEL")
-	if mcpServerLabel == "" {
-		mcpServerLabel = "dmcp"
+		return "", toolCalls, fmt.Errorf("failed to get vector store: %w", err)
 	}
 
 	// Create tools configuration
@@ -1739,8 +1799,8 @@ Just execute tool calls until you have an answer, then provide it.`
 		// MCP tool
 		{
 			OfMcp: &llamastack.ResponseNewParamsToolMcp{
-				ServerLabel: mcpServerLabel,
-				ServerURL:   mcpUrl,
+				ServerLabel: c.cfg.MCPServerLabel,
+				ServerURL:   c.cfg.MCPURL,
 				RequireApproval: llamastack.ResponseNewParamsToolMcpRequireApprovalUnion{
 					OfResponseNewsToolMcpRequireApprovalString: param.Opt[llamastack.ResponseNewParamsToolMcpRequireApprovalString]{
 						Value: llamastack.ResponseNewParamsToolMcpRequireApprovalStringNever,
@@ -1756,6 +1816,13 @@ Just execute tool calls until you have an answer, then provide it.`
 		},
 	}
 
+	// Outside business hours the bot may be restricted to general answers
+	if c.botMode() == hours.BotRestricted {
+		log.Printf("🌙 Outside business hours, answering without tools")
+		modelInstructions = hours.RestrictedInstructions
+		tools = nil
+	}
+
 	// Convert history to the format expected by the API
 	inputArray := make([]llamastack.ResponseNewParamsInputArrayItemUnion, len(history))
 	for i, msg := range history {
@@ -1791,12 +1858,17 @@ Just execute tool calls until you have an answer, then provide it.`
 		},
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create response: %w", err)
+		return "", toolCalls, fmt.Errorf("failed to create response: %w", err)
 	}
 
-	// Extract response text from output
+	// Extract response text from output, noting the tools called
 	var responseText string
 	for _, output := range resp.Output {
+		switch output.Type {
+		case "mcp_call", "function_call", "web_search_call", "file_search_call":
+			toolCalls = append(toolCalls, toolCallName(output.Type, output.ServerLabel, output.Name, output.Error))
+			continue
+		}
 		if msg := output.AsMessage(); msg.Role == llamastack.ResponseObjectOutputMessageRoleAssistant {
 			if msg.Content.OfString != "" {
 				responseText = msg.Content.OfString
@@ -1805,7 +1877,7 @@ Just execute tool calls until you have an answer, then provide it.`
 		}
 	}
 	if responseText == "" {
-		return "", fmt.Errorf("no response text found in output")
+		return "", toolCalls, fmt.Errorf("no response text found in output")
 	}
 
 	// Add assistant response to conversation history
@@ -1815,14 +1887,17 @@ Just execute tool calls until you have an answer, then provide it.`
 	})
 
 	// Update conversation history
+	c.historyMu.Lock()
 	c.conversationHistory[chatJID] = history
+	c.historyMu.Unlock()
 
 	log.Printf("✅ Response generated successfully")
-	return responseText, nil
+	return responseText, toolCalls, nil
 }
 
 // generateAgentResponse generates a response using the LlamaStack agent
-func (c *Client) generateAgentResponse(client llamastack.Client, agentID, userMessage string) (string, error) {
+func (c *Client) generateAgentResponse(client llamastack.Client, agentID, userMessage string) (string, []string, error) {
+	var toolCalls []string // tools the agent called, for the audit log
 	log.Printf("🤖 Generating agent response using agent: %s", agentID)
 	log.Printf("💬 User message: %s", userMessage)
 
@@ -1831,7 +1906,7 @@ func (c *Client) generateAgentResponse(client llamastack.Client, agentID, userMe
 		SessionName: "WhatsApp Banking Session",
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create agent session: %w", err)
+		return "", toolCalls, fmt.Errorf("failed to create agent session: %w", err)
 	}
 
 	log.Printf("✅ Agent session created: %s", session.SessionID)
@@ -1900,6 +1975,9 @@ func (c *Client) generateAgentResponse(client llamastack.Client, agentID, userMe
 				}
 			} else if step.StepType == "tool_execution" {
 				log.Printf("🔧 Tool execution completed - StepID: %s", step.StepID)
+				for _, call := range step.ToolCalls {
+					toolCalls = append(toolCalls, string(call.ToolName))
+				}
 				// Log tool responses for debugging
 				if len(step.ToolResponses) > 0 {
 					for i, toolResp := range step.ToolResponses {
@@ -1925,19 +2003,19 @@ func (c *Client) generateAgentResponse(client llamastack.Client, agentID, userMe
 streamComplete:
 
 	if err := stream.Err(); err != nil {
-		return "", fmt.Errorf("streaming error: %w", err)
+		return "", toolCalls, fmt.Errorf("streaming error: %w", err)
 	}
 
 	if hasError {
-		return "", fmt.Errorf("%s", errorMessage)
+		return "", toolCalls, fmt.Errorf("%s", errorMessage)
 	}
 
 	if finalResponse == "" {
-		return "", fmt.Errorf("no response received from agent")
+		return "", toolCalls, fmt.Errorf("no response received from agent")
 	}
 
 	log.Printf("✅ Agent response generated successfully")
-	return finalResponse, nil
+	return finalResponse, toolCalls, nil
 }
 
 // generateFallbackResponse generates a simple fallback response when LlamaStack is unavailable
@@ -1978,7 +2056,7 @@ func (c *Client) setVoiceRecordingPresence(chatJID string) error {
 	}
 
 	log.Printf("🎤 Setting voice recording presence for %s", chatJID)
-	err = c.client.SendChatPresence(recipientJID, types.ChatPresenceComposing, types.ChatPresenceMediaAudio)
+	err = c.wa().SendChatPresence(recipientJID, types.ChatPresenceComposing, types.ChatPresenceMediaAudio)
 	if err != nil {
 		log.Printf("❌ Failed to set voice recording presence: %v", err)
 		return fmt.Errorf("failed to set voice recording presence: %w", err)
@@ -2001,7 +2079,7 @@ func (c *Client) clearChatPresence(chatJID string) error {
 	}
 
 	log.Printf("🔄 Clearing chat presence for %s", chatJID)
-	err = c.client.SendChatPresence(recipientJID, types.ChatPresencePaused, "")
+	err = c.wa().SendChatPresence(recipientJID, types.ChatPresencePaused, "")
 	if err != nil {
 		log.Printf("❌ Failed to clear chat presence: %v", err)
 		return fmt.Errorf("failed to clear chat presence: %w", err)
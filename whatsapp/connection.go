@@ -0,0 +1,305 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Connection states reported by ConnectionState and published as connection events
+const (
+	StatePairing        = "pairing"         // no session, waiting for a QR code scan or pairing code
+	StateConnecting     = "connecting"      // a connection attempt is in progress
+	StateConnected      = "connected"       // connected and logged in
+	StateDisconnected   = "disconnected"    // connection lost, reconnecting with backoff
+	StateLoggedOut      = "logged_out"      // session removed from the phone, pairing needed
+	StateStreamReplaced = "stream_replaced" // another client took over the session
+)
+
+// Errors returned when the connection is not usable
+var (
+	ErrNotLoggedIn  = errors.New("WhatsApp session is logged out, the device has to be paired again")
+	ErrNotConnected = errors.New("not connected to WhatsApp")
+)
+
+const (
+	// reconnectBaseDelay is the delay before the second reconnection attempt; it doubles with every attempt
+	reconnectBaseDelay = 2 * time.Second
+	// reconnectMaxDelay caps the delay between reconnection attempts
+	reconnectMaxDelay = 5 * time.Minute
+	// ensureConnectedTimeout bounds how long EnsureConnected waits for a reconnection
+	ensureConnectedTimeout = 10 * time.Second
+	// watcherBuffer is the number of state changes a slow watcher may fall behind
+	watcherBuffer = 8
+)
+
+// ConnectionState describes the connection to WhatsApp
+type ConnectionState struct {
+	State           string     `json:"state"`
+	Reason          string     `json:"reason,omitempty"`
+	Since           time.Time  `json:"since"`
+	Attempts        int        `json:"reconnect_attempts,omitempty"`
+	NextRetryAt     *time.Time `json:"next_retry_at,omitempty"`
+	LastConnectedAt *time.Time `json:"last_connected_at,omitempty"`
+}
+
+// connectionSupervisor tracks the connection state and reconnects when the
+// connection drops. whatsmeow's own auto-reconnect is disabled so that there
+// is a single place deciding when to reconnect.
+type connectionSupervisor struct {
+	mu            sync.Mutex
+	state         ConnectionState
+	notBefore     time.Time // no reconnection before this time, e.g. during a temporary ban
+	restoring     bool      // a backup is being restored, no connection attempts
+	watchers      map[int]chan ConnectionState
+	nextWatcherID int
+	reconnect     chan struct{}
+}
+
+func newConnectionSupervisor() *connectionSupervisor {
+	return &connectionSupervisor{
+		state:     ConnectionState{State: StateDisconnected, Since: time.Now()},
+		watchers:  make(map[int]chan ConnectionState),
+		reconnect: make(chan struct{}, 1),
+	}
+}
+
+// ConnectionState returns the current connection state
+func (c *Client) ConnectionState() ConnectionState {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	return c.conn.state
+}
+
+// WatchConnection returns a channel receiving every connection state change
+// and a function that stops watching. A watcher that falls behind misses the
+// oldest changes rather than blocking the client.
+func (c *Client) WatchConnection() (<-chan ConnectionState, func()) {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+
+	ch := make(chan ConnectionState, watcherBuffer)
+	id := c.conn.nextWatcherID
+	c.conn.nextWatcherID++
+	c.conn.watchers[id] = ch
+
+	return ch, func() {
+		c.conn.mu.Lock()
+		delete(c.conn.watchers, id)
+		c.conn.mu.Unlock()
+	}
+}
+
+// HasSession reports whether a paired session is stored
+func (c *Client) HasSession() bool {
+	return c.wa().Store.ID != nil
+}
+
+// setConnectionState records a state change, notifies watchers and publishes
+// a connection event
+func (c *Client) setConnectionState(state, reason string, update func(*ConnectionState)) {
+	c.conn.mu.Lock()
+	s := c.conn.state
+	if s.State != state {
+		s.Since = time.Now()
+	}
+	s.State, s.Reason = state, reason
+	if update != nil {
+		update(&s)
+	}
+	c.conn.state = s
+	for _, ch := range c.conn.watchers {
+		select {
+		case <-ch: // drop the oldest change if the watcher is behind
+		default:
+		}
+		select {
+		case ch <- s:
+		default:
+		}
+	}
+	c.conn.mu.Unlock()
+
+	if reason != "" {
+		log.Printf("🔌 Connection state: %s (%s)", state, reason)
+	} else {
+		log.Printf("🔌 Connection state: %s", state)
+	}
+	c.publish(Event{Type: EventConnection, Data: &ConnectionEvent{State: state, Reason: reason}})
+}
+
+// requestReconnect asks the supervisor to reconnect
+func (c *Client) requestReconnect() {
+	select {
+	case c.conn.reconnect <- struct{}{}:
+	default:
+	}
+}
+
+// Supervise reconnects whenever the connection drops, until ctx is cancelled.
+// Attempts back off exponentially; a logged out or replaced session is not
+// reconnected.
+func (c *Client) Supervise(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.conn.reconnect:
+			c.reconnect(ctx)
+		}
+	}
+}
+
+// reconnect makes connection attempts with backoff until one succeeds, the
+// session turns out to be gone or ctx is cancelled. The attempt count is kept
+// until the client is logged in again, so failures after the socket opens
+// still back off.
+func (c *Client) reconnect(ctx context.Context) {
+	for {
+		if c.IsConnected() {
+			return
+		}
+		if !c.HasSession() {
+			if !c.pairingActive() {
+				c.setConnectionState(StateLoggedOut, "no stored session", nil)
+			}
+			return
+		}
+		if state := c.ConnectionState().State; state == StateLoggedOut || state == StateStreamReplaced {
+			return
+		}
+		if c.restoreActive() {
+			return
+		}
+
+		c.conn.mu.Lock()
+		delay := reconnectDelay(c.conn.state.Attempts)
+		if wait := time.Until(c.conn.notBefore); wait > delay {
+			delay = wait
+		}
+		c.conn.mu.Unlock()
+
+		next := time.Now().Add(delay)
+		c.setConnectionState(StateDisconnected, c.ConnectionState().Reason, func(s *ConnectionState) {
+			s.NextRetryAt = &next
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if !c.startConnecting(func(s *ConnectionState) {
+			s.Attempts++
+			s.NextRetryAt = nil
+		}) {
+			return
+		}
+		err := c.wa().Connect()
+		if err == nil || errors.Is(err, whatsmeow.ErrAlreadyConnected) {
+			return
+		}
+		log.Printf("❌ Reconnection attempt failed: %v", err)
+		c.setConnectionState(StateDisconnected, err.Error(), nil)
+	}
+}
+
+// startConnecting marks a connection attempt as started. It returns false,
+// leaving the client disconnected, while a backup is being restored: the
+// state is set before checking so that Restore either sees the attempt or the
+// attempt sees the restore.
+func (c *Client) startConnecting(update func(*ConnectionState)) bool {
+	c.setConnectionState(StateConnecting, "", update)
+	if c.restoreActive() {
+		c.setConnectionState(StateDisconnected, "backup restore in progress", nil)
+		return false
+	}
+	return true
+}
+
+// reconnectDelay returns the wait before a reconnection attempt: none for the
+// first, then doubling up to reconnectMaxDelay
+func reconnectDelay(attempts int) time.Duration {
+	if attempts == 0 {
+		return 0
+	}
+	delay := reconnectBaseDelay
+	for i := 1; i < attempts && delay < reconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+	return delay
+}
+
+// handleConnectionEvent updates the connection state from a whatsmeow event
+func (c *Client) handleConnectionEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Connected:
+		now := time.Now()
+		c.setConnectionState(StateConnected, "", func(s *ConnectionState) {
+			s.Attempts, s.NextRetryAt, s.LastConnectedAt = 0, nil, &now
+		})
+		c.wakeOutbox()
+	case *events.Disconnected:
+		c.setConnectionState(StateDisconnected, "connection lost", nil)
+		c.requestReconnect()
+	case *events.KeepAliveTimeout:
+		log.Printf("⚠️ WhatsApp keepalive failed %d times since %s", v.ErrorCount, v.LastSuccess.Format(time.RFC3339))
+		if time.Since(v.LastSuccess) > whatsmeow.KeepAliveMaxFailTime {
+			c.wa().Disconnect()
+			c.setConnectionState(StateDisconnected, "keepalive timeout", nil)
+			c.requestReconnect()
+		}
+	case *events.KeepAliveRestored:
+		log.Printf("✅ WhatsApp keepalive restored")
+	case *events.LoggedOut:
+		c.handleLoggedOut(v.Reason.String())
+	case *events.StreamReplaced:
+		log.Printf("🚨 ALERT: WhatsApp session was opened by another client; not reconnecting")
+		c.setConnectionState(StateStreamReplaced, "another client connected with this session", nil)
+	case *events.TemporaryBan:
+		log.Printf("🚨 ALERT: WhatsApp account temporarily banned: %s", v.String())
+		c.conn.mu.Lock()
+		c.conn.notBefore = time.Now().Add(v.Expire)
+		c.conn.mu.Unlock()
+		c.setConnectionState(StateDisconnected, v.String(), nil)
+		c.requestReconnect()
+	case *events.ClientOutdated:
+		log.Printf("🚨 ALERT: WhatsApp rejected this client version as outdated; update whatsmeow")
+		c.setConnectionState(StateDisconnected, "client outdated", nil)
+	case *events.ConnectFailure:
+		c.setConnectionState(StateDisconnected, "connect failure: "+v.Reason.String(), nil)
+		if permanentConnectFailure(v.Reason) {
+			log.Printf("🚨 ALERT: WhatsApp refused the connection (%s); not reconnecting", v.Reason.String())
+			return
+		}
+		c.requestReconnect()
+	}
+}
+
+// permanentConnectFailure reports whether retrying cannot fix a connect
+// failure. Logouts are also delivered as LoggedOut events.
+func permanentConnectFailure(reason events.ConnectFailureReason) bool {
+	return reason.IsLoggedOut() ||
+		reason == events.ConnectFailureClientOutdated ||
+		reason == events.ConnectFailureBadUserAgent
+}
+
+// handleLoggedOut clears the removed device so that it can be paired again,
+// and raises an alert. The session is not reconnected.
+func (c *Client) handleLoggedOut(reason string) {
+	log.Printf("🚨 ALERT: WhatsApp session logged out (%s); pair the device again", reason)
+	if c.wa().Store.ID != nil {
+		if err := c.wa().Store.Delete(context.Background()); err != nil {
+			log.Printf("❌ Failed to clear logged out device: %v", err)
+		}
+	}
+	c.setConnectionState(StateLoggedOut, reason, nil)
+}
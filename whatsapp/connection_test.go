@@ -0,0 +1,41 @@
+package whatsapp
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestConnectFailureReconnectsUnlessPermanent(t *testing.T) {
+	tests := []struct {
+		reason    events.ConnectFailureReason
+		reconnect bool
+	}{
+		{events.ConnectFailureInternalServerError, true},
+		{events.ConnectFailureServiceUnavailable, true},
+		{events.ConnectFailureGeneric, true},
+		{events.ConnectFailureReason(499), true},
+		{events.ConnectFailureLoggedOut, false},
+		{events.ConnectFailureMainDeviceGone, false},
+		{events.ConnectFailureClientOutdated, false},
+		{events.ConnectFailureBadUserAgent, false},
+	}
+	for _, tt := range tests {
+		c := &Client{conn: newConnectionSupervisor()}
+		c.handleConnectionEvent(&events.ConnectFailure{Reason: tt.reason})
+
+		if state := c.ConnectionState().State; state != StateDisconnected {
+			t.Errorf("%s: state = %s, want %s", tt.reason, state, StateDisconnected)
+		}
+		select {
+		case <-c.conn.reconnect:
+			if !tt.reconnect {
+				t.Errorf("%s: reconnection requested", tt.reason)
+			}
+		default:
+			if tt.reconnect {
+				t.Errorf("%s: no reconnection requested", tt.reason)
+			}
+		}
+	}
+}
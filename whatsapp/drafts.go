@@ -0,0 +1,75 @@
+package whatsapp
+
+import (
+	"log"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/models"
+)
+
+// ReplyDrafter parks a bot reply for approval instead of sending it
+type ReplyDrafter func(chatJID, text string) error
+
+// AdminCommandHandler runs a command written in the admin chat and returns
+// the reply, or false if the text is not a command
+type AdminCommandHandler func(text, reviewer string) (string, bool)
+
+// SetReplyDrafter makes the LlamaStack bot draft its replies for approval
+// instead of sending them. Voice notes are answered with a text draft. It
+// must be called before connecting.
+func (c *Client) SetReplyDrafter(drafter ReplyDrafter) {
+	c.replyDrafter = drafter
+}
+
+// SetAdminChat sets the chat in which approvers review drafts by writing
+// commands such as "approve 12". The bot never answers in this chat. It must
+// be called before connecting.
+func (c *Client) SetAdminChat(chat types.JID, handler AdminCommandHandler) {
+	c.adminChat = chat.ToNonAD()
+	c.adminCommands = handler
+	log.Printf("🛂 Draft approvals enabled in admin chat %s", c.adminChat)
+}
+
+// sendAgentReply sends a reply written by the LlamaStack bot, or drafts it
+// for approval
+func (c *Client) sendAgentReply(chatJID, text string) {
+	if c.replyDrafter == nil {
+		c.sendAutoReply(chatJID, text)
+		return
+	}
+	if err := c.replyDrafter(chatJID, text); err != nil {
+		log.Printf("❌ Failed to draft reply to %s: %v", chatJID, err)
+	}
+}
+
+// handleAdminChat runs draft commands written in the admin chat. It reports
+// whether the message was in the admin chat, in which case the bot leaves it
+// alone.
+func (c *Client) handleAdminChat(message *models.Message) bool {
+	if c.adminCommands == nil || message.ChatJID != c.adminChat.String() {
+		return false
+	}
+	if message.MediaType != "" && message.MediaType != "text" {
+		return true
+	}
+	reviewer := "whatsapp:" + message.Sender
+	reply, ok := c.adminCommands(message.Content, reviewer)
+	if !ok {
+		return true
+	}
+	log.Printf("🛂 Admin chat command from %s: %s", message.Sender, message.Content)
+	fields := strings.Fields(message.Content) // the command and draft ID, without a reject reason
+	c.recordAudit(&models.AuditEntry{
+		ActorType: models.ActorAdminChat,
+		Actor:     message.Sender,
+		Action:    "admin_chat.command",
+		Tool:      "admin_chat",
+		Details:   map[string]string{"command": strings.ToLower(strings.Join(fields[:min(len(fields), 2)], " "))},
+	})
+	if err := c.SendMessage(message.ChatJID, reply); err != nil {
+		log.Printf("❌ Failed to answer admin chat command: %v", err)
+	}
+	return true
+}
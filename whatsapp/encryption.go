@@ -0,0 +1,143 @@
+package whatsapp
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"whatsapp-go-mcp/models"
+)
+
+// mediaRotationGracePeriod skips media files that are still being written or
+// processed (voice downloads, TTS output) when encrypting the media directory
+const mediaRotationGracePeriod = 5 * time.Minute
+
+// EncryptionRotationResult summarizes a key rotation run
+type EncryptionRotationResult struct {
+	ActiveKeyID  string `json:"active_key_id"`
+	RowsRotated  int    `json:"rows_rotated"`
+	FilesRotated int    `json:"files_rotated"`
+}
+
+// EnableEncryption turns on encryption at rest for the message database and
+// the media directory, then migrates existing plaintext data to the active key
+func (c *Client) EnableEncryption(enc *models.Encryptor) error {
+	c.enc = enc
+	c.db.SetEncryptor(enc)
+
+	log.Printf("🔐 Encryption at rest enabled (active key: %s)", enc.ActiveKeyID())
+
+	result, err := c.RotateEncryption()
+	if err != nil {
+		return fmt.Errorf("failed to migrate existing data to encrypted storage: %w", err)
+	}
+	if result.RowsRotated > 0 || result.FilesRotated > 0 {
+		log.Printf("🔐 Migrated %d rows and %d media files to key %s",
+			result.RowsRotated, result.FilesRotated, result.ActiveKeyID)
+	}
+	return nil
+}
+
+// RotateEncryption re-encrypts stored messages and media files with the
+// active key. Run it after adding a new key to the keyfile.
+func (c *Client) RotateEncryption() (*EncryptionRotationResult, error) {
+	if c.enc == nil {
+		return nil, fmt.Errorf("encryption is not enabled")
+	}
+
+	rows, err := c.db.RotateEncryption()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate database encryption: %w", err)
+	}
+
+	files, err := c.rotateMediaEncryption()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate media encryption: %w", err)
+	}
+
+	return &EncryptionRotationResult{
+		ActiveKeyID:  c.enc.ActiveKeyID(),
+		RowsRotated:  rows,
+		FilesRotated: files,
+	}, nil
+}
+
+// rotateMediaEncryption encrypts or re-wraps every file in the media directory
+func (c *Client) rotateMediaEncryption() (int, error) {
+	rotated := 0
+	err := filepath.Walk(c.mediaDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".rotating") {
+			return nil
+		}
+		if time.Since(info.ModTime()) < mediaRotationGracePeriod {
+			return nil
+		}
+
+		changed, err := c.enc.RotateFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if changed {
+			rotated++
+		}
+		return nil
+	})
+	return rotated, err
+}
+
+// readMediaFile reads a file from the media directory, decrypting it if it
+// was written with encryption at rest enabled
+func (c *Client) readMediaFile(path string) ([]byte, error) {
+	if c.enc != nil {
+		return c.enc.ReadFile(path)
+	}
+	if models.IsEncryptedFile(path) {
+		return nil, models.ErrNoEncryptionKey
+	}
+	return os.ReadFile(path)
+}
+
+// writeMediaFile writes a file to the media directory, encrypting it when
+// encryption at rest is enabled
+func (c *Client) writeMediaFile(path string, data []byte) error {
+	if c.enc != nil {
+		return c.enc.WriteFile(path, data, 0644)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// plaintextMediaPath returns a path to the plaintext of a media file for
+// tools that read it themselves, such as ffprobe and whisper. An encrypted
+// file is decrypted to a temporary file outside the media directory, which
+// cleanup removes.
+func (c *Client) plaintextMediaPath(path string) (string, func(), error) {
+	if !models.IsEncryptedFile(path) {
+		return path, func() {}, nil
+	}
+	data, err := c.readMediaFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	tmp, err := os.CreateTemp("", "media_*"+filepath.Ext(path))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+	if err := tmp.Chmod(0600); err == nil {
+		_, err = tmp.Write(data)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tmp.Name(), cleanup, nil
+}
@@ -0,0 +1,207 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow"
+
+	"whatsapp-go-mcp/broadcast"
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/scheduler"
+)
+
+// encryptedMediaClient returns a client with encryption at rest enabled for a
+// temporary media directory
+func encryptedMediaClient(t *testing.T) *Client {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	enc, err := models.NewEncryptor(map[string][]byte{"k1": key}, "k1")
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	return &Client{mediaDir: t.TempDir(), enc: enc}
+}
+
+// ageMedia backdates a file past the rotation grace period
+func ageMedia(t *testing.T, path string) {
+	t.Helper()
+	old := time.Now().Add(-2 * mediaRotationGracePeriod)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+func TestQueuedFileIsSentDecryptedAfterRotation(t *testing.T) {
+	c := encryptedMediaClient(t)
+	report := []byte("%PDF-1.4 quarterly statement")
+
+	src := filepath.Join(t.TempDir(), "statement.pdf")
+	if err := os.WriteFile(src, report, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(c.mediaDir, "outbox"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	queued := filepath.Join(c.mediaDir, "outbox", "1700000000000000000_statement.pdf")
+	if err := copyFile(src, queued); err != nil {
+		t.Fatalf("copyFile: %v", err)
+	}
+	ageMedia(t, queued)
+
+	if n, err := c.rotateMediaEncryption(); err != nil || n != 1 {
+		t.Fatalf("rotateMediaEncryption = %d, %v; want 1 file", n, err)
+	}
+	if !models.IsEncryptedFile(queued) {
+		t.Fatal("queued file was not encrypted by the rotation")
+	}
+
+	upload, err := c.readFileUpload(queued)
+	if err != nil {
+		t.Fatalf("readFileUpload: %v", err)
+	}
+	if !bytes.Equal(upload.data, report) {
+		t.Errorf("upload data = %q, want the plaintext", upload.data)
+	}
+	if upload.fileName != "statement.pdf" || upload.mimeType != "application/pdf" || upload.uploadType != whatsmeow.MediaDocument {
+		t.Errorf("upload = %s %s %s, want statement.pdf as a PDF document", upload.fileName, upload.mimeType, upload.uploadType)
+	}
+
+	plainPath, cleanup, err := c.plaintextMediaPath(queued)
+	if err != nil {
+		t.Fatalf("plaintextMediaPath: %v", err)
+	}
+	if data, _ := os.ReadFile(plainPath); !bytes.Equal(data, report) {
+		t.Errorf("plaintext copy = %q", data)
+	}
+	cleanup()
+	if _, err := os.Stat(plainPath); !os.IsNotExist(err) {
+		t.Errorf("plaintext copy was not removed: %v", err)
+	}
+}
+
+func TestWrittenMediaIsEncrypted(t *testing.T) {
+	c := encryptedMediaClient(t)
+	path := filepath.Join(c.mediaDir, "voice_ABC.ogg")
+	if err := c.writeMediaFile(path, []byte("OggS voice")); err != nil {
+		t.Fatalf("writeMediaFile: %v", err)
+	}
+	if !models.IsEncryptedFile(path) {
+		t.Fatal("downloaded media was written in plaintext")
+	}
+
+	c.enc = nil
+	if _, err := c.readMediaFile(path); err != models.ErrNoEncryptionKey {
+		t.Errorf("readMediaFile without a key = %v, want ErrNoEncryptionKey", err)
+	}
+}
+
+// encryptedMediaClientWithDB adds a message database to encryptedMediaClient
+func encryptedMediaClientWithDB(t *testing.T) *Client {
+	t.Helper()
+	c := encryptedMediaClient(t)
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c.db = db
+	return c
+}
+
+func TestScheduledFileIsSentDecryptedAfterRotation(t *testing.T) {
+	c := encryptedMediaClientWithDB(t)
+	db := c.db
+
+	invoice := []byte("%PDF-1.4 invoice 2041")
+	if err := os.WriteFile(filepath.Join(c.mediaDir, "invoice.pdf"), invoice, 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := scheduler.New(db, c, filepath.Join(c.mediaDir, "scheduled"))
+	sendAt := time.Now().Add(100 * time.Millisecond)
+	m := &models.ScheduledMessage{
+		Recipient: "353851234567@s.whatsapp.net",
+		Kind:      models.ScheduledFile,
+		Text:      "Your invoice",
+		MediaPath: "invoice.pdf",
+		SendAt:    &sendAt,
+	}
+	if err := s.Create(m); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// The server restarts with encryption on before the schedule is due
+	ageMedia(t, filepath.Join(c.mediaDir, "invoice.pdf"))
+	ageMedia(t, m.MediaPath)
+	if n, err := c.rotateMediaEncryption(); err != nil || n != 2 {
+		t.Fatalf("rotateMediaEncryption = %d, %v; want 2 files", n, err)
+	}
+
+	time.Sleep(time.Until(sendAt))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Run(ctx)
+
+	run, err := s.Get(m.ID)
+	if err != nil || run.LastOutboxID == 0 {
+		t.Fatalf("schedule did not run: %+v, %v", run, err)
+	}
+	queued, err := c.OutboxMessage(run.LastOutboxID)
+	if err != nil {
+		t.Fatalf("OutboxMessage: %v", err)
+	}
+	upload, err := c.readFileUpload(queued.MediaPath)
+	if err != nil {
+		t.Fatalf("readFileUpload: %v", err)
+	}
+	if !bytes.Equal(upload.data, invoice) || upload.mimeType != "application/pdf" {
+		t.Errorf("scheduled upload = %q (%s), want the plaintext PDF", upload.data, upload.mimeType)
+	}
+}
+
+func TestBroadcastFileIsSentDecryptedAfterRotation(t *testing.T) {
+	c := encryptedMediaClientWithDB(t)
+
+	flyer := []byte("\x89PNG\r\n\x1a\n holiday hours")
+	if err := os.WriteFile(filepath.Join(c.mediaDir, "flyer.png"), flyer, 0600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := broadcast.New(c.db, c, filepath.Join(c.mediaDir, "broadcasts")).Create(&broadcast.Request{
+		Template:   "We are open until 14:00 on the 24th",
+		MediaPath:  "flyer.png",
+		Recipients: []broadcast.Recipient{{To: "+353 85 123 4567"}},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	ageMedia(t, b.MediaPath)
+	if _, err := c.rotateMediaEncryption(); err != nil {
+		t.Fatalf("rotateMediaEncryption: %v", err)
+	}
+	if !models.IsEncryptedFile(b.MediaPath) {
+		t.Fatal("broadcast file was not encrypted by the rotation")
+	}
+
+	// Queue the file the way the broadcast sender does once connected
+	queued, err := c.QueueFile("353851234567@s.whatsapp.net", b.MediaPath, "We are open until 14:00 on the 24th", "broadcast-1-1")
+	if err != nil {
+		t.Fatalf("QueueFile: %v", err)
+	}
+	upload, err := c.readFileUpload(queued.MediaPath)
+	if err != nil {
+		t.Fatalf("readFileUpload: %v", err)
+	}
+	if !bytes.Equal(upload.data, flyer) || upload.uploadType != whatsmeow.MediaImage {
+		t.Errorf("broadcast upload = %q (%s), want the plaintext image", upload.data, upload.uploadType)
+	}
+}
@@ -0,0 +1,174 @@
+package whatsapp
+
+import (
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-go-mcp/models"
+)
+
+// Event types published to subscribers
+const (
+	EventMessage    = "message"
+	EventReceipt    = "receipt"
+	EventPresence   = "presence"
+	EventGroup      = "group"
+	EventConnection = "connection"
+)
+
+// EventTypes lists every event type that can be published
+var EventTypes = []string{EventMessage, EventReceipt, EventPresence, EventGroup, EventConnection}
+
+// Event is a normalized WhatsApp event published to subscribers such as
+// webhooks. Data holds a *models.Message for message events and one of the
+// *Event structs below for the other types.
+type Event struct {
+	Type    string      `json:"type"`
+	Time    time.Time   `json:"time"`
+	ChatJID string      `json:"chat_jid,omitempty"`
+	Sender  string      `json:"sender,omitempty"`
+	Data    interface{} `json:"data"`
+}
+
+// ReceiptEvent reports that messages were delivered, read or played
+type ReceiptEvent struct {
+	Type       string   `json:"type"` // "delivered", "read", "played", ...
+	MessageIDs []string `json:"message_ids"`
+}
+
+// PresenceEvent reports a contact going online or offline
+type PresenceEvent struct {
+	Unavailable bool      `json:"unavailable"`
+	LastSeen    time.Time `json:"last_seen,omitempty"`
+}
+
+// GroupEvent reports a change to a group or joining a group
+type GroupEvent struct {
+	Change  string   `json:"change"` // "joined" or "updated"
+	Name    string   `json:"name,omitempty"`
+	Topic   string   `json:"topic,omitempty"`
+	Join    []string `json:"join,omitempty"`
+	Leave   []string `json:"leave,omitempty"`
+	Promote []string `json:"promote,omitempty"`
+	Demote  []string `json:"demote,omitempty"`
+}
+
+// ConnectionEvent reports a change of the connection to WhatsApp, published
+// by the connection supervisor
+type ConnectionEvent struct {
+	State  string `json:"state"` // one of the State constants
+	Reason string `json:"reason,omitempty"`
+}
+
+// Subscribe registers fn to be called for every published event and returns
+// a function that removes the subscription. fn is called synchronously from
+// the event handler and must not block.
+func (c *Client) Subscribe(fn func(Event)) func() {
+	c.subscribersMu.Lock()
+	defer c.subscribersMu.Unlock()
+
+	if c.subscribers == nil {
+		c.subscribers = make(map[int]func(Event))
+	}
+	id := c.nextSubscriberID
+	c.nextSubscriberID++
+	c.subscribers[id] = fn
+
+	return func() {
+		c.subscribersMu.Lock()
+		delete(c.subscribers, id)
+		c.subscribersMu.Unlock()
+	}
+}
+
+// publish delivers an event to all subscribers
+func (c *Client) publish(evt Event) {
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+
+	c.subscribersMu.RLock()
+	defer c.subscribersMu.RUnlock()
+	for _, fn := range c.subscribers {
+		fn(evt)
+	}
+}
+
+// storeMessage stores a message and publishes it as a message event
+func (c *Client) storeMessage(msg *models.Message) error {
+	if err := c.db.StoreMessage(msg); err != nil {
+		return err
+	}
+	c.publish(Event{
+		Type:    EventMessage,
+		Time:    msg.Time,
+		ChatJID: msg.ChatJID,
+		Sender:  msg.Sender,
+		Data:    msg,
+	})
+	return nil
+}
+
+// publishWhatsAppEvent normalizes a whatsmeow event other than a message and
+// publishes it. Events that subscribers do not care about are ignored.
+func (c *Client) publishWhatsAppEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Receipt:
+		receiptType := string(v.Type)
+		if v.Type == types.ReceiptTypeDelivered {
+			receiptType = "delivered"
+		}
+		c.publish(Event{
+			Type:    EventReceipt,
+			Time:    v.Timestamp,
+			ChatJID: v.Chat.String(),
+			Sender:  v.Sender.String(),
+			Data:    &ReceiptEvent{Type: receiptType, MessageIDs: v.MessageIDs},
+		})
+	case *events.Presence:
+		c.publish(Event{
+			Type:   EventPresence,
+			Sender: v.From.String(),
+			Data:   &PresenceEvent{Unavailable: v.Unavailable, LastSeen: v.LastSeen},
+		})
+	case *events.JoinedGroup:
+		c.publish(Event{
+			Type:    EventGroup,
+			ChatJID: v.JID.String(),
+			Data:    &GroupEvent{Change: "joined", Name: v.Name, Topic: v.Topic},
+		})
+	case *events.GroupInfo:
+		group := &GroupEvent{
+			Change:  "updated",
+			Join:    jidStrings(v.Join),
+			Leave:   jidStrings(v.Leave),
+			Promote: jidStrings(v.Promote),
+			Demote:  jidStrings(v.Demote),
+		}
+		if v.Name != nil {
+			group.Name = v.Name.Name
+		}
+		if v.Topic != nil {
+			group.Topic = v.Topic.Topic
+		}
+		sender := ""
+		if v.Sender != nil {
+			sender = v.Sender.String()
+		}
+		c.publish(Event{Type: EventGroup, Time: v.Timestamp, ChatJID: v.JID.String(), Sender: sender, Data: group})
+	}
+}
+
+// jidStrings converts JIDs to their string form
+func jidStrings(jids []types.JID) []string {
+	if len(jids) == 0 {
+		return nil
+	}
+	out := make([]string, len(jids))
+	for i, jid := range jids {
+		out[i] = jid.String()
+	}
+	return out
+}
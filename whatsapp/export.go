@@ -0,0 +1,276 @@
+package whatsapp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/models"
+)
+
+// Chat export formats supported by ExportChat
+const (
+	ExportFormatText  = "txt"
+	ExportFormatJSONL = "jsonl"
+	ExportFormatHTML  = "html"
+)
+
+// ErrUnsupportedExportFormat is returned for an unknown chat export format
+var ErrUnsupportedExportFormat = errors.New("unsupported export format")
+
+// ExportContentType returns the MIME type of a chat export format
+func ExportContentType(format string) (string, error) {
+	switch format {
+	case ExportFormatText:
+		return "text/plain; charset=utf-8", nil
+	case ExportFormatJSONL:
+		return "application/x-ndjson", nil
+	case ExportFormatHTML:
+		return "text/html; charset=utf-8", nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedExportFormat, format)
+	}
+}
+
+// chatExporter renders a chat one message at a time
+type chatExporter struct {
+	client *Client
+	w      *bufio.Writer
+	chat   string
+	media  map[string]string
+	names  map[string]string
+}
+
+// ExportChat writes the full history of a chat to w in the given format.
+// Messages are streamed from the database so large chats are never held in
+// memory. The txt format mirrors the layout of the phone's "Export chat",
+// jsonl writes one models.Message per line and html is a self-contained
+// transcript with images inlined from the media directory.
+func (c *Client) ExportChat(chatJID, format string, w io.Writer) error {
+	if _, err := ExportContentType(format); err != nil {
+		return err
+	}
+	chatJID, err := normalizeContactJID(chatJID)
+	if err != nil {
+		return err
+	}
+
+	media, err := c.mediaIndex()
+	if err != nil {
+		return fmt.Errorf("failed to index media directory: %w", err)
+	}
+
+	e := &chatExporter{
+		client: c,
+		w:      bufio.NewWriter(w),
+		chat:   chatJID,
+		media:  media,
+		names:  make(map[string]string),
+	}
+
+	var write func(*models.Message) error
+	switch format {
+	case ExportFormatText:
+		write = e.writeText
+	case ExportFormatJSONL:
+		encoder := json.NewEncoder(e.w)
+		write = func(msg *models.Message) error { return encoder.Encode(msg) }
+	case ExportFormatHTML:
+		e.writeHTMLHeader()
+		write = e.writeHTML
+	}
+
+	count := 0
+	err = c.db.IterateMessages(chatJID, func(msg *models.Message) error {
+		count++
+		return write(msg)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export chat: %w", err)
+	}
+
+	if format == ExportFormatHTML {
+		e.w.WriteString("</main>\n</body>\n</html>\n")
+	}
+
+	log.Printf("📤 Exported %d messages from %s as %s", count, chatJID, format)
+	return e.w.Flush()
+}
+
+// writeText writes a message in the phone's export layout:
+// "dd/mm/yyyy, HH:MM - Sender: message"
+func (e *chatExporter) writeText(msg *models.Message) error {
+	body := msg.Content
+	if attachment := e.attachmentLine(msg); attachment != "" {
+		if body != "" {
+			body = attachment + "\n" + body
+		} else {
+			body = attachment
+		}
+	}
+	_, err := fmt.Fprintf(e.w, "%s - %s: %s\n",
+		msg.Time.Local().Format("02/01/2006, 15:04"), e.senderName(msg), body)
+	return err
+}
+
+// attachmentLine returns the attachment placeholder used by the phone export
+func (e *chatExporter) attachmentLine(msg *models.Message) string {
+	if msg.MediaType == "" || msg.MediaType == "text" {
+		return ""
+	}
+	if path, ok := e.media[msg.MessageID]; ok {
+		return filepath.Base(path) + " (file attached)"
+	}
+	return "<Media omitted>"
+}
+
+// writeHTMLHeader writes the start of the self-contained HTML transcript
+func (e *chatExporter) writeHTMLHeader() {
+	title := e.chat
+	if chat, err := e.client.db.GetChatByJID(e.chat); err == nil && chat.Name != "" {
+		title = chat.Name
+	}
+
+	fmt.Fprintf(e.w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; background: #efeae2; margin: 0; }
+header { background: #075e54; color: #fff; padding: 12px 16px; }
+header p { margin: 4px 0 0; font-size: 0.85em; opacity: 0.8; }
+main { max-width: 800px; margin: 0 auto; padding: 16px; }
+.msg { background: #fff; border-radius: 8px; padding: 6px 10px; margin: 6px 0; max-width: 75%%; overflow-wrap: anywhere; }
+.msg.me { background: #d9fdd3; margin-left: auto; }
+.sender { font-weight: bold; font-size: 0.85em; color: #075e54; }
+.content { white-space: pre-wrap; }
+.media { font-style: italic; color: #667781; }
+.msg img { max-width: 100%%; border-radius: 4px; display: block; margin: 4px 0; }
+time { display: block; text-align: right; font-size: 0.75em; color: #667781; }
+</style>
+</head>
+<body>
+<header>
+<h1>%s</h1>
+<p>%s &middot; exported %s</p>
+</header>
+<main>
+`, html.EscapeString(title), html.EscapeString(title), html.EscapeString(e.chat),
+		time.Now().Format(time.RFC3339))
+}
+
+// writeHTML writes a message as an HTML block, inlining images as data URIs
+func (e *chatExporter) writeHTML(msg *models.Message) error {
+	class := "msg"
+	if msg.IsFromMe {
+		class += " me"
+	}
+	fmt.Fprintf(e.w, "<div class=\"%s\" id=\"%s\">\n<div class=\"sender\">%s</div>\n",
+		class, html.EscapeString(msg.MessageID), html.EscapeString(e.senderName(msg)))
+
+	if msg.MediaType != "" && msg.MediaType != "text" {
+		if err := e.writeHTMLMedia(msg); err != nil {
+			return err
+		}
+	}
+	if msg.Content != "" {
+		fmt.Fprintf(e.w, "<div class=\"content\">%s</div>\n", html.EscapeString(msg.Content))
+	}
+
+	_, err := fmt.Fprintf(e.w, "<time datetime=\"%s\">%s</time>\n</div>\n",
+		msg.Time.Format(time.RFC3339), msg.Time.Local().Format("02/01/2006 15:04"))
+	return err
+}
+
+// writeHTMLMedia writes an inline image or an attachment placeholder
+func (e *chatExporter) writeHTMLMedia(msg *models.Message) error {
+	path, ok := e.media[msg.MessageID]
+	if !ok {
+		fmt.Fprintf(e.w, "<div class=\"media\">&lt;%s omitted&gt;</div>\n", html.EscapeString(msg.MediaType))
+		return nil
+	}
+
+	if msg.MediaType == "image" {
+		data, err := e.client.readMediaFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read media file %s: %w", path, err)
+		}
+		fmt.Fprintf(e.w, "<img alt=\"%s\" src=\"data:%s;base64,",
+			html.EscapeString(filepath.Base(path)), http.DetectContentType(data))
+		encoder := base64.NewEncoder(base64.StdEncoding, e.w)
+		encoder.Write(data)
+		encoder.Close()
+		e.w.WriteString("\">\n")
+		return nil
+	}
+
+	fmt.Fprintf(e.w, "<div class=\"media\">%s (%s attached)</div>\n",
+		html.EscapeString(filepath.Base(path)), html.EscapeString(msg.MediaType))
+	return nil
+}
+
+// senderName resolves the display name of a message sender, caching lookups
+// for the duration of the export
+func (e *chatExporter) senderName(msg *models.Message) string {
+	if msg.IsFromMe {
+		if e.client.client.Store.PushName != "" {
+			return e.client.client.Store.PushName
+		}
+		return "You"
+	}
+
+	if name, ok := e.names[msg.Sender]; ok {
+		return name
+	}
+	name := e.client.lookupName(msg.Sender)
+	e.names[msg.Sender] = name
+	return name
+}
+
+// lookupName finds a contact name in the message database or the WhatsApp
+// contact store, falling back to the phone number
+func (c *Client) lookupName(sender string) string {
+	jid, err := types.ParseJID(sender)
+	if err != nil {
+		return sender
+	}
+	jid = jid.ToNonAD()
+
+	if contact, err := c.db.GetContact(jid.String()); err == nil {
+		if contact.Name != "" {
+			return contact.Name
+		}
+		if contact.PushName != "" {
+			return contact.PushName
+		}
+	}
+
+	// The contact store is only available once the device has been paired
+	if contacts := c.wa().Store.Contacts; contacts != nil {
+		if info, err := contacts.GetContact(context.Background(), jid); err == nil && info.Found {
+			if info.FullName != "" {
+				return info.FullName
+			}
+			if info.PushName != "" {
+				return info.PushName
+			}
+		}
+	}
+
+	if jid.Server == types.DefaultUserServer {
+		return "+" + jid.User
+	}
+	return jid.User
+}
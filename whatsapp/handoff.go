@@ -0,0 +1,157 @@
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"whatsapp-go-mcp/models"
+)
+
+// Errors returned when changing the bot state of a chat
+var (
+	ErrInvalidBotMode = errors.New("invalid bot mode")
+	ErrInvalidChatJID = errors.New("invalid chat JID")
+)
+
+// DefaultHandoffKeywords are the phrases with which customers ask for a human
+var DefaultHandoffKeywords = []string{"talk to a human", "speak to a human", "human agent", "real person"}
+
+// HandoffSettings configures how chats are handed over to staff
+type HandoffSettings struct {
+	// PauseDuration is how long the bot stays quiet in a chat after a staff
+	// member replies from the phone, and the default for API pauses
+	PauseDuration time.Duration
+	// StaffGroupJID is notified when a customer asks for a human
+	StaffGroupJID string
+	// Keywords are matched as whole words, ignoring case; none disables escalation
+	Keywords []string
+}
+
+// escalationReply is sent to a customer who asked for a human
+const escalationReply = "I've asked a member of our team to take over. They'll reply here as soon as possible."
+
+// SetHandoff configures human handoff. It must be called before connecting.
+func (c *Client) SetHandoff(settings HandoffSettings) {
+	c.handoff = settings
+	c.escalationPattern = nil
+	if len(settings.Keywords) > 0 {
+		quoted := make([]string, len(settings.Keywords))
+		for i, keyword := range settings.Keywords {
+			quoted[i] = regexp.QuoteMeta(strings.TrimSpace(keyword))
+		}
+		c.escalationPattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+}
+
+// ChatBotState returns whether the bot answers in a chat
+func (c *Client) ChatBotState(chatJID string) (*models.ChatBotState, error) {
+	chatJID, err := normalizeContactJID(chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatJID, err)
+	}
+	return c.db.GetChatBotState(chatJID)
+}
+
+// SetChatBotMode switches the bot on or off in a chat. A pause lasts for the
+// given duration, or the configured pause duration if it is zero.
+func (c *Client) SetChatBotMode(chatJID, mode string, pause time.Duration, reason, updatedBy string) (*models.ChatBotState, error) {
+	chatJID, err := normalizeContactJID(chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatJID, err)
+	}
+
+	state := &models.ChatBotState{ChatJID: chatJID, Mode: mode, Reason: reason, UpdatedBy: updatedBy}
+	switch mode {
+	case models.BotModeAuto, models.BotModeHumanOnly:
+	case models.BotModePaused:
+		if pause <= 0 {
+			pause = c.handoff.PauseDuration
+		}
+		until := time.Now().Add(pause)
+		state.PausedUntil = &until
+	default:
+		return nil, fmt.Errorf("%w %q (use %s, %s or %s)", ErrInvalidBotMode, mode,
+			models.BotModeAuto, models.BotModePaused, models.BotModeHumanOnly)
+	}
+
+	if err := c.db.SetChatBotState(state); err != nil {
+		return nil, err
+	}
+	log.Printf("🙋 Bot mode in %s set to %s by %s", chatJID, mode, updatedBy)
+	return state, nil
+}
+
+// botActiveIn reports whether the bot may answer in a chat
+func (c *Client) botActiveIn(chatJID string) bool {
+	state, err := c.db.GetChatBotState(chatJID)
+	if err != nil {
+		log.Printf("⚠️ Failed to load bot state for %s: %v", chatJID, err)
+		return true
+	}
+	return state.Active(time.Now())
+}
+
+// pauseForStaffReply pauses the bot in a chat a staff member just wrote in
+// from the phone. Chats handed over to humans stay that way.
+func (c *Client) pauseForStaffReply(message *models.Message) {
+	if c.handoff.PauseDuration <= 0 {
+		return
+	}
+	state, err := c.db.GetChatBotState(message.ChatJID)
+	if err != nil {
+		log.Printf("⚠️ Failed to load bot state for %s: %v", message.ChatJID, err)
+		return
+	}
+	if state.Mode == models.BotModeHumanOnly {
+		return
+	}
+
+	until := time.Now().Add(c.handoff.PauseDuration)
+	state.Mode = models.BotModePaused
+	state.PausedUntil = &until
+	state.Reason = "staff replied from the phone"
+	state.UpdatedBy = "phone"
+	if err := c.db.SetChatBotState(state); err != nil {
+		log.Printf("❌ Failed to pause bot in %s: %v", message.ChatJID, err)
+		return
+	}
+	log.Printf("🙋 Staff replied in %s, bot paused until %s", message.ChatJID, until.Format(time.RFC3339))
+}
+
+// isEscalationRequest reports whether a customer message asks for a human
+func (c *Client) isEscalationRequest(message *models.Message) bool {
+	return c.escalationPattern != nil && message.ChatJID != c.handoff.StaffGroupJID &&
+		c.escalationPattern.MatchString(message.Content)
+}
+
+// escalateToHuman hands a chat over to staff: the bot stops answering, the
+// customer is told, and the staff group is notified
+func (c *Client) escalateToHuman(message *models.Message) {
+	if _, err := c.SetChatBotMode(message.ChatJID, models.BotModeHumanOnly, 0, "customer asked for a human", "customer"); err != nil {
+		log.Printf("❌ Failed to hand %s over to staff: %v", message.ChatJID, err)
+		return
+	}
+	c.recordAudit(&models.AuditEntry{
+		ActorType: models.ActorBot,
+		Action:    "bot.handoff",
+		Recipient: message.ChatJID,
+		Details:   map[string]string{"reason": "customer asked for a human"},
+	})
+	if err := c.SendMessage(message.ChatJID, escalationReply); err != nil {
+		log.Printf("❌ Failed to confirm handoff to %s: %v", message.ChatJID, err)
+	}
+
+	if c.handoff.StaffGroupJID == "" {
+		log.Printf("⚠️ %s asked for a human but no staff group is configured", message.ChatJID)
+		return
+	}
+	notice := fmt.Sprintf("🙋 %s asked to talk to a human.\nChat: %s\nMessage: %s\n\nThe bot is off in this chat until it is switched back to auto.",
+		c.lookupName(message.ChatJID), message.ChatJID, message.Content)
+	if err := c.SendMessage(c.handoff.StaffGroupJID, notice); err != nil {
+		log.Printf("❌ Failed to notify staff group about %s: %v", message.ChatJID, err)
+	}
+}
@@ -0,0 +1,48 @@
+package whatsapp
+
+import (
+	"log"
+	"time"
+
+	"whatsapp-go-mcp/hours"
+	"whatsapp-go-mcp/models"
+)
+
+// SetBusinessHours enables away messages and the after-hours bot mode. It
+// must be called before connecting.
+func (c *Client) SetBusinessHours(policy *hours.Policy) {
+	c.hours = policy
+	log.Printf("🕘 Business hours enabled (%s, after-hours bot: %s)", policy.Calendar.Location, policy.AfterHoursBot)
+}
+
+// botMode returns how the LlamaStack bot behaves right now
+func (c *Client) botMode() hours.BotMode {
+	return c.hours.BotMode(time.Now())
+}
+
+// sendAwayMessage sends the away message for an incoming direct message
+// received outside business hours, unless the contact already got one since
+// the business closed
+func (c *Client) sendAwayMessage(message *models.Message) {
+	if c.hours == nil || c.hours.AwayMessage == "" || message.IsFromMe {
+		return
+	}
+	closedSince := c.hours.Calendar.ClosedSince(message.Time)
+	if closedSince.IsZero() {
+		return
+	}
+
+	claimed, err := c.db.ClaimAwayNotice(message.ChatJID, closedSince)
+	if err != nil {
+		log.Printf("❌ Failed to record away message for %s: %v", message.ChatJID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	log.Printf("🌙 Sending away message to %s", message.ChatJID)
+	if err := c.SendMessage(message.ChatJID, c.hours.FormatAwayMessage(message.Time)); err != nil {
+		log.Printf("❌ Failed to send away message to %s: %v", message.ChatJID, err)
+	}
+}
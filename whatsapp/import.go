@@ -0,0 +1,419 @@
+package whatsapp
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/chatimport"
+	"whatsapp-go-mcp/models"
+)
+
+// importMergeWindow is how far apart an imported message and a live message
+// with the same content may be to be treated as the same message. Android
+// exports only have minute precision.
+const importMergeWindow = 2 * time.Minute
+
+// ErrInvalidExport is returned for an upload that is not a usable chat export
+var ErrInvalidExport = errors.New("invalid chat export")
+
+// ImportOptions control how a chat export is mapped onto the message store
+type ImportOptions struct {
+	// Self is the display name the export uses for your own messages. Defaults
+	// to the push name of the paired device.
+	Self string
+	// DateOrder overrides detection of the export's date format
+	DateOrder chatimport.DateOrder
+	// Location is the time zone of the phone that made the export
+	Location *time.Location
+}
+
+// ImportResult summarizes a chat import
+type ImportResult struct {
+	ChatJID    string `json:"chat_jid"`
+	Parsed     int    `json:"parsed"`
+	Imported   int    `json:"imported"`
+	Duplicates int    `json:"duplicates"` // already imported earlier
+	Merged     int    `json:"merged"`     // already present from the live connection
+	System     int    `json:"system"`     // system notices, which are not stored
+	MediaFiles int    `json:"media_files"`
+}
+
+// importSource is an opened chat export: the transcript and, for zip
+// archives, the attached media files by name
+type importSource struct {
+	transcript io.ReadCloser
+	name       string
+	media      map[string]*zip.File
+	closer     io.Closer
+}
+
+// ImportChat imports a chat exported from the phone, either the bare .txt
+// transcript or the .zip archive including media, into the given chat.
+// Imported messages get stable synthetic IDs, so importing the same export
+// again only adds what is missing. Messages that were also received live are
+// skipped.
+func (c *Client) ImportChat(chatJID, exportPath string, opts ImportOptions) (*ImportResult, error) {
+	chatJID, err := normalizeContactJID(chatJID)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := openImportSource(exportPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.closer.Close()
+
+	messages, err := chatimport.Parse(src.transcript, chatimport.Options{
+		DateOrder: opts.DateOrder,
+		Location:  opts.Location,
+	})
+	src.transcript.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	chatimport.AssignIDs(chatJID, messages)
+
+	live, err := c.liveMessageIndex(chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load existing messages: %w", err)
+	}
+
+	self, err := c.importSelfName(chatJID, opts.Self, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{ChatJID: chatJID, Parsed: len(messages)}
+	senders := make(map[string]string)
+	var last *models.Message
+
+	for _, imported := range messages {
+		if imported.System {
+			result.System++
+			continue
+		}
+
+		msg := &models.Message{
+			Time:      imported.Time,
+			Content:   imported.Content,
+			IsFromMe:  imported.Sender == self,
+			MediaType: importMediaType(imported),
+			Filename:  imported.Attachment,
+			ChatJID:   chatJID,
+			MessageID: imported.ID,
+		}
+		if _, err := c.db.GetMessageByID(msg.MessageID); err == nil {
+			result.Duplicates++
+			continue
+		}
+		if live.contains(msg) {
+			result.Merged++
+			continue
+		}
+
+		if msg.Sender = senders[imported.Sender]; msg.Sender == "" {
+			msg.Sender = c.importSenderJID(chatJID, imported.Sender, msg.IsFromMe)
+			senders[imported.Sender] = msg.Sender
+		}
+
+		if file, ok := src.media[imported.Attachment]; ok {
+			if err := c.importMediaFile(msg.MessageID, file); err != nil {
+				return result, fmt.Errorf("failed to import %s: %w", imported.Attachment, err)
+			}
+			result.MediaFiles++
+		}
+
+		if err := c.db.StoreMessage(msg); err != nil {
+			return result, fmt.Errorf("failed to store message: %w", err)
+		}
+		result.Imported++
+		last = msg
+	}
+
+	if last != nil {
+		if err := c.updateImportedChat(chatJID, src.name, last); err != nil {
+			return result, fmt.Errorf("failed to update chat: %w", err)
+		}
+	}
+
+	log.Printf("📥 Imported %d of %d messages into %s (%d duplicates, %d merged with live messages, %d media files)",
+		result.Imported, result.Parsed, chatJID, result.Duplicates, result.Merged, result.MediaFiles)
+	return result, nil
+}
+
+// openImportSource opens a .txt transcript or a .zip export archive
+func openImportSource(exportPath string) (*importSource, error) {
+	file, err := os.Open(exportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(file, magic)
+	if !bytes.Equal(magic[:n], []byte("PK\x03\x04")) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &importSource{transcript: io.NopCloser(file), name: filepath.Base(exportPath), closer: file}, nil
+	}
+	file.Close()
+
+	archive, err := zip.OpenReader(exportPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to open export archive: %v", ErrInvalidExport, err)
+	}
+
+	// The transcript is "_chat.txt" on iOS and "WhatsApp Chat with <name>.txt" on Android
+	var transcript *zip.File
+	for _, f := range archive.File {
+		name := path.Base(f.Name)
+		if !strings.HasSuffix(name, ".txt") || f.FileInfo().IsDir() {
+			continue
+		}
+		if transcript == nil || name == "_chat.txt" || strings.HasPrefix(name, "WhatsApp Chat") {
+			transcript = f
+		}
+	}
+	if transcript == nil {
+		archive.Close()
+		return nil, fmt.Errorf("%w: export archive contains no chat transcript (.txt)", ErrInvalidExport)
+	}
+
+	src := &importSource{media: make(map[string]*zip.File), closer: archive}
+	for _, f := range archive.File {
+		if f != transcript && !f.FileInfo().IsDir() {
+			src.media[path.Base(f.Name)] = f
+		}
+	}
+
+	if src.transcript, err = transcript.Open(); err != nil {
+		archive.Close()
+		return nil, err
+	}
+	src.name = path.Base(transcript.Name)
+	return src, nil
+}
+
+// liveIndex holds the times of the messages of a chat that did not come from
+// an import, keyed by direction, type and content, for merging
+type liveIndex map[string][]time.Time
+
+// liveMessageIndex indexes the live messages already stored for a chat
+func (c *Client) liveMessageIndex(chatJID string) (liveIndex, error) {
+	index := make(liveIndex)
+	err := c.db.IterateMessages(chatJID, func(msg *models.Message) error {
+		if !strings.HasPrefix(msg.MessageID, chatimport.IDPrefix) {
+			key := liveIndexKey(msg)
+			index[key] = append(index[key], msg.Time)
+		}
+		return nil
+	})
+	return index, err
+}
+
+func liveIndexKey(msg *models.Message) string {
+	return fmt.Sprintf("%t\x00%s\x00%s", msg.IsFromMe, msg.MediaType, strings.TrimSpace(msg.Content))
+}
+
+// contains reports whether a live message with the same direction, type and content
+// was sent close to the time of an imported message
+func (index liveIndex) contains(msg *models.Message) bool {
+	for _, t := range index[liveIndexKey(msg)] {
+		diff := t.Sub(msg.Time)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= importMergeWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// importSelfName determines the display name the export uses for our own
+// messages. In a direct chat it is whichever sender is not the contact.
+func (c *Client) importSelfName(chatJID, self string, messages []*chatimport.Message) (string, error) {
+	if self != "" {
+		return self, nil
+	}
+	if c.wa().Store.PushName != "" {
+		return c.wa().Store.PushName, nil
+	}
+
+	errUnknown := fmt.Errorf("%w: cannot tell which messages are your own; set the name the export uses for you", ErrInvalidExport)
+	jid, err := types.ParseJID(chatJID)
+	if err != nil || jid.Server != types.DefaultUserServer {
+		return "", errUnknown
+	}
+
+	names := c.contactNames(jid)
+	candidates := make(map[string]bool)
+	for _, msg := range messages {
+		if msg.Sender == "" || names[msg.Sender] || phoneDigits(msg.Sender) == jid.User {
+			continue
+		}
+		candidates[msg.Sender] = true
+	}
+
+	switch len(candidates) {
+	case 0:
+		// Only the contact wrote anything
+		return "", nil
+	case 1:
+		for name := range candidates {
+			return name, nil
+		}
+	}
+	return "", errUnknown
+}
+
+// contactNames returns the names a contact may appear under in an export
+func (c *Client) contactNames(jid types.JID) map[string]bool {
+	names := make(map[string]bool)
+	if chat, err := c.db.GetChatByJID(jid.String()); err == nil && chat.Name != "" {
+		names[chat.Name] = true
+	}
+	if contact, err := c.db.GetContact(jid.String()); err == nil {
+		names[contact.Name] = true
+		names[contact.PushName] = true
+	}
+	if contacts := c.wa().Store.Contacts; contacts != nil {
+		if info, err := contacts.GetContact(context.Background(), jid); err == nil && info.Found {
+			names[info.FullName] = true
+			names[info.PushName] = true
+		}
+	}
+	delete(names, "")
+	return names
+}
+
+// phoneDigits returns the digits of a phone number shown as a sender name,
+// such as "+353 85 123 4567", or "" if the name is not a phone number
+func phoneDigits(sender string) string {
+	phone := strings.NewReplacer(" ", "", "\u00a0", "", "-", "", "(", "", ")", "").Replace(sender)
+	if !strings.HasPrefix(phone, "+") || !isNumeric(phone[1:]) {
+		return ""
+	}
+	return phone[1:]
+}
+
+// importSenderJID maps a display name from the export to a JID. In a direct
+// chat everyone but us is the contact; in groups phone numbers map directly
+// and names are looked up in the contacts. Names that cannot be resolved are
+// kept as they are.
+func (c *Client) importSenderJID(chatJID, sender string, isFromMe bool) string {
+	if isFromMe {
+		if c.wa().Store.ID != nil {
+			return c.wa().Store.ID.ToNonAD().String()
+		}
+		return sender
+	}
+
+	if jid, err := types.ParseJID(chatJID); err == nil && jid.Server == types.DefaultUserServer {
+		return chatJID
+	}
+	if digits := phoneDigits(sender); digits != "" {
+		return types.NewJID(digits, types.DefaultUserServer).String()
+	}
+
+	if contacts, err := c.db.SearchContacts(sender); err == nil {
+		for _, contact := range contacts {
+			if strings.EqualFold(contact.Name, sender) || strings.EqualFold(contact.PushName, sender) {
+				return contact.JID
+			}
+		}
+	}
+	if contacts := c.wa().Store.Contacts; contacts != nil {
+		if all, err := contacts.GetAllContacts(context.Background()); err == nil {
+			for jid, info := range all {
+				if strings.EqualFold(info.FullName, sender) || strings.EqualFold(info.PushName, sender) {
+					return jid.String()
+				}
+			}
+		}
+	}
+	return sender
+}
+
+// importMediaType maps an attachment to the media types used for live messages
+func importMediaType(msg *chatimport.Message) string {
+	if msg.MediaOmitted {
+		return "unknown"
+	}
+	if msg.Attachment == "" {
+		return "text"
+	}
+	switch strings.ToLower(filepath.Ext(msg.Attachment)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return "image"
+	case ".mp4", ".3gp", ".mov":
+		return "video"
+	case ".opus":
+		// Voice notes are exported as Opus, other audio keeps its format
+		return "voice"
+	case ".ogg", ".m4a", ".mp3", ".aac", ".amr":
+		return "audio"
+	default:
+		return "document"
+	}
+}
+
+// importMediaFile copies an attachment from the export archive into the
+// media directory under the name live media uses
+func (c *Client) importMediaFile(messageID string, file *zip.File) error {
+	target := filepath.Join(c.mediaDir, mediaFileName(messageID, path.Base(file.Name)))
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return c.writeMediaFile(target, data)
+}
+
+// updateImportedChat creates the chat if it is new, or moves its last message
+// forward if the import contains newer messages
+func (c *Client) updateImportedChat(chatJID, transcriptName string, last *models.Message) error {
+	chat, err := c.db.GetChatByJID(chatJID)
+	if err != nil {
+		jid, _ := types.ParseJID(chatJID)
+		// Android names the transcript after the chat
+		name := chatJID
+		if title, ok := strings.CutPrefix(transcriptName, "WhatsApp Chat with "); ok {
+			name = strings.TrimSuffix(title, ".txt")
+		}
+		chat = &models.Chat{
+			JID:     chatJID,
+			Name:    name,
+			IsGroup: jid.Server == types.GroupServer,
+		}
+	} else if !last.Time.After(chat.LastMessageTime) {
+		return nil
+	}
+
+	chat.LastMessage = last.Content
+	chat.LastMessageTime = last.Time
+	return c.db.StoreChat(chat)
+}
@@ -0,0 +1,89 @@
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/ratelimit"
+)
+
+// ErrRateLimited is wrapped by RateLimitError
+var ErrRateLimited = errors.New("send rate limit exceeded")
+
+// RateLimitError is returned when queueing a message would exceed a send limit
+type RateLimitError struct {
+	Scope      string // "recipient" or "global"
+	Limit      ratelimit.Limit
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit of %s exceeded, retry in %s", e.Scope, e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// RetryDelay returns how long to wait before the message may be queued
+func (e *RateLimitError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// SendLimits protects contacts and the account from runaway senders, such as
+// an agent stuck in a loop
+type SendLimits struct {
+	// PerRecipient limits the messages queued for each recipient
+	PerRecipient ratelimit.Limit
+	// Global limits the messages queued for all recipients together
+	Global ratelimit.Limit
+	// BotLoop halts the bot in a chat that sends it more messages than this,
+	// which people do not type but another bot answering ours does
+	BotLoop ratelimit.Limit
+}
+
+// SetSendLimits configures send limits and bot loop detection. It must be
+// called before connecting.
+func (c *Client) SetSendLimits(limits SendLimits) {
+	c.recipientLimiter = ratelimit.New(limits.PerRecipient)
+	c.globalLimiter = ratelimit.New(limits.Global)
+	c.loopLimiter = ratelimit.New(limits.BotLoop)
+}
+
+// checkSendLimits takes a token for one message to recipient, or returns a
+// RateLimitError if either limit is exhausted
+func (c *Client) checkSendLimits(recipient string) error {
+	if ok, wait := c.recipientLimiter.Allow(recipient); !ok {
+		return &RateLimitError{Scope: "recipient", Limit: c.recipientLimiter.Limit(), RetryAfter: wait}
+	}
+	if ok, wait := c.globalLimiter.Allow("global"); !ok {
+		c.recipientLimiter.Refund(recipient)
+		return &RateLimitError{Scope: "global", Limit: c.globalLimiter.Limit(), RetryAfter: wait}
+	}
+	return nil
+}
+
+// detectBotLoop hands a chat over to staff if it is sending messages faster
+// than a person could, which happens when our bot and another keep answering
+// each other. It reports whether the bot was halted.
+func (c *Client) detectBotLoop(message *models.Message) bool {
+	if ok, _ := c.loopLimiter.Allow(message.ChatJID); ok {
+		return false
+	}
+	log.Printf("🚨 ALERT: %s sent more than %s, probably another bot; halting the bot in this chat",
+		message.ChatJID, c.loopLimiter.Limit())
+	if _, err := c.SetChatBotMode(message.ChatJID, models.BotModeHumanOnly, 0, "possible loop with another bot", "loop detection"); err != nil {
+		log.Printf("❌ Failed to halt bot in %s: %v", message.ChatJID, err)
+	}
+	c.recordAudit(&models.AuditEntry{
+		ActorType: models.ActorBot,
+		Action:    "bot.loop_detected",
+		Recipient: message.ChatJID,
+		Status:    models.AuditDenied,
+		Details:   map[string]string{"limit": c.loopLimiter.Limit().String()},
+	})
+	return true
+}
@@ -0,0 +1,84 @@
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mediaFileName returns the name under which media for a message is stored
+// in the media directory
+func mediaFileName(messageID, filename string) string {
+	return fmt.Sprintf("%s_%s", messageID, filename)
+}
+
+// messageIDFromMediaFile extracts the message ID from a media file name.
+// It understands both "<id>_<filename>" and "voice_<id>_<timestamp>.ogg".
+func messageIDFromMediaFile(name string) string {
+	name = strings.TrimPrefix(name, "voice_")
+	if idx := strings.Index(name, "_"); idx > 0 {
+		return name[:idx]
+	}
+	return ""
+}
+
+// mediaIndex maps message IDs to the files stored for them in the top level
+// of the media directory
+func (c *Client) mediaIndex() (map[string]string, error) {
+	entries, err := os.ReadDir(c.mediaDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+
+	index := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if id := messageIDFromMediaFile(entry.Name()); id != "" {
+			index[id] = filepath.Join(c.mediaDir, entry.Name())
+		}
+	}
+	return index, nil
+}
+
+// ErrMediaPathNotAllowed is returned for a media path outside the media directory
+var ErrMediaPathNotAllowed = errors.New("media_path must be a file inside the media directory")
+
+// CheckMediaPath resolves a media path given in an API request and checks
+// that it names a regular file inside the media directory, so that requests
+// cannot send arbitrary files from the server. Relative paths are taken
+// relative to the media directory.
+func (c *Client) CheckMediaPath(path string) (string, error) {
+	root, err := filepath.EvalSymlinks(c.mediaDir)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.mediaDir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMediaPathNotAllowed, err)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrMediaPathNotAllowed
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.Mode().IsRegular() {
+		return "", ErrMediaPathNotAllowed
+	}
+	return resolved, nil
+}
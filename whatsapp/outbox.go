@@ -0,0 +1,349 @@
+package whatsapp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/models"
+)
+
+// Errors returned when queueing outbound messages
+var (
+	ErrInvalidRecipient    = errors.New("invalid recipient")
+	ErrIdempotencyConflict = errors.New("idempotency key was already used for a different request")
+)
+
+const (
+	// outboxMaxAttempts is the number of attempts before a message is marked failed
+	outboxMaxAttempts = 8
+	// outboxBaseRetryDelay is the delay before the first retry; it doubles with every attempt
+	outboxBaseRetryDelay = 5 * time.Second
+	// outboxMaxRetryDelay caps the delay between attempts
+	outboxMaxRetryDelay = 10 * time.Minute
+	// outboxPollInterval is how often the queue is checked for retries that became due
+	outboxPollInterval = 5 * time.Second
+	// outboxBatchSize is the maximum number of messages attempted per poll
+	outboxBatchSize = 50
+	// outboxSendTimeout bounds a single attempt, including media upload
+	outboxSendTimeout = 2 * time.Minute
+)
+
+// QueueText queues a text message and sends it right away if connected. The
+// returned entry has status sent if it went out, or queued if the outbox
+// worker will retry it. Reusing an idempotency key returns the original entry.
+func (c *Client) QueueText(recipient, text, idempotencyKey string) (*models.OutboxMessage, error) {
+	return c.queue(&models.OutboxMessage{
+		IdempotencyKey: idempotencyKey,
+		Recipient:      recipient,
+		Kind:           models.OutboxText,
+		Body:           text,
+	})
+}
+
+// QueueAudio queues an audio file as a voice message and sends it right away
+// if connected. The file is copied, so the caller may remove it afterwards.
+func (c *Client) QueueAudio(recipient, filePath, idempotencyKey string) (*models.OutboxMessage, error) {
+	return c.queueMedia(&models.OutboxMessage{
+		IdempotencyKey: idempotencyKey,
+		Recipient:      recipient,
+		Kind:           models.OutboxAudio,
+	}, filePath)
+}
+
+// QueueFile queues an image, video or document with a caption and sends it
+// right away if connected. The file is copied, so the caller may remove it
+// afterwards.
+func (c *Client) QueueFile(recipient, filePath, caption, idempotencyKey string) (*models.OutboxMessage, error) {
+	return c.queueMedia(&models.OutboxMessage{
+		IdempotencyKey: idempotencyKey,
+		Recipient:      recipient,
+		Kind:           models.OutboxFile,
+		Body:           caption,
+	}, filePath)
+}
+
+// queueMedia copies a file into the outbox directory and queues m with it
+func (c *Client) queueMedia(m *models.OutboxMessage, filePath string) (*models.OutboxMessage, error) {
+	dir := filepath.Join(c.mediaDir, "outbox")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	// A retry with the same idempotency key has to send the same file
+	if m.IdempotencyKey != "" {
+		data, err := c.readMediaFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to queue file: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		m.MediaDigest = hex.EncodeToString(sum[:])
+	}
+	queued := filepath.Join(dir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(filePath)))
+	if err := copyFile(filePath, queued); err != nil {
+		return nil, fmt.Errorf("failed to queue file: %w", err)
+	}
+
+	m.MediaPath = queued
+	stored, err := c.queue(m)
+	if err != nil || stored.MediaPath != queued {
+		os.Remove(queued)
+	}
+	return stored, err
+}
+
+// OutboxMessage returns the delivery state of a queued message
+func (c *Client) OutboxMessage(id int64) (*models.OutboxMessage, error) {
+	return c.db.GetOutboxMessage(id)
+}
+
+// queue stores a message in the outbox and makes a first attempt at sending it
+func (c *Client) queue(m *models.OutboxMessage) (*models.OutboxMessage, error) {
+	recipientJID, err := types.ParseJID(m.Recipient)
+	if err != nil || recipientJID.User == "" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidRecipient, m.Recipient)
+	}
+	m.Recipient = recipientJID.String()
+
+	decision, err := c.checkSendPolicy(m, recipientJID)
+	if err != nil {
+		c.auditBlocked(m, decision, err)
+		return nil, err
+	}
+
+	// Retries of an idempotent request do not count against the send limits
+	if !c.isOutboxRetry(m) {
+		if err := c.checkSendLimits(m.Recipient); err != nil {
+			log.Printf("🚦 Not queueing %s message to %s: %v", m.Kind, m.Recipient, err)
+			c.auditBlocked(m, decision, err)
+			return nil, err
+		}
+	}
+
+	stored, created, err := c.db.EnqueueOutboxMessage(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue message: %w", err)
+	}
+	if !created {
+		// The body itself is dropped once sent, so it is compared by digest.
+		// Messages queued before digests were kept only compare the rest.
+		if stored.Recipient != m.Recipient || stored.Kind != m.Kind ||
+			(stored.BodyDigest != "" && stored.BodyDigest != models.OutboxBodyDigest(m.Body, m.MediaDigest)) {
+			return nil, ErrIdempotencyConflict
+		}
+		log.Printf("📤 Message with idempotency key %q already queued as %d (%s)", m.IdempotencyKey, stored.ID, stored.Status)
+		return stored, nil
+	}
+
+	log.Printf("📤 Queued %s message %d to %s", m.Kind, m.ID, m.Recipient)
+	c.auditOutbox("message.queued", m, decision, nil)
+	c.attemptOutbox(context.Background(), m)
+	return m, nil
+}
+
+// isOutboxRetry reports whether m repeats an idempotency key already queued
+func (c *Client) isOutboxRetry(m *models.OutboxMessage) bool {
+	if m.IdempotencyKey == "" {
+		return false
+	}
+	_, err := c.db.GetOutboxMessageByKey(m.IdempotencyKey)
+	return err == nil
+}
+
+// RunOutbox sends queued messages until ctx is cancelled. Messages are
+// retried with exponential backoff, and the queue is drained as soon as the
+// connection comes back.
+func (c *Client) RunOutbox(ctx context.Context) {
+	if n, err := c.db.RequeueInterruptedOutboxMessages(); err != nil {
+		log.Printf("❌ Failed to requeue interrupted outbox messages: %v", err)
+	} else if n > 0 {
+		log.Printf("📤 Requeued %d messages interrupted while sending", n)
+	}
+
+	log.Printf("📤 Outbox worker started")
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		c.drainOutbox(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.outboxWake:
+		}
+	}
+}
+
+// wakeOutbox makes the outbox worker check the queue now
+func (c *Client) wakeOutbox() {
+	select {
+	case c.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// drainOutbox attempts every message that is due. Messages to the same
+// recipient are sent in order; different recipients are served concurrently.
+func (c *Client) drainOutbox(ctx context.Context) {
+	if !c.IsConnected() {
+		return
+	}
+	messages, err := c.db.GetDueOutboxMessages(time.Now(), outboxBatchSize)
+	if err != nil {
+		log.Printf("❌ Failed to load outbox: %v", err)
+		return
+	}
+
+	byRecipient := make(map[string][]*models.OutboxMessage)
+	for _, m := range messages {
+		byRecipient[m.Recipient] = append(byRecipient[m.Recipient], m)
+	}
+
+	var wg sync.WaitGroup
+	for _, queue := range byRecipient {
+		wg.Add(1)
+		go func(queue []*models.OutboxMessage) {
+			defer wg.Done()
+			for _, m := range queue {
+				if ctx.Err() != nil || !c.attemptOutbox(ctx, m) {
+					return
+				}
+			}
+		}(queue)
+	}
+	wg.Wait()
+}
+
+// attemptOutbox sends one message and records the outcome, updating m. It
+// reports whether the message was sent. Nothing is attempted while
+// disconnected or while an older message to the same recipient is pending.
+func (c *Client) attemptOutbox(ctx context.Context, m *models.OutboxMessage) bool {
+	if !c.IsConnected() {
+		log.Printf("⏳ Not connected, message %d to %s stays queued", m.ID, m.Recipient)
+		return false
+	}
+	claimed, err := c.db.ClaimOutboxMessage(m.ID)
+	if err != nil {
+		log.Printf("❌ Failed to claim outbox message %d: %v", m.ID, err)
+		return false
+	}
+	if !claimed {
+		return false
+	}
+
+	attempts := m.Attempts + 1
+	sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+	messageID, err := c.deliver(sendCtx, m)
+	cancel()
+
+	if err == nil {
+		if err := c.db.MarkOutboxSent(m.ID, attempts, messageID); err != nil {
+			log.Printf("❌ Failed to record outbox message %d as sent: %v", m.ID, err)
+		}
+		c.removeQueuedMedia(m)
+		now := time.Now()
+		m.Status, m.Attempts, m.MessageID, m.LastError, m.SentAt = models.OutboxSent, attempts, messageID, "", &now
+		c.auditOutbox("message.sent", m, "", nil)
+		return true
+	}
+
+	var next time.Time
+	if attempts < outboxMaxAttempts && !errors.Is(err, os.ErrNotExist) {
+		next = time.Now().Add(outboxRetryDelay(attempts))
+		log.Printf("⚠️ Outbox message %d to %s failed (attempt %d/%d), retrying at %s: %v",
+			m.ID, m.Recipient, attempts, outboxMaxAttempts, next.Format(time.RFC3339), err)
+		m.Status, m.NextAttemptAt = models.OutboxQueued, next
+	} else {
+		log.Printf("❌ Outbox message %d to %s failed after %d attempts: %v", m.ID, m.Recipient, attempts, err)
+		c.removeQueuedMedia(m)
+		m.Status = models.OutboxFailed
+		c.auditOutbox("message.failed", m, "", err)
+	}
+	m.Attempts, m.LastError = attempts, err.Error()
+	if err := c.db.MarkOutboxAttemptFailed(m.ID, attempts, err.Error(), next); err != nil {
+		log.Printf("❌ Failed to record outbox message %d attempt: %v", m.ID, err)
+	}
+	return false
+}
+
+// deliver sends a queued message over the WhatsApp connection
+func (c *Client) deliver(ctx context.Context, m *models.OutboxMessage) (string, error) {
+	recipientJID, err := types.ParseJID(m.Recipient)
+	if err != nil {
+		return "", err
+	}
+	switch m.Kind {
+	case models.OutboxText:
+		return c.sendText(ctx, recipientJID, m.Body)
+	case models.OutboxAudio:
+		return c.sendAudio(ctx, recipientJID, m.MediaPath)
+	case models.OutboxFile:
+		return c.sendFile(ctx, recipientJID, m.MediaPath, m.Body)
+	default:
+		return "", fmt.Errorf("unknown outbox message kind %q", m.Kind)
+	}
+}
+
+// removeQueuedMedia deletes the queued copy of an audio file once it is no
+// longer needed
+func (c *Client) removeQueuedMedia(m *models.OutboxMessage) {
+	if m.MediaPath == "" {
+		return
+	}
+	if err := os.Remove(m.MediaPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("⚠️ Failed to remove queued media %s: %v", m.MediaPath, err)
+	}
+}
+
+// outboxRetryDelay returns the backoff before the attempt following the given one
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := outboxBaseRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= outboxMaxRetryDelay {
+			return outboxMaxRetryDelay
+		}
+	}
+	return delay
+}
+
+// originalFileName strips the prefix added to files copied into the outbox
+func originalFileName(path string) string {
+	name := filepath.Base(path)
+	if prefix, rest, ok := strings.Cut(name, "_"); ok && isNumeric(prefix) {
+		return rest
+	}
+	return name
+}
+
+// copyFile copies src to a new file at dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,72 @@
+package whatsapp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"whatsapp-go-mcp/models"
+)
+
+func TestIdempotencyKeyIsBoundToTheText(t *testing.T) {
+	db, err := models.NewDatabase(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	c := &Client{db: db, outboxWake: make(chan struct{}, 1)}
+
+	const to = "353851234567@s.whatsapp.net"
+	queued, err := c.QueueText(to, "Your order 1042 has shipped", "order-1042-shipped")
+	if err != nil {
+		t.Fatalf("QueueText: %v", err)
+	}
+	if retry, err := c.QueueText(to, "Your order 1042 has shipped", "order-1042-shipped"); err != nil || retry.ID != queued.ID {
+		t.Fatalf("retry = %+v, %v; want message %d", retry, err, queued.ID)
+	}
+	if _, err := c.QueueText(to, "Your order 1042 was cancelled", "order-1042-shipped"); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("different text = %v, want ErrIdempotencyConflict", err)
+	}
+
+	// The body is dropped once sent; retries are still checked against it
+	if err := db.MarkOutboxSent(queued.ID, 1, "3EB0C0FFEE"); err != nil {
+		t.Fatalf("MarkOutboxSent: %v", err)
+	}
+	if retry, err := c.QueueText(to, "Your order 1042 has shipped", "order-1042-shipped"); err != nil || retry.Status != models.OutboxSent {
+		t.Errorf("retry after sending = %+v, %v; want the sent message", retry, err)
+	}
+	if _, err := c.QueueText(to, "Your order 1042 was cancelled", "order-1042-shipped"); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("different text after sending = %v, want ErrIdempotencyConflict", err)
+	}
+}
+
+func TestIdempotencyKeyIsBoundToTheFile(t *testing.T) {
+	dir := t.TempDir()
+	db, err := models.NewDatabase(filepath.Join(dir, "messages.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	c := &Client{db: db, mediaDir: filepath.Join(dir, "media"), outboxWake: make(chan struct{}, 1)}
+
+	invoice, other := filepath.Join(dir, "invoice.pdf"), filepath.Join(dir, "other.pdf")
+	if err := os.WriteFile(invoice, []byte("%PDF invoice 1042"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, []byte("%PDF invoice 1043"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	const to = "353851234567@s.whatsapp.net"
+	queued, err := c.QueueFile(to, invoice, "Your invoice", "invoice-1042")
+	if err != nil {
+		t.Fatalf("QueueFile: %v", err)
+	}
+	if retry, err := c.QueueFile(to, invoice, "Your invoice", "invoice-1042"); err != nil || retry.ID != queued.ID {
+		t.Fatalf("retry = %+v, %v; want message %d", retry, err, queued.ID)
+	}
+	if _, err := c.QueueFile(to, other, "Your invoice", "invoice-1042"); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("different file with the same caption = %v, want ErrIdempotencyConflict", err)
+	}
+}
@@ -0,0 +1,337 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdp/qrterminal/v3"
+	"go.mau.fi/whatsmeow"
+	"rsc.io/qr"
+)
+
+// Errors returned by the pairing methods
+var (
+	ErrAlreadyPaired = errors.New("device is already paired")
+	ErrNoQRCode      = errors.New("no QR code available yet, retry shortly")
+	ErrInvalidPhone  = errors.New("invalid phone number, use the international format with country code")
+)
+
+const (
+	// pairingDisplayName is shown on the phone under Linked Devices. WhatsApp
+	// only accepts "Browser (OS)" names of common browsers.
+	pairingDisplayName = "Chrome (Linux)"
+	// qrWaitTimeout bounds how long a request waits for the first QR code
+	qrWaitTimeout = 10 * time.Second
+	// qrFileName is the QR code image written to the QR code directory
+	qrFileName = "whatsapp-qr.png"
+	// qrQuietZone is the white border around the QR code, in modules
+	qrQuietZone = 4
+)
+
+// QRCode is a QR code to scan with WhatsApp > Linked Devices > Link a Device
+type QRCode struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PairingStatus describes whether the device is paired and the state of a
+// pairing in progress
+type PairingStatus struct {
+	Paired              bool            `json:"paired"`
+	JID                 string          `json:"jid,omitempty"`
+	Active              bool            `json:"active"`
+	QRExpiresAt         *time.Time      `json:"qr_expires_at,omitempty"`
+	PairingCodeIssuedAt *time.Time      `json:"pairing_code_issued_at,omitempty"`
+	LastError           string          `json:"last_error,omitempty"`
+	Connection          ConnectionState `json:"connection"`
+}
+
+// pairingSession tracks a running pairing. A session lasts as long as
+// WhatsApp keeps sending QR codes (about 160 seconds); the next request for a
+// QR code or pairing code starts a new one.
+type pairingSession struct {
+	mu           sync.Mutex
+	active       bool
+	code         string
+	expiresAt    time.Time
+	codeIssuedAt *time.Time
+	lastError    string
+	ready        chan struct{} // closed once the first QR code arrives or the session ends
+	readyClosed  bool
+	qrDir        string
+}
+
+// SetQRCodeDir sets the directory the current QR code image is written to
+// while pairing. An empty directory disables writing it.
+func (c *Client) SetQRCodeDir(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create QR code directory: %w", err)
+		}
+	}
+	c.pairing.mu.Lock()
+	c.pairing.qrDir = dir
+	c.pairing.mu.Unlock()
+	return nil
+}
+
+// StartPairing connects without a session so that WhatsApp starts sending QR
+// codes. It returns once connected; the QR codes are handled in the
+// background. Starting while a pairing is already running does nothing.
+func (c *Client) StartPairing() error {
+	if c.HasSession() {
+		return ErrAlreadyPaired
+	}
+
+	c.pairing.mu.Lock()
+	if c.pairing.active {
+		c.pairing.mu.Unlock()
+		return nil
+	}
+	c.pairing.active = true
+	c.pairing.code, c.pairing.lastError, c.pairing.codeIssuedAt = "", "", nil
+	c.pairing.ready, c.pairing.readyClosed = make(chan struct{}), false
+	c.pairing.mu.Unlock()
+	if c.restoreActive() {
+		c.endPairing(ErrRestoreInProgress.Error())
+		return ErrRestoreInProgress
+	}
+
+	log.Printf("📱 No stored session found, starting pairing...")
+	c.setConnectionState(StatePairing, "", nil)
+	qrChan, err := c.wa().GetQRChannel(context.Background())
+	if err == nil {
+		err = c.wa().Connect()
+	}
+	if err != nil {
+		log.Printf("❌ Failed to start pairing: %v", err)
+		c.endPairing(err.Error())
+		c.setConnectionState(StatePairing, err.Error(), nil)
+		return fmt.Errorf("failed to start pairing: %w", err)
+	}
+
+	go c.runPairing(qrChan)
+	return nil
+}
+
+// runPairing consumes the QR channel of a pairing session until it ends
+func (c *Client) runPairing(qrChan <-chan whatsmeow.QRChannelItem) {
+	lastError := ""
+	for evt := range qrChan {
+		switch evt.Event {
+		case whatsmeow.QRChannelEventCode:
+			c.pairing.mu.Lock()
+			c.pairing.code, c.pairing.expiresAt = evt.Code, time.Now().Add(evt.Timeout)
+			c.closePairingReady()
+			qrDir := c.pairing.qrDir
+			c.pairing.mu.Unlock()
+
+			if qrDir != "" {
+				if err := writeQRFile(qrDir, evt.Code); err != nil {
+					log.Printf("⚠️ Failed to write QR code image: %v", err)
+				}
+			}
+
+			// Display QR code
+			fmt.Println("\n📱 WhatsApp Registration")
+			fmt.Println("Scan the QR code below with WhatsApp, or open GET /api/pairing/qr:")
+			qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
+			fmt.Println("\n🔑 Or request a pairing code with POST /api/pairing/phone and enter it in")
+			fmt.Println("   WhatsApp > Settings > Linked Devices > Link a Device > Link with Phone Number Instead")
+			fmt.Println()
+		case "success":
+			fmt.Println("\n✅ Successfully logged in!")
+			log.Printf("✅ WhatsApp login successful")
+		case "timeout":
+			log.Printf("⚠️ QR codes expired; request a new one to continue pairing")
+			lastError = "QR codes expired"
+		case whatsmeow.QRChannelEventError:
+			log.Printf("❌ Pairing failed: %v", evt.Error)
+			lastError = evt.Error.Error()
+		default:
+			log.Printf("⚠️ Pairing ended: %s", evt.Event)
+			lastError = evt.Event
+		}
+	}
+
+	c.endPairing(lastError)
+	if !c.HasSession() {
+		c.setConnectionState(StatePairing, lastError, nil)
+	}
+}
+
+// endPairing marks the pairing session as finished and removes its QR code
+func (c *Client) endPairing(lastError string) {
+	c.pairing.mu.Lock()
+	defer c.pairing.mu.Unlock()
+	c.pairing.active = false
+	c.pairing.code = ""
+	c.pairing.lastError = lastError
+	c.closePairingReady()
+	if c.pairing.qrDir != "" {
+		if err := os.Remove(filepath.Join(c.pairing.qrDir, qrFileName)); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ Failed to remove QR code image: %v", err)
+		}
+	}
+}
+
+// pairingActive reports whether a pairing session is running
+func (c *Client) pairingActive() bool {
+	c.pairing.mu.Lock()
+	defer c.pairing.mu.Unlock()
+	return c.pairing.active
+}
+
+// closePairingReady wakes requests waiting for the first QR code. The caller
+// must hold c.pairing.mu.
+func (c *Client) closePairingReady() {
+	if !c.pairing.readyClosed {
+		close(c.pairing.ready)
+		c.pairing.readyClosed = true
+	}
+}
+
+// waitForPairing starts pairing if needed and waits until WhatsApp has sent
+// the first QR code
+func (c *Client) waitForPairing(ctx context.Context) error {
+	if err := c.StartPairing(); err != nil {
+		return err
+	}
+	c.pairing.mu.Lock()
+	ready := c.pairing.ready
+	c.pairing.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, qrWaitTimeout)
+	defer cancel()
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return ErrNoQRCode
+	}
+
+	c.pairing.mu.Lock()
+	defer c.pairing.mu.Unlock()
+	if c.pairing.code == "" {
+		if c.HasSession() {
+			return ErrAlreadyPaired
+		}
+		return ErrNoQRCode
+	}
+	return nil
+}
+
+// PairingQR returns the current QR code, starting a pairing if none is running
+func (c *Client) PairingQR(ctx context.Context) (*QRCode, error) {
+	if err := c.waitForPairing(ctx); err != nil {
+		return nil, err
+	}
+	c.pairing.mu.Lock()
+	defer c.pairing.mu.Unlock()
+	return &QRCode{Code: c.pairing.code, ExpiresAt: c.pairing.expiresAt}, nil
+}
+
+// PairPhone requests a pairing code for the phone number of the account to
+// link. The code is entered on that phone under Linked Devices > Link with
+// Phone Number Instead, and WhatsApp shows a notification prompting for it.
+func (c *Client) PairPhone(ctx context.Context, phone string) (string, error) {
+	if err := c.waitForPairing(ctx); err != nil {
+		return "", err
+	}
+
+	code, err := c.wa().PairPhone(ctx, phone, true, whatsmeow.PairClientChrome, pairingDisplayName)
+	if errors.Is(err, whatsmeow.ErrPhoneNumberTooShort) || errors.Is(err, whatsmeow.ErrPhoneNumberIsNotInternational) {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPhone, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to request pairing code: %w", err)
+	}
+
+	now := time.Now()
+	c.pairing.mu.Lock()
+	c.pairing.codeIssuedAt = &now
+	c.pairing.mu.Unlock()
+	log.Printf("🔑 Pairing code requested for phone number ending %s", lastDigits(phone, 4))
+	return code, nil
+}
+
+// PairingStatus reports whether the device is paired and how pairing is going
+func (c *Client) PairingStatus() *PairingStatus {
+	status := &PairingStatus{Paired: c.HasSession(), JID: c.JID(), Connection: c.ConnectionState()}
+
+	c.pairing.mu.Lock()
+	defer c.pairing.mu.Unlock()
+	status.Active = c.pairing.active
+	status.LastError = c.pairing.lastError
+	status.PairingCodeIssuedAt = c.pairing.codeIssuedAt
+	if c.pairing.code != "" {
+		expiresAt := c.pairing.expiresAt
+		status.QRExpiresAt = &expiresAt
+	}
+	return status
+}
+
+// PNG renders the QR code as a PNG image
+func (q *QRCode) PNG() ([]byte, error) {
+	code, err := qr.Encode(q.Code, qr.L)
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(), nil
+}
+
+// SVG renders the QR code as an SVG image, one unit per module
+func (q *QRCode) SVG() (string, error) {
+	code, err := qr.Encode(q.Code, qr.L)
+	if err != nil {
+		return "", err
+	}
+
+	size := code.Size + 2*qrQuietZone
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String(), nil
+}
+
+// writeQRFile writes the QR code image to dir, replacing the previous one
+func writeQRFile(dir, code string) error {
+	png, err := (&QRCode{Code: code}).PNG()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, qrFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, png, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// lastDigits returns the last n digits of a phone number for logging
+func lastDigits(phone string, n int) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) > n {
+		return digits[len(digits)-n:]
+	}
+	return digits
+}
@@ -0,0 +1,99 @@
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/policy"
+)
+
+// Errors returned when the send policy stops a message
+var (
+	ErrSendDenied       = errors.New("send blocked by policy")
+	ErrApprovalRequired = errors.New("first contact needs approval")
+)
+
+// SetSendPolicy sets the rules every outgoing message is checked against.
+// Without a policy every recipient is allowed. It must be called before
+// connecting.
+func (c *Client) SetSendPolicy(rules *policy.Rules) {
+	c.sendPolicy = rules
+}
+
+// SendPolicy returns the rules outgoing messages are checked against, or nil
+func (c *Client) SendPolicy() *policy.Rules {
+	return c.sendPolicy
+}
+
+// checkSendPolicy decides whether m may be sent and records the decision.
+// Without a policy the decision is empty.
+func (c *Client) checkSendPolicy(m *models.OutboxMessage, recipientJID types.JID) (string, error) {
+	if c.sendPolicy == nil {
+		return "", nil
+	}
+	decision, reason := c.sendPolicy.Check(recipientJID, func() (bool, error) {
+		return c.db.IsKnownContact(recipientJID.ToNonAD().String())
+	})
+	if err := c.db.RecordSendDecision(&models.SendDecision{
+		Recipient: m.Recipient,
+		Kind:      m.Kind,
+		Decision:  decision,
+		Reason:    reason,
+	}); err != nil {
+		log.Printf("❌ Failed to record send decision for %s: %v", m.Recipient, err)
+	}
+
+	switch decision {
+	case policy.Denied:
+		log.Printf("🛡️ Not sending %s message to %s: %s", m.Kind, m.Recipient, reason)
+		return decision, fmt.Errorf("%w: %s", ErrSendDenied, reason)
+	case policy.NeedsApproval:
+		log.Printf("🛡️ Holding %s message to %s: %s", m.Kind, m.Recipient, reason)
+		return decision, fmt.Errorf("%w: approve %s before messaging it", ErrApprovalRequired, m.Recipient)
+	}
+	return decision, nil
+}
+
+// ApproveContact approves a number for first contact
+func (c *Client) ApproveContact(jid, approvedBy string) (*models.ApprovedContact, error) {
+	normalized, err := normalizeContactJID(jid)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidRecipient, jid)
+	}
+	contact := &models.ApprovedContact{JID: normalized, ApprovedBy: approvedBy}
+	if err := c.db.ApproveContact(contact); err != nil {
+		return nil, err
+	}
+	log.Printf("🛡️ %s approved for first contact by %s", normalized, approvedBy)
+	return contact, nil
+}
+
+// RevokeContactApproval withdraws the first-contact approval of a number
+func (c *Client) RevokeContactApproval(jid string) error {
+	normalized, err := normalizeContactJID(jid)
+	if err != nil {
+		return fmt.Errorf("%w %q", ErrInvalidRecipient, jid)
+	}
+	return c.db.DeleteContactApproval(normalized)
+}
+
+// ApprovedContacts returns the numbers approved for first contact
+func (c *Client) ApprovedContacts() ([]*models.ApprovedContact, error) {
+	return c.db.GetApprovedContacts()
+}
+
+// SendDecisions returns the recorded send policy decisions
+func (c *Client) SendDecisions(filter models.SendDecisionFilter) ([]*models.SendDecision, error) {
+	if filter.Recipient != "" {
+		jid, err := normalizeContactJID(filter.Recipient)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", ErrInvalidRecipient, filter.Recipient)
+		}
+		filter.Recipient = jid
+	}
+	return c.db.GetSendDecisions(filter)
+}
@@ -0,0 +1,291 @@
+package whatsapp
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-go-mcp/models"
+)
+
+// ContactDataExport is everything held about a contact, written as data.json
+// in the export archive
+type ContactDataExport struct {
+	JID                    string                    `json:"jid"`
+	ExportedAt             time.Time                 `json:"exported_at"`
+	Contact                *models.Contact           `json:"contact"`
+	Chats                  []*models.Chat            `json:"chats"`
+	Messages               []*models.Message         `json:"messages"`
+	Transcripts            []*models.Transcript      `json:"transcripts"`
+	LLMConversationHistory []map[string]interface{}  `json:"llm_conversation_history"`
+	MediaFiles             []string                  `json:"media_files"`
+	WebhookDeliveries      []*models.WebhookDelivery `json:"webhook_deliveries"`
+	Events                 []*models.LoggedEvent     `json:"events"`
+	SendDecisions          []*models.SendDecision    `json:"send_decisions"`
+	ContactApproval        *models.ApprovedContact   `json:"contact_approval"`
+}
+
+// ContactErasureResult reports what was removed by EraseContactData
+type ContactErasureResult struct {
+	JID                    string                `json:"jid"`
+	Database               *models.ErasureCounts `json:"database"`
+	MediaFiles             int                   `json:"media_files"`
+	LLMConversationHistory bool                  `json:"llm_conversation_history"`
+}
+
+// ErrInvalidContactJID is returned for a contact that is neither a JID nor a
+// phone number
+var ErrInvalidContactJID = errors.New("invalid contact JID")
+
+// normalizeContactJID parses a JID or bare phone number into its canonical form
+func normalizeContactJID(jid string) (string, error) {
+	jid = strings.TrimPrefix(strings.TrimSpace(jid), "+")
+	if !strings.Contains(jid, "@") {
+		jid += "@" + types.DefaultUserServer
+	}
+	parsed, err := types.ParseJID(jid)
+	if err != nil || parsed.User == "" {
+		return "", fmt.Errorf("%w %q", ErrInvalidContactJID, jid)
+	}
+	return parsed.ToNonAD().String(), nil
+}
+
+// ExportContactData writes a zip archive with everything held about a contact:
+// messages, chats, the contact row, transcripts, LLM conversation history,
+// logged events, pending webhook deliveries, send decisions, the first-contact
+// approval and the related media files. The request is recorded in the
+// data_requests table.
+func (c *Client) ExportContactData(jid string, w io.Writer, source, requestedBy string) (err error) {
+	jid, err = normalizeContactJID(jid)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		c.recordDataRequest(jid, "export", source, requestedBy, err, "")
+	}()
+
+	export := &ContactDataExport{JID: jid, ExportedAt: time.Now().UTC()}
+
+	if export.Contact, err = c.db.GetContact(jid); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to load contact: %w", err)
+	}
+	if export.Messages, err = c.db.GetMessagesByContact(jid); err != nil {
+		return fmt.Errorf("failed to load messages: %w", err)
+	}
+	if export.Transcripts, err = c.db.GetTranscriptsByContact(jid); err != nil {
+		return fmt.Errorf("failed to load transcripts: %w", err)
+	}
+	if export.Chats, err = c.contactChats(jid); err != nil {
+		return fmt.Errorf("failed to load chats: %w", err)
+	}
+	if export.WebhookDeliveries, err = c.db.GetWebhookDeliveriesByContact(jid); err != nil {
+		return fmt.Errorf("failed to load webhook deliveries: %w", err)
+	}
+	if export.Events, err = c.db.GetEventsByContact(jid); err != nil {
+		return fmt.Errorf("failed to load logged events: %w", err)
+	}
+	if export.SendDecisions, err = c.db.GetSendDecisions(models.SendDecisionFilter{Recipient: jid}); err != nil {
+		return fmt.Errorf("failed to load send decisions: %w", err)
+	}
+	if export.ContactApproval, err = c.db.GetContactApproval(jid); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to load contact approval: %w", err)
+	}
+
+	c.historyMu.Lock()
+	export.LLMConversationHistory = append(export.LLMConversationHistory, c.conversationHistory[jid]...)
+	c.historyMu.Unlock()
+
+	mediaFiles, err := c.contactMediaFiles(export.Messages)
+	if err != nil {
+		return fmt.Errorf("failed to list media files: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, path := range mediaFiles {
+		data, err := c.readMediaFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read media file %s: %w", path, err)
+		}
+		name := "media/" + filepath.Base(path)
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+		export.MediaFiles = append(export.MediaFiles, name)
+	}
+
+	fw, err := zw.Create("data.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(fw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	log.Printf("📦 Exported data for %s: %d messages, %d transcripts, %d media files",
+		jid, len(export.Messages), len(export.Transcripts), len(export.MediaFiles))
+	return zw.Close()
+}
+
+// EraseContactData removes everything held about a contact from the message
+// database, the media directory, the outbox, scheduled messages and the
+// in-memory LLM conversation history.
+// The request is recorded in the data_requests table.
+func (c *Client) EraseContactData(jid, source, requestedBy string) (result *ContactErasureResult, err error) {
+	jid, err = normalizeContactJID(jid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		details := ""
+		if result != nil {
+			if data, marshalErr := json.Marshal(result); marshalErr == nil {
+				details = string(data)
+			}
+		}
+		c.recordDataRequest(jid, "erase", source, requestedBy, err, details)
+	}()
+
+	// Find media before the messages referencing it are deleted
+	messages, err := c.db.GetMessagesByContact(jid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	mediaFiles, err := c.contactMediaFiles(messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list media files: %w", err)
+	}
+	queuedMedia, err := c.db.GetOutboxMediaPaths(jid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queued media files: %w", err)
+	}
+	mediaFiles = append(mediaFiles, queuedMedia...)
+	scheduledMedia, err := c.db.GetScheduledMediaPaths(jid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled media files: %w", err)
+	}
+	mediaFiles = append(mediaFiles, scheduledMedia...)
+
+	result = &ContactErasureResult{JID: jid}
+	if result.Database, err = c.db.EraseContact(jid); err != nil {
+		return nil, fmt.Errorf("failed to erase database records: %w", err)
+	}
+
+	for _, path := range mediaFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return result, fmt.Errorf("failed to remove media file %s: %w", path, err)
+		}
+		result.MediaFiles++
+	}
+
+	c.historyMu.Lock()
+	if _, ok := c.conversationHistory[jid]; ok {
+		delete(c.conversationHistory, jid)
+		result.LLMConversationHistory = true
+	}
+	c.historyMu.Unlock()
+
+	log.Printf("🗑️ Erased data for %s: %d messages, %d chats, %d transcripts, %d media files",
+		jid, result.Database.Messages, result.Database.Chats, result.Database.Transcripts, result.MediaFiles)
+	return result, nil
+}
+
+// GetDataRequests lists audited export and erasure requests
+func (c *Client) GetDataRequests(jid string) ([]*models.DataRequest, error) {
+	if jid != "" {
+		normalized, err := normalizeContactJID(jid)
+		if err != nil {
+			return nil, err
+		}
+		jid = normalized
+	}
+	return c.db.GetDataRequests(jid)
+}
+
+// contactChats returns the direct chat with a contact and any chats it wrote in
+func (c *Client) contactChats(jid string) ([]*models.Chat, error) {
+	chats, err := c.db.GetChatsByContact(jid)
+	if err != nil {
+		return nil, err
+	}
+
+	if direct, err := c.db.GetChatByJID(jid); err == nil {
+		found := false
+		for _, chat := range chats {
+			if chat.JID == direct.JID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			chats = append([]*models.Chat{direct}, chats...)
+		}
+	}
+	return chats, nil
+}
+
+// contactMediaFiles finds files in the media directory that belong to the
+// given messages. Media files are named after the WhatsApp message ID.
+func (c *Client) contactMediaFiles(messages []*models.Message) ([]string, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	var files []string
+	err := filepath.Walk(c.mediaDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name := filepath.Base(path)
+		for _, msg := range messages {
+			if msg.MessageID != "" && strings.Contains(name, msg.MessageID) {
+				files = append(files, path)
+				break
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// recordDataRequest writes an audit record for an export or erasure request
+func (c *Client) recordDataRequest(jid, requestType, source, requestedBy string, err error, details string) {
+	req := &models.DataRequest{
+		JID:         jid,
+		Type:        requestType,
+		Source:      source,
+		RequestedBy: requestedBy,
+		Status:      "completed",
+		Details:     details,
+	}
+	if err != nil {
+		req.Status = "failed"
+		req.Details = err.Error()
+	}
+	if recordErr := c.db.RecordDataRequest(req); recordErr != nil {
+		log.Printf("❌ Failed to record %s request for %s: %v", requestType, jid, recordErr)
+	}
+}
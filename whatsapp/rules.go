@@ -0,0 +1,42 @@
+package whatsapp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"whatsapp-go-mcp/models"
+	"whatsapp-go-mcp/rules"
+)
+
+// Rules returns the auto-reply rules engine
+func (c *Client) Rules() *rules.Engine {
+	return c.rules
+}
+
+// SendVoiceReply converts text to speech and sends it as a voice note
+func (c *Client) SendVoiceReply(chatJID, text string) error {
+	audioPath, err := c.textToSpeech(text)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(audioPath)
+	return c.SendAudioMessage(chatJID, audioPath)
+}
+
+// ForwardMessage sends a copy of a stored message to another chat as text,
+// naming the original sender. Media is referred to by type, with its caption.
+func (c *Client) ForwardMessage(msg *models.Message, chatJID string) error {
+	content := msg.Content
+	if msg.MediaType != "" && msg.MediaType != "text" {
+		label := "[" + strings.ToUpper(msg.MediaType[:1]) + msg.MediaType[1:] + "]"
+		content = strings.TrimSpace(label + " " + content)
+	}
+	return c.SendMessage(chatJID, fmt.Sprintf("Forwarded from %s:\n%s", c.lookupName(msg.Sender), content))
+}
+
+// ReplyWithLLM answers a message in a chat with LlamaStack
+func (c *Client) ReplyWithLLM(chatJID, content string) error {
+	c.processWithLlamaStack(chatJID, content)
+	return nil
+}